@@ -11,14 +11,22 @@ import (
 type App struct {
 	DB               *gorm.DB
 	SecretMiddleware func(http.Handler) http.Handler
+	IngestMiddleware func(http.Handler) http.Handler // guards /ingest/ instead of SecretMiddleware
 }
 
 // Start starts the HTTP server
 func (app *App) Start(host, port string) error {
 	mux := app.RegisterRoutes()
+	handler := middlewares.Recovery(middlewares.LoggingMiddleware(mux))
+
+	// the ingest API is used by browser extensions, they authenticate with a token instead of the cookie
+	root := http.NewServeMux()
+	root.Handle("/ingest/", app.IngestMiddleware(handler))
+	root.Handle("/", app.SecretMiddleware(handler))
+
 	server := &http.Server{
 		Addr:    fmt.Sprintf("%s:%s", host, port),
-		Handler: app.SecretMiddleware(middlewares.Recovery(middlewares.LoggingMiddleware(mux))),
+		Handler: root,
 	}
 
 	fmt.Printf("Server starting on http://%s:%s\n", host, port)
@@ -1,11 +1,13 @@
 package api
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/linn221/RequesterBackend/handlers"
+	"github.com/linn221/RequesterBackend/models"
 	"github.com/linn221/RequesterBackend/services"
 	"github.com/linn221/RequesterBackend/utils"
 )
@@ -116,20 +118,64 @@ func (app *App) RegisterRoutes() *http.ServeMux {
 	mux.HandleFunc("GET /endpoints/{id}", endpointHandler.Get)
 	mux.HandleFunc("PUT /endpoints/{id}", endpointHandler.Update)
 	mux.HandleFunc("DELETE /endpoints/{id}", endpointHandler.Delete)
+	mux.HandleFunc("POST /programs/{id}/normalize_endpoints", endpointHandler.Normalize)
+
+	// Path patterns
+	pathPatternService := services.PathPatternService{
+		DB: app.DB,
+	}
+	pathPatternHandler := handlers.PathPatternHandler{
+		Service: &pathPatternService,
+	}
+	mux.HandleFunc("POST /path_patterns", pathPatternHandler.Create)
+	mux.HandleFunc("GET /path_patterns", pathPatternHandler.List)
+	mux.HandleFunc("DELETE /path_patterns/{id}", pathPatternHandler.Delete)
+
+	// Scope rules
+	scopeRuleService := services.ScopeRuleService{
+		DB: app.DB,
+	}
+	scopeRuleHandler := handlers.ScopeRuleHandler{
+		Service: &scopeRuleService,
+	}
+	mux.HandleFunc("POST /scope_rules", scopeRuleHandler.Create)
+	mux.HandleFunc("GET /scope_rules", scopeRuleHandler.List)
+	mux.HandleFunc("DELETE /scope_rules/{id}", scopeRuleHandler.Delete)
+	mux.HandleFunc("GET /programs/{id}/scope_check", scopeRuleHandler.Check)
 
 	// Requests
 	requestService := services.RequestService{
 		DB: app.DB,
 	}
 	requestHandler := handlers.RequestHandler{
-		Service: &requestService,
+		Service:     &requestService,
+		AllowRawSQL: utils.GetEnv("ALLOW_RAW_SQL", "") == "true",
 	}
+	mux.HandleFunc("POST /requests", requestHandler.Create)
 	mux.HandleFunc("GET /requests", requestHandler.List)
+	mux.HandleFunc("GET /requests/search", requestHandler.Search)
 	mux.HandleFunc("GET /requests/{id}", requestHandler.Get)
+	mux.HandleFunc("GET /requests/{id}/response_body", requestHandler.GetResponseBody)
+	mux.HandleFunc("POST /requests/{id}/replay", requestHandler.Replay)
+
+	// Ingest API for browser extensions, authenticated by App.IngestMiddleware
+	ingestService := services.IngestService{
+		DB: app.DB,
+	}
+	ingestHandler := handlers.IngestHandler{
+		Service: &ingestService,
+	}
+	mux.HandleFunc("POST /ingest/batch", ingestHandler.IngestBatch)
+
+	// Job runner processes uploaded import files in the background
+	jobEvents := services.NewJobEvents()
+	jobRunner := services.NewJobRunner(app.DB, jobEvents, parseIntEnv("IMPORT_WORKERS", 2), parseIntEnv("IMPORT_PROGRESS_EVERY", 50))
 
 	// Import HAR
 	importHarService := services.ImportHarService{
-		DB: app.DB,
+		DB:              app.DB,
+		Runner:          jobRunner,
+		UploadDirectory: uploadDir,
 	}
 	importHarHandler := handlers.ImportHarHandler{
 		Service: &importHarService,
@@ -138,18 +184,129 @@ func (app *App) RegisterRoutes() *http.ServeMux {
 
 	// Import Burp XML
 	importBurpService := services.ImportBurpService{
-		DB: app.DB,
+		DB:              app.DB,
+		Runner:          jobRunner,
+		UploadDirectory: uploadDir,
 	}
 	importBurpHandler := handlers.ImportBurpHandler{
 		Service: &importBurpService,
 	}
 	mux.HandleFunc("POST /import_burp_xml", importBurpHandler.ImportBurpXML)
 
+	// Import ZAP
+	importZapService := services.ImportZapService{
+		DB:              app.DB,
+		Runner:          jobRunner,
+		UploadDirectory: uploadDir,
+	}
+	importZapHandler := handlers.ImportZapHandler{
+		Service: &importZapService,
+	}
+	mux.HandleFunc("POST /import_zap", importZapHandler.ImportZAP)
+
+	// Import mitmproxy
+	importMitmproxyService := services.ImportMitmproxyService{
+		DB:              app.DB,
+		Runner:          jobRunner,
+		UploadDirectory: uploadDir,
+	}
+	importMitmproxyHandler := handlers.ImportMitmproxyHandler{
+		Service: &importMitmproxyService,
+	}
+	mux.HandleFunc("POST /import_mitmproxy", importMitmproxyHandler.ImportMitmproxy)
+
+	// Import Postman collections and curl commands as template requests
+	importPostmanService := services.ImportPostmanService{
+		DB:              app.DB,
+		Runner:          jobRunner,
+		UploadDirectory: uploadDir,
+	}
+	importPostmanHandler := handlers.ImportPostmanHandler{
+		Service: &importPostmanService,
+	}
+	mux.HandleFunc("POST /import_postman", importPostmanHandler.ImportPostman)
+
+	importCurlService := services.ImportCurlService{
+		DB:              app.DB,
+		Runner:          jobRunner,
+		UploadDirectory: uploadDir,
+	}
+	importCurlHandler := handlers.ImportCurlHandler{
+		Service: &importCurlService,
+	}
+	mux.HandleFunc("POST /import_curl", importCurlHandler.ImportCurl)
+
+	// Import OpenAPI/Swagger specs as documented endpoints
+	importOpenAPIService := services.ImportOpenAPIService{
+		DB:              app.DB,
+		Runner:          jobRunner,
+		UploadDirectory: uploadDir,
+	}
+	importOpenAPIHandler := handlers.ImportOpenAPIHandler{
+		Service: &importOpenAPIService,
+	}
+	mux.HandleFunc("POST /import_openapi", importOpenAPIHandler.ImportOpenAPI)
+
+	// Saved request searches and smart collections
+	savedSearchService := services.SavedSearchService{
+		DB:       app.DB,
+		Requests: &requestService,
+	}
+	savedSearchHandler := handlers.SavedSearchHandler{
+		Service: &savedSearchService,
+	}
+	mux.HandleFunc("POST /saved_searches", savedSearchHandler.Create)
+	mux.HandleFunc("GET /saved_searches", savedSearchHandler.List)
+	mux.HandleFunc("GET /saved_searches/{id}", savedSearchHandler.Get)
+	mux.HandleFunc("PUT /saved_searches/{id}", savedSearchHandler.Update)
+	mux.HandleFunc("DELETE /saved_searches/{id}", savedSearchHandler.Delete)
+	mux.HandleFunc("GET /saved_searches/{id}/requests", savedSearchHandler.Run)
+	mux.HandleFunc("POST /saved_searches/{id}/refresh", savedSearchHandler.Refresh)
+	mux.HandleFunc("GET /saved_searches/{id}/collection", savedSearchHandler.ListCollection)
+	mux.HandleFunc("POST /saved_searches/{id}/viewed", savedSearchHandler.MarkViewed)
+
+	// Regex and JSONPath searches over the traffic, run as jobs
+	patternSearchService := services.PatternSearchService{
+		DB:     app.DB,
+		Runner: jobRunner,
+	}
+	patternSearchHandler := handlers.PatternSearchHandler{
+		Service: &patternSearchService,
+	}
+	mux.HandleFunc("POST /pattern_searches", patternSearchHandler.Create)
+	mux.HandleFunc("GET /pattern_searches", patternSearchHandler.List)
+	mux.HandleFunc("GET /pattern_searches/{id}", patternSearchHandler.Get)
+	mux.HandleFunc("POST /pattern_searches/{id}/run", patternSearchHandler.Run)
+	mux.HandleFunc("GET /pattern_searches/{id}/matches", patternSearchHandler.ListMatches)
+	mux.HandleFunc("DELETE /pattern_searches/{id}", patternSearchHandler.Delete)
+
 	// Jobs
+	jobService := services.JobService{
+		DB:     app.DB,
+		Runner: jobRunner,
+	}
 	jobHandler := handlers.JobHandler{
-		Service: &importHarService,
+		Service: &jobService,
+		Events:  jobEvents,
 	}
 	mux.HandleFunc("GET /jobs", jobHandler.ListJobs)
+	mux.HandleFunc("GET /jobs/{id}", jobHandler.GetJob)
+	mux.HandleFunc("GET /jobs/{id}/events", jobHandler.StreamEvents)
+	mux.HandleFunc("POST /jobs/{id}/cancel", jobHandler.CancelJob)
+	mux.HandleFunc("POST /jobs/{id}/retry", jobHandler.RetryJob)
+	mux.HandleFunc("DELETE /jobs/{id}", jobHandler.DeleteJob)
+
+	jobRunner.Register(models.JobTypeImportHar, importHarService.ProcessJob)
+	jobRunner.Register(models.JobTypeImportBurpXML, importBurpService.ProcessJob)
+	jobRunner.Register(models.JobTypeImportZap, importZapService.ProcessJob)
+	jobRunner.Register(models.JobTypeImportMitmproxy, importMitmproxyService.ProcessJob)
+	jobRunner.Register(models.JobTypeImportPostman, importPostmanService.ProcessJob)
+	jobRunner.Register(models.JobTypeImportCurl, importCurlService.ProcessJob)
+	jobRunner.Register(models.JobTypeImportOpenAPI, importOpenAPIService.ProcessJob)
+	jobRunner.Register(models.JobTypePatternSearch, patternSearchService.ProcessJob)
+	if err := jobRunner.Start(context.Background()); err != nil {
+		log.Printf("Failed to start job runner: %v", err)
+	}
 
 	// Tag Handler
 	tagHandler := handlers.TagHandler{
@@ -178,6 +335,16 @@ func parseMaxFileSize(sizeStr string) int64 {
 	return size
 }
 
+// parseIntEnv reads an integer environment variable, falling back to the default when unset or invalid
+func parseIntEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(utils.GetEnv(key, strconv.Itoa(fallback)))
+	if err != nil {
+		log.Printf("Invalid %s value, using default %d", key, fallback)
+		return fallback
+	}
+	return value
+}
+
 // addSwaggerRoutes adds Swagger UI routes for development
 // To disable in production, comment out the call to this function in RegisterRoutes()
 func addSwaggerRoutes(mux *http.ServeMux) {
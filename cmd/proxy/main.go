@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/linn221/RequesterBackend/config"
+	"github.com/linn221/RequesterBackend/proxy"
+	"github.com/linn221/RequesterBackend/services"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+func main() {
+	db := config.ConnectDB()
+
+	// Get proxy configuration from environment
+	addr := utils.GetEnv("PROXY_ADDR", "localhost:8082")
+	session := utils.GetEnv("PROXY_SESSION", "default")
+	certFile := utils.GetEnv("PROXY_CA_CERT", "proxy-ca.pem")
+	keyFile := utils.GetEnv("PROXY_CA_KEY", "proxy-ca-key.pem")
+
+	var programId *int
+	if value := utils.GetEnv("PROXY_PROGRAM_ID", ""); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatalf("Invalid PROXY_PROGRAM_ID: %v", err)
+		}
+		programId = &id
+	}
+
+	ca, err := proxy.LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		log.Fatalf("Failed to load proxy CA: %v", err)
+	}
+
+	recorder := services.NewProxyRecorder(db, session, programId)
+	ctx, cancel := context.WithCancel(context.Background())
+	recorded := make(chan struct{})
+	go func() {
+		recorder.Run(ctx)
+		close(recorded)
+	}()
+
+	p := proxy.New(ca, recorder)
+	if utils.GetEnv("PROXY_INSECURE", "") == "true" {
+		// targets with self-signed certificates
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		p.Transport = transport
+	}
+	server := &http.Server{
+		Addr:    addr,
+		Handler: p,
+	}
+
+	// Start proxy in a goroutine
+	go func() {
+		fmt.Printf("Proxy listening on %s, CA certificate at %s (or http://%s/ca.pem)\n", addr, certFile, addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Proxy failed to start: %v", err)
+		}
+	}()
+
+	// Wait for interrupt signal, then save what is still queued
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	fmt.Println("Proxy shutting down...")
+	server.Close()
+	cancel()
+	<-recorded
+}
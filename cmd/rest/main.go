@@ -29,9 +29,13 @@ func main() {
 			return utils.GenerateRandomString(20)
 		},
 	}
+	ingestConfig := middlewares.TokenConfig{
+		Token: utils.GetEnv("INGEST_TOKEN", ""),
+	}
 	app := api.App{
 		DB:               db,
 		SecretMiddleware: secretConfig.Middleware(),
+		IngestMiddleware: ingestConfig.Middleware(),
 	}
 
 	// Start server in a goroutine
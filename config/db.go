@@ -19,6 +19,14 @@ import (
 
 const SearchLimit = 10
 
+// list pagination, lists without a limit return DefaultPageLimit rows, search results SearchLimit. The lists
+// that returned every row before they were paged keep doing so without a limit, their default is UnlimitedPage.
+const (
+	UnlimitedPage    = 0
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
 var _BASE_DIR string
 
 func ConnectDB() *gorm.DB {
@@ -2,24 +2,92 @@ package config
 
 import (
 	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/search"
 	"gorm.io/gorm"
 )
 
 func migrate(db *gorm.DB) {
+	// requests saved before the content type column existed get it filled in once it is added
+	backfill := db.Migrator().HasTable(&models.MyRequest{}) && !db.Migrator().HasColumn(&models.MyRequest{}, "ResContentType")
+	// and so do endpoints created before they were keyed
+	backfillKeys := db.Migrator().HasTable(&models.Endpoint{}) && !db.Migrator().HasColumn(&models.Endpoint{}, "KeyHash")
+
 	// Auto-migrate all models in dependency order
 	err := db.AutoMigrate(
-		&models.Program{},    // No dependencies
-		&models.ImportJob{},  // No dependencies
-		&models.Tag{},        // No dependencies
-		&models.Taggable{},   // Depends on Tag
-		&models.Endpoint{},   // Depends on Program
-		&models.MyRequest{},  // Depends on Program, ImportJob, Endpoint
-		&models.Vuln{},       // Self-referencing, no external dependencies
-		&models.Attachment{}, // Polymorphic - depends on all above
-		&models.Image{},      // Polymorphic - depends on all above
-		&models.Note{},       // Polymorphic - depends on all above
+		&models.Program{},        // No dependencies
+		&models.ImportJob{},      // No dependencies
+		&models.IngestBatch{},    // No dependencies
+		&models.Tag{},            // No dependencies
+		&models.Taggable{},       // Depends on Tag
+		&models.PathPattern{},    // Depends on Program
+		&models.ScopeRule{},      // Depends on Program
+		&models.Endpoint{},       // Depends on Program
+		&models.MyRequest{},      // Depends on Program, ImportJob, Endpoint
+		&models.Vuln{},           // Self-referencing, no external dependencies
+		&models.Attachment{},     // Polymorphic - depends on all above
+		&models.Image{},          // Polymorphic - depends on all above
+		&models.Note{},           // Polymorphic - depends on all above
+		&models.PatternSearch{},  // Depends on Program
+		&models.PatternMatch{},   // Depends on PatternSearch, ImportJob, MyRequest
+		&models.SavedSearch{},    // Depends on Program
+		&models.CollectionItem{}, // Depends on SavedSearch, MyRequest
 	)
 	if err != nil {
 		panic("Error migrating tables: " + err.Error())
 	}
+	if err := search.Migrate(db); err != nil {
+		panic("Error migrating the search index: " + err.Error())
+	}
+	if backfill {
+		if err := backfillContentTypes(db); err != nil {
+			panic("Error filling in content types: " + err.Error())
+		}
+	}
+	if backfillKeys {
+		if err := backfillEndpointKeys(db); err != nil {
+			panic("Error filling in endpoint keys: " + err.Error())
+		}
+	}
+}
+
+// backfillContentTypes sets the content type column of existing requests from their response headers
+func backfillContentTypes(db *gorm.DB) error {
+	var requests []*models.MyRequest
+	return db.Model(&models.MyRequest{}).Select("id", "res_headers").Where("res_headers <> ?", "").
+		FindInBatches(&requests, 500, func(tx *gorm.DB, batch int) error {
+			for _, request := range requests {
+				contentType := models.ContentTypeFromHeaders(request.ResHeaders)
+				if contentType == "" {
+					continue
+				}
+				if err := db.Model(request).UpdateColumn("res_content_type", contentType).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// backfillEndpointKeys sets the key hash of existing endpoints, duplicates of an older endpoint keep it NULL
+// until they are merged by a normalize
+func backfillEndpointKeys(db *gorm.DB) error {
+	seen := make(map[int]map[string]bool)
+	var endpoints []*models.Endpoint
+	return db.Model(&models.Endpoint{}).Select("id", "program_id", "domain", "method", "uri").
+		FindInBatches(&endpoints, 500, func(tx *gorm.DB, batch int) error {
+			for _, endpoint := range endpoints {
+				hash := models.EndpointKeyHash(endpoint.Domain, endpoint.Method, endpoint.URI)
+				if seen[endpoint.ProgramId] == nil {
+					seen[endpoint.ProgramId] = make(map[string]bool)
+				}
+				if seen[endpoint.ProgramId][hash] {
+					continue
+				}
+				seen[endpoint.ProgramId][hash] = true
+				if err := db.Model(endpoint).UpdateColumn("key_hash", hash).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
 }
@@ -0,0 +1,365 @@
+// Package curl parses curl command lines into HTTP requests
+package curl
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+// Command is a request built from a curl command line
+type Command struct {
+	Line     int // line the command starts on
+	Method   string
+	URL      string
+	Headers  []models.Header
+	Body     string
+	Warnings []string // options that were ignored
+}
+
+// optionsWithValue are options whose value is not used but has to be skipped
+var optionsWithValue = map[string]bool{
+	"-o": true, "--output": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+	"-x": true, "--proxy": true, "-U": true, "--proxy-user": true, "--cacert": true, "--capath": true,
+	"-E": true, "--cert": true, "--key": true, "-w": true, "--write-out": true, "--retry": true,
+	"--resolve": true, "--connect-to": true, "-T": true, "--upload-file": true, "--limit-rate": true,
+	"-r": true, "--range": true, "-c": true, "--cookie-jar": true, "-K": true, "--config": true,
+	"--interface": true, "--max-redirs": true, "-D": true, "--dump-header": true, "--trace": true,
+	"--trace-ascii": true, "--ciphers": true, "--tls-max": true, "--retry-delay": true, "--retry-max-time": true,
+}
+
+// shortFlags are single letter options without a value that may be combined, as in -sSL
+const shortFlags = "sSLkivfgnN#0123456qZ"
+
+// Parse parses one or more curl commands. Commands are separated by new lines, a backslash
+// (or caret, as copied from Windows) at the end of a line continues the command.
+func Parse(text string) ([]*Command, error) {
+	lines, err := splitCommands(text)
+	if err != nil {
+		return nil, err
+	}
+	var commands []*Command
+	for _, line := range lines {
+		if len(line.args) == 0 || line.args[0] != "curl" {
+			return nil, fmt.Errorf("line %d: expected a curl command", line.number)
+		}
+		cmd, err := parseArgs(line.args[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.number, err)
+		}
+		cmd.Line = line.number
+		commands = append(commands, cmd)
+	}
+	return commands, nil
+}
+
+func parseArgs(args []string) (*Command, error) {
+	cmd := &Command{}
+	var data []string
+	var form []string
+	get, head, json := false, false, false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option %s needs a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+
+		// short options with an attached value, as in -XPOST or -H'Accept: */*'
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && strings.ContainsRune("XHdbuAeF", rune(arg[1])) {
+			split := make([]string, 0, len(args)+1)
+			split = append(split, args[:i]...)
+			split = append(split, arg[:2], arg[2:])
+			args = append(split, args[i+1:]...)
+			arg = arg[:2]
+		}
+
+		switch arg {
+		case "-X", "--request":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			cmd.Method = strings.ToUpper(v)
+		case "-H", "--header":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			name, headerValue, ok := strings.Cut(v, ":")
+			if !ok {
+				cmd.Warnings = append(cmd.Warnings, fmt.Sprintf("ignored header '%s'", v))
+				continue
+			}
+			cmd.Headers = append(cmd.Headers, models.Header{Name: strings.TrimSpace(name), Value: strings.TrimSpace(headerValue)})
+		case "-d", "--data", "--data-raw", "--data-binary", "--data-ascii", "--data-urlencode", "--json":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(v, "@") && arg != "--data-raw" {
+				cmd.Warnings = append(cmd.Warnings, fmt.Sprintf("body read from file '%s' is not available", v[1:]))
+			}
+			if arg == "--data-urlencode" {
+				v = urlencodeData(v)
+			}
+			if arg == "--json" {
+				json = true
+			}
+			data = append(data, v)
+		case "-F", "--form", "--form-string":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			form = append(form, v)
+		case "-b", "--cookie":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			if !strings.Contains(v, "=") {
+				cmd.Warnings = append(cmd.Warnings, fmt.Sprintf("cookies read from file '%s' are not available", v))
+				continue
+			}
+			cmd.Headers = append(cmd.Headers, models.Header{Name: "Cookie", Value: v})
+		case "-u", "--user":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			cmd.Headers = append(cmd.Headers, models.Header{Name: "Authorization", Value: "Basic " + base64.StdEncoding.EncodeToString([]byte(v))})
+		case "-A", "--user-agent":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			cmd.Headers = append(cmd.Headers, models.Header{Name: "User-Agent", Value: v})
+		case "-e", "--referer":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			cmd.Headers = append(cmd.Headers, models.Header{Name: "Referer", Value: v})
+		case "--url":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			cmd.URL = v
+		case "--compressed":
+			cmd.Headers = append(cmd.Headers, models.Header{Name: "Accept-Encoding", Value: "deflate, gzip, br"})
+		case "-G", "--get":
+			get = true
+		case "-I", "--head":
+			head = true
+		default:
+			switch {
+			case optionsWithValue[arg]:
+				if _, err := value(); err != nil {
+					return nil, err
+				}
+			case strings.HasPrefix(arg, "--"):
+				// remaining long options (--insecure, --location, --http2, ...) don't change the request
+			case strings.HasPrefix(arg, "-") && len(arg) > 1:
+				if strings.Trim(arg[1:], shortFlags) != "" {
+					cmd.Warnings = append(cmd.Warnings, fmt.Sprintf("ignored option '%s'", arg))
+				}
+			default:
+				if cmd.URL == "" {
+					cmd.URL = arg
+				} else {
+					cmd.Warnings = append(cmd.Warnings, fmt.Sprintf("ignored extra URL '%s'", arg))
+				}
+			}
+		}
+	}
+
+	if cmd.URL == "" {
+		return nil, fmt.Errorf("no URL")
+	}
+	if !strings.Contains(cmd.URL, "://") {
+		cmd.URL = "http://" + cmd.URL // curl's default scheme
+	}
+
+	switch {
+	case len(data) > 0 && get:
+		separator := "?"
+		if strings.Contains(cmd.URL, "?") {
+			separator = "&"
+		}
+		cmd.URL += separator + strings.Join(data, "&")
+	case len(data) > 0:
+		cmd.Body = strings.Join(data, "&")
+		if json {
+			cmd.setDefaultHeader("Content-Type", "application/json")
+			cmd.setDefaultHeader("Accept", "application/json")
+		} else {
+			cmd.setDefaultHeader("Content-Type", "application/x-www-form-urlencoded")
+		}
+	case len(form) > 0:
+		cmd.Body = strings.Join(form, "\n")
+		cmd.setDefaultHeader("Content-Type", "multipart/form-data")
+	}
+
+	if cmd.Method == "" {
+		switch {
+		case head:
+			cmd.Method = "HEAD"
+		case cmd.Body != "":
+			cmd.Method = "POST"
+		default:
+			cmd.Method = "GET"
+		}
+	}
+	return cmd, nil
+}
+
+func (c *Command) setDefaultHeader(name, value string) {
+	for _, h := range c.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return
+		}
+	}
+	c.Headers = append(c.Headers, models.Header{Name: name, Value: value})
+}
+
+// urlencodeData encodes the content part of a --data-urlencode value ([name=]content)
+func urlencodeData(v string) string {
+	if name, content, ok := strings.Cut(v, "="); ok {
+		if name == "" {
+			return url.QueryEscape(content)
+		}
+		return name + "=" + url.QueryEscape(content)
+	}
+	return url.QueryEscape(v)
+}
+
+type commandLine struct {
+	number int
+	args   []string
+}
+
+// splitCommands tokenizes text the way a POSIX shell would, one command per logical line
+func splitCommands(text string) ([]commandLine, error) {
+	var commands []commandLine
+	var args []string
+	var word strings.Builder
+	inWord := false
+	line, start := 1, 1
+
+	endWord := func() {
+		if inWord {
+			args = append(args, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(args) > 0 {
+			commands = append(commands, commandLine{number: start, args: args})
+		}
+		args = nil
+	}
+
+	runes := []rune(strings.ReplaceAll(text, "\r\n", "\n"))
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\\' && i+1 < len(runes):
+			i++
+			if runes[i] == '\n' {
+				line++
+				continue
+			}
+			word.WriteRune(runes[i])
+			inWord = true
+		case c == '^' && i+1 < len(runes) && runes[i+1] == '\n':
+			i++
+			line++
+		case c == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated quote", line)
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			line += strings.Count(string(runes[i+1:end]), "\n")
+			inWord = true
+			i = end
+		case c == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						line++
+						continue
+					}
+				} else if runes[i] == '\n' {
+					line++
+				}
+				word.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated quote", line)
+			}
+			inWord = true
+		case c == '$' && i+1 < len(runes) && runes[i+1] == '\'':
+			// ANSI-C quoting as produced by browser "Copy as cURL"
+			i += 2
+			for ; i < len(runes) && runes[i] != '\''; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						word.WriteRune('\n')
+					case 'r':
+						word.WriteRune('\r')
+					case 't':
+						word.WriteRune('\t')
+					default:
+						word.WriteRune(runes[i])
+					}
+					continue
+				}
+				word.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated quote", line)
+			}
+			inWord = true
+		case c == '\n' || c == ';':
+			endCommand()
+			if c == '\n' {
+				line++
+			}
+			start = line
+		case c == ' ' || c == '\t':
+			endWord()
+		case c == '#' && !inWord:
+			// comment until the end of the line
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		default:
+			if !inWord && len(args) == 0 {
+				start = line
+			}
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands, nil
+}
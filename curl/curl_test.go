@@ -0,0 +1,206 @@
+package curl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []*Command
+	}{
+		{
+			name: "plain GET",
+			text: "curl https://example.com/users",
+			want: []*Command{{Line: 1, Method: "GET", URL: "https://example.com/users"}},
+		},
+		{
+			name: "default scheme",
+			text: "curl example.com",
+			want: []*Command{{Line: 1, Method: "GET", URL: "http://example.com"}},
+		},
+		{
+			name: "browser copy with line continuations",
+			text: "curl 'https://example.com/api' \\\n  -H 'accept: */*' \\\n  -H \"x-quoted: a \\\"b\\\" \\$x\" \\\n  --compressed",
+			want: []*Command{{
+				Line:   1,
+				Method: "GET",
+				URL:    "https://example.com/api",
+				Headers: []models.Header{
+					{Name: "accept", Value: "*/*"},
+					{Name: "x-quoted", Value: `a "b" $x`},
+					{Name: "Accept-Encoding", Value: "deflate, gzip, br"},
+				},
+			}},
+		},
+		{
+			name: "ANSI-C quoting",
+			text: `curl https://example.com --data-raw $'line1\nline2\t\'q\'\\'`,
+			want: []*Command{{
+				Line:    1,
+				Method:  "POST",
+				URL:     "https://example.com",
+				Headers: []models.Header{{Name: "Content-Type", Value: "application/x-www-form-urlencoded"}},
+				Body:    "line1\nline2\t'q'\\",
+			}},
+		},
+		{
+			name: "windows caret continuation",
+			text: "curl ^\n \"https://example.com/a\" ^\n -X DELETE",
+			want: []*Command{{Line: 1, Method: "DELETE", URL: "https://example.com/a"}},
+		},
+		{
+			name: "attached short option values",
+			text: "curl -XPUT -H'Accept: text/html' -dfoo=bar -Amybot example.com/items",
+			want: []*Command{{
+				Line:   1,
+				Method: "PUT",
+				URL:    "http://example.com/items",
+				Headers: []models.Header{
+					{Name: "Accept", Value: "text/html"},
+					{Name: "User-Agent", Value: "mybot"},
+					{Name: "Content-Type", Value: "application/x-www-form-urlencoded"},
+				},
+				Body: "foo=bar",
+			}},
+		},
+		{
+			name: "data moved to the query with -G",
+			text: "curl -G --data-urlencode 'q=a b&c' -d page=2 'https://example.com/search?x=1'",
+			want: []*Command{{Line: 1, Method: "GET", URL: "https://example.com/search?x=1&q=a+b%26c&page=2"}},
+		},
+		{
+			name: "urlencoded data without a name",
+			text: "curl https://example.com --data-urlencode '=a&b' --data-urlencode 'c d'",
+			want: []*Command{{
+				Line:    1,
+				Method:  "POST",
+				URL:     "https://example.com",
+				Headers: []models.Header{{Name: "Content-Type", Value: "application/x-www-form-urlencoded"}},
+				Body:    "a%26b&c+d",
+			}},
+		},
+		{
+			name: "basic auth, cookies and referer",
+			text: "curl -u user:pass -b 'a=1; b=2' -e https://example.com/ https://example.com/me",
+			want: []*Command{{
+				Line:   1,
+				Method: "GET",
+				URL:    "https://example.com/me",
+				Headers: []models.Header{
+					{Name: "Authorization", Value: "Basic dXNlcjpwYXNz"},
+					{Name: "Cookie", Value: "a=1; b=2"},
+					{Name: "Referer", Value: "https://example.com/"},
+				},
+			}},
+		},
+		{
+			name: "json body keeps an explicit content type",
+			text: `curl --json '{"a":1}' -H 'Content-Type: application/vnd.api+json' https://example.com`,
+			want: []*Command{{
+				Line:   1,
+				Method: "POST",
+				URL:    "https://example.com",
+				Headers: []models.Header{
+					{Name: "Content-Type", Value: "application/vnd.api+json"},
+					{Name: "Accept", Value: "application/json"},
+				},
+				Body: `{"a":1}`,
+			}},
+		},
+		{
+			name: "form fields",
+			text: "curl -F name=x -F file=@a.png https://example.com/upload",
+			want: []*Command{{
+				Line:    1,
+				Method:  "POST",
+				URL:     "https://example.com/upload",
+				Headers: []models.Header{{Name: "Content-Type", Value: "multipart/form-data"}},
+				Body:    "name=x\nfile=@a.png",
+			}},
+		},
+		{
+			name: "head and flags without effect",
+			text: "curl -sSL -k --location -I -o out.html --max-time 5 https://example.com",
+			want: []*Command{{Line: 1, Method: "HEAD", URL: "https://example.com"}},
+		},
+		{
+			name: "ignored options",
+			text: "curl -z -b cookies.txt -d @body.json -H 'bad header' https://example.com https://example.org",
+			want: []*Command{{
+				Line:    1,
+				Method:  "POST",
+				URL:     "https://example.com",
+				Headers: []models.Header{{Name: "Content-Type", Value: "application/x-www-form-urlencoded"}},
+				Body:    "@body.json",
+				Warnings: []string{
+					"ignored option '-z'",
+					"cookies read from file 'cookies.txt' are not available",
+					"body read from file 'body.json' is not available",
+					"ignored header 'bad header'",
+					"ignored extra URL 'https://example.org'",
+				},
+			}},
+		},
+		{
+			name: "several commands and comments",
+			text: "# login first\ncurl -X POST https://example.com/login\n\ncurl \\\n  https://example.com/me; curl https://example.com/logout # done\r\n",
+			want: []*Command{
+				{Line: 2, Method: "POST", URL: "https://example.com/login"},
+				{Line: 4, Method: "GET", URL: "https://example.com/me"},
+				{Line: 5, Method: "GET", URL: "https://example.com/logout"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d commands, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Errorf("command %d:\n got %+v\nwant %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"not curl", "wget https://example.com", "line 1: expected a curl command"},
+		{"not curl on a later line", "curl https://example.com\n\nhttp GET example.com", "line 3: expected a curl command"},
+		{"unterminated single quote", "curl 'https://example.com", "unterminated quote"},
+		{"unterminated double quote", "curl \"https://example.com", "unterminated quote"},
+		{"unterminated ANSI-C quote", "curl $'https://example.com", "unterminated quote"},
+		{"missing option value", "curl https://example.com -H", "option -H needs a value"},
+		{"missing skipped option value", "curl https://example.com --max-time", "option --max-time needs a value"},
+		{"no URL", "curl -s -H 'Accept: */*'", "line 1: no URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.text)
+			if err == nil {
+				t.Fatalf("got no error, want %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package filterql
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Condition is a parameterized WHERE condition
+type Condition struct {
+	SQL  string
+	Args []any
+}
+
+type kind int
+
+const (
+	kindNumber kind = iota // comparisons like >=400, ranges like 400..499 and comma separated lists
+	kindExact              // exact values, comma separated alternatives
+	kindText               // substring match, a * anywhere anchors the pattern and matches anything
+	kindHost               // exact host, * globs like *.example.com, comma separated alternatives
+	kindBool
+)
+
+type field struct {
+	columns []string // text matches when any of the columns does
+	kind    kind
+	upper   bool     // exact values are compared upper cased, lower cased otherwise
+	values  []string // the allowed exact values, empty allows any
+	classes bool     // numbers accept status classes like 4xx
+}
+
+// fields is the whitelist of filterable request columns
+var fields = map[string]field{
+	"status":   {columns: []string{"res_status"}, kind: kindNumber, classes: true},
+	"method":   {columns: []string{"method"}, kind: kindExact, upper: true},
+	"host":     {columns: []string{"domain"}, kind: kindHost},
+	"domain":   {columns: []string{"domain"}, kind: kindHost},
+	"url":      {columns: []string{"url"}, kind: kindText},
+	"body":     {columns: []string{"req_body", "res_body"}, kind: kindText},
+	"req.body": {columns: []string{"req_body"}, kind: kindText},
+	"res.body": {columns: []string{"res_body"}, kind: kindText},
+	"latency":  {columns: []string{"latency_ms"}, kind: kindNumber},
+	"size":     {columns: []string{"resp_size"}, kind: kindNumber},
+	"mime":     {columns: []string{"res_mime_type"}, kind: kindText},
+	"type":     {columns: []string{"resource_type"}, kind: kindExact},
+	"scope":    {columns: []string{"scope"}, kind: kindExact, values: []string{"in", "out", "unknown"}},
+	"ip":       {columns: []string{"server_ip_address"}, kind: kindExact},
+	"comment":  {columns: []string{"comment"}, kind: kindText},
+	"program":  {columns: []string{"program_id"}, kind: kindNumber},
+	"endpoint": {columns: []string{"endpoint_id"}, kind: kindNumber},
+	"job":      {columns: []string{"import_job_id"}, kind: kindNumber},
+	"template": {columns: []string{"is_template"}, kind: kindBool},
+	"binary":   {columns: []string{"res_body_binary"}, kind: kindBool},
+}
+
+// header terms, like res.header.content-type:json
+const (
+	reqHeaderPrefix = "req.header."
+	resHeaderPrefix = "res.header."
+)
+
+var (
+	headerNameRegex  = regexp.MustCompile(`^[a-z0-9!#$%&'*+.^_|~-]+$`)
+	statusClassRegex = regexp.MustCompile(`^[1-5]xx$`)
+)
+
+// Fields lists the field names a filter can use, header fields excluded
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply adds the conditions of the query to a GORM query on requests
+func (q *Query) Apply(db *gorm.DB) (*gorm.DB, error) {
+	conditions, err := q.Conditions(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	for _, condition := range conditions {
+		db = db.Where(condition.SQL, condition.Args...)
+	}
+	return db, nil
+}
+
+// Conditions compiles the terms of the query for a GORM dialect name, header terms need mysql or sqlite
+func (q *Query) Conditions(dialect string) ([]Condition, error) {
+	conditions := make([]Condition, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		condition, err := compileTerm(term, dialect)
+		if err != nil {
+			return nil, err
+		}
+		if term.Negate {
+			condition.SQL = "NOT (" + condition.SQL + ")"
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+func compileTerm(term Term, dialect string) (Condition, error) {
+	switch {
+	case term.Field == "":
+		return textCondition([]string{"url"}, term.Value, !term.Quoted), nil
+	case strings.HasPrefix(term.Field, reqHeaderPrefix):
+		return headerCondition("req_headers", strings.TrimPrefix(term.Field, reqHeaderPrefix), term, dialect)
+	case strings.HasPrefix(term.Field, resHeaderPrefix):
+		return headerCondition("res_headers", strings.TrimPrefix(term.Field, resHeaderPrefix), term, dialect)
+	}
+
+	f, ok := fields[term.Field]
+	if !ok {
+		return Condition{}, fmt.Errorf("unknown field '%s', expected one of %s, req.header.<name> or res.header.<name>", term.Field, strings.Join(Fields(), ", "))
+	}
+	if f.kind == kindText {
+		return textCondition(f.columns, term.Value, !term.Quoted), nil
+	}
+
+	values := []string{term.Value}
+	if !term.Quoted {
+		values = strings.Split(term.Value, ",")
+	}
+	alternatives := make([]Condition, 0, len(values))
+	for _, value := range values {
+		if value == "" {
+			return Condition{}, fmt.Errorf("empty value in '%s:%s'", term.Field, term.Value)
+		}
+		condition, err := f.compile(term.Field, value, term.Quoted)
+		if err != nil {
+			return Condition{}, err
+		}
+		alternatives = append(alternatives, condition)
+	}
+	return or(alternatives), nil
+}
+
+func (f field) compile(name, value string, quoted bool) (Condition, error) {
+	column := f.columns[0]
+	switch f.kind {
+	case kindNumber:
+		return numberCondition(column, name, value, f.classes)
+	case kindBool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return Condition{}, fmt.Errorf("invalid %s '%s', expected true or false", name, value)
+		}
+		return Condition{SQL: column + " = ?", Args: []any{v}}, nil
+	case kindHost:
+		value = strings.ToLower(value)
+		if !quoted && strings.Contains(value, "*") {
+			return Condition{SQL: column + " LIKE ? ESCAPE '!'", Args: []any{likePattern(value, true)}}, nil
+		}
+		return Condition{SQL: column + " = ?", Args: []any{value}}, nil
+	default:
+		if f.upper {
+			value = strings.ToUpper(value)
+		} else {
+			value = strings.ToLower(value)
+		}
+		if len(f.values) > 0 && !contains(f.values, value) {
+			return Condition{}, fmt.Errorf("invalid %s '%s', expected %s", name, value, strings.Join(f.values, ", "))
+		}
+		return Condition{SQL: column + " = ?", Args: []any{value}}, nil
+	}
+}
+
+// numberCondition compiles =N, >N, >=N, <N, <=N, N..M and, when classes is set, status classes like 4xx
+func numberCondition(column, name, value string, classes bool) (Condition, error) {
+	if classes && statusClassRegex.MatchString(strings.ToLower(value)) {
+		low := int64(value[0]-'0') * 100
+		return Condition{SQL: column + " BETWEEN ? AND ?", Args: []any{low, low + 99}}, nil
+	}
+	if low, high, ok := strings.Cut(value, ".."); ok {
+		from, err := strconv.ParseInt(low, 10, 64)
+		if err != nil {
+			return Condition{}, fmt.Errorf("invalid %s range '%s'", name, value)
+		}
+		to, err := strconv.ParseInt(high, 10, 64)
+		if err != nil {
+			return Condition{}, fmt.Errorf("invalid %s range '%s'", name, value)
+		}
+		return Condition{SQL: column + " BETWEEN ? AND ?", Args: []any{from, to}}, nil
+	}
+
+	operator := "="
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, op) {
+			operator, value = op, value[len(op):]
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return Condition{}, fmt.Errorf("invalid %s '%s', expected a number", name, value)
+	}
+	return Condition{SQL: column + " " + operator + " ?", Args: []any{n}}, nil
+}
+
+// textCondition matches a substring of any of the columns, or a * glob of the whole value
+func textCondition(columns []string, value string, glob bool) Condition {
+	pattern := likePattern(value, glob)
+	parts := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, column := range columns {
+		parts[i] = column + " LIKE ? ESCAPE '!'"
+		args[i] = pattern
+	}
+	if len(parts) == 1 {
+		return Condition{SQL: parts[0], Args: args}
+	}
+	return Condition{SQL: "(" + strings.Join(parts, " OR ") + ")", Args: args}
+}
+
+// headerCondition matches requests having a header of the name whose value contains the term's value.
+// The headers are stored as a JSON array of name and value objects, each header is matched on its own.
+func headerCondition(column, name string, term Term, dialect string) (Condition, error) {
+	name = strings.ToLower(name)
+	if !headerNameRegex.MatchString(name) {
+		return Condition{}, fmt.Errorf("invalid header name in '%s'", term.Field)
+	}
+	pattern := likePattern(strings.ToLower(term.Value), !term.Quoted)
+
+	var sql string
+	switch dialect {
+	case "sqlite":
+		sql = "EXISTS (SELECT 1 FROM json_each(CASE WHEN json_valid(" + column + ") THEN " + column + " ELSE '[]' END) " +
+			"WHERE LOWER(json_extract(value, '$.name')) = ? AND LOWER(json_extract(value, '$.value')) LIKE ? ESCAPE '!')"
+	case "mysql":
+		sql = "EXISTS (SELECT 1 FROM JSON_TABLE(IF(JSON_VALID(" + column + "), " + column + ", '[]'), '$[*]' " +
+			"COLUMNS (name VARCHAR(255) PATH '$.name', value TEXT PATH '$.value')) AS h " +
+			"WHERE LOWER(h.name) = ? AND LOWER(h.value) LIKE ? ESCAPE '!')"
+	default:
+		return Condition{}, fmt.Errorf("header filters are not supported on %s", dialect)
+	}
+	return Condition{SQL: sql, Args: []any{name, pattern}}, nil
+}
+
+// likePattern escapes LIKE wildcards with !. With glob, a value containing * must match as a whole
+// with * standing for anything, other values match as substrings.
+func likePattern(value string, glob bool) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '!', '%', '_':
+			b.WriteRune('!')
+			b.WriteRune(r)
+		case '*':
+			if glob {
+				b.WriteRune('%')
+			} else {
+				b.WriteRune(r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if glob && strings.Contains(value, "*") {
+		return b.String()
+	}
+	return "%" + b.String() + "%"
+}
+
+// or joins alternatives, a single one is returned as it is
+func or(alternatives []Condition) Condition {
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	parts := make([]string, len(alternatives))
+	var args []any
+	for i, alternative := range alternatives {
+		parts[i] = "(" + alternative.SQL + ")"
+		args = append(args, alternative.Args...)
+	}
+	return Condition{SQL: "(" + strings.Join(parts, " OR ") + ")", Args: args}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package filterql
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Term
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"status:404", []Term{{Field: "status", Value: "404"}}},
+		{"Method:post", []Term{{Field: "method", Value: "post"}}},
+		{"login", []Term{{Value: "login"}}},
+		{"-login", []Term{{Value: "login", Negate: true}}},
+		{"-", []Term{{Value: "-"}}},
+		{"status:>=400  -method:OPTIONS\tapi", []Term{
+			{Field: "status", Value: ">=400"},
+			{Field: "method", Value: "OPTIONS", Negate: true},
+			{Value: "api"},
+		}},
+		{`body:"a b"`, []Term{{Field: "body", Value: "a b", Quoted: true}}},
+		{`"x y"`, []Term{{Value: "x y", Quoted: true}}},
+		{`-"x y"`, []Term{{Value: "x y", Quoted: true, Negate: true}}},
+		{`body:"say \"hi\" \\ there"`, []Term{{Field: "body", Value: `say "hi" \ there`, Quoted: true}}},
+		{`url:http://a/b:c`, []Term{{Field: "url", Value: "http://a/b:c"}}},
+		{`res.header.content-type:json`, []Term{{Field: "res.header.content-type", Value: "json"}}},
+		{`body:héllo`, []Term{{Field: "body", Value: "héllo"}}},
+	}
+	for _, tt := range tests {
+		query, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if fmt.Sprint(query.Terms) != fmt.Sprint(tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.input, query.Terms, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`:404`, "missing field name at position 1"},
+		{`status:`, "missing value for 'status' at position 8"},
+		{`status: 404`, "missing value for 'status'"},
+		{`body:"open`, "unterminated quote at position 6"},
+		{`"open`, "unterminated quote at position 1"},
+		{`body:"trailing\`, "unterminated quote"},
+		{`body:"a"b`, "expected a space after the quote at position 8"},
+		{`a"b`, "unterminated quote at position 2"}, // a quote starts a new term
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q): got error %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestConditions(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{"status:404", "res_status = ?", []any{int64(404)}},
+		{"status:>=400", "res_status >= ?", []any{int64(400)}},
+		{"status:<500", "res_status < ?", []any{int64(500)}},
+		{"status:4xx", "res_status BETWEEN ? AND ?", []any{int64(400), int64(499)}},
+		{"status:200..299", "res_status BETWEEN ? AND ?", []any{int64(200), int64(299)}},
+		{"status:200,304", "((res_status = ?) OR (res_status = ?))", []any{int64(200), int64(304)}},
+		{"latency:>1000", "latency_ms > ?", []any{int64(1000)}},
+		{"method:post", "method = ?", []any{"POST"}},
+		{"scope:IN", "scope = ?", []any{"in"}},
+		{"host:*.Example.com", "domain LIKE ? ESCAPE '!'", []any{"%.example.com"}},
+		{"host:example.com", "domain = ?", []any{"example.com"}},
+		{`host:"*.example.com"`, "domain = ?", []any{"*.example.com"}},
+		{"url:/api/", "url LIKE ? ESCAPE '!'", []any{"%/api/%"}},
+		{"url:*/v1/*", "url LIKE ? ESCAPE '!'", []any{"%/v1/%"}},
+		{`url:"*"`, "url LIKE ? ESCAPE '!'", []any{"%*%"}},
+		{"url:100%_done!", "url LIKE ? ESCAPE '!'", []any{"%100!%!_done!!%"}},
+		{"login", "url LIKE ? ESCAPE '!'", []any{"%login%"}},
+		{"body:token", "(req_body LIKE ? ESCAPE '!' OR res_body LIKE ? ESCAPE '!')", []any{"%token%", "%token%"}},
+		{"-method:OPTIONS", "NOT (method = ?)", []any{"OPTIONS"}},
+		{"template:true", "is_template = ?", []any{true}},
+		{`req.header.Authorization:bearer`, "EXISTS", []any{"authorization", "%bearer%"}},
+	}
+	for _, tt := range tests {
+		query, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.input, err)
+		}
+		conditions, err := query.Conditions("sqlite")
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if len(conditions) != 1 {
+			t.Fatalf("%q: got %d conditions", tt.input, len(conditions))
+		}
+		got := conditions[0]
+		if got.SQL != tt.wantSQL && !(tt.wantSQL == "EXISTS" && strings.HasPrefix(got.SQL, "EXISTS (")) {
+			t.Errorf("%q: got SQL %q, want %q", tt.input, got.SQL, tt.wantSQL)
+		}
+		if fmt.Sprintf("%#v", got.Args) != fmt.Sprintf("%#v", tt.wantArgs) {
+			t.Errorf("%q: got args %#v, want %#v", tt.input, got.Args, tt.wantArgs)
+		}
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		dialect string
+		want    string
+	}{
+		{"nope:1", "sqlite", "unknown field 'nope'"},
+		{"status:abc", "sqlite", "invalid status 'abc', expected a number"},
+		{"status:6xx", "sqlite", "invalid status '6xx'"},
+		{"latency:4xx", "sqlite", "invalid latency '4xx'"},
+		{"status:1..x", "sqlite", "invalid status range '1..x'"},
+		{"status:200,", "sqlite", "empty value in 'status:200,'"},
+		{"scope:maybe", "sqlite", "invalid scope 'maybe', expected in, out, unknown"},
+		{"template:yes", "sqlite", "invalid template 'yes', expected true or false"},
+		{"req.header.x y:1", "sqlite", "unknown field 'y'"},
+		{`req.header.a"b:1`, "sqlite", "unterminated quote at position 13"},
+		{"req.header.a(b:1", "sqlite", "invalid header name in 'req.header.a(b'"},
+		{"res.header.x:1", "postgres", "header filters are not supported on postgres"},
+	}
+	for _, tt := range tests {
+		query, err := Parse(tt.input)
+		if err == nil {
+			_, err = query.Conditions(tt.dialect)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got error %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+// injection attempts either fail to compile or end up as parameters, never in the SQL
+var injections = []string{
+	`url:"' OR '1'='1"`,
+	`"'; DROP TABLE my_requests; --"`,
+	`body:"\") OR 1=1 --"`,
+	`comment:x'--`,
+	`method:"GET' OR 'a'='a"`,
+	`ip:"1.1.1.1' UNION SELECT password FROM users --"`,
+	`host:"evil.com' OR domain LIKE '%"`,
+	`res.header.content-type:"json') OR ('1'='1"`,
+	`type:xhr'/**/OR/**/1=1`,
+	`status:1;DELETE`,
+	`status:"1 OR 1=1"`,
+	`"res_status) OR (1":1`,
+	`req.header.x')--:a`,
+	`program:1,2)--`,
+}
+
+func TestInjectionIsParameterized(t *testing.T) {
+	for _, input := range injections {
+		query, err := Parse(input)
+		if err != nil {
+			continue
+		}
+		conditions, err := query.Conditions("sqlite")
+		if err != nil {
+			continue
+		}
+		for _, condition := range conditions {
+			for _, term := range query.Terms {
+				for _, marker := range []string{"'1'='1", "DROP", "1=1", "UNION", "domain LIKE '%", "--"} {
+					if strings.Contains(term.Value, marker) && strings.Contains(condition.SQL, marker) {
+						t.Errorf("%q: %q ended up in the SQL %q", input, marker, condition.SQL)
+					}
+				}
+			}
+			if strings.Count(condition.SQL, "?") != len(condition.Args) {
+				t.Errorf("%q: %d placeholders for %d args in %q", input, strings.Count(condition.SQL, "?"), len(condition.Args), condition.SQL)
+			}
+		}
+	}
+}
+
+func TestApplyInjection(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.MyRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	headers, _ := models.HeaderSlice{{Name: "Content-Type", Value: "application/json"}}.ToJSON()
+	for _, url := range []string{"https://example.com/a", "https://example.com/b"} {
+		req := &models.MyRequest{URL: url, Method: "GET", Domain: "example.com", ResStatus: 200, ResHeaders: headers}
+		if err := db.Create(req).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, input := range injections {
+		query, err := Parse(input)
+		if err != nil {
+			continue
+		}
+		filtered, err := query.Apply(db.Model(&models.MyRequest{}))
+		if err != nil {
+			continue
+		}
+		var count int64
+		if err := filtered.Count(&count).Error; err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if count != 0 {
+			t.Errorf("%q matched %d requests, want none", input, count)
+		}
+	}
+
+	var count int64
+	if err := db.Model(&models.MyRequest{}).Count(&count).Error; err != nil || count != 2 {
+		t.Errorf("got %d requests and error %v after the injections, want 2", count, err)
+	}
+	// the header filter works on the stored JSON
+	query, _ := Parse(`res.header.content-type:json -url:/b`)
+	filtered, err := query.Apply(db.Model(&models.MyRequest{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := filtered.Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("got %d requests and error %v, want 1", count, err)
+	}
+}
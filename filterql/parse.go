@@ -0,0 +1,142 @@
+package filterql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Term is one condition of a filter, like status:>=400, -method:OPTIONS or a bare word
+type Term struct {
+	Field  string // lower cased field name, empty for a bare word matched against the URL
+	Value  string
+	Negate bool // the term was prefixed with -
+	Quoted bool // the value was quoted, it is matched literally
+}
+
+// Query is a parsed filter, its terms must all match
+type Query struct {
+	Terms []Term
+}
+
+// Parse reads a filter made of space separated field:value terms. Values with spaces are quoted,
+// "a \"b\"" escapes quotes, and a leading - negates a term.
+func Parse(input string) (*Query, error) {
+	p := &parser{input: []rune(input)}
+	query := &Query{}
+	for {
+		p.skipSpaces()
+		if p.done() {
+			return query, nil
+		}
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		query.Terms = append(query.Terms, term)
+	}
+}
+
+type parser struct {
+	input []rune
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) peek() rune {
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpaces() {
+	for !p.done() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *parser) term() (Term, error) {
+	var term Term
+	start := p.pos
+	if p.peek() == '-' && p.pos+1 < len(p.input) && !unicode.IsSpace(p.input[p.pos+1]) {
+		term.Negate = true
+		p.pos++
+	}
+	if !p.done() && p.peek() == '"' {
+		value, err := p.quoted()
+		if err != nil {
+			return term, err
+		}
+		term.Value, term.Quoted = value, true
+		return term, nil
+	}
+
+	word := p.word(true)
+	if p.done() || p.peek() != ':' {
+		if word == "" {
+			return term, fmt.Errorf("unexpected '%c' at position %d", p.peek(), p.pos+1)
+		}
+		term.Value = word
+		return term, nil
+	}
+	if word == "" {
+		return term, fmt.Errorf("missing field name at position %d", start+1)
+	}
+	term.Field = strings.ToLower(word)
+	p.pos++ // the colon
+
+	if !p.done() && p.peek() == '"' {
+		value, err := p.quoted()
+		if err != nil {
+			return term, err
+		}
+		term.Value, term.Quoted = value, true
+		return term, nil
+	}
+	term.Value = p.word(false)
+	if term.Value == "" {
+		return term, fmt.Errorf("missing value for '%s' at position %d", term.Field, p.pos+1)
+	}
+	return term, nil
+}
+
+// word reads up to the next space, and up to the next colon when reading a field name
+func (p *parser) word(field bool) string {
+	start := p.pos
+	for !p.done() {
+		r := p.peek()
+		if unicode.IsSpace(r) || (field && (r == ':' || r == '"')) {
+			break
+		}
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+// quoted reads a double quoted value, backslash escapes the next character
+func (p *parser) quoted() (string, error) {
+	start := p.pos
+	p.pos++ // the opening quote
+	var b strings.Builder
+	for !p.done() {
+		r := p.peek()
+		p.pos++
+		switch r {
+		case '\\':
+			if p.done() {
+				return "", fmt.Errorf("unterminated quote at position %d", start+1)
+			}
+			b.WriteRune(p.peek())
+			p.pos++
+		case '"':
+			if !p.done() && !unicode.IsSpace(p.peek()) {
+				return "", fmt.Errorf("expected a space after the quote at position %d", p.pos)
+			}
+			return b.String(), nil
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return "", fmt.Errorf("unterminated quote at position %d", start+1)
+}
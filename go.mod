@@ -5,8 +5,10 @@ go 1.24.0
 toolchain go1.24.7
 
 require (
+	github.com/andybalholm/brotli v1.2.6
 	github.com/joho/godotenv v1.5.1
 	golang.org/x/crypto v0.42.0
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/mysql v1.6.0
 	gorm.io/driver/sqlite v1.6.0
 	gorm.io/gorm v1.31.0
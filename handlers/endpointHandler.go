@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
+	"github.com/linn221/RequesterBackend/config"
+	"github.com/linn221/RequesterBackend/scope"
 	"github.com/linn221/RequesterBackend/services"
 	"github.com/linn221/RequesterBackend/utils"
 )
@@ -122,7 +125,50 @@ func (h *EndpointHandler) Delete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *EndpointHandler) List(w http.ResponseWriter, r *http.Request) {
-	endpoints, err := h.Service.List(r.Context())
+	var programId *int
+	if programIdStr := r.URL.Query().Get("program_id"); programIdStr != "" {
+		id, err := strconv.Atoi(programIdStr)
+		if err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid program_id"))
+			return
+		}
+		programId = &id
+	}
+
+	scopeStatus := r.URL.Query().Get("scope")
+	if scopeStatus != "" && !scope.Status(scopeStatus).Valid() {
+		utils.RespondError(w, utils.BadRequest("invalid scope, expected in, out or unknown"))
+		return
+	}
+
+	var documented *bool
+	if documentedStr := r.URL.Query().Get("documented"); documentedStr != "" {
+		v, err := strconv.ParseBool(documentedStr)
+		if err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid documented"))
+			return
+		}
+		documented = &v
+	}
+
+	// exercised=false lists the documented endpoints never seen in captured traffic
+	var exercised *bool
+	if exercisedStr := r.URL.Query().Get("exercised"); exercisedStr != "" {
+		v, err := strconv.ParseBool(exercisedStr)
+		if err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid exercised"))
+			return
+		}
+		exercised = &v
+	}
+
+	page, fields, err := parseListParams[EndpointList](r, config.UnlimitedPage)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	endpoints, err := h.Service.List(r.Context(), programId, scopeStatus, documented, exercised, page, fields)
 	if err != nil {
 		utils.RespondError(w, err)
 		return
@@ -132,7 +178,7 @@ func (h *EndpointHandler) List(w http.ResponseWriter, r *http.Request) {
 		response[i] = ToEndpointList(e)
 	}
 
-	utils.OkJson(w, response)
+	writeList(w, page, response, fields)
 }
 
 func (h *EndpointHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -149,3 +195,24 @@ func (h *EndpointHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	utils.OkJson(w, ToEndpointDetail(endpoint))
 }
+
+// Normalize re-templates the endpoint URIs of a program and merges the endpoints that collapse into one
+func (h *EndpointHandler) Normalize(w http.ResponseWriter, r *http.Request) {
+	programId, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	result, err := h.Service.Normalize(r.Context(), programId)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkJson(w, &EndpointNormalizeResult{
+		EndpointsUpdated: result.EndpointsUpdated,
+		EndpointsMerged:  result.EndpointsMerged,
+		RequestsMoved:    result.RequestsMoved,
+	})
+}
@@ -6,8 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator"
+	"github.com/linn221/RequesterBackend/config"
+	"github.com/linn221/RequesterBackend/services"
 	"github.com/linn221/RequesterBackend/utils"
 )
 
@@ -62,3 +68,102 @@ func parseJson[T any](r *http.Request) (*T, error) {
 	}
 	return &v, nil
 }
+
+// parseOptionalId reads an optional id query parameter, nil when it is missing
+func parseOptionalId(r *http.Request, name string) (*int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, utils.BadRequest("invalid " + name)
+	}
+	return &id, nil
+}
+
+// parseListParams reads the limit, offset, cursor, sort and fields query parameters of a list.
+// Lists without limit return defaultLimit rows, or every row with config.UnlimitedPage. Fields are checked
+// against the JSON names of T and the sort keys by the service of the list.
+func parseListParams[T any](r *http.Request, defaultLimit int) (*services.Page, services.Fields, error) {
+	query := r.URL.Query()
+	page := &services.Page{Limit: defaultLimit, Cursor: query.Get("cursor"), Sort: query.Get("sort")}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > config.MaxPageLimit {
+			return nil, nil, utils.BadRequest(fmt.Sprintf("limit must be between 1 and %d", config.MaxPageLimit))
+		}
+		page.Limit = limit
+	}
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return nil, nil, utils.BadRequest("invalid offset")
+		}
+		if page.Cursor != "" && offset > 0 {
+			return nil, nil, utils.BadRequest("use either offset or cursor")
+		}
+		page.Offset = offset
+	}
+
+	fieldsStr := query.Get("fields")
+	if fieldsStr == "" {
+		return page, nil, nil
+	}
+	names := jsonNames(reflect.TypeFor[T]())
+	fields := services.Fields{"id": true} // kept for cursors and links
+	for _, name := range strings.Split(fieldsStr, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := names[name]; !ok {
+			known := make([]string, 0, len(names))
+			for knownName := range names {
+				known = append(known, knownName)
+			}
+			sort.Strings(known)
+			return nil, nil, utils.BadRequest(fmt.Sprintf("unknown field '%s', expected %s", name, strings.Join(known, ", ")))
+		}
+		fields[name] = true
+	}
+	return page, fields, nil
+}
+
+// writeList writes a page of a list as a JSON array with the X-Total-Count and X-Next-Cursor headers,
+// keeping only the wanted fields of each item
+func writeList[T any](w http.ResponseWriter, page *services.Page, items []*T, fields services.Fields) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	if fields == nil {
+		utils.OkJson(w, items)
+		return
+	}
+
+	projected := make([]map[string]any, len(items))
+	for i, item := range items {
+		v := reflect.ValueOf(item).Elem()
+		m := make(map[string]any, len(fields))
+		for name, index := range jsonNames(v.Type()) {
+			if fields[name] {
+				m[name] = v.Field(index).Interface()
+			}
+		}
+		projected[i] = m
+	}
+	utils.OkJson(w, projected)
+}
+
+// jsonNames maps the JSON names of a struct's fields to their index
+func jsonNames(t reflect.Type) map[string]int {
+	names := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = i
+		}
+	}
+	return names
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/config"
+	"github.com/linn221/RequesterBackend/services"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+func TestParseListParams(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		defaultLimit int
+		wantPage     services.Page
+		wantFields   services.Fields
+		wantErr      bool
+	}{
+		{name: "unlimited list", query: "", defaultLimit: config.UnlimitedPage, wantPage: services.Page{}},
+		{name: "default limit", query: "", defaultLimit: config.DefaultPageLimit, wantPage: services.Page{Limit: config.DefaultPageLimit}},
+		{name: "limit and offset", query: "limit=20&offset=40", defaultLimit: config.UnlimitedPage, wantPage: services.Page{Limit: 20, Offset: 40}},
+		{name: "cursor and sort", query: "limit=5&cursor=abc&sort=-name", defaultLimit: config.DefaultPageLimit, wantPage: services.Page{Limit: 5, Cursor: "abc", Sort: "-name"}},
+		{name: "cursor with zero offset", query: "cursor=abc&offset=0", defaultLimit: config.DefaultPageLimit, wantPage: services.Page{Limit: config.DefaultPageLimit, Cursor: "abc"}},
+		{name: "fields", query: "fields=name,%20tags,", defaultLimit: config.DefaultPageLimit, wantPage: services.Page{Limit: config.DefaultPageLimit},
+			wantFields: services.Fields{"id": true, "name": true, "tags": true}},
+
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit too large", query: "limit=1001", wantErr: true},
+		{name: "limit not a number", query: "limit=ten", wantErr: true},
+		{name: "negative offset", query: "offset=-1", wantErr: true},
+		{name: "offset and cursor", query: "offset=10&cursor=abc", wantErr: true},
+		{name: "unknown field", query: "fields=name,secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/programs?"+tt.query, nil)
+			page, fields, err := parseListParams[ProgramList](r, tt.defaultLimit)
+			if tt.wantErr {
+				if !errors.Is(err, utils.ErrBadRequest) {
+					t.Errorf("got error %v, want a bad request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*page, tt.wantPage) {
+				t.Errorf("got page %+v, want %+v", *page, tt.wantPage)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("got fields %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestWriteList(t *testing.T) {
+	items := []*ProgramList{
+		{Id: 1, Name: "one", URL: "https://one.test", Tags: []TagDTO{}},
+		{Id: 2, Name: "two", URL: "https://two.test", Tags: []TagDTO{}},
+	}
+	tests := []struct {
+		name       string
+		fields     services.Fields
+		nextCursor string
+		want       string
+	}{
+		{
+			name: "every field",
+			want: `[{"id":1,"name":"one","url":"https://one.test","tags":[]},{"id":2,"name":"two","url":"https://two.test","tags":[]}]`,
+		},
+		{
+			name:       "projected",
+			fields:     services.Fields{"id": true, "name": true},
+			nextCursor: "Mg",
+			want:       `[{"id":1,"name":"one"},{"id":2,"name":"two"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeList(w, &services.Page{Total: 42, NextCursor: tt.nextCursor}, items, tt.fields)
+
+			var got, want any
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got body %s, want %s", w.Body.String(), tt.want)
+			}
+			if total := w.Header().Get("X-Total-Count"); total != "42" {
+				t.Errorf("got X-Total-Count %q, want 42", total)
+			}
+			if cursor, ok := w.Header()["X-Next-Cursor"]; tt.nextCursor == "" && ok || tt.nextCursor != "" && cursor[0] != tt.nextCursor {
+				t.Errorf("got X-Next-Cursor %v, want %q", cursor, tt.nextCursor)
+			}
+		})
+	}
+}
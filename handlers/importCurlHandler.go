@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/services"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+type ImportCurlHandler struct {
+	Service *services.ImportCurlService
+}
+
+// ImportCurl accepts the curl commands either as an uploaded file or pasted in the commands field
+func (h *ImportCurlHandler) ImportCurl(w http.ResponseWriter, r *http.Request) {
+	form, err := parseImportForm(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	var file io.Reader
+	filename := "commands.txt"
+	if form.file != nil {
+		defer form.file.Close()
+		file = form.file
+		filename = form.filename
+	} else if commands := r.FormValue("commands"); strings.TrimSpace(commands) != "" {
+		file = strings.NewReader(commands)
+	} else {
+		utils.RespondError(w, utils.BadRequest("file or commands is required"))
+		return
+	}
+
+	// Import the curl commands
+	jobId, err := h.Service.ImportCurl(r.Context(), file, filename, form.programId, form.ignoredHeaders)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// Return the job ID as plain text
+	utils.OkCreated(w, jobId)
+}
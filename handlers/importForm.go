@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+// importForm holds the fields shared by the multipart forms of the import endpoints
+type importForm struct {
+	file           multipart.File // nil when no file was uploaded
+	filename       string
+	programId      int
+	ignoredHeaders string
+}
+
+// parseImportForm parses the multipart form of an import request, the file field is optional here.
+// The caller closes the uploaded file.
+func parseImportForm(r *http.Request) (*importForm, error) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil { // 32 MB max file size
+		return nil, utils.BadRequest("failed to parse multipart form")
+	}
+
+	programIdStr := r.FormValue("program_id")
+	if programIdStr == "" {
+		return nil, utils.BadRequest("program_id is required")
+	}
+	programId, err := strconv.Atoi(programIdStr)
+	if err != nil {
+		return nil, utils.BadRequest("program_id must be a valid integer")
+	}
+
+	form := &importForm{programId: programId, ignoredHeaders: r.FormValue("ignored_headers")}
+	if file, handler, err := r.FormFile("file"); err == nil {
+		form.file = file
+		form.filename = handler.Filename
+	}
+	return form, nil
+}
+
+// handleImport parses an import request with a required file, queues the import with queue
+// and responds with the id of the job
+func handleImport(w http.ResponseWriter, r *http.Request, queue func(form *importForm) (int, error)) {
+	form, err := parseImportForm(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	if form.file == nil {
+		utils.RespondError(w, utils.BadRequest("file is required"))
+		return
+	}
+	defer form.file.Close()
+
+	jobId, err := queue(form)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// Return the job ID as plain text
+	utils.OkCreated(w, jobId)
+}
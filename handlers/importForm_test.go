@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+func TestParseImportForm(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   map[string]string
+		file     string // name of the uploaded file, none when empty
+		wantForm importForm
+		wantErr  bool
+	}{
+		{name: "file and fields", fields: map[string]string{"program_id": "7", "ignored_headers": "Cookie"}, file: "capture.har",
+			wantForm: importForm{filename: "capture.har", programId: 7, ignoredHeaders: "Cookie"}},
+		{name: "no file", fields: map[string]string{"program_id": "7"}, wantForm: importForm{programId: 7}},
+		{name: "no program", file: "capture.har", wantErr: true},
+		{name: "program not a number", fields: map[string]string{"program_id": "seven"}, file: "capture.har", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			for name, value := range tt.fields {
+				mw.WriteField(name, value)
+			}
+			if tt.file != "" {
+				fw, _ := mw.CreateFormFile("file", tt.file)
+				io.WriteString(fw, "content")
+			}
+			mw.Close()
+			r := httptest.NewRequest("POST", "/imports", &body)
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+
+			form, err := parseImportForm(r)
+			if tt.wantErr {
+				if !errors.Is(err, utils.ErrBadRequest) {
+					t.Errorf("got error %v, want a bad request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (form.file != nil) != (tt.file != "") {
+				t.Errorf("got file %v, want one uploaded %v", form.file, tt.file != "")
+			}
+			if form.file != nil {
+				content, _ := io.ReadAll(form.file)
+				form.file.Close()
+				if string(content) != "content" {
+					t.Errorf("got file content %q", content)
+				}
+				form.file = nil
+			}
+			if *form != tt.wantForm {
+				t.Errorf("got form %+v, want %+v", *form, tt.wantForm)
+			}
+		})
+	}
+}
@@ -14,52 +14,43 @@ type ImportHarHandler struct {
 }
 
 func (h *ImportHarHandler) ImportHAR(w http.ResponseWriter, r *http.Request) {
-	// Parse multipart form
-	err := r.ParseMultipartForm(32 << 20) // 32 MB max file size
-	if err != nil {
-		utils.RespondError(w, utils.BadRequest("failed to parse multipart form"))
-		return
-	}
-
-	// Get the file from the form
-	file, handler, err := r.FormFile("file")
-	if err != nil {
-		utils.RespondError(w, utils.BadRequest("file is required"))
-		return
-	}
-	defer file.Close()
-
-	// Validate file extension
-	filename := handler.Filename
-	if !isValidHARFile(filename) {
-		utils.RespondError(w, utils.BadRequest("file must be a .har file"))
-		return
-	}
-
-	// Parse additional form fields
-	programIdStr := r.FormValue("program_id")
-	if programIdStr == "" {
-		utils.RespondError(w, utils.BadRequest("program_id is required"))
-		return
-	}
+	handleImport(w, r, func(form *importForm) (int, error) {
+		if !isValidHARFile(form.filename) {
+			return 0, utils.BadRequest("file must be a .har file")
+		}
+		filter, err := parseImportFilter(r)
+		if err != nil {
+			return 0, err
+		}
+		return h.Service.ImportHAR(r.Context(), form.file, form.filename, form.programId, form.ignoredHeaders, filter)
+	})
+}
 
-	programId, err := strconv.Atoi(programIdStr)
-	if err != nil {
-		utils.RespondError(w, utils.BadRequest("program_id must be a valid integer"))
-		return
+// parseImportFilter reads the apply_scope, deny_hosts, skip_static and static_extensions form fields.
+// skip_static without static_extensions drops the default static extensions.
+func parseImportFilter(r *http.Request) (services.ImportFilterOptions, error) {
+	var filter services.ImportFilterOptions
+	if applyScopeStr := r.FormValue("apply_scope"); applyScopeStr != "" {
+		v, err := strconv.ParseBool(applyScopeStr)
+		if err != nil {
+			return filter, utils.BadRequest("apply_scope must be a boolean")
+		}
+		filter.ApplyScope = v
 	}
-
-	ignoredHeaders := r.FormValue("ignored_headers")
-
-	// Import the HAR file
-	jobId, err := h.Service.ImportHAR(r.Context(), file, filename, programId, ignoredHeaders)
-	if err != nil {
-		utils.RespondError(w, err)
-		return
+	filter.DenyHosts = r.FormValue("deny_hosts")
+	filter.StaticExtensions = r.FormValue("static_extensions")
+	if skipStaticStr := r.FormValue("skip_static"); skipStaticStr != "" {
+		v, err := strconv.ParseBool(skipStaticStr)
+		if err != nil {
+			return filter, utils.BadRequest("skip_static must be a boolean")
+		}
+		if !v {
+			filter.StaticExtensions = ""
+		} else if strings.TrimSpace(filter.StaticExtensions) == "" {
+			filter.StaticExtensions = services.DefaultStaticExtensions
+		}
 	}
-
-	// Return the job ID as plain text
-	utils.OkCreated(w, jobId)
+	return filter, nil
 }
 
 // isValidHARFile checks if the file has a .har extension
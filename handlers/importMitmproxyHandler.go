@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/linn221/RequesterBackend/services"
+)
+
+type ImportMitmproxyHandler struct {
+	Service *services.ImportMitmproxyService
+}
+
+func (h *ImportMitmproxyHandler) ImportMitmproxy(w http.ResponseWriter, r *http.Request) {
+	handleImport(w, r, func(form *importForm) (int, error) {
+		return h.Service.ImportMitmproxy(r.Context(), form.file, form.filename, form.programId, form.ignoredHeaders)
+	})
+}
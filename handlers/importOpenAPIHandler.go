@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/services"
+)
+
+type ImportOpenAPIHandler struct {
+	Service *services.ImportOpenAPIService
+}
+
+func (h *ImportOpenAPIHandler) ImportOpenAPI(w http.ResponseWriter, r *http.Request) {
+	handleImport(w, r, func(form *importForm) (int, error) {
+		// Optional, required for specs without a host
+		domain := strings.TrimSpace(r.FormValue("domain"))
+		return h.Service.ImportOpenAPI(r.Context(), form.file, form.filename, form.programId, domain)
+	})
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/linn221/RequesterBackend/services"
+)
+
+type ImportPostmanHandler struct {
+	Service *services.ImportPostmanService
+}
+
+func (h *ImportPostmanHandler) ImportPostman(w http.ResponseWriter, r *http.Request) {
+	handleImport(w, r, func(form *importForm) (int, error) {
+		return h.Service.ImportPostman(r.Context(), form.file, form.filename, form.programId, form.ignoredHeaders)
+	})
+}
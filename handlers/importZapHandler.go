@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/linn221/RequesterBackend/services"
+)
+
+type ImportZapHandler struct {
+	Service *services.ImportZapService
+}
+
+func (h *ImportZapHandler) ImportZAP(w http.ResponseWriter, r *http.Request) {
+	handleImport(w, r, func(form *importForm) (int, error) {
+		return h.Service.ImportZAP(r.Context(), form.file, form.filename, form.programId, form.ignoredHeaders)
+	})
+}
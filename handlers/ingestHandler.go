@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/har"
+	"github.com/linn221/RequesterBackend/services"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+type IngestHandler struct {
+	Service *services.IngestService
+}
+
+// IngestBatch accepts a JSON array of HAR entries. The Idempotency-Key header makes retries safe,
+// X-Ingest-Session names the session the entries are collected under and the optional program_id
+// query parameter skips the scope lookup.
+func (h *IngestHandler) IngestBatch(w http.ResponseWriter, r *http.Request) {
+	var programId *int
+	if programIdStr := r.URL.Query().Get("program_id"); programIdStr != "" {
+		id, err := strconv.Atoi(programIdStr)
+		if err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid program_id"))
+			return
+		}
+		programId = &id
+	}
+
+	var entries []*har.Entry
+	body := http.MaxBytesReader(w, r.Body, 32<<20) // 32 MB max batch size
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(&entries); err != nil {
+		utils.RespondError(w, utils.BadRequest("body must be a JSON array of HAR entries: "+err.Error()))
+		return
+	}
+
+	session := strings.TrimSpace(r.Header.Get("X-Ingest-Session"))
+	idempotencyKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if len(session) > 255 || len(idempotencyKey) > 255 {
+		utils.RespondError(w, utils.BadRequest("X-Ingest-Session and Idempotency-Key must be at most 255 characters"))
+		return
+	}
+
+	result, err := h.Service.IngestBatch(r.Context(), session, idempotencyKey, programId, entries)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	warnings := result.Warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	jobIds := result.JobIds
+	if jobIds == nil {
+		jobIds = []int{}
+	}
+	utils.OkJson(w, &IngestResult{
+		Accepted:   result.Accepted,
+		Duplicates: result.Duplicates,
+		Skipped:    result.Skipped,
+		JobIds:     jobIds,
+		Warnings:   warnings,
+		Replayed:   result.Replayed,
+	})
+}
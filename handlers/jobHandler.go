@@ -2,18 +2,27 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/linn221/RequesterBackend/config"
 	"github.com/linn221/RequesterBackend/models"
 	"github.com/linn221/RequesterBackend/services"
 	"github.com/linn221/RequesterBackend/utils"
 )
 
 type JobHandler struct {
-	Service *services.ImportHarService
+	Service *services.JobService
+	Events  *services.JobEvents
 }
 
 func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
-	jobs, err := h.Service.ListImportJobs(r.Context())
+	page, fields, err := parseListParams[Job](r, config.UnlimitedPage)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	jobs, err := h.Service.List(r.Context(), page)
 	if err != nil {
 		utils.RespondError(w, err)
 		return
@@ -24,16 +33,184 @@ func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
 		response[i] = ToJob(job)
 	}
 
-	utils.OkJson(w, response)
+	writeList(w, page, response, fields)
+}
+
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	job, err := h.Service.Get(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkJson(w, ToJob(job))
+}
+
+func (h *JobHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	_, err = h.Service.Cancel(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkUpdated(w)
+}
+
+func (h *JobHandler) RetryJob(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	_, err = h.Service.Retry(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkUpdated(w)
+}
+
+func (h *JobHandler) DeleteJob(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	_, err = h.Service.Delete(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkDeleted(w)
+}
+
+// StreamEvents pushes progress, warnings and the final outcome of a job as Server-Sent Events
+func (h *JobHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// subscribe before reading the job so no update between the two is lost
+	events, unsubscribe := h.Events.Subscribe(id)
+	defer unsubscribe()
+
+	job, err := h.Service.Get(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.StartSSE(w)
+	if job.IsFinished() {
+		utils.WriteSSE(w, string(services.JobEventFinished), ToJobEvent(services.NewJobEventFromJob(services.JobEventFinished, job, job.ErrorMessage)))
+		return
+	}
+	if err := utils.WriteSSE(w, string(services.JobEventProgress), ToJobEvent(services.NewJobEventFromJob(services.JobEventProgress, job, ""))); err != nil {
+		return
+	}
+
+	// the heartbeat keeps proxies from closing the stream and catches a missed final event
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := utils.WriteSSE(w, string(event.Type), ToJobEvent(event)); err != nil {
+				return
+			}
+			if event.Type == services.JobEventFinished {
+				return
+			}
+		case <-heartbeat.C:
+			job, err := h.Service.Get(r.Context(), id)
+			if err != nil {
+				return
+			}
+			if job.IsFinished() {
+				utils.WriteSSE(w, string(services.JobEventFinished), ToJobEvent(services.NewJobEventFromJob(services.JobEventFinished, job, job.ErrorMessage)))
+				return
+			}
+			if err := utils.WriteSSE(w, string(services.JobEventProgress), ToJobEvent(services.NewJobEventFromJob(services.JobEventProgress, job, ""))); err != nil {
+				return
+			}
+		}
+	}
 }
 
 func ToJob(job *models.ImportJob) *Job {
+	var startedAt, finishedAt *string
+	if job.StartedAt != nil {
+		s := job.StartedAt.Format("2006-01-02T15:04:05Z07:00")
+		startedAt = &s
+	}
+	if job.FinishedAt != nil {
+		s := job.FinishedAt.Format("2006-01-02T15:04:05Z07:00")
+		finishedAt = &s
+	}
+
 	return &Job{
-		Id:          job.Id,
-		JobType:     job.JobType,
-		Title:       job.Title,
-		Progress:    job.Progress,
-		CreatedAt:   job.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		Description: job.Description,
+		Id:               job.Id,
+		JobType:          job.JobType,
+		Title:            job.Title,
+		Progress:         job.Progress,
+		Status:           string(job.Status),
+		ErrorMessage:     job.ErrorMessage,
+		TotalItems:       job.TotalItems,
+		ProcessedItems:   job.ProcessedItems,
+		WarningCount:     job.WarningCount,
+		ApplyScope:       job.ApplyScope,
+		DenyHosts:        job.DenyHosts,
+		StaticExtensions: job.StaticExtensions,
+		KeptItems:        job.KeptItems,
+		OutOfScopeItems:  job.OutOfScopeItems,
+		StaticItems:      job.StaticItems,
+		PatternSearchId:  job.PatternSearchId,
+		StartedAt:        startedAt,
+		FinishedAt:       finishedAt,
+		CreatedAt:        job.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Description:      job.Description,
+	}
+}
+
+func ToJobEvent(event services.JobEvent) *JobEvent {
+	var match *PatternMatch
+	if event.Match != nil {
+		match = ToPatternMatch(event.Match)
+	}
+	return &JobEvent{
+		Type:           string(event.Type),
+		JobId:          event.JobId,
+		Status:         string(event.Status),
+		Progress:       event.Progress,
+		TotalItems:     event.TotalItems,
+		ProcessedItems: event.ProcessedItems,
+		WarningCount:   event.WarningCount,
+		Message:        event.Message,
+		Match:          match,
+		Missed:         event.Missed,
 	}
 }
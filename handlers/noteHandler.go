@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/linn221/RequesterBackend/config"
 	"github.com/linn221/RequesterBackend/models"
 	"github.com/linn221/RequesterBackend/services"
 	"github.com/linn221/RequesterBackend/utils"
@@ -58,7 +59,17 @@ func (h *NoteHandler) List(w http.ResponseWriter, r *http.Request) {
 	referenceType := r.URL.Query().Get("type")
 	search := r.URL.Query().Get("search")
 
-	notes, err := h.Service.List(r.Context(), referenceType, search)
+	defaultLimit := config.UnlimitedPage
+	if search != "" {
+		defaultLimit = config.SearchLimit
+	}
+	page, fields, err := parseListParams[Note](r, defaultLimit)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	notes, err := h.Service.List(r.Context(), referenceType, search, page)
 	if err != nil {
 		utils.RespondError(w, err)
 		return
@@ -69,7 +80,7 @@ func (h *NoteHandler) List(w http.ResponseWriter, r *http.Request) {
 		response[i] = ToNote(n)
 	}
 
-	utils.OkJson(w, response)
+	writeList(w, page, response, fields)
 }
 
 func (h *NoteHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/linn221/RequesterBackend/services"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+type PathPatternHandler struct {
+	Service *services.PathPatternService
+}
+
+func (h *PathPatternHandler) Create(w http.ResponseWriter, r *http.Request) {
+	input, err := parseJson[PathPatternInput](r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	id, err := h.Service.Create(r.Context(), input.ToModel())
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkCreated(w, id)
+}
+
+func (h *PathPatternHandler) List(w http.ResponseWriter, r *http.Request) {
+	var programId *int
+	if programIdStr := r.URL.Query().Get("program_id"); programIdStr != "" {
+		id, err := strconv.Atoi(programIdStr)
+		if err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid program_id"))
+			return
+		}
+		programId = &id
+	}
+
+	patterns, err := h.Service.List(r.Context(), programId)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	response := make([]*PathPattern, len(patterns))
+	for i, p := range patterns {
+		response[i] = ToPathPattern(p)
+	}
+
+	utils.OkJson(w, response)
+}
+
+func (h *PathPatternHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	_, err = h.Service.Delete(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkDeleted(w)
+}
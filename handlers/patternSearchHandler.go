@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/linn221/RequesterBackend/config"
+	"github.com/linn221/RequesterBackend/services"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+type PatternSearchHandler struct {
+	Service *services.PatternSearchService
+}
+
+// Create saves a regex or JSONPath search and starts its first run
+func (h *PatternSearchHandler) Create(w http.ResponseWriter, r *http.Request) {
+	input, err := parseJson[PatternSearchInput](r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	id, err := h.Service.Create(r.Context(), input.ToModel())
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkCreated(w, id)
+}
+
+func (h *PatternSearchHandler) List(w http.ResponseWriter, r *http.Request) {
+	programId, err := parseOptionalId(r, "program_id")
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	page, fields, err := parseListParams[PatternSearch](r, config.DefaultPageLimit)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	searches, err := h.Service.List(r.Context(), programId, page)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	response := make([]*PatternSearch, len(searches))
+	for i, search := range searches {
+		response[i] = ToPatternSearch(search)
+	}
+
+	writeList(w, page, response, fields)
+}
+
+func (h *PatternSearchHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	search, err := h.Service.Get(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkJson(w, ToPatternSearch(search))
+}
+
+// Run starts a new run of a saved search and returns its job id, new_only=true only searches
+// the requests saved since the previous run
+func (h *PatternSearchHandler) Run(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	onlyNew := false
+	if newOnlyStr := r.URL.Query().Get("new_only"); newOnlyStr != "" {
+		if onlyNew, err = strconv.ParseBool(newOnlyStr); err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid new_only"))
+			return
+		}
+	}
+
+	jobId, err := h.Service.Run(r.Context(), id, onlyNew)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkCreated(w, jobId)
+}
+
+// ListMatches lists the matches of the latest run of a search, or of the run given by job_id
+func (h *PatternSearchHandler) ListMatches(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	jobId, err := parseOptionalId(r, "job_id")
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	requestId, err := parseOptionalId(r, "request_id")
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	page, fields, err := parseListParams[PatternMatch](r, config.DefaultPageLimit)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	matches, err := h.Service.ListMatches(r.Context(), id, jobId, requestId, page)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	response := make([]*PatternMatch, len(matches))
+	for i, match := range matches {
+		response[i] = ToPatternMatch(match)
+	}
+
+	writeList(w, page, response, fields)
+}
+
+func (h *PatternSearchHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	_, err = h.Service.Delete(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkDeleted(w)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/linn221/RequesterBackend/config"
 	"github.com/linn221/RequesterBackend/services"
 	"github.com/linn221/RequesterBackend/utils"
 )
@@ -122,7 +123,13 @@ func (h *ProgramHandler) Delete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ProgramHandler) List(w http.ResponseWriter, r *http.Request) {
-	programs, err := h.Service.List(r.Context())
+	page, fields, err := parseListParams[ProgramList](r, config.UnlimitedPage)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	programs, err := h.Service.List(r.Context(), page, fields)
 	if err != nil {
 		utils.RespondError(w, err)
 		return
@@ -132,7 +139,7 @@ func (h *ProgramHandler) List(w http.ResponseWriter, r *http.Request) {
 		response[i] = ToProgramList(p)
 	}
 
-	utils.OkJson(w, response)
+	writeList(w, page, response, fields)
 }
 
 func (h *ProgramHandler) Get(w http.ResponseWriter, r *http.Request) {
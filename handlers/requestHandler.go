@@ -1,78 +1,102 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/linn221/RequesterBackend/config"
 	"github.com/linn221/RequesterBackend/models"
 	"github.com/linn221/RequesterBackend/services"
 	"github.com/linn221/RequesterBackend/utils"
 )
 
 type RequestHandler struct {
-	Service *services.RequestService
+	Service     *services.RequestService
+	AllowRawSQL bool // raw_sql is passed to the database as it is, only for trusted single user setups
 }
 
-func (h *RequestHandler) List(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	var programId, endpointId, jobId *int
-	var err error
+// Create records a raw HTTP request pasted from Burp Repeater or the browser devtools
+func (h *RequestHandler) Create(w http.ResponseWriter, r *http.Request) {
+	input, err := parseJson[RequestInput](r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
 
-	if programIdStr := r.URL.Query().Get("program_id"); programIdStr != "" {
-		id, err := strconv.Atoi(programIdStr)
-		if err != nil {
-			utils.RespondError(w, utils.BadRequest("invalid program_id"))
+	rawRequest := []byte(input.RawRequest)
+	rawResponse := []byte(input.RawResponse)
+	if input.Base64 {
+		if rawRequest, err = base64.StdEncoding.DecodeString(strings.TrimSpace(input.RawRequest)); err != nil {
+			utils.RespondError(w, utils.BadRequest("raw_request is not valid base64"))
 			return
 		}
-		programId = &id
-	}
-
-	if endpointIdStr := r.URL.Query().Get("endpoint_id"); endpointIdStr != "" {
-		id, err := strconv.Atoi(endpointIdStr)
-		if err != nil {
-			utils.RespondError(w, utils.BadRequest("invalid endpoint_id"))
+		if rawResponse, err = base64.StdEncoding.DecodeString(strings.TrimSpace(input.RawResponse)); err != nil {
+			utils.RespondError(w, utils.BadRequest("raw_response is not valid base64"))
 			return
 		}
-		endpointId = &id
 	}
 
-	if jobIdStr := r.URL.Query().Get("job_id"); jobIdStr != "" {
-		id, err := strconv.Atoi(jobIdStr)
-		if err != nil {
-			utils.RespondError(w, utils.BadRequest("invalid job_id"))
-			return
-		}
-		jobId = &id
+	id, err := h.Service.Create(r.Context(), input.ProgramId, input.URL, rawRequest, rawResponse, input.Comment)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
 	}
 
-	rawSQL := r.URL.Query().Get("raw_sql")
+	utils.OkCreated(w, id)
+}
 
-	// Parse new filter parameters
-	domain := r.URL.Query().Get("domain")
-	urlContains := r.URL.Query().Get("url_contains")
-	urlMatch := r.URL.Query().Get("url_match")
-	includeSubdomains := r.URL.Query().Get("includeSubdomains") == "1"
+// Replay sends a stored request again, edited by the optional body, and returns the id of the saved replay
+func (h *RequestHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	input, err := parseJson[ReplayInput](r)
+	if errors.Is(err, io.EOF) {
+		input, err = &ReplayInput{}, nil // no edits
+	}
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
 
-	// Parse multi-level ordering parameters
-	orderBy1 := r.URL.Query().Get("order_by1")
-	asc1 := r.URL.Query().Get("asc1") != "false" // default to true
-	orderBy2 := r.URL.Query().Get("order_by2")
-	asc2 := r.URL.Query().Get("asc2") != "false" // default to true
-	orderBy3 := r.URL.Query().Get("order_by3")
-	asc3 := r.URL.Query().Get("asc3") != "false" // default to true
-	orderBy4 := r.URL.Query().Get("order_by4")
-	asc4 := r.URL.Query().Get("asc4") != "false" // default to true
+	replayId, err := h.Service.Replay(r.Context(), id, input.ToOptions())
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
 
-	// Check if search query is provided
-	searchQuery := r.URL.Query().Get("search")
-	var requests []*models.MyRequest
+	utils.OkCreated(w, replayId)
+}
 
-	if searchQuery != "" {
-		requests, err = h.Service.SearchRequests(r.Context(), searchQuery, domain, urlContains, urlMatch, includeSubdomains, orderBy1, asc1, orderBy2, asc2, orderBy3, asc3, orderBy4, asc4)
-	} else {
-		requests, err = h.Service.List(r.Context(), programId, endpointId, jobId, rawSQL, domain, urlContains, urlMatch, includeSubdomains, orderBy1, asc1, orderBy2, asc2, orderBy3, asc3, orderBy4, asc4)
+func (h *RequestHandler) List(w http.ResponseWriter, r *http.Request) {
+	q, err := services.ParseRequestQuery(r.URL.Query())
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	if q.RawSQL != "" && !h.AllowRawSQL {
+		utils.RespondError(w, utils.BadRequest("raw_sql is disabled, use filter instead (e.g. filter=status:>=400 method:POST)"))
+		return
 	}
 
+	// search results are paged by config.SearchLimit
+	defaultLimit := config.UnlimitedPage
+	if q.Search != "" {
+		defaultLimit = config.SearchLimit
+	}
+	page, fields, err := parseListParams[RequestList](r, defaultLimit)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	requests, err := h.Service.List(r.Context(), q, page, fields)
 	if err != nil {
 		utils.RespondError(w, err)
 		return
@@ -80,10 +104,48 @@ func (h *RequestHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	response := make([]*RequestList, len(requests))
 	for i, req := range requests {
-		response[i] = ToRequestList(req)
+		response[i] = toRequestList(req, fields.Has("text"))
 	}
 
-	utils.OkJson(w, response)
+	writeList(w, page, response, fields)
+}
+
+// Search runs a full-text search over URLs, headers and bodies and returns highlighted snippets of the matches
+func (h *RequestHandler) Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		utils.RespondError(w, utils.BadRequest("q is required"))
+		return
+	}
+
+	var programId *int
+	if programIdStr := r.URL.Query().Get("program_id"); programIdStr != "" {
+		id, err := strconv.Atoi(programIdStr)
+		if err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid program_id"))
+			return
+		}
+		programId = &id
+	}
+
+	page, fields, err := parseListParams[SearchHit](r, config.SearchLimit)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	results, err := h.Service.Search(r.Context(), q, programId, page)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	response := make([]*SearchHit, len(results))
+	for i, result := range results {
+		response[i] = ToSearchHit(result)
+	}
+
+	writeList(w, page, response, fields)
 }
 
 func (h *RequestHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -101,3 +163,29 @@ func (h *RequestHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	utils.OkJson(w, ToRequestDetail(request))
 }
+
+// GetResponseBody serves the raw response body as a sandboxed download, binary bodies included.
+// Captured bodies are never rendered on the API's origin; their original Content-Type is sent in X-Original-Content-Type
+func (h *RequestHandler) GetResponseBody(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	request, err := h.Service.GetResponseBody(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if contentType := models.ContentTypeFromHeaders(request.ResHeaders); contentType != "" {
+		w.Header().Set("X-Original-Content-Type", contentType)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="response_body_`+strconv.Itoa(request.Id)+`"`)
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(request.ResBodyBytes())
+}
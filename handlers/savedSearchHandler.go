@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/linn221/RequesterBackend/config"
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/services"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+type SavedSearchHandler struct {
+	Service *services.SavedSearchService
+}
+
+func (h *SavedSearchHandler) Create(w http.ResponseWriter, r *http.Request) {
+	input, err := parseJson[SavedSearchInput](r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	search, err := input.ToModel()
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	id, err := h.Service.Create(r.Context(), search)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkCreated(w, id)
+}
+
+// List lists saved searches, pinned ones first. With program_id, the searches of every program and the
+// shared ones are listed too.
+func (h *SavedSearchHandler) List(w http.ResponseWriter, r *http.Request) {
+	programId, err := parseOptionalId(r, "program_id")
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	var pinned *bool
+	if pinnedStr := r.URL.Query().Get("pinned"); pinnedStr != "" {
+		v, err := strconv.ParseBool(pinnedStr)
+		if err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid pinned"))
+			return
+		}
+		pinned = &v
+	}
+	page, fields, err := parseListParams[SavedSearch](r, config.DefaultPageLimit)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	searches, err := h.Service.List(r.Context(), programId, pinned, page)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	stats, err := h.Service.Stats(r.Context(), searches)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	response := make([]*SavedSearch, len(searches))
+	for i, search := range searches {
+		response[i] = ToSavedSearch(search, stats[search.Id])
+	}
+
+	writeList(w, page, response, fields)
+}
+
+func (h *SavedSearchHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	search, err := h.Service.Get(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	stats, err := h.Service.Stats(r.Context(), []*models.SavedSearch{search})
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkJson(w, ToSavedSearch(search, stats[search.Id]))
+}
+
+func (h *SavedSearchHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	input, err := parseJson[SavedSearchInput](r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	search, err := input.ToModel()
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	_, err = h.Service.Update(r.Context(), id, search)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkUpdated(w)
+}
+
+func (h *SavedSearchHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	_, err = h.Service.Delete(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkDeleted(w)
+}
+
+// Run lists the requests a saved search matches now, like GET /requests with its parameters.
+// program_id runs a shared search on another program.
+func (h *SavedSearchHandler) Run(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	programId, err := parseOptionalId(r, "program_id")
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	page, fields, err := parseListParams[RequestList](r, config.DefaultPageLimit)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	requests, err := h.Service.Run(r.Context(), id, programId, page, fields)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	response := make([]*RequestList, len(requests))
+	for i, req := range requests {
+		response[i] = toRequestList(req, fields.Has("text"))
+	}
+
+	writeList(w, page, response, fields)
+}
+
+// Refresh materializes the requests matching a collection
+func (h *SavedSearchHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	result, err := h.Service.Refresh(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkJson(w, &CollectionRefresh{Total: result.Total, Added: result.Added, Removed: result.Removed})
+}
+
+// ListCollection refreshes a collection and lists its requests, X-New-Count holds how many were added
+// since it was last viewed and new_only=true lists only those
+func (h *SavedSearchHandler) ListCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	newOnly := false
+	if newOnlyStr := r.URL.Query().Get("new_only"); newOnlyStr != "" {
+		if newOnly, err = strconv.ParseBool(newOnlyStr); err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid new_only"))
+			return
+		}
+	}
+	page, fields, err := parseListParams[RequestList](r, config.DefaultPageLimit)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	requests, stats, err := h.Service.ListCollection(r.Context(), id, newOnly, page, fields)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	response := make([]*RequestList, len(requests))
+	for i, req := range requests {
+		response[i] = toRequestList(req, fields.Has("text"))
+	}
+
+	w.Header().Set("X-New-Count", strconv.FormatInt(stats.NewCount, 10))
+	writeList(w, page, response, fields)
+}
+
+// MarkViewed marks the current requests of a collection as seen
+func (h *SavedSearchHandler) MarkViewed(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	_, err = h.Service.MarkViewed(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkUpdated(w)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/linn221/RequesterBackend/services"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+type ScopeRuleHandler struct {
+	Service *services.ScopeRuleService
+}
+
+func (h *ScopeRuleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	input, err := parseJson[ScopeRuleInput](r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	id, err := h.Service.Create(r.Context(), input.ToModel())
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkCreated(w, id)
+}
+
+func (h *ScopeRuleHandler) List(w http.ResponseWriter, r *http.Request) {
+	var programId *int
+	if programIdStr := r.URL.Query().Get("program_id"); programIdStr != "" {
+		id, err := strconv.Atoi(programIdStr)
+		if err != nil {
+			utils.RespondError(w, utils.BadRequest("invalid program_id"))
+			return
+		}
+		programId = &id
+	}
+
+	rules, err := h.Service.List(r.Context(), programId)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	response := make([]*ScopeRule, len(rules))
+	for i, rule := range rules {
+		response[i] = ToScopeRule(rule)
+	}
+
+	utils.OkJson(w, response)
+}
+
+func (h *ScopeRuleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	_, err = h.Service.Delete(r.Context(), id)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkDeleted(w)
+}
+
+// Check tests the url query parameter against the scope of the program
+func (h *ScopeRuleHandler) Check(w http.ResponseWriter, r *http.Request) {
+	programId, err := utils.GetIdParam(r)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		utils.RespondError(w, utils.BadRequest("url is required"))
+		return
+	}
+
+	result, err := h.Service.Check(r.Context(), programId, url)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.OkJson(w, ToScopeCheck(url, result))
+}
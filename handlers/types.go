@@ -3,7 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/linn221/RequesterBackend/models"
 	"github.com/linn221/RequesterBackend/services"
@@ -360,6 +360,8 @@ type EndpointList struct {
 	URI          string   `json:"uri"`
 	Method       string   `json:"method"`
 	EndpointType string   `json:"endpoint_type"`
+	Documented   bool     `json:"documented"`
+	Scope        string   `json:"scope"`
 	CreatedAt    string   `json:"created_at"`
 	UpdatedAt    string   `json:"updated_at"`
 	Text         string   `json:"text"`
@@ -415,6 +417,8 @@ func ToEndpointList(endpoint *models.Endpoint) *EndpointList {
 		URI:          endpoint.URI,
 		Method:       endpoint.Method,
 		EndpointType: string(endpoint.EndpointType),
+		Documented:   endpoint.Documented,
+		Scope:        endpoint.Scope,
 		CreatedAt:    endpoint.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		UpdatedAt:    endpoint.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		Text:         text,
@@ -423,20 +427,25 @@ func ToEndpointList(endpoint *models.Endpoint) *EndpointList {
 }
 
 type EndpointDetail struct {
-	Id           int           `json:"id"`
-	ProgramId    int           `json:"program_id"`
-	ProgramName  string        `json:"program_name"`
-	Domain       string        `json:"domain"`
-	URI          string        `json:"uri"`
-	Method       string        `json:"method"`
-	EndpointType string        `json:"endpoint_type"`
-	Description  string        `json:"description"`
-	CreatedAt    string        `json:"created_at"`
-	UpdatedAt    string        `json:"updated_at"`
-	Notes        []NoteListing `json:"notes"`
-	Attachments  []Attachment  `json:"attachments"`
-	Images       []Image       `json:"images"`
-	Tags         []TagDTO      `json:"tags"`
+	Id                int             `json:"id"`
+	ProgramId         int             `json:"program_id"`
+	ProgramName       string          `json:"program_name"`
+	Domain            string          `json:"domain"`
+	URI               string          `json:"uri"`
+	Method            string          `json:"method"`
+	EndpointType      string          `json:"endpoint_type"`
+	Description       string          `json:"description"`
+	Documented        bool            `json:"documented"`
+	Scope             string          `json:"scope"`
+	Parameters        json.RawMessage `json:"parameters"`
+	RequestBodySchema json.RawMessage `json:"request_body_schema"`
+	Security          json.RawMessage `json:"security"`
+	CreatedAt         string          `json:"created_at"`
+	UpdatedAt         string          `json:"updated_at"`
+	Notes             []NoteListing   `json:"notes"`
+	Attachments       []Attachment    `json:"attachments"`
+	Images            []Image         `json:"images"`
+	Tags              []TagDTO        `json:"tags"`
 }
 
 func ToEndpointDetail(endpoint *models.Endpoint) *EndpointDetail {
@@ -477,24 +486,183 @@ func ToEndpointDetail(endpoint *models.Endpoint) *EndpointDetail {
 	}
 
 	return &EndpointDetail{
-		Id:           endpoint.Id,
-		ProgramId:    endpoint.ProgramId,
-		ProgramName:  programName,
-		Domain:       endpoint.Domain,
-		URI:          endpoint.URI,
-		Method:       endpoint.Method,
-		EndpointType: string(endpoint.EndpointType),
-		Description:  endpoint.Note,
-		CreatedAt:    endpoint.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:    endpoint.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		Notes:        notes,
-		Attachments:  attachments,
-		Images:       images,
-		Tags:         tags,
+		Id:                endpoint.Id,
+		ProgramId:         endpoint.ProgramId,
+		ProgramName:       programName,
+		Domain:            endpoint.Domain,
+		URI:               endpoint.URI,
+		Method:            endpoint.Method,
+		EndpointType:      string(endpoint.EndpointType),
+		Description:       endpoint.Note,
+		Documented:        endpoint.Documented,
+		Scope:             endpoint.Scope,
+		Parameters:        rawJSON(endpoint.Parameters),
+		RequestBodySchema: rawJSON(endpoint.RequestBodySchema),
+		Security:          rawJSON(endpoint.Security),
+		CreatedAt:         endpoint.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:         endpoint.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Notes:             notes,
+		Attachments:       attachments,
+		Images:            images,
+		Tags:              tags,
+	}
+}
+
+// rawJSON embeds a stored JSON document as is, null when nothing is stored
+func rawJSON(data string) json.RawMessage {
+	if data == "" {
+		return nil
+	}
+	return json.RawMessage(data)
+}
+
+type EndpointNormalizeResult struct {
+	EndpointsUpdated int   `json:"endpoints_updated"`
+	EndpointsMerged  int   `json:"endpoints_merged"`
+	RequestsMoved    int64 `json:"requests_moved"`
+}
+
+// ===== Path Patterns =====
+type PathPatternInput struct {
+	ProgramId   int    `json:"program_id" validate:"required"`
+	Pattern     string `json:"pattern" validate:"required"`
+	Placeholder string `json:"placeholder" validate:"required"`
+	Priority    int    `json:"priority"`
+}
+
+func (input *PathPatternInput) ToModel() *models.PathPattern {
+	return &models.PathPattern{
+		ProgramId:   input.ProgramId,
+		Pattern:     input.Pattern,
+		Placeholder: input.Placeholder,
+		Priority:    input.Priority,
+	}
+}
+
+type PathPattern struct {
+	Id          int    `json:"id"`
+	ProgramId   int    `json:"program_id"`
+	Pattern     string `json:"pattern"`
+	Placeholder string `json:"placeholder"`
+	Priority    int    `json:"priority"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func ToPathPattern(pattern *models.PathPattern) *PathPattern {
+	return &PathPattern{
+		Id:          pattern.Id,
+		ProgramId:   pattern.ProgramId,
+		Pattern:     pattern.Pattern,
+		Placeholder: pattern.Placeholder,
+		Priority:    pattern.Priority,
+		CreatedAt:   pattern.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// ===== Scope Rules =====
+type ScopeRuleInput struct {
+	ProgramId  int    `json:"program_id" validate:"required"`
+	Kind       string `json:"kind" validate:"required,oneof=in out"`
+	Host       string `json:"host"`
+	Scheme     string `json:"scheme" validate:"omitempty,oneof=http https"`
+	Port       int    `json:"port" validate:"min=0,max=65535"`
+	PathPrefix string `json:"path_prefix"`
+	Note       string `json:"note"`
+}
+
+func (input *ScopeRuleInput) ToModel() *models.ScopeRule {
+	return &models.ScopeRule{
+		ProgramId:  input.ProgramId,
+		Kind:       input.Kind,
+		Host:       input.Host,
+		Scheme:     input.Scheme,
+		Port:       input.Port,
+		PathPrefix: input.PathPrefix,
+		Note:       input.Note,
+	}
+}
+
+type ScopeRule struct {
+	Id         int    `json:"id"`
+	ProgramId  int    `json:"program_id"`
+	Kind       string `json:"kind"`
+	Host       string `json:"host"`
+	Scheme     string `json:"scheme"`
+	Port       int    `json:"port"`
+	PathPrefix string `json:"path_prefix"`
+	Note       string `json:"note"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func ToScopeRule(rule *models.ScopeRule) *ScopeRule {
+	return &ScopeRule{
+		Id:         rule.Id,
+		ProgramId:  rule.ProgramId,
+		Kind:       rule.Kind,
+		Host:       rule.Host,
+		Scheme:     rule.Scheme,
+		Port:       rule.Port,
+		PathPrefix: rule.PathPrefix,
+		Note:       rule.Note,
+		CreatedAt:  rule.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
 }
 
+// ScopeCheck is the result of testing a URL against a program's scope
+type ScopeCheck struct {
+	URL    string     `json:"url"`
+	Scope  string     `json:"scope"`
+	Rule   *ScopeRule `json:"rule"`   // the scope rule that decided, if any
+	Domain string     `json:"domain"` // the program domain that put the URL in scope, if any
+}
+
+func ToScopeCheck(url string, result *services.ScopeCheckResult) *ScopeCheck {
+	check := &ScopeCheck{
+		URL:    url,
+		Scope:  string(result.Status),
+		Domain: result.Domain,
+	}
+	if result.Rule != nil {
+		check.Rule = ToScopeRule(result.Rule)
+	}
+	return check
+}
+
 // ===== Requests =====
+type RequestInput struct {
+	ProgramId   int    `json:"program_id" validate:"required"`
+	URL         string `json:"url"` // scheme or base URL, needed when the request has no Host header
+	RawRequest  string `json:"raw_request" validate:"required"`
+	RawResponse string `json:"raw_response"`
+	Base64      bool   `json:"base64"` // raw_request and raw_response are base64 encoded, for binary bodies
+	Comment     string `json:"comment"`
+}
+
+// ReplayInput edits a request before it is sent again, omitted fields keep the original
+type ReplayInput struct {
+	Method          string          `json:"method"`
+	URL             string          `json:"url"`
+	Headers         []models.Header `json:"headers"` // replace the original headers of the same name, the others are added
+	RemoveHeaders   []string        `json:"remove_headers"`
+	Body            *string         `json:"body"`
+	TimeoutMs       int             `json:"timeout_ms" validate:"omitempty,min=1,max=300000"`
+	FollowRedirects bool            `json:"follow_redirects"`
+	Insecure        bool            `json:"insecure"` // skip the TLS certificate verification
+}
+
+func (input *ReplayInput) ToOptions() *services.ReplayOptions {
+	return &services.ReplayOptions{
+		Method:             input.Method,
+		URL:                input.URL,
+		SetHeaders:         input.Headers,
+		RemoveHeaders:      input.RemoveHeaders,
+		Body:               input.Body,
+		Timeout:            time.Duration(input.TimeoutMs) * time.Millisecond,
+		FollowRedirects:    input.FollowRedirects,
+		InsecureSkipVerify: input.Insecure,
+	}
+}
+
 type RequestList struct {
 	Id               int      `json:"id"`
 	ProgramId        int      `json:"program_id"`
@@ -509,6 +677,9 @@ type RequestList struct {
 	StatusCode       int      `json:"status_code"`
 	ContentType      string   `json:"content_type"`
 	Size             int      `json:"size"`
+	ResourceType     string   `json:"resource_type"`
+	IsTemplate       bool     `json:"is_template"`
+	Scope            string   `json:"scope"`
 	ReqHash          string   `json:"req_hash"`
 	ResponseHash     string   `json:"response_hash"`
 	ResponseBodyHash string   `json:"response_body_hash"`
@@ -517,83 +688,307 @@ type RequestList struct {
 }
 
 type RequestDetail struct {
-	Id               int           `json:"id"`
-	ProgramId        int           `json:"program_id"`
-	ProgramName      string        `json:"program_name"`
-	EndpointId       int           `json:"endpoint_id"`
-	EndpointName     string        `json:"endpoint_name"`
-	JobId            int           `json:"job_id"`
-	SequenceNumber   int           `json:"sequence_number"`
-	URL              string        `json:"url"`
-	Method           string        `json:"method"`
-	Domain           string        `json:"domain"`
-	StatusCode       int           `json:"status_code"`
-	RequestHeaders   string        `json:"request_headers"`
-	RequestBody      interface{}   `json:"request_body"`
-	ResponseBody     interface{}   `json:"response_body"`
-	ResponseHeaders  interface{}   `json:"response_headers"`
-	ReqHash          string        `json:"req_hash"`
-	ResponseHash     string        `json:"response_hash"`
-	ResponseBodyHash string        `json:"response_body_hash"`
-	LatencyMs        int           `json:"latency_ms"`
-	Notes            []NoteListing `json:"notes"`
-	Attachments      []Attachment  `json:"attachments"`
-	Images           []Image       `json:"images"`
-	Tags             []TagDTO      `json:"tags"`
+	Id              int         `json:"id"`
+	ProgramId       int         `json:"program_id"`
+	ProgramName     string      `json:"program_name"`
+	EndpointId      int         `json:"endpoint_id"`
+	EndpointName    string      `json:"endpoint_name"`
+	JobId           int         `json:"job_id"`
+	SequenceNumber  int         `json:"sequence_number"`
+	URL             string      `json:"url"`
+	Method          string      `json:"method"`
+	Domain          string      `json:"domain"`
+	StatusCode      int         `json:"status_code"`
+	RequestHeaders  string      `json:"request_headers"`
+	RequestBody     interface{} `json:"request_body"`
+	ResponseBody    interface{} `json:"response_body"`
+	ResponseHeaders interface{} `json:"response_headers"`
+	// binary response bodies are left out of response_body, see GET /requests/{id}/response_body
+	ResponseBodyBinary   bool            `json:"response_body_binary"`
+	ResponseSize         int             `json:"response_size"`
+	ResponseDeclaredSize int             `json:"response_declared_size"`
+	HTTPVersion          string          `json:"http_version"`
+	ResponseHTTPVersion  string          `json:"response_http_version"`
+	QueryParams          []models.Param  `json:"query_params"`
+	RequestCookies       []models.Cookie `json:"request_cookies"`
+	ResponseCookies      []models.Cookie `json:"response_cookies"`
+	RequestMimeType      string          `json:"request_mime_type"`
+	PostParams           []models.Param  `json:"post_params"`
+	RedirectURL          string          `json:"redirect_url"`
+	ServerIPAddress      string          `json:"server_ip_address"`
+	ResourceType         string          `json:"resource_type"`
+	ResponseMimeType     string          `json:"response_mime_type"`
+	Comment              string          `json:"comment"`
+	IsTemplate           bool            `json:"is_template"`
+	ReplayOfId           *int            `json:"replay_of_id"`
+	Scope                string          `json:"scope"`
+	Timings              models.Timings  `json:"timings"`
+	ReqHash              string          `json:"req_hash"`
+	ResponseHash         string          `json:"response_hash"`
+	ResponseBodyHash     string          `json:"response_body_hash"`
+	LatencyMs            int             `json:"latency_ms"`
+	Notes                []NoteListing   `json:"notes"`
+	Attachments          []Attachment    `json:"attachments"`
+	Images               []Image         `json:"images"`
+	Tags                 []TagDTO        `json:"tags"`
+}
+
+// SearchHit is a request matching a full-text search
+type SearchHit struct {
+	Id         int             `json:"id"`
+	ProgramId  int             `json:"program_id"`
+	EndpointId int             `json:"endpoint_id"`
+	URL        string          `json:"url"`
+	Method     string          `json:"method"`
+	Domain     string          `json:"domain"`
+	StatusCode int             `json:"status_code"`
+	Snippets   []SearchSnippet `json:"snippets"`
+}
+
+// SearchSnippet is an HTML escaped excerpt of a field, matches are wrapped in <mark>
+type SearchSnippet struct {
+	Field string `json:"field"`
+	Text  string `json:"text"`
+}
+
+// ===== Pattern Searches =====
+type PatternSearchInput struct {
+	ProgramId  *int   `json:"program_id"` // omitted searches every program
+	Name       string `json:"name"`
+	Mode       string `json:"mode" validate:"required,oneof=regex jsonpath"`
+	Expression string `json:"expression" validate:"required"`
+	Targets    string `json:"targets"` // comma separated fields, every field the mode can read when empty
+	Filter     string `json:"filter"`  // filter query limiting the requests searched
+}
+
+func (input *PatternSearchInput) ToModel() *models.PatternSearch {
+	return &models.PatternSearch{
+		ProgramId:  input.ProgramId,
+		Name:       input.Name,
+		Mode:       input.Mode,
+		Expression: input.Expression,
+		Targets:    input.Targets,
+		Filter:     input.Filter,
+	}
+}
+
+type PatternSearch struct {
+	Id            int    `json:"id"`
+	ProgramId     *int   `json:"program_id"`
+	Name          string `json:"name"`
+	Mode          string `json:"mode"`
+	Expression    string `json:"expression"`
+	Targets       string `json:"targets"`
+	Filter        string `json:"filter"`
+	LastJobId     *int   `json:"last_job_id"`
+	LastRequestId int    `json:"last_request_id"`
+	CreatedAt     string `json:"created_at"`
+}
+
+func ToPatternSearch(search *models.PatternSearch) *PatternSearch {
+	return &PatternSearch{
+		Id:            search.Id,
+		ProgramId:     search.ProgramId,
+		Name:          search.Name,
+		Mode:          search.Mode,
+		Expression:    search.Expression,
+		Targets:       search.Targets,
+		Filter:        search.Filter,
+		LastJobId:     search.LastJobId,
+		LastRequestId: search.LastRequestId,
+		CreatedAt:     search.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// PatternMatch is a value found by a pattern search and where it was found
+type PatternMatch struct {
+	Id        int    `json:"id"`
+	JobId     int    `json:"job_id"`
+	RequestId int    `json:"request_id"`
+	Field     string `json:"field"`
+	Path      string `json:"path"`
+	Offset    int    `json:"offset"`
+	Value     string `json:"value"`
+}
+
+func ToPatternMatch(match *models.PatternMatch) *PatternMatch {
+	return &PatternMatch{
+		Id:        match.Id,
+		JobId:     match.ImportJobId,
+		RequestId: match.RequestId,
+		Field:     match.Field,
+		Path:      match.Path,
+		Offset:    match.Offset,
+		Value:     match.Value,
+	}
+}
+
+// ===== Saved Searches =====
+type SavedSearchInput struct {
+	ProgramId   *int              `json:"program_id"` // omitted runs over every program
+	Name        string            `json:"name" validate:"required"`
+	Description string            `json:"description"`
+	Params      map[string]string `json:"params"` // query parameters of GET /requests, like filter or sort
+	Pinned      bool              `json:"pinned"`
+	Shared      bool              `json:"shared"`
+	Collection  bool              `json:"collection"`
+}
+
+func (input *SavedSearchInput) ToModel() (*models.SavedSearch, error) {
+	query, err := services.EncodeSavedSearchQuery(input.Params)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SavedSearch{
+		ProgramId:   input.ProgramId,
+		Name:        input.Name,
+		Description: input.Description,
+		Query:       query,
+		Pinned:      input.Pinned,
+		Shared:      input.Shared,
+		Collection:  input.Collection,
+	}, nil
+}
+
+type SavedSearch struct {
+	Id           int               `json:"id"`
+	ProgramId    *int              `json:"program_id"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description"`
+	Params       map[string]string `json:"params"`
+	Pinned       bool              `json:"pinned"`
+	Shared       bool              `json:"shared"`
+	Collection   bool              `json:"collection"`
+	Total        *int64            `json:"total"`     // collections only, requests as of the last refresh
+	NewCount     *int64            `json:"new_count"` // collections only, requests added since last viewed
+	RefreshedAt  *string           `json:"refreshed_at"`
+	LastViewedAt *string           `json:"last_viewed_at"`
+	CreatedAt    string            `json:"created_at"`
+}
+
+func ToSavedSearch(search *models.SavedSearch, stats *services.SavedSearchStats) *SavedSearch {
+	dto := &SavedSearch{
+		Id:          search.Id,
+		ProgramId:   search.ProgramId,
+		Name:        search.Name,
+		Description: search.Description,
+		Params:      services.DecodeSavedSearchQuery(search.Query),
+		Pinned:      search.Pinned,
+		Shared:      search.Shared,
+		Collection:  search.Collection,
+		CreatedAt:   search.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if stats != nil {
+		dto.Total = &stats.Total
+		dto.NewCount = &stats.NewCount
+	}
+	if search.RefreshedAt != nil {
+		s := search.RefreshedAt.Format("2006-01-02T15:04:05Z07:00")
+		dto.RefreshedAt = &s
+	}
+	if search.LastViewedAt != nil {
+		s := search.LastViewedAt.Format("2006-01-02T15:04:05Z07:00")
+		dto.LastViewedAt = &s
+	}
+	return dto
+}
+
+// CollectionRefresh reports how a refresh changed a collection
+type CollectionRefresh struct {
+	Total   int `json:"total"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
 }
 
 // ===== Jobs =====
 type Job struct {
-	Id          int    `json:"id"`
-	JobType     string `json:"job_type" validate:"oneof=import_har import_burp_xml"`
-	Title       string `json:"title"`
-	Progress    int    `json:"progress" validate:"min=1,max=100"`
-	CreatedAt   string `json:"created_at"`
-	Description string `json:"description"`
+	Id               int     `json:"id"`
+	JobType          string  `json:"job_type" validate:"oneof=import_har import_burp_xml import_zap import_mitmproxy import_postman import_curl import_openapi manual ingest proxy pattern_search"`
+	Title            string  `json:"title"`
+	Progress         int     `json:"progress" validate:"min=1,max=100"`
+	Status           string  `json:"status"`
+	ErrorMessage     string  `json:"error_message"`
+	TotalItems       int     `json:"total_items"`
+	ProcessedItems   int     `json:"processed_items"`
+	WarningCount     int     `json:"warning_count"`
+	ApplyScope       bool    `json:"apply_scope"`
+	DenyHosts        string  `json:"deny_hosts"`
+	StaticExtensions string  `json:"static_extensions"`
+	KeptItems        int     `json:"kept_items"`
+	OutOfScopeItems  int     `json:"out_of_scope_items"`
+	StaticItems      int     `json:"static_items"`
+	PatternSearchId  *int    `json:"pattern_search_id"`
+	StartedAt        *string `json:"started_at"`
+	FinishedAt       *string `json:"finished_at"`
+	CreatedAt        string  `json:"created_at"`
+	Description      string  `json:"description"`
+}
+
+type JobEvent struct {
+	Type           string        `json:"type"`
+	JobId          int           `json:"job_id"`
+	Status         string        `json:"status"`
+	Progress       int           `json:"progress"`
+	TotalItems     int           `json:"total_items"`
+	ProcessedItems int           `json:"processed_items"`
+	WarningCount   int           `json:"warning_count"`
+	Message        string        `json:"message,omitempty"`
+	Match          *PatternMatch `json:"match,omitempty"`
+	Missed         int           `json:"missed,omitempty"` // events dropped before this one, compare warning_count to spot lost warnings
+}
+
+// ===== Ingest =====
+type IngestResult struct {
+	Accepted   int      `json:"accepted"`
+	Duplicates int      `json:"duplicates"`
+	Skipped    int      `json:"skipped"`
+	JobIds     []int    `json:"job_ids"`
+	Warnings   []string `json:"warnings"`
+	Replayed   bool     `json:"replayed"`
 }
 
 // ===== Import HAR =====
 type ImportHarRequest struct {
-	ProgramId      int    `form:"program_id" validate:"required"`
-	IgnoredHeaders string `form:"ignored_headers"`
+	ProgramId        int    `form:"program_id" validate:"required"`
+	IgnoredHeaders   string `form:"ignored_headers"`
+	ApplyScope       bool   `form:"apply_scope"`
+	DenyHosts        string `form:"deny_hosts"`
+	SkipStatic       bool   `form:"skip_static"`
+	StaticExtensions string `form:"static_extensions"`
 	// file handled as multipart
 }
 
 // ===== Request Conversion Functions =====
 
-// extractContentType extracts content type from response headers
-func extractContentType(responseHeaders string) string {
-	if responseHeaders == "" {
-		return ""
-	}
-
-	// Parse the JSON headers
-	var headers map[string]interface{}
-	if err := json.Unmarshal([]byte(responseHeaders), &headers); err != nil {
-		// If JSON parsing fails, try to parse as HeaderSlice
-		if headerSlice, err := models.HeaderSliceFromJSON(responseHeaders); err == nil {
-			for _, header := range headerSlice {
-				if strings.EqualFold(header.Name, "content-type") {
-					return header.Value
-				}
-			}
-		}
-		return ""
-	}
+func ToRequestList(request *models.MyRequest) *RequestList {
+	return toRequestList(request, true)
+}
 
-	// Look for Content-Type header (case insensitive)
-	for key, value := range headers {
-		if strings.EqualFold(key, "content-type") {
-			if str, ok := value.(string); ok {
-				return str
-			}
-		}
+// ToSearchHit converts a full-text search result
+func ToSearchHit(result *services.SearchResult) *SearchHit {
+	request := result.Request
+	programId := 0
+	if request.ProgramId != nil {
+		programId = *request.ProgramId
+	}
+	snippets := make([]SearchSnippet, len(result.Snippets))
+	for i, snippet := range result.Snippets {
+		snippets[i] = SearchSnippet{Field: snippet.Field, Text: snippet.Text}
+	}
+	return &SearchHit{
+		Id:         request.Id,
+		ProgramId:  programId,
+		EndpointId: request.EndpointId,
+		URL:        request.URL,
+		Method:     request.Method,
+		Domain:     request.Domain,
+		StatusCode: request.ResStatus,
+		Snippets:   snippets,
 	}
-
-	return ""
 }
 
-func ToRequestList(request *models.MyRequest) *RequestList {
+// toRequestList converts a request for lists, the text field is left empty without withText
+func toRequestList(request *models.MyRequest, withText bool) *RequestList {
 	programName := ""
 	programId := 0
 	if request.ProgramId != nil {
@@ -608,6 +1003,44 @@ func ToRequestList(request *models.MyRequest) *RequestList {
 		endpointName = request.Endpoint.URI
 	}
 
+	var text string
+	if withText {
+		text = requestListText(request, programId, programName, endpointName)
+	}
+
+	// Convert tags
+	tags := make([]TagDTO, len(request.Taggables))
+	for i, taggable := range request.Taggables {
+		tags[i] = *ToTagDTO(&taggable.Tag)
+	}
+
+	return &RequestList{
+		Id:               request.Id,
+		ProgramId:        programId,
+		ProgramName:      programName,
+		EndpointId:       request.EndpointId,
+		EndpointName:     endpointName,
+		JobId:            request.ImportJobId,
+		SequenceNumber:   request.Sequence,
+		URL:              request.URL,
+		Method:           request.Method,
+		Domain:           request.Domain,
+		StatusCode:       request.ResStatus,
+		ContentType:      request.ResContentType,
+		Size:             request.RespSize,
+		ResourceType:     request.ResourceType,
+		IsTemplate:       request.IsTemplate,
+		Scope:            request.Scope,
+		ReqHash:          request.ReqHash,
+		ResponseHash:     request.ResHash,
+		ResponseBodyHash: request.ResBodyHash,
+		Text:             text,
+		Tags:             tags,
+	}
+}
+
+// requestListText concatenates everything about a request into the text of its list item
+func requestListText(request *models.MyRequest, programId int, programName, endpointName string) string {
 	// Parse headers and body for text concatenation
 	_, _ = services.ParseRequestHeaders(request.ReqHeaders)
 	var responseHeaders interface{}
@@ -622,7 +1055,10 @@ func ToRequestList(request *models.MyRequest) *RequestList {
 		}
 	}
 	requestBody, _ := services.ParseRequestBody(request.ReqBody)
-	responseBody, _ := services.ParseResponseBody(request.ResBody)
+	var responseBody interface{}
+	if !request.ResBodyBinary {
+		responseBody, _ = services.ParseResponseBody(request.ResBody)
+	}
 
 	// Concatenate all information into text field
 	text := fmt.Sprintf("ID: %d\nProgram ID: %d\nProgram Name: %s\nEndpoint ID: %d\nEndpoint Name: %s\nJob ID: %d\nSequence Number: %d\nURL: %s\nMethod: %s\nDomain: %s\nStatus Code: %d\nContent Type: %s\nSize: %d\nRequest Headers: %s\nRequest Body: %v\nResponse Headers: %v\nResponse Body: %v\nRequest Hash: %s\nResponse Hash: %s\nResponse Body Hash: %s",
@@ -637,7 +1073,7 @@ func ToRequestList(request *models.MyRequest) *RequestList {
 		request.Method,
 		request.Domain,
 		request.ResStatus,
-		extractContentType(request.ResHeaders),
+		request.ResContentType,
 		request.RespSize,
 		request.ReqHeaders,
 		requestBody,
@@ -664,32 +1100,16 @@ func ToRequestList(request *models.MyRequest) *RequestList {
 		}
 	}
 
-	// Convert tags
-	tags := make([]TagDTO, len(request.Taggables))
-	for i, taggable := range request.Taggables {
-		tags[i] = *ToTagDTO(&taggable.Tag)
-	}
+	return text
+}
 
-	return &RequestList{
-		Id:               request.Id,
-		ProgramId:        programId,
-		ProgramName:      programName,
-		EndpointId:       request.EndpointId,
-		EndpointName:     endpointName,
-		JobId:            request.ImportJobId,
-		SequenceNumber:   request.Sequence,
-		URL:              request.URL,
-		Method:           request.Method,
-		Domain:           request.Domain,
-		StatusCode:       request.ResStatus,
-		ContentType:      extractContentType(request.ResHeaders),
-		Size:             request.RespSize,
-		ReqHash:          request.ReqHash,
-		ResponseHash:     request.ResHash,
-		ResponseBodyHash: request.ResBodyHash,
-		Text:             text,
-		Tags:             tags,
+// fromJSONList decodes a list stored as a JSON string, returning an empty list when it is missing or invalid
+func fromJSONList[T any](data string) []T {
+	values := []T{}
+	if data != "" {
+		json.Unmarshal([]byte(data), &values)
 	}
+	return values
 }
 
 func ToRequestDetail(request *models.MyRequest) *RequestDetail {
@@ -723,7 +1143,10 @@ func ToRequestDetail(request *models.MyRequest) *RequestDetail {
 		}
 	}
 	requestBody, _ := services.ParseRequestBody(request.ReqBody)
-	responseBody, _ := services.ParseResponseBody(request.ResBody)
+	var responseBody interface{}
+	if !request.ResBodyBinary {
+		responseBody, _ = services.ParseResponseBody(request.ResBody)
+	}
 
 	// Convert notes
 	notes := make([]NoteListing, len(request.Notes))
@@ -761,29 +1184,48 @@ func ToRequestDetail(request *models.MyRequest) *RequestDetail {
 	}
 
 	return &RequestDetail{
-		Id:               request.Id,
-		ProgramId:        programId,
-		ProgramName:      programName,
-		EndpointId:       request.EndpointId,
-		EndpointName:     endpointName,
-		JobId:            request.ImportJobId,
-		SequenceNumber:   request.Sequence,
-		URL:              request.URL,
-		Method:           request.Method,
-		Domain:           request.Domain,
-		StatusCode:       request.ResStatus,
-		RequestHeaders:   request.ReqHeaders,
-		RequestBody:      requestBody,
-		ResponseBody:     responseBody,
-		ResponseHeaders:  responseHeaders,
-		ReqHash:          request.ReqHash,
-		ResponseHash:     request.ResHash,
-		ResponseBodyHash: request.ResBodyHash,
-		LatencyMs:        int(request.LatencyMs),
-		Notes:            notes,
-		Attachments:      attachments,
-		Images:           images,
-		Tags:             tags,
+		Id:                   request.Id,
+		ProgramId:            programId,
+		ProgramName:          programName,
+		EndpointId:           request.EndpointId,
+		EndpointName:         endpointName,
+		JobId:                request.ImportJobId,
+		SequenceNumber:       request.Sequence,
+		URL:                  request.URL,
+		Method:               request.Method,
+		Domain:               request.Domain,
+		StatusCode:           request.ResStatus,
+		RequestHeaders:       request.ReqHeaders,
+		RequestBody:          requestBody,
+		ResponseBody:         responseBody,
+		ResponseHeaders:      responseHeaders,
+		ResponseBodyBinary:   request.ResBodyBinary,
+		ResponseSize:         request.RespSize,
+		ResponseDeclaredSize: request.ResDeclaredSize,
+		HTTPVersion:          request.HTTPVersion,
+		ResponseHTTPVersion:  request.ResHTTPVersion,
+		QueryParams:          fromJSONList[models.Param](request.ReqQueryString),
+		RequestCookies:       fromJSONList[models.Cookie](request.ReqCookies),
+		ResponseCookies:      fromJSONList[models.Cookie](request.ResCookies),
+		RequestMimeType:      request.ReqMimeType,
+		PostParams:           fromJSONList[models.Param](request.ReqPostParams),
+		RedirectURL:          request.RedirectURL,
+		ServerIPAddress:      request.ServerIPAddress,
+		ResourceType:         request.ResourceType,
+		ResponseMimeType:     request.ResMimeType,
+		Comment:              request.Comment,
+		IsTemplate:           request.IsTemplate,
+		ReplayOfId:           request.ReplayOfId,
+		Scope:                request.Scope,
+		Timings:              request.GetTimings(),
+		ReqHash:              request.ReqHash,
+		ResponseHash:         request.ResHash,
+		ResponseBodyHash:     request.ResBodyHash,
+		LatencyMs:            int(request.LatencyMs),
+		Notes:                notes,
+		Attachments:          attachments,
+		Images:               images,
+		Tags:                 tags,
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/linn221/RequesterBackend/config"
 	"github.com/linn221/RequesterBackend/services"
 	"github.com/linn221/RequesterBackend/utils"
 )
@@ -63,7 +64,13 @@ func (h *VulnHandler) List(w http.ResponseWriter, r *http.Request) {
 		parentId = &id
 	}
 
-	vulns, err := h.VulnService.List(r.Context(), parentId)
+	page, fields, err := parseListParams[VulnList](r, config.UnlimitedPage)
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	vulns, err := h.VulnService.List(r.Context(), parentId, page, fields)
 	if err != nil {
 		utils.RespondError(w, err)
 		return
@@ -74,7 +81,7 @@ func (h *VulnHandler) List(w http.ResponseWriter, r *http.Request) {
 		response[i] = ToVulnList(vuln)
 	}
 
-	utils.OkJson(w, response)
+	writeList(w, page, response, fields)
 }
 
 // Get handles GET /vulns/{id}
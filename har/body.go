@@ -0,0 +1,49 @@
+package har
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/rawhttp"
+)
+
+// Body is a decoded request or response body
+type Body struct {
+	Data   []byte
+	Binary bool // not valid UTF-8 text, stored as a blob instead of text
+}
+
+// DecodeBody decodes the text of a HAR content object. Base64 content is decoded, and when the capture
+// stored the still-encoded stream the Content-Encoding (gzip, deflate, br) is undone by rawhttp.DecodeContent.
+// The decoded body is cut at rawhttp.MaxDecodedSize. Decoding problems, truncation included, are returned
+// as a warning and an undecodable body is kept as it was.
+func DecodeBody(text, encoding string, headers []models.Header) (*Body, string) {
+	data := []byte(text)
+	warning := ""
+
+	if strings.EqualFold(encoding, "base64") {
+		decoded, err := decodeBase64(text)
+		if err != nil {
+			warning = fmt.Sprintf("failed to decode base64 body: %v", err)
+		} else {
+			data = decoded
+		}
+	}
+
+	data, err := rawhttp.DecodeContent(data, headers)
+	if err != nil && warning == "" {
+		warning = err.Error()
+	}
+
+	return &Body{Data: data, Binary: rawhttp.IsBinary(data)}, warning
+}
+
+func decodeBase64(text string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	if decoded, err := base64.StdEncoding.DecodeString(text); err == nil {
+		return decoded, nil
+	}
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(text, "="))
+}
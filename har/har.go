@@ -2,140 +2,291 @@ package har
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/url"
 	"strings"
 
 	"github.com/linn221/RequesterBackend/models"
-	"github.com/linn221/RequesterBackend/utils"
 )
 
 // AI generated struct
 type HAR struct {
 	Log struct {
-		Entries []struct {
-			StartedDateTime string  `json:"startedDateTime"`
-			Time            float64 `json:"time"`
-			Request         struct {
-				Method  string `json:"method"`
-				URL     string `json:"url"`
-				Headers []struct {
-					Name  string `json:"name"`
-					Value string `json:"value"`
-				} `json:"headers"`
-				PostData struct {
-					Text string `json:"text"`
-				} `json:"postData"`
-			} `json:"request"`
-			Response struct {
-				Status  int `json:"status"`
-				Headers []struct {
-					Name  string `json:"name"`
-					Value string `json:"value"`
-				} `json:"headers"`
-				Content struct {
-					Text     string `json:"text"`
-					Encoding string `json:"encoding,omitempty"`
-				} `json:"content"`
-			} `json:"response"`
-		} `json:"entries"`
+		Entries []Entry `json:"entries"`
 	} `json:"log"`
 }
 
-func ParseHAR(bs []byte, resHashFunc func(*models.MyRequest) (string, string)) ([]models.MyRequest, error) {
-	var har HAR
-	if err := json.Unmarshal(bs, &har); err != nil {
+// Entry is a single request/response pair of log.entries
+type Entry struct {
+	StartedDateTime string  `json:"startedDateTime"`
+	Time            float64 `json:"time"`
+	Request         struct {
+		Method      string `json:"method"`
+		URL         string `json:"url"`
+		HTTPVersion string `json:"httpVersion"`
+		Headers     []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		QueryString []models.Param  `json:"queryString"`
+		Cookies     []models.Cookie `json:"cookies"`
+		PostData    struct {
+			MimeType string         `json:"mimeType"`
+			Params   []models.Param `json:"params"`
+			Text     string         `json:"text"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Status      int    `json:"status"`
+		HTTPVersion string `json:"httpVersion"`
+		Headers     []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		Cookies []models.Cookie `json:"cookies"`
+		Content struct {
+			Size     int    `json:"size"`
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding,omitempty"`
+		} `json:"content"`
+		RedirectURL string `json:"redirectURL"`
+	} `json:"response"`
+	Timings         models.Timings `json:"timings"`
+	ServerIPAddress string         `json:"serverIPAddress"`
+	ResourceType    string         `json:"_resourceType"` // Chrome DevTools extension
+	Comment         string         `json:"comment"`
+
+	// OWASP ZAP extensions
+	ZapMessageId   int    `json:"_zapMessageId"`
+	ZapMessageNote string `json:"_zapMessageNote"`
+}
+
+// Reader decodes the entries of a HAR file one at a time, so memory use does not
+// depend on the size of the file. Keys other than log.entries are skipped.
+type Reader struct {
+	dec       *json.Decoder
+	inEntries bool
+	done      bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{dec: json.NewDecoder(r)}
+}
+
+// Next decodes the next entry, it returns io.EOF once all entries have been read
+func (r *Reader) Next() (*Entry, error) {
+	if err := r.more(); err != nil {
 		return nil, err
 	}
+	var entry Entry
+	if err := r.dec.Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
 
-	var result []models.MyRequest
+// Skip decodes the next entry without keeping it, it is used to count the entries of a file
+func (r *Reader) Skip() error {
+	if err := r.more(); err != nil {
+		return err
+	}
+	var skip struct{}
+	return r.dec.Decode(&skip)
+}
 
-	for i, entry := range har.Log.Entries {
-		reqHeaders := make([]models.Header, 0, len(entry.Request.Headers))
-		for _, h := range entry.Request.Headers {
-			reqHeaders = append(reqHeaders, models.Header{Name: h.Name, Value: h.Value})
+// more positions the decoder at the next entry, it returns io.EOF after the last one
+func (r *Reader) more() error {
+	if r.done {
+		return io.EOF
+	}
+	if !r.inEntries {
+		if err := r.seekEntries(); err != nil {
+			if err == io.EOF { // the file ended before log.entries, it isn't an empty HAR
+				return io.ErrUnexpectedEOF
+			}
+			return err
 		}
+		r.inEntries = true
+	}
+	if !r.dec.More() {
+		r.done = true
+		return io.EOF
+	}
+	return nil
+}
+
+// seekEntries moves the decoder to the first element of log.entries
+func (r *Reader) seekEntries() error {
+	if err := r.expectDelim('{'); err != nil {
+		return err
+	}
+	if err := r.seekKey("log"); err != nil {
+		return err
+	}
+	if err := r.expectDelim('{'); err != nil {
+		return err
+	}
+	if err := r.seekKey("entries"); err != nil {
+		return err
+	}
+	return r.expectDelim('[')
+}
 
-		resHeaders := make([]models.Header, 0, len(entry.Response.Headers))
-		for _, h := range entry.Response.Headers {
-			resHeaders = append(resHeaders, models.Header{Name: h.Name, Value: h.Value})
+// seekKey skips object members until the given key, leaving the decoder at its value
+func (r *Reader) seekKey(key string) error {
+	for r.dec.More() {
+		token, err := r.dec.Token()
+		if err != nil {
+			return err
+		}
+		if name, ok := token.(string); ok && name == key {
+			return nil
+		}
+		var skip json.RawMessage
+		if err := r.dec.Decode(&skip); err != nil {
+			return err
 		}
+	}
+	return fmt.Errorf("missing \"%s\" in HAR file", key)
+}
 
-		u, err := url.Parse(entry.Request.URL)
-		domain := ""
-		if err == nil && u.Hostname() != "" {
-			domain = u.Hostname()
-		} else {
-			// Fallback: try to extract domain from URL string if parsing fails
-			if err != nil {
-				// If URL parsing fails, try to extract domain manually
-				urlStr := entry.Request.URL
-				if strings.HasPrefix(urlStr, "http://") || strings.HasPrefix(urlStr, "https://") {
-					parts := strings.Split(urlStr[8:], "/") // Skip "https://" (8 chars)
-					if len(parts) > 0 {
-						domain = parts[0]
-						// Remove port if present
-						if colonIndex := strings.Index(domain, ":"); colonIndex != -1 {
-							domain = domain[:colonIndex]
-						}
+func (r *Reader) expectDelim(delim json.Delim) error {
+	token, err := r.dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("invalid HAR file: expected '%s'", delim)
+	}
+	return nil
+}
+
+// ToMyRequest converts an entry into a request, sequence is its position in the file starting from 1.
+// Problems that don't prevent the import, like a body that can't be decoded, are returned as warnings.
+func ToMyRequest(entry *Entry, sequence int, setHashes func(req *models.MyRequest, reqHeaders, resHeaders []models.Header, resBody []byte)) (*models.MyRequest, []string, error) {
+	reqHeaders := make([]models.Header, 0, len(entry.Request.Headers))
+	for _, h := range entry.Request.Headers {
+		reqHeaders = append(reqHeaders, models.Header{Name: h.Name, Value: h.Value})
+	}
+
+	resHeaders := make([]models.Header, 0, len(entry.Response.Headers))
+	for _, h := range entry.Response.Headers {
+		resHeaders = append(resHeaders, models.Header{Name: h.Name, Value: h.Value})
+	}
+
+	u, err := url.Parse(entry.Request.URL)
+	domain := ""
+	if err == nil && u.Hostname() != "" {
+		domain = u.Hostname()
+	} else {
+		// Fallback: try to extract domain from URL string if parsing fails
+		if err != nil {
+			// If URL parsing fails, try to extract domain manually
+			urlStr := entry.Request.URL
+			if strings.HasPrefix(urlStr, "http://") || strings.HasPrefix(urlStr, "https://") {
+				parts := strings.Split(urlStr[8:], "/") // Skip "https://" (8 chars)
+				if len(parts) > 0 {
+					domain = parts[0]
+					// Remove port if present
+					if colonIndex := strings.Index(domain, ":"); colonIndex != -1 {
+						domain = domain[:colonIndex]
 					}
-				} else if strings.HasPrefix(urlStr, "http://") {
-					parts := strings.Split(urlStr[7:], "/") // Skip "http://" (7 chars)
-					if len(parts) > 0 {
-						domain = parts[0]
-						// Remove port if present
-						if colonIndex := strings.Index(domain, ":"); colonIndex != -1 {
-							domain = domain[:colonIndex]
-						}
+				}
+			} else if strings.HasPrefix(urlStr, "http://") {
+				parts := strings.Split(urlStr[7:], "/") // Skip "http://" (7 chars)
+				if len(parts) > 0 {
+					domain = parts[0]
+					// Remove port if present
+					if colonIndex := strings.Index(domain, ":"); colonIndex != -1 {
+						domain = domain[:colonIndex]
 					}
 				}
 			}
 		}
+	}
 
-		resBody := entry.Response.Content.Text
-		// Decode base64 if needed
-		// if strings.ToLower(entry.Response.Content.Encoding) == "base64" {
-		// 	decoded, err := decodeBase64(resBody)
-		// 	if err == nil {
-		// 		resBody = decoded
-		// 	}
-		// }
-
-		// Convert HeaderSlice to JSON strings
-		reqHeadersJSON, err := models.HeaderSlice(reqHeaders).ToJSON()
-		if err != nil {
-			return nil, err
-		}
+	var warnings []string
+	resBody, warning := DecodeBody(entry.Response.Content.Text, entry.Response.Content.Encoding, resHeaders)
+	if warning != "" {
+		warnings = append(warnings, warning)
+	}
 
-		resHeadersJSON, err := models.HeaderSlice(resHeaders).ToJSON()
-		if err != nil {
-			return nil, err
-		}
+	// Convert HeaderSlice to JSON strings
+	reqHeadersJSON, err := models.HeaderSlice(reqHeaders).ToJSON()
+	if err != nil {
+		return nil, nil, err
+	}
 
-		my := models.MyRequest{
-			Sequence:    i + 1,
-			URL:         entry.Request.URL,
-			Domain:      domain,
-			ReqHeaders:  reqHeadersJSON,
-			ReqBody:     entry.Request.PostData.Text,
-			ResHeaders:  resHeadersJSON,
-			ResStatus:   entry.Response.Status,
-			ResBody:     resBody,
-			RespSize:    len(resBody),
-			LatencyMs:   int64(entry.Time),
-			RequestTime: entry.StartedDateTime,
-			Method:      entry.Request.Method,
-		}
+	resHeadersJSON, err := models.HeaderSlice(resHeaders).ToJSON()
+	if err != nil {
+		return nil, nil, err
+	}
 
-		requestText, responseText := resHashFunc(&my)
+	queryStringJSON, err := toJSON(entry.Request.QueryString)
+	if err != nil {
+		return nil, nil, err
+	}
+	postParamsJSON, err := toJSON(entry.Request.PostData.Params)
+	if err != nil {
+		return nil, nil, err
+	}
+	reqCookiesJSON, err := toJSON(entry.Request.Cookies)
+	if err != nil {
+		return nil, nil, err
+	}
+	resCookiesJSON, err := toJSON(entry.Response.Cookies)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		my.ReqHash = utils.HashString(requestText)
-		my.ResHash = utils.HashString(responseText)
-		my.ResBodyHash = utils.HashString(my.ResBody)
-		reqHeadersFromJSON, _ := models.HeaderSliceFromJSON(my.ReqHeaders)
-		my.ReqHash1 = utils.HashString(my.Method + " " + my.URL + " " + my.ReqBody + " " + reqHeadersFromJSON.EchoAll())
+	my := models.MyRequest{
+		Sequence:        sequence,
+		URL:             entry.Request.URL,
+		Domain:          domain,
+		ReqHeaders:      reqHeadersJSON,
+		ReqBody:         entry.Request.PostData.Text,
+		ResHeaders:      resHeadersJSON,
+		ResStatus:       entry.Response.Status,
+		RespSize:        len(resBody.Data),
+		ResDeclaredSize: entry.Response.Content.Size,
+		ResMimeType:     entry.Response.Content.MimeType,
+		LatencyMs:       int64(entry.Time),
+		RequestTime:     entry.StartedDateTime,
+		Method:          entry.Request.Method,
 
-		result = append(result, my)
+		HTTPVersion:     entry.Request.HTTPVersion,
+		ReqQueryString:  queryStringJSON,
+		ReqCookies:      reqCookiesJSON,
+		ReqMimeType:     entry.Request.PostData.MimeType,
+		ReqPostParams:   postParamsJSON,
+		ResHTTPVersion:  entry.Response.HTTPVersion,
+		ResCookies:      resCookiesJSON,
+		RedirectURL:     entry.Response.RedirectURL,
+		ServerIPAddress: entry.ServerIPAddress,
+		ResourceType:    entry.ResourceType,
+		Comment:         entry.Comment,
+	}
+	if my.Comment == "" {
+		my.Comment = entry.ZapMessageNote
 	}
+	my.SetTimings(entry.Timings)
+	my.SetResBody(resBody.Data, resBody.Binary)
 
-	return result, nil
+	setHashes(&my, reqHeaders, resHeaders, resBody.Data)
+
+	return &my, warnings, nil
+}
+
+// toJSON encodes the optional lists of an entry, empty lists are stored as an empty string
+func toJSON[T any](values []T) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
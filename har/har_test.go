@@ -0,0 +1,214 @@
+package har
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testEntry = `{"startedDateTime":"2024-01-01T00:00:00Z","time":12,` +
+	`"request":{"method":"GET","url":"https://example.com/%d","headers":[{"name":"Accept","value":"*/*"}]},` +
+	`"response":{"status":200,"headers":[],"content":{"size":2,"mimeType":"application/json","text":"{}"}}}`
+
+func testHAR(entries ...string) string {
+	return `{"log":{"version":"1.2","creator":{"name":"test"},"pages":[{"id":"p1"}],"entries":[` +
+		strings.Join(entries, ",") + `]}}`
+}
+
+func entry(n int) string {
+	return fmt.Sprintf(testEntry, n)
+}
+
+func TestReaderNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string // URLs of the entries read before the error
+		wantErr string   // empty when the reader ends with io.EOF
+	}{
+		{name: "entries", input: testHAR(entry(1), entry(2)), want: []string{"https://example.com/1", "https://example.com/2"}},
+		{name: "no entries", input: testHAR()},
+		{name: "keys after entries", input: `{"log":{"entries":[` + entry(1) + `],"comment":"x"},"extra":[1,2]}`, want: []string{"https://example.com/1"}},
+		{name: "entries first", input: `{"log":{"entries":[` + entry(1) + `]}}`, want: []string{"https://example.com/1"}},
+		{name: "empty input", input: "", wantErr: "unexpected EOF"},
+		{name: "not an object", input: `[]`, wantErr: "invalid HAR file: expected '{'"},
+		{name: "log not an object", input: `{"log":[]}`, wantErr: "invalid HAR file: expected '{'"},
+		{name: "entries not an array", input: `{"log":{"entries":{}}}`, wantErr: "invalid HAR file: expected '['"},
+		{name: "missing log", input: `{"version":"1.2"}`, wantErr: `missing "log" in HAR file`},
+		{name: "missing entries", input: `{"log":{"version":"1.2"}}`, wantErr: `missing "entries" in HAR file`},
+		{name: "truncated before entries", input: `{"log":{"version":"1.2",`, wantErr: "unexpected end of JSON input"},
+		{name: "truncated in skipped value", input: `{"log":{"pages":[{"id":`, wantErr: "unexpected EOF"},
+		{name: "truncated entry", input: testHAR(entry(1), entry(2))[:len(testHAR(entry(1)))+20], want: []string{"https://example.com/1"}, wantErr: "unexpected EOF"},
+		{name: "entry not an object", input: testHAR(entry(1), `"x"`), want: []string{"https://example.com/1"}, wantErr: "cannot unmarshal string"},
+		{name: "wrong field type", input: testHAR(`{"request":{"url":1}}`), wantErr: "cannot unmarshal number"},
+		{name: "malformed entry", input: testHAR(`{"request":}`), wantErr: "invalid character '}'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.input))
+			var got []string
+			var err error
+			for {
+				var e *Entry
+				e, err = r.Next()
+				if err != nil {
+					break
+				}
+				got = append(got, e.Request.URL)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got entries %v, want %v", got, tt.want)
+			}
+			if tt.wantErr == "" {
+				if err != io.EOF {
+					t.Fatalf("got error %v, want io.EOF", err)
+				}
+				// the reader stays at the end
+				if _, err := r.Next(); err != io.EOF {
+					t.Errorf("got error %v after the end, want io.EOF", err)
+				}
+				return
+			}
+			if err == io.EOF || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReaderSkip(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{name: "entries", input: testHAR(entry(1), entry(2), entry(3)), want: 3},
+		{name: "no entries", input: testHAR(), want: 0},
+		{name: "unknown keys", input: testHAR(`{}`, `{"a":[1,{"b":null}]}`, `null`), want: 3},
+		{name: "entry not an object", input: testHAR(entry(1), `"x"`), want: 1, wantErr: true},
+		{name: "truncated entry", input: testHAR(entry(1), entry(2))[:len(testHAR(entry(1)))+20], want: 1, wantErr: true},
+		{name: "malformed entry", input: testHAR(entry(1), `{"a" 1}`), want: 1, wantErr: true},
+		{name: "missing entries", input: `{"log":{}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.input))
+			count := 0
+			var err error
+			for {
+				if err = r.Skip(); err != nil {
+					break
+				}
+				count++
+			}
+			if count != tt.want {
+				t.Errorf("skipped %d entries, want %d", count, tt.want)
+			}
+			if gotErr := !errors.Is(err, io.EOF); gotErr != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReaderSeekEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantMore bool // whether an entry follows
+		wantErr  string
+	}{
+		{name: "first key", input: `{"log":{"entries":[{}]}}`, wantMore: true},
+		{name: "after other keys", input: `{"a":{"log":1},"log":{"b":["entries"],"entries":[{}]}}`, wantMore: true},
+		{name: "empty entries", input: `{"log":{"entries":[]}}`},
+		{name: "nested log is not the top one", input: `{"a":{"log":{"entries":[{}]}}}`, wantErr: `missing "log"`},
+		{name: "key as a value", input: `{"a":"log"}`, wantErr: `missing "log"`},
+		{name: "entries null", input: `{"log":{"entries":null}}`, wantErr: "expected '['"},
+		{name: "unquoted key", input: `{log:{}}`, wantErr: "invalid character"},
+		{name: "truncated key", input: `{"lo`, wantErr: "unexpected EOF"},
+		{name: "empty input", input: ``, wantErr: "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.input))
+			err := r.seekEntries()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if more := r.dec.More(); more != tt.wantMore {
+				t.Errorf("got more %v, want %v", more, tt.wantMore)
+			}
+		})
+	}
+}
+
+// harStream writes a HAR file of n entries as it is read, so the file is never held in memory
+type harStream struct {
+	n, written int
+	buf        bytes.Buffer
+	closed     bool
+}
+
+func (s *harStream) Read(p []byte) (int, error) {
+	for s.buf.Len() < len(p) && !s.closed {
+		switch {
+		case s.written == 0:
+			s.buf.WriteString(`{"log":{"version":"1.2","entries":[`)
+		case s.written > s.n:
+			s.buf.WriteString(`]}}`)
+			s.closed = true
+			continue
+		}
+		if s.written < s.n {
+			if s.written > 0 {
+				s.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&s.buf, testEntry, s.written)
+		}
+		s.written++
+	}
+	if s.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return s.buf.Read(p)
+}
+
+func BenchmarkReader(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("entries=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			for b.Loop() {
+				r := NewReader(&harStream{n: n})
+				count := 0
+				for {
+					if _, err := r.Next(); err != nil {
+						if err != io.EOF {
+							b.Fatal(err)
+						}
+						break
+					}
+					count++
+				}
+				if count != n {
+					b.Fatalf("read %d entries, want %d", count, n)
+				}
+			}
+			runtime.ReadMemStats(&after)
+			// what an entry costs should not depend on the size of the file
+			b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N*n), "B/entry")
+		})
+	}
+}
@@ -0,0 +1,357 @@
+// Package jsonpath evaluates a subset of JSONPath over decoded JSON documents: member names
+// ($.a.b, $['a b']), wildcards (.*, [*]), recursive descent ($..email), array indexes including
+// negative ones, slices like [1:3] and unions like [0,2] or ['a','b']. Filter expressions are not supported.
+package jsonpath
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type selectorKind int
+
+const (
+	selectName selectorKind = iota
+	selectIndex
+	selectSlice
+	selectWildcard
+)
+
+type selector struct {
+	kind       selectorKind
+	name       string
+	index      int
+	start, end *int // slice bounds, nil when omitted
+	step       int
+}
+
+// segment selects children of the current nodes, or of the nodes and all their descendants
+type segment struct {
+	descendant bool
+	selectors  []selector
+}
+
+// Path is a compiled JSONPath expression
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Result is a value found by a path and its normalized location, like $.users[0].email
+type Result struct {
+	Path  string
+	Value any
+}
+
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// Compile parses a JSONPath expression, which must start with $
+func Compile(expr string) (*Path, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("the path must start with $")
+	}
+	p := &parser{input: expr, pos: 1}
+	path := &Path{expr: expr}
+	for !p.done() {
+		seg, err := p.segment()
+		if err != nil {
+			return nil, err
+		}
+		path.segments = append(path.segments, seg)
+	}
+	return path, nil
+}
+
+// String returns the expression the path was compiled from
+func (p *Path) String() string {
+	return p.expr
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.pos+1)
+}
+
+func (p *parser) segment() (segment, error) {
+	var seg segment
+	switch {
+	case strings.HasPrefix(p.input[p.pos:], ".."):
+		seg.descendant = true
+		p.pos += 2
+		if !p.done() && p.input[p.pos] == '[' {
+			selectors, err := p.bracket()
+			seg.selectors = selectors
+			return seg, err
+		}
+	case p.input[p.pos] == '.':
+		p.pos++
+	case p.input[p.pos] == '[':
+		selectors, err := p.bracket()
+		seg.selectors = selectors
+		return seg, err
+	default:
+		return seg, p.errorf("expected . or [")
+	}
+
+	// a dot followed by a member name or *
+	if !p.done() && p.input[p.pos] == '*' {
+		p.pos++
+		seg.selectors = []selector{{kind: selectWildcard}}
+		return seg, nil
+	}
+	start := p.pos
+	for !p.done() && p.input[p.pos] != '.' && p.input[p.pos] != '[' {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+	if !identifierRegex.MatchString(name) {
+		return seg, fmt.Errorf("invalid member name '%s' at position %d, quote it like ['%s']", name, start+1, name)
+	}
+	seg.selectors = []selector{{kind: selectName, name: name}}
+	return seg, nil
+}
+
+// bracket reads [selector, selector...]
+func (p *parser) bracket() ([]selector, error) {
+	p.pos++ // the opening bracket
+	var selectors []selector
+	for {
+		p.skipSpaces()
+		if p.done() {
+			return nil, p.errorf("unterminated [")
+		}
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+		p.skipSpaces()
+		if p.done() {
+			return nil, p.errorf("unterminated [")
+		}
+		switch p.input[p.pos] {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return selectors, nil
+		default:
+			return nil, p.errorf("expected , or ]")
+		}
+	}
+}
+
+func (p *parser) selector() (selector, error) {
+	switch c := p.input[p.pos]; {
+	case c == '*':
+		p.pos++
+		return selector{kind: selectWildcard}, nil
+	case c == '\'' || c == '"':
+		name, err := p.quoted(c)
+		return selector{kind: selectName, name: name}, err
+	case c == '?' || c == '(':
+		return selector{}, p.errorf("filter and script expressions are not supported")
+	}
+
+	start := p.pos
+	for !p.done() && strings.IndexByte("-0123456789:", p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+	text := p.input[start:p.pos]
+	if text == "" {
+		return selector{}, p.errorf("expected an index, a slice, * or a quoted name")
+	}
+	if !strings.Contains(text, ":") {
+		index, err := strconv.Atoi(text)
+		if err != nil {
+			return selector{}, fmt.Errorf("invalid index '%s' at position %d", text, start+1)
+		}
+		return selector{kind: selectIndex, index: index}, nil
+	}
+
+	parts := strings.Split(text, ":")
+	if len(parts) > 3 {
+		return selector{}, fmt.Errorf("invalid slice '%s' at position %d", text, start+1)
+	}
+	sel := selector{kind: selectSlice, step: 1}
+	bounds := []**int{&sel.start, &sel.end}
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return selector{}, fmt.Errorf("invalid slice '%s' at position %d", text, start+1)
+		}
+		if i == 2 {
+			if n <= 0 {
+				return selector{}, fmt.Errorf("slice steps must be positive in '%s' at position %d", text, start+1)
+			}
+			sel.step = n
+			continue
+		}
+		*bounds[i] = &n
+	}
+	return sel, nil
+}
+
+// quoted reads a quoted member name, backslash escapes the next character
+func (p *parser) quoted(quote byte) (string, error) {
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for !p.done() {
+		c := p.input[p.pos]
+		p.pos++
+		switch c {
+		case '\\':
+			if p.done() {
+				return "", fmt.Errorf("unterminated quote at position %d", start+1)
+			}
+			b.WriteByte(p.input[p.pos])
+			p.pos++
+		case quote:
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated quote at position %d", start+1)
+}
+
+func (p *parser) skipSpaces() {
+	for !p.done() && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// Find returns the values of a document decoded by encoding/json that the path selects, in document
+// order for arrays and in key order for objects
+func (p *Path) Find(doc any) []Result {
+	nodes := []Result{{Path: "$", Value: doc}}
+	for _, seg := range p.segments {
+		var next []Result
+		for _, node := range nodes {
+			if seg.descendant {
+				for _, descendant := range descendants(node) {
+					next = append(next, seg.apply(descendant)...)
+				}
+			} else {
+				next = append(next, seg.apply(node)...)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (seg segment) apply(node Result) []Result {
+	var results []Result
+	for _, sel := range seg.selectors {
+		results = append(results, sel.apply(node)...)
+	}
+	return results
+}
+
+func (sel selector) apply(node Result) []Result {
+	switch value := node.Value.(type) {
+	case map[string]any:
+		switch sel.kind {
+		case selectName:
+			if child, ok := value[sel.name]; ok {
+				return []Result{{Path: memberPath(node.Path, sel.name), Value: child}}
+			}
+		case selectWildcard:
+			return children(node)
+		}
+	case []any:
+		switch sel.kind {
+		case selectIndex:
+			i := sel.index
+			if i < 0 {
+				i += len(value)
+			}
+			if i >= 0 && i < len(value) {
+				return []Result{{Path: indexPath(node.Path, i), Value: value[i]}}
+			}
+		case selectSlice:
+			start, end := bound(sel.start, 0, len(value)), bound(sel.end, len(value), len(value))
+			var results []Result
+			for i := start; i < end; i += sel.step {
+				results = append(results, Result{Path: indexPath(node.Path, i), Value: value[i]})
+			}
+			return results
+		case selectWildcard:
+			return children(node)
+		}
+	}
+	return nil
+}
+
+// bound resolves a slice bound, negative ones count from the end
+func bound(n *int, fallback, length int) int {
+	if n == nil {
+		return fallback
+	}
+	i := *n
+	if i < 0 {
+		i += length
+	}
+	return max(0, min(i, length))
+}
+
+func children(node Result) []Result {
+	switch value := node.Value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		results := make([]Result, len(keys))
+		for i, key := range keys {
+			results[i] = Result{Path: memberPath(node.Path, key), Value: value[key]}
+		}
+		return results
+	case []any:
+		results := make([]Result, len(value))
+		for i, child := range value {
+			results[i] = Result{Path: indexPath(node.Path, i), Value: child}
+		}
+		return results
+	}
+	return nil
+}
+
+// descendants returns the node and everything below it, parents first
+func descendants(node Result) []Result {
+	results := []Result{node}
+	for _, child := range children(node) {
+		results = append(results, descendants(child)...)
+	}
+	return results
+}
+
+func memberPath(parent, name string) string {
+	if identifierRegex.MatchString(name) {
+		return parent + "." + name
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name)
+	return parent + "['" + escaped + "']"
+}
+
+func indexPath(parent string, i int) string {
+	return parent + "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,126 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testDoc = `{
+	"users": [
+		{"id": 1, "email": "a@example.com", "roles": ["admin", "dev"]},
+		{"id": 2, "email": "b@example.com", "profile": {"email": "b@home.test"}},
+		{"id": 3}
+	],
+	"meta": {"total": 3, "next page": null, "it's": true},
+	"email": "root@example.com"
+}`
+
+func TestFind(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(testDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		want []string // path=value
+	}{
+		{"$", nil}, // checked separately, the whole document
+		{"$.email", []string{"$.email=root@example.com"}},
+		{"$.meta.total", []string{"$.meta.total=3"}},
+		{"$['meta']['next page']", []string{"$.meta['next page']=<nil>"}},
+		{`$.meta["it's"]`, []string{`$.meta['it\'s']=true`}},
+		{`$.meta['it\'s']`, []string{`$.meta['it\'s']=true`}},
+		{"$.users[0].email", []string{"$.users[0].email=a@example.com"}},
+		{"$.users[-1].id", []string{"$.users[2].id=3"}},
+		{"$.users[3]", []string{}},
+		{"$.users[-4]", []string{}},
+		{"$.users[*].id", []string{"$.users[0].id=1", "$.users[1].id=2", "$.users[2].id=3"}},
+		{"$.users.*.id", []string{"$.users[0].id=1", "$.users[1].id=2", "$.users[2].id=3"}},
+		{"$.users[0:2].id", []string{"$.users[0].id=1", "$.users[1].id=2"}},
+		{"$.users[1:].id", []string{"$.users[1].id=2", "$.users[2].id=3"}},
+		{"$.users[:-2].id", []string{"$.users[0].id=1"}},
+		{"$.users[::2].id", []string{"$.users[0].id=1", "$.users[2].id=3"}},
+		{"$.users[5:10]", []string{}},
+		{"$.users[0,2].id", []string{"$.users[0].id=1", "$.users[2].id=3"}},
+		{"$.users[ 2 , 0 ].id", []string{"$.users[2].id=3", "$.users[0].id=1"}},
+		{"$.meta['total','missing']", []string{"$.meta.total=3"}},
+		{"$.meta.*", []string{"$.meta['it\\'s']=true", "$.meta['next page']=<nil>", "$.meta.total=3"}},
+		{"$..email", []string{"$.email=root@example.com", "$.users[0].email=a@example.com", "$.users[1].email=b@example.com", "$.users[1].profile.email=b@home.test"}},
+		{"$..roles[1]", []string{"$.users[0].roles[1]=dev"}},
+		{"$..[0]", []string{"$.users[0]=map[email:a@example.com id:1 roles:[admin dev]]", "$.users[0].roles[0]=admin"}},
+		{"$.users[0].roles.*", []string{"$.users[0].roles[0]=admin", "$.users[0].roles[1]=dev"}},
+		{"$.email.length", []string{}},
+		{"$.users.id", []string{}},
+		{"$.meta[0]", []string{}},
+	}
+	for _, tt := range tests {
+		path, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.expr, err)
+			continue
+		}
+		results := path.Find(doc)
+		if tt.expr == "$" {
+			if len(results) != 1 || results[0].Path != "$" {
+				t.Errorf("Find(%q) = %v, want the document", tt.expr, results)
+			}
+			continue
+		}
+		got := make([]string, len(results))
+		for i, result := range results {
+			got[i] = fmt.Sprintf("%s=%v", result.Path, result.Value)
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("Find(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "the path must start with $"},
+		{"users", "the path must start with $"},
+		{"$users", "expected . or [ at position 2"},
+		{"$.", "invalid member name '' at position 3"},
+		{"$..", "invalid member name '' at position 4"},
+		{"$.a b", "invalid member name 'a b' at position 3, quote it like ['a b']"},
+		{"$.1a", "invalid member name '1a'"},
+		{"$[", "unterminated [ at position 3"},
+		{"$[0", "unterminated [ at position 4"},
+		{"$[0 1]", "expected , or ] at position 5"},
+		{"$['a", "unterminated quote at position 3"},
+		{`$['a\`, "unterminated quote at position 3"},
+		{"$[]", "expected an index, a slice, * or a quoted name at position 3"},
+		{"$[x]", "expected an index, a slice, * or a quoted name at position 3"},
+		{"$[1-2]", "invalid index '1-2' at position 3"},
+		{"$[1:2:3:4]", "invalid slice '1:2:3:4' at position 3"},
+		{"$[1:-:2]", "invalid slice '1:-:2'"},
+		{"$[::0]", "slice steps must be positive in '::0'"},
+		{"$[::-1]", "slice steps must be positive in '::-1'"},
+		{"$[?(@.id==1)]", "filter and script expressions are not supported at position 3"},
+		{"$[(@.length-1)]", "filter and script expressions are not supported"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q): got error %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestFindScalarDocument(t *testing.T) {
+	path, err := Compile("$..a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range []any{nil, "text", 1.5, []any{}} {
+		if results := path.Find(doc); len(results) != 0 {
+			t.Errorf("Find(%v) = %v, want nothing", doc, results)
+		}
+	}
+}
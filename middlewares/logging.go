@@ -27,6 +27,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap returns the original ResponseWriter so http.ResponseController can flush streaming responses
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // StatusCode returns the captured status code
 func (rw *responseWriter) StatusCode() int {
 	return rw.statusCode
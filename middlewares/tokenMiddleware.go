@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// TokenConfig authenticates clients that can't hold the session cookie, like browser extensions,
+// with a static token sent as "Authorization: Bearer <token>" or in the X-Ingest-Token header.
+// Every request is refused when Token is empty.
+type TokenConfig struct {
+	Token string
+}
+
+func (cfg *TokenConfig) Middleware() func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.Token == "" {
+				http.Error(w, "ingestion is disabled, set INGEST_TOKEN to enable it", http.StatusServiceUnavailable)
+				return
+			}
+			pretendToken := r.Header.Get("X-Ingest-Token")
+			if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				pretendToken = strings.TrimPrefix(auth, "Bearer ")
+			}
+			if subtle.ConstantTimeCompare([]byte(pretendToken), []byte(cfg.Token)) != 1 {
+				http.Error(w, "invalid ingest token", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Package mitm reads mitmproxy flow dumps, a sequence of flows serialized as tnetstrings
+package mitm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+// Flow is a flow of a dump, Request is nil for flows that aren't HTTP
+type Flow struct {
+	Id       string
+	Type     string // "http", "tcp", "udp", "dns", ...
+	Request  *Request
+	Response *Response // nil when the flow has no response
+	ServerIP string
+	Comment  string
+	Error    string
+}
+
+type Request struct {
+	Method         string
+	URL            string
+	Host           string
+	HTTPVersion    string
+	Headers        []models.Header
+	Content        []byte // as sent, content encodings are not undone
+	TimestampStart float64
+	TimestampEnd   float64
+}
+
+type Response struct {
+	StatusCode     int
+	HTTPVersion    string
+	Headers        []models.Header
+	Content        []byte // as received, content encodings are not undone
+	TimestampStart float64
+	TimestampEnd   float64
+}
+
+// Reader reads the flows of a dump one at a time
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next flow, it returns io.EOF once all flows have been read
+func (r *Reader) Next() (*Flow, error) {
+	value, err := readTnetstring(r.r)
+	if err != nil {
+		return nil, err
+	}
+	state, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid flow: expected a dictionary")
+	}
+	return toFlow(state)
+}
+
+// toFlow maps the serialized state of a flow. Keys are read leniently since they vary slightly
+// between mitmproxy versions.
+func toFlow(state map[string]any) (*Flow, error) {
+	flow := &Flow{
+		Id:      toString(state["id"]),
+		Type:    toString(state["type"]),
+		Comment: toString(state["comment"]),
+	}
+	if flow.Type == "" {
+		flow.Type = "http" // dumps from before flow types were added only contain HTTP flows
+	}
+	if errState, ok := state["error"].(map[string]any); ok {
+		flow.Error = toString(errState["msg"])
+	}
+	if serverConn, ok := state["server_conn"].(map[string]any); ok {
+		for _, key := range []string{"peername", "ip_address", "address"} {
+			if address, ok := serverConn[key].([]any); ok && len(address) > 0 {
+				if ip := net.ParseIP(toString(address[0])); ip != nil {
+					flow.ServerIP = ip.String()
+					break
+				}
+			}
+		}
+	}
+	if flow.Type != "http" {
+		return flow, nil
+	}
+
+	reqState, ok := state["request"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("HTTP flow %s has no request", flow.Id)
+	}
+	req := &Request{
+		Method:         toString(reqState["method"]),
+		Host:           toString(reqState["host"]),
+		HTTPVersion:    toString(reqState["http_version"]),
+		Headers:        toHeaders(reqState["headers"]),
+		Content:        toBytes(reqState["content"]),
+		TimestampStart: toFloat(reqState["timestamp_start"]),
+		TimestampEnd:   toFloat(reqState["timestamp_end"]),
+	}
+	scheme := toString(reqState["scheme"])
+	if scheme == "" {
+		scheme = "http"
+	}
+	host := req.Host
+	if host == "" {
+		host = toString(reqState["authority"])
+	}
+	port := int(toFloat(reqState["port"]))
+	if port != 0 && !(scheme == "http" && port == 80) && !(scheme == "https" && port == 443) {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	req.URL = scheme + "://" + host + toString(reqState["path"])
+	flow.Request = req
+
+	if resState, ok := state["response"].(map[string]any); ok {
+		flow.Response = &Response{
+			StatusCode:     int(toFloat(resState["status_code"])),
+			HTTPVersion:    toString(resState["http_version"]),
+			Headers:        toHeaders(resState["headers"]),
+			Content:        toBytes(resState["content"]),
+			TimestampStart: toFloat(resState["timestamp_start"]),
+			TimestampEnd:   toFloat(resState["timestamp_end"]),
+		}
+	}
+	return flow, nil
+}
+
+// LatencyMs is the time from the start of the request to the end of the response
+func (f *Flow) LatencyMs() int64 {
+	if f.Request == nil || f.Response == nil || f.Response.TimestampEnd < f.Request.TimestampStart {
+		return 0
+	}
+	return int64(math.Round((f.Response.TimestampEnd - f.Request.TimestampStart) * 1000))
+}
+
+// RequestTime is the start of the request in RFC3339, empty when unknown
+func (f *Flow) RequestTime() string {
+	if f.Request == nil || f.Request.TimestampStart <= 0 {
+		return ""
+	}
+	sec, frac := math.Modf(f.Request.TimestampStart)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano)
+}
+
+// Timings returns the HAR style timing breakdown of the flow, phases that can't be derived are -1
+func (f *Flow) Timings() models.Timings {
+	timings := models.Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Send: -1, Wait: -1, Receive: -1}
+	if f.Request == nil {
+		return timings
+	}
+	ms := func(start, end float64) float64 {
+		if start <= 0 || end < start {
+			return -1
+		}
+		return math.Round((end-start)*1000*1000) / 1000
+	}
+	timings.Send = ms(f.Request.TimestampStart, f.Request.TimestampEnd)
+	if f.Response != nil {
+		timings.Wait = ms(f.Request.TimestampEnd, f.Response.TimestampStart)
+		timings.Receive = ms(f.Response.TimestampStart, f.Response.TimestampEnd)
+	}
+	return timings
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return ""
+}
+
+func toBytes(v any) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
+
+func toFloat(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+// toHeaders converts the [[name, value], ...] header list of a flow
+func toHeaders(v any) []models.Header {
+	list, _ := v.([]any)
+	headers := make([]models.Header, 0, len(list))
+	for _, item := range list {
+		pair, ok := item.([]any)
+		if !ok || len(pair) != 2 {
+			continue
+		}
+		headers = append(headers, models.Header{Name: toString(pair[0]), Value: toString(pair[1])})
+	}
+	return headers
+}
@@ -0,0 +1,134 @@
+package mitm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxTnetstringLength guards against a corrupted length prefix, a flow with its bodies is one value
+const maxTnetstringLength = 64 << 20
+
+// maxTnetstringDepth limits the nesting of lists and dicts, flows are a few levels deep and a crafted
+// dump nested deeper would overflow the stack
+const maxTnetstringDepth = 64
+
+// readTnetstring decodes the next tnetstring value. Values decode to map[string]any, []any,
+// []byte, string, int64, float64, bool and nil.
+func readTnetstring(r *bufio.Reader) (any, error) {
+	length := 0
+	digits := 0
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && digits > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if c == ':' {
+			break
+		}
+		if c < '0' || c > '9' || digits >= 10 {
+			return nil, fmt.Errorf("invalid tnetstring length")
+		}
+		length = length*10 + int(c-'0')
+		digits++
+	}
+	if digits == 0 || length > maxTnetstringLength {
+		return nil, fmt.Errorf("invalid tnetstring length")
+	}
+
+	// read as the data comes rather than allocating the declared length up front
+	data, err := io.ReadAll(io.LimitReader(r, int64(length)))
+	if err != nil || len(data) < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	kind, err := r.ReadByte()
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return parseTnetstring(data, kind, 0)
+}
+
+// parseTnetstring decodes a value of the given type, depth is the number of lists and dicts it is in
+func parseTnetstring(data []byte, kind byte, depth int) (any, error) {
+	if (kind == ']' || kind == '}') && depth >= maxTnetstringDepth {
+		return nil, fmt.Errorf("tnetstring nested deeper than %d levels", maxTnetstringDepth)
+	}
+	switch kind {
+	case ',':
+		return data, nil
+	case ';':
+		return string(data), nil
+	case '#':
+		return strconv.ParseInt(string(data), 10, 64)
+	case '^':
+		return strconv.ParseFloat(string(data), 64)
+	case '!':
+		return string(data) == "true", nil
+	case '~':
+		if len(data) != 0 {
+			return nil, fmt.Errorf("invalid tnetstring null")
+		}
+		return nil, nil
+	case ']':
+		list := []any{}
+		for len(data) > 0 {
+			value, rest, err := splitTnetstring(data, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+			data = rest
+		}
+		return list, nil
+	case '}':
+		dict := map[string]any{}
+		for len(data) > 0 {
+			key, rest, err := splitTnetstring(data, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value, rest, err := splitTnetstring(rest, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			dict[toString(key)] = value
+			data = rest
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("invalid tnetstring type '%c'", kind)
+}
+
+// splitTnetstring decodes the value at the start of data and returns the remaining bytes
+func splitTnetstring(data []byte, depth int) (any, []byte, error) {
+	colon := -1
+	for i := 0; i < len(data) && i <= 10; i++ {
+		if data[i] == ':' {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return nil, nil, fmt.Errorf("invalid tnetstring length")
+	}
+	length := 0
+	for _, c := range data[:colon] {
+		if c < '0' || c > '9' {
+			return nil, nil, fmt.Errorf("invalid tnetstring length")
+		}
+		length = length*10 + int(c-'0')
+	}
+	end := colon + 1 + length
+	if end >= len(data) {
+		return nil, nil, fmt.Errorf("truncated tnetstring")
+	}
+	value, err := parseTnetstring(data[colon+1:end], data[end], depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, data[end+1:], nil
+}
@@ -0,0 +1,190 @@
+package mitm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeTnetstring encodes a value the way mitmproxy writes flows, dicts with sorted keys
+func writeTnetstring(buf *bytes.Buffer, value any) {
+	var data bytes.Buffer
+	var kind byte
+	switch v := value.(type) {
+	case []byte:
+		data.Write(v)
+		kind = ','
+	case string:
+		data.WriteString(v)
+		kind = ';'
+	case int64:
+		data.WriteString(strconv.FormatInt(v, 10))
+		kind = '#'
+	case float64:
+		data.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		kind = '^'
+	case bool:
+		data.WriteString(strconv.FormatBool(v))
+		kind = '!'
+	case nil:
+		kind = '~'
+	case []any:
+		for _, item := range v {
+			writeTnetstring(&data, item)
+		}
+		kind = ']'
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			writeTnetstring(&data, []byte(key))
+			writeTnetstring(&data, v[key])
+		}
+		kind = '}'
+	default:
+		panic(fmt.Sprintf("no tnetstring for %T", value))
+	}
+	fmt.Fprintf(buf, "%d:", data.Len())
+	buf.Write(data.Bytes())
+	buf.WriteByte(kind)
+}
+
+func TestTnetstringRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"bytes", []byte("GET")},
+		{"empty bytes", []byte{}},
+		{"binary bytes", []byte{0, 0xff, ':', ',', '\n'}},
+		{"string", "héllo"},
+		{"int", int64(-42)},
+		{"large int", int64(1) << 62},
+		{"float", 1.5e-3},
+		{"true", true},
+		{"false", false},
+		{"null", nil},
+		{"empty list", []any{}},
+		{"empty dict", map[string]any{}},
+		{"nested", map[string]any{
+			"request": map[string]any{
+				"method":  []byte("POST"),
+				"headers": []any{[]any{[]byte("Host"), []byte("example.com")}, []any{[]byte("Accept"), []byte("*/*")}},
+				"content": []byte(`{"a":"1:2,"}`),
+				"port":    int64(443),
+			},
+			"response":        nil,
+			"timestamp_start": 1700000000.25,
+			"is_replay":       false,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeTnetstring(&buf, tt.value)
+			got, err := readTnetstring(bufio.NewReader(&buf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("got %#v, want %#v", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestReadTnetstringStream(t *testing.T) {
+	var buf bytes.Buffer
+	for i := range 3 {
+		writeTnetstring(&buf, map[string]any{"id": int64(i)})
+	}
+	r := bufio.NewReader(&buf)
+	for i := range 3 {
+		value, err := readTnetstring(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := value.(map[string]any)["id"]; id != int64(i) {
+			t.Errorf("flow %d: got id %v", i, id)
+		}
+	}
+	if _, err := readTnetstring(r); err != io.EOF {
+		t.Errorf("got %v after the last flow, want io.EOF", err)
+	}
+}
+
+func TestReadTnetstringCorrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error  // checked with errors.Is when set
+		wantMsg string // otherwise the error has to contain it
+	}{
+		{name: "empty length", input: ":abc,", wantMsg: "invalid tnetstring length"},
+		{name: "letters in length", input: "1a:abc,", wantMsg: "invalid tnetstring length"},
+		{name: "signed length", input: "-3:abc,", wantMsg: "invalid tnetstring length"},
+		{name: "length too long", input: "12345678901:x,", wantMsg: "invalid tnetstring length"},
+		{name: "length over the cap", input: strconv.Itoa(maxTnetstringLength+1) + ":x,", wantMsg: "invalid tnetstring length"},
+		{name: "huge length with short data", input: "60000000:abc,", wantErr: io.ErrUnexpectedEOF},
+		{name: "length without colon", input: "12", wantErr: io.ErrUnexpectedEOF},
+		{name: "data shorter than length", input: "10:abc,", wantErr: io.ErrUnexpectedEOF},
+		{name: "missing type", input: "3:abc", wantErr: io.ErrUnexpectedEOF},
+		{name: "unknown type", input: "3:abc?", wantMsg: "invalid tnetstring type"},
+		{name: "length shorter than data", input: "2:abc,", wantMsg: "invalid tnetstring type 'c'"},
+		{name: "invalid int", input: "3:abc#", wantMsg: "invalid syntax"},
+		{name: "invalid null", input: "1:x~", wantMsg: "invalid tnetstring null"},
+		{name: "nested length past the end", input: "6:9:abc,]", wantMsg: "truncated tnetstring"},
+		{name: "nested signed length", input: "7:+3:abc,]", wantMsg: "invalid tnetstring length"},
+		{name: "nested length without colon", input: "13:12345678901a,]", wantMsg: "invalid tnetstring length"},
+		{name: "dict key without value", input: "6:3:abc,}", wantMsg: "invalid tnetstring length"},
+		{name: "nested unknown type", input: "6:3:abc?]", wantMsg: "invalid tnetstring type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := readTnetstring(bufio.NewReader(strings.NewReader(tt.input)))
+			if err == nil {
+				t.Fatalf("got %#v, want an error", value)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("got error %v, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestReadTnetstringDepth(t *testing.T) {
+	nested := func(depth int) []byte {
+		value := "0:~"
+		for range depth {
+			value = fmt.Sprintf("%d:%s]", len(value), value)
+		}
+		return []byte(value)
+	}
+
+	value, err := readTnetstring(bufio.NewReader(bytes.NewReader(nested(maxTnetstringDepth))))
+	if err != nil {
+		t.Fatalf("nested %d levels: %v", maxTnetstringDepth, err)
+	}
+	if _, ok := value.([]any); !ok {
+		t.Fatalf("got %#v, want a list", value)
+	}
+	for _, depth := range []int{maxTnetstringDepth + 1, 5000} {
+		_, err := readTnetstring(bufio.NewReader(bytes.NewReader(nested(depth))))
+		if err == nil || !strings.Contains(err.Error(), "nested deeper") {
+			t.Errorf("nested %d levels: got error %v, want the depth error", depth, err)
+		}
+	}
+}
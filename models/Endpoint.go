@@ -1,6 +1,12 @@
 package models
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // EndpointType represents the type of endpoint
 type EndpointType string
@@ -14,7 +20,7 @@ const (
 // Endpoint represents an API endpoint
 type Endpoint struct {
 	Id           int          `gorm:"primaryKey"`
-	ProgramId    int          `gorm:"index;not null"` // Foreign key to Program
+	ProgramId    int          `gorm:"index;not null;uniqueIndex:idx_endpoints_program_key,priority:1"` // Foreign key to Program
 	Method       string       `gorm:"size:10;not null"`
 	Domain       string       `gorm:"size:255;not null"`
 	URI          string       `gorm:"type:text;not null"`
@@ -23,6 +29,18 @@ type Endpoint struct {
 	CreatedAt    time.Time    `gorm:"autoCreateTime"`
 	UpdatedAt    time.Time    `gorm:"autoUpdateTime"`
 
+	// EndpointKeyHash of the domain, method and URI, unique per program so concurrent imports can't create the
+	// same endpoint twice. NULL for duplicates left over from before the index.
+	KeyHash *string `gorm:"size:64;uniqueIndex:idx_endpoints_program_key,priority:2"`
+
+	// Set for endpoints imported from an OpenAPI/Swagger spec, the JSON fields hold what the spec documents
+	Documented        bool   `gorm:"not null;default:false;index"`
+	Parameters        string `gorm:"type:text"`     // JSON list of path, query, header and cookie parameters
+	RequestBodySchema string `gorm:"type:longtext"` // JSON object of media type to schema
+	Security          string `gorm:"type:text"`     // JSON list of alternative security requirements
+
+	Scope string `gorm:"size:10;not null;default:'unknown';index"` // "in", "out" or "unknown" against the program's scope rules
+
 	// Belongs to relationship
 	Program *Program `gorm:"foreignKey:ProgramId"`
 
@@ -35,3 +53,18 @@ type Endpoint struct {
 	Images      []Image      `gorm:"polymorphic:Reference;polymorphicValue:endpoints"`
 	Taggables   []Taggable   `gorm:"polymorphic:Taggable;polymorphicValue:endpoints"`
 }
+
+// BeforeCreate hook to key new endpoints on their domain, method and URI
+func (e *Endpoint) BeforeCreate(tx *gorm.DB) error {
+	if e.KeyHash == nil {
+		hash := EndpointKeyHash(e.Domain, e.Method, e.URI)
+		e.KeyHash = &hash
+	}
+	return nil
+}
+
+// EndpointKeyHash returns the key endpoints are unique on within a program, URIs are too long to be indexed
+func EndpointKeyHash(domain, method, uri string) string {
+	sum := sha256.Sum256([]byte(domain + ":" + method + ":" + uri))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,17 +2,77 @@ package models
 
 import "time"
 
+// JobStatus represents the lifecycle state of an import job
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+	JobStatusDone      JobStatus = "done"
+)
+
+const (
+	JobTypeImportHar       = "import_har"
+	JobTypeImportBurpXML   = "import_burp_xml"
+	JobTypeImportZap       = "import_zap"
+	JobTypeImportMitmproxy = "import_mitmproxy"
+	JobTypeImportPostman   = "import_postman"
+	JobTypeImportCurl      = "import_curl"
+	JobTypeImportOpenAPI   = "import_openapi"
+	JobTypeManual          = "manual" // holds the requests pasted one by one into a program, never queued
+	JobTypeIngest          = "ingest" // collects the traffic of an ingest API session, never queued
+	JobTypeProxy           = "proxy"  // collects the traffic recorded by the proxy in a session, never queued
+	JobTypeReplay          = "replay" // holds the requests of a program sent again with POST /requests/{id}/replay, never queued
+	JobTypePatternSearch   = "pattern_search"
+)
+
 type ImportJob struct {
 	Id             int       `gorm:"primaryKey"`
-	ProgramId      *int      `gorm:"index"`            // Foreign key to Program (nullable for migration)
-	JobType        string    `gorm:"size:20;not null"` // "import_har", "import_xml"
+	ProgramId      *int      `gorm:"index;uniqueIndex:idx_import_jobs_singleton,priority:1;uniqueIndex:idx_import_jobs_session,priority:1"` // Foreign key to Program (nullable for migration)
+	JobType        string    `gorm:"size:20;not null;uniqueIndex:idx_import_jobs_session,priority:2"`                                       // "import_har", "import_xml"
 	Title          string    `gorm:"not null"`
 	Progress       int       `gorm:"not null;default:0"` // 0-100
 	Description    string    `gorm:"type:text"`
 	IgnoredHeaders string    `gorm:"type:text"` // Store as JSON string
+	Status         JobStatus `gorm:"size:20;not null;default:'queued';index"`
+	ErrorMessage   string    `gorm:"type:text"`
+	FilePath       string    `gorm:"size:500"` // uploaded file the worker reads from
+	OriginalName   string    `gorm:"size:255"`
+	Domain         string    `gorm:"size:255"`                                                      // domain used when the imported file doesn't name one
+	Session        string    `gorm:"size:255;index;uniqueIndex:idx_import_jobs_session,priority:3"` // ingest API or proxy session the job collects traffic for
+	TotalItems     int       `gorm:"not null;default:0"`
+	ProcessedItems int       `gorm:"not null;default:0"`
+	WarningCount   int       `gorm:"not null;default:0"`
+	StartedAt      *time.Time
+	FinishedAt     *time.Time
 	CreatedAt      time.Time `gorm:"autoCreateTime"`
 	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
 
+	// entry filtering of HAR and Burp imports, the counts are set when the job finishes
+	ApplyScope       bool   `gorm:"not null;default:false"` // entries out of the program's scope are dropped
+	DenyHosts        string `gorm:"type:text"`              // comma separated hosts dropped as out of scope
+	StaticExtensions string `gorm:"type:text"`              // comma separated path extensions dropped as static files
+	KeptItems        int    `gorm:"not null;default:0"`
+	OutOfScopeItems  int    `gorm:"not null;default:0"`
+	StaticItems      int    `gorm:"not null;default:0"`
+
+	// runs of pattern searches, they read no file
+	PatternSearchId *int `gorm:"index"`
+	AfterRequestId  int  `gorm:"not null;default:0"` // only requests with a higher id are searched
+
+	// set to the job type on manual and replay jobs, a program has one of each and concurrent requests can't create a second
+	Singleton *string `gorm:"size:20;uniqueIndex:idx_import_jobs_singleton,priority:2"`
+
+	// numbers the rolling jobs of an ingest or proxy session from 1, concurrent batches can't start the same one twice
+	Generation *int `gorm:"uniqueIndex:idx_import_jobs_session,priority:4"`
+
 	// One-to-many relationship
 	Requests []MyRequest `gorm:"foreignKey:ImportJobId"`
 }
+
+// IsFinished reports whether the job has reached a terminal status
+func (j *ImportJob) IsFinished() bool {
+	return j.Status == JobStatusDone || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
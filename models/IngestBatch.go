@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// IngestBatch records a batch posted to the ingest API so a retry with the same idempotency key
+// returns the original outcome instead of importing the entries again
+type IngestBatch struct {
+	Id             int       `gorm:"primaryKey"`
+	IdempotencyKey string    `gorm:"size:255;not null;uniqueIndex"`
+	Session        string    `gorm:"size:255"`
+	Accepted       int       `gorm:"not null;default:0"`
+	Duplicates     int       `gorm:"not null;default:0"`
+	Skipped        int       `gorm:"not null;default:0"`
+	JobIds         string    `gorm:"size:500"` // comma separated ids of the jobs the entries went to
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
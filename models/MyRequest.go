@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
 )
 
 type MyRequest struct {
@@ -26,7 +29,40 @@ type MyRequest struct {
 	RespSize   int    `gorm:"not null"`
 	LatencyMs  int64  `gorm:"not null"`
 
+	ResContentType  string `gorm:"size:255;index"`         // Content-Type response header, set from ResHeaders when saved
+	ResDeclaredSize int    `gorm:"not null;default:0"`     // body size reported by the capture
+	ResMimeType     string `gorm:"size:100"`               // mime type reported by the capture
+	ResBodyBinary   bool   `gorm:"not null;default:false"` // the body is kept in ResBodyBlob instead of ResBody
+	ResBodyBlob     []byte `gorm:"type:longblob"`
+
 	RequestTime string `gorm:"size:50"`
+
+	// capture details, list fields are stored as JSON strings
+	HTTPVersion     string `gorm:"size:20"`
+	ReqQueryString  string `gorm:"type:text"`
+	ReqCookies      string `gorm:"type:text"`
+	ReqMimeType     string `gorm:"size:255"`
+	ReqPostParams   string `gorm:"type:text"`
+	ResHTTPVersion  string `gorm:"size:20"`
+	ResCookies      string `gorm:"type:text"`
+	RedirectURL     string `gorm:"type:text"`
+	ServerIPAddress string `gorm:"size:64"`
+	ResourceType    string `gorm:"size:32;index"`
+	Comment         string `gorm:"type:text"`                    // comment from the capture tool
+	IsTemplate      bool   `gorm:"not null;default:false;index"` // built from API docs (Postman, curl) rather than observed traffic
+	ReplayOfId      *int   `gorm:"index"`                        // the request this one was replayed from
+
+	Scope string `gorm:"size:10;not null;default:'unknown';index"` // "in", "out" or "unknown" against the program's scope rules
+
+	// timings in milliseconds, -1 when the phase does not apply
+	TimingBlocked float64 `gorm:"not null;default:0"`
+	TimingDNS     float64 `gorm:"not null;default:0"`
+	TimingConnect float64 `gorm:"not null;default:0"`
+	TimingSSL     float64 `gorm:"not null;default:0"`
+	TimingSend    float64 `gorm:"not null;default:0"`
+	TimingWait    float64 `gorm:"not null;default:0"`
+	TimingReceive float64 `gorm:"not null;default:0"`
+
 	// hashes
 	ReqHash1    string `gorm:"size:64;index"` // hash raw request
 	ReqHash     string `gorm:"size:64;index"`
@@ -47,6 +83,132 @@ type MyRequest struct {
 	Taggables   []Taggable   `gorm:"polymorphic:Taggable;polymorphicValue:requests"`
 }
 
+// BeforeSave hook to keep the content type column in line with the response headers
+func (r *MyRequest) BeforeSave(tx *gorm.DB) error {
+	r.ResContentType = ContentTypeFromHeaders(r.ResHeaders)
+	return nil
+}
+
+// ContentTypeFromHeaders returns the first Content-Type of headers stored as JSON, a list of name and
+// value pairs or an object, cut to the size of the column
+func ContentTypeFromHeaders(headersJSON string) string {
+	if headersJSON == "" {
+		return ""
+	}
+
+	var contentType string
+	if headerSlice, err := HeaderSliceFromJSON(headersJSON); err == nil {
+		for _, header := range headerSlice {
+			if strings.EqualFold(header.Name, "content-type") {
+				contentType = header.Value
+				break
+			}
+		}
+	} else {
+		contentType = firstObjectValue(headersJSON, "content-type")
+	}
+	if len(contentType) > 255 {
+		contentType = contentType[:255]
+	}
+	return contentType
+}
+
+// firstObjectValue returns the first string member of a JSON object named name in any case, walking
+// the members in document order as decoding to a map would lose it
+func firstObjectValue(objectJSON, name string) string {
+	decoder := json.NewDecoder(strings.NewReader(objectJSON))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return ""
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return ""
+		}
+		if str, ok := value.(string); ok && strings.EqualFold(key.(string), name) {
+			return str
+		}
+	}
+	return ""
+}
+
+// SetResBody stores the response body as text, or as a blob when it is binary
+func (r *MyRequest) SetResBody(data []byte, binary bool) {
+	r.ResBodyBinary = binary
+	if binary {
+		r.ResBody = ""
+		r.ResBodyBlob = data
+		return
+	}
+	r.ResBody = string(data)
+	r.ResBodyBlob = nil
+}
+
+// ResBodyBytes returns the raw response body regardless of how it is stored
+func (r *MyRequest) ResBodyBytes() []byte {
+	if r.ResBodyBinary {
+		return r.ResBodyBlob
+	}
+	return []byte(r.ResBody)
+}
+
+// SetTimings copies the timing breakdown of a capture
+func (r *MyRequest) SetTimings(t Timings) {
+	r.TimingBlocked = t.Blocked
+	r.TimingDNS = t.DNS
+	r.TimingConnect = t.Connect
+	r.TimingSSL = t.SSL
+	r.TimingSend = t.Send
+	r.TimingWait = t.Wait
+	r.TimingReceive = t.Receive
+}
+
+// GetTimings returns the timing breakdown of the request
+func (r *MyRequest) GetTimings() Timings {
+	return Timings{
+		Blocked: r.TimingBlocked,
+		DNS:     r.TimingDNS,
+		Connect: r.TimingConnect,
+		SSL:     r.TimingSSL,
+		Send:    r.TimingSend,
+		Wait:    r.TimingWait,
+		Receive: r.TimingReceive,
+	}
+}
+
+// Timings is the HAR timing breakdown of a request in milliseconds, -1 when a phase does not apply
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Param is a query string or form parameter
+type Param struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
 // Temporary struct for parsing HAR files (with HeaderSlice fields)
 type TempMyRequest struct {
 	Sequence    int
@@ -117,6 +279,66 @@ func (hs HeaderSlice) ToJSON() (string, error) {
 	return string(data), nil
 }
 
+// ToJSONWithin converts the headers to JSON of at most max bytes that stays valid: headers that don't
+// fit are dropped from the end, and the value of the first of them is cut to the room left when its
+// name fits
+func (hs HeaderSlice) ToJSONWithin(max int) (string, error) {
+	data, err := hs.ToJSON()
+	if err != nil || len(data) <= max {
+		return data, err
+	}
+	kept := HeaderSlice{}
+	size := len("[]")
+	for _, h := range hs {
+		if len(kept) > 0 {
+			size++ // the comma
+		}
+		encoded, err := json.Marshal(h)
+		if err != nil {
+			return "", err
+		}
+		if size+len(encoded) <= max {
+			kept = append(kept, h)
+			size += len(encoded)
+			continue
+		}
+		// escaping makes the encoded value longer than its bytes, search the longest cut that fits
+		var fitting *Header
+		for low, high := 0, len(h.Value); low <= high; {
+			n := (low + high) / 2
+			cut := Header{Name: h.Name, Value: cutString(h.Value, n)}
+			if encoded, err = json.Marshal(cut); err != nil {
+				return "", err
+			}
+			if size+len(encoded) <= max {
+				fitting = &cut
+				low = n + 1
+			} else {
+				high = n - 1
+			}
+		}
+		if fitting != nil {
+			kept = append(kept, *fitting)
+		}
+		break
+	}
+	return kept.ToJSON()
+}
+
+// cutString keeps at most n bytes of s, on a character boundary
+func cutString(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
 // Convert JSON string to HeaderSlice from database
 func HeaderSliceFromJSON(jsonStr string) (HeaderSlice, error) {
 	var hs HeaderSlice
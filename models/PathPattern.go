@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// PathPattern is a program specific rule for templating endpoint paths,
+// path segments fully matching Pattern are replaced with Placeholder
+type PathPattern struct {
+	Id          int       `gorm:"primaryKey"`
+	ProgramId   int       `gorm:"index;not null"` // Foreign key to Program
+	Pattern     string    `gorm:"size:255;not null"`
+	Placeholder string    `gorm:"size:100;not null"`
+	Priority    int       `gorm:"default:0"` // higher priority patterns are tried first
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+
+	// Belongs to relationship
+	Program *Program `gorm:"foreignKey:ProgramId"`
+}
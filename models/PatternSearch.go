@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+const (
+	PatternModeRegex    = "regex"
+	PatternModeJSONPath = "jsonpath"
+)
+
+// PatternSearch is a saved regex or JSONPath search over the traffic of a program, each run is an import job
+type PatternSearch struct {
+	Id            int       `gorm:"primaryKey"`
+	ProgramId     *int      `gorm:"index"` // nil searches every program
+	Name          string    `gorm:"size:255"`
+	Mode          string    `gorm:"size:10;not null"` // "regex" or "jsonpath"
+	Expression    string    `gorm:"type:text;not null"`
+	Targets       string    `gorm:"size:255;not null"` // comma separated fields: url, req.headers, req.body, res.headers, res.body
+	Filter        string    `gorm:"type:text"`         // filter query limiting the requests searched
+	LastJobId     *int      // the latest run
+	LastRequestId int       `gorm:"not null;default:0"` // highest request id searched, runs of new requests start after it
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+}
+
+// PatternMatch is a value a pattern search run found in a request
+type PatternMatch struct {
+	Id              int       `gorm:"primaryKey"`
+	PatternSearchId int       `gorm:"not null;index"`
+	ImportJobId     int       `gorm:"not null;index"` // the run that found it
+	RequestId       int       `gorm:"not null;index"`
+	Field           string    `gorm:"size:20;not null"`   // url, req.headers, req.body, res.headers or res.body
+	Path            string    `gorm:"size:500"`           // JSONPath of the value, or the header name
+	Offset          int       `gorm:"not null;default:0"` // byte offset of a regex match in the field, or in the "Name: value" line of the header
+	Value           string    `gorm:"type:text"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+}
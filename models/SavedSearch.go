@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// SavedSearch is a named request list, the query parameters of GET /requests stored to run again.
+// A collection also keeps which requests match, so the ones added since it was last viewed can be told apart.
+type SavedSearch struct {
+	Id           int        `gorm:"primaryKey"`
+	ProgramId    *int       `gorm:"index"` // nil runs over every program
+	Name         string     `gorm:"size:255;not null"`
+	Description  string     `gorm:"type:text"`
+	Query        string     `gorm:"type:text"` // URL encoded query parameters of GET /requests
+	Pinned       bool       `gorm:"not null;default:false"`
+	Shared       bool       `gorm:"not null;default:false"` // listed under every program and run on the program asked for
+	Collection   bool       `gorm:"not null;default:false"`
+	RefreshedAt  *time.Time // when the matching requests of a collection were last materialized
+	LastViewedAt *time.Time
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+// CollectionItem is a request matching a collection when it was last refreshed
+type CollectionItem struct {
+	SavedSearchId int       `gorm:"primaryKey;autoIncrement:false"`
+	RequestId     int       `gorm:"primaryKey;autoIncrement:false;index"`
+	AddedAt       time.Time `gorm:"not null;index"` // when the request started matching
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	ScopeRuleIn  = "in"
+	ScopeRuleOut = "out"
+)
+
+// ScopeRule is an in-scope or out-of-scope rule of a program, empty fields match anything
+type ScopeRule struct {
+	Id         int       `gorm:"primaryKey"`
+	ProgramId  int       `gorm:"index;not null"`  // Foreign key to Program
+	Kind       string    `gorm:"size:3;not null"` // "in" or "out"
+	Host       string    `gorm:"size:255"`        // example.com, *.example.com or a CIDR like 10.0.0.0/8
+	Scheme     string    `gorm:"size:10"`
+	Port       int       `gorm:"not null;default:0"`
+	PathPrefix string    `gorm:"size:500"`
+	Note       string    `gorm:"type:text"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+
+	// Belongs to relationship
+	Program *Program `gorm:"foreignKey:ProgramId"`
+}
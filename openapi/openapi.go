@@ -0,0 +1,623 @@
+// Package openapi reads OpenAPI 3.x and Swagger 2.0 specs, in JSON or YAML, into the operations
+// they document with parameters, request bodies and security requirements resolved
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the parsed document
+type Spec struct {
+	Version    string
+	Title      string
+	Operations []*Operation
+	Warnings   []string
+}
+
+// Operation is one path and method of the spec
+type Operation struct {
+	Method        string
+	Path          string   // path template relative to the server, e.g. /users/{id}
+	Servers       []string // base URLs, the most specific level of the spec that declares them wins
+	OperationId   string
+	Summary       string
+	Description   string
+	Tags          []string
+	Deprecated    bool
+	Parameters    []Parameter
+	RequestBody   *RequestBody
+	Security      [][]SecurityScheme // alternatives, every scheme of one alternative is required
+	ResponseTypes []string           // media types of the documented responses
+}
+
+// Parameter is a path, query, header or cookie parameter
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+	Schema      any    `json:"schema,omitempty"`
+}
+
+// RequestBody maps the accepted media types to their schemas
+type RequestBody struct {
+	Required    bool           `json:"required,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Content     map[string]any `json:"content"`
+}
+
+// SecurityScheme is a scheme an operation requires, Swagger 2.0 schemes use the OpenAPI 3 vocabulary
+type SecurityScheme struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`             // apiKey, http, oauth2, openIdConnect, mutualTLS
+	Scheme    string   `json:"scheme,omitempty"` // http auth scheme such as basic or bearer
+	In        string   `json:"in,omitempty"`     // where an apiKey is sent
+	ParamName string   `json:"paramName,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+}
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Parse reads a spec, the version is taken from its openapi or swagger field
+func Parse(data []byte) (*Spec, error) {
+	root, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{root: root}
+	spec := &Spec{Title: getString(getMap(root, "info"), "title")}
+	if version := getString(root, "openapi"); version != "" {
+		spec.Version = version
+		p.v2 = false
+	} else if version := getString(root, "swagger"); version != "" {
+		spec.Version = version
+		p.v2 = true
+	} else {
+		return nil, fmt.Errorf("not an OpenAPI or Swagger document: missing openapi or swagger field")
+	}
+
+	servers := p.specServers()
+	paths := getMap(root, "paths")
+	for _, path := range sortedKeys(paths) {
+		item := p.deref(paths[path])
+		if item == nil {
+			continue
+		}
+		pathServers := servers
+		if s := p.servers(getList(item, "servers")); len(s) > 0 {
+			pathServers = s
+		}
+		for _, method := range methods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			operation := p.operation(path, method, item, op)
+			operation.Servers = pathServers
+			if s := p.servers(getList(op, "servers")); len(s) > 0 {
+				operation.Servers = s
+			}
+			spec.Operations = append(spec.Operations, operation)
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	spec.Warnings = p.warnings
+	return spec, nil
+}
+
+type parser struct {
+	root     map[string]any
+	v2       bool
+	warnings []string
+	err      error // the first problem that makes the spec unusable, Parse returns it
+}
+
+func (p *parser) warn(format string, args ...any) {
+	p.warnings = append(p.warnings, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *parser) operation(path, method string, item, op map[string]any) *Operation {
+	operation := &Operation{
+		Method:      strings.ToUpper(method),
+		Path:        path,
+		OperationId: getString(op, "operationId"),
+		Summary:     getString(op, "summary"),
+		Description: getString(op, "description"),
+		Deprecated:  getBool(op, "deprecated"),
+	}
+	if operation.Summary == "" {
+		operation.Summary = getString(item, "summary")
+	}
+	if operation.Description == "" {
+		operation.Description = getString(item, "description")
+	}
+	for _, tag := range getList(op, "tags") {
+		if s, ok := tag.(string); ok {
+			operation.Tags = append(operation.Tags, s)
+		}
+	}
+
+	// operation parameters override the path ones with the same name and location
+	var params []map[string]any
+	index := make(map[string]int)
+	for _, list := range [][]any{getList(item, "parameters"), getList(op, "parameters")} {
+		for _, raw := range list {
+			param := p.deref(raw)
+			if param == nil {
+				continue
+			}
+			key := getString(param, "in") + ":" + getString(param, "name")
+			if i, exists := index[key]; exists {
+				params[i] = param
+				continue
+			}
+			index[key] = len(params)
+			params = append(params, param)
+		}
+	}
+
+	if p.v2 {
+		p.v2Parameters(operation, op, params)
+		operation.ResponseTypes = stringList(op, "produces")
+		if operation.ResponseTypes == nil {
+			operation.ResponseTypes = stringList(p.root, "produces")
+		}
+	} else {
+		for _, param := range params {
+			operation.Parameters = append(operation.Parameters, p.v3Parameter(param))
+		}
+		if body := p.deref(op["requestBody"]); body != nil {
+			operation.RequestBody = &RequestBody{
+				Required:    getBool(body, "required"),
+				Description: getString(body, "description"),
+				Content:     p.content(getMap(body, "content")),
+			}
+		}
+		operation.ResponseTypes = p.v3ResponseTypes(getMap(op, "responses"))
+	}
+
+	requirements, declared := op["security"].([]any)
+	if !declared {
+		requirements = getList(p.root, "security")
+	}
+	operation.Security = p.security(requirements)
+	return operation
+}
+
+// v2Parameters splits Swagger 2.0 parameters into the request body (body and formData parameters)
+// and the others
+func (p *parser) v2Parameters(operation *Operation, op map[string]any, params []map[string]any) {
+	consumes := stringList(op, "consumes")
+	if consumes == nil {
+		consumes = stringList(p.root, "consumes")
+	}
+
+	var formProperties map[string]any
+	var formRequired []any
+	multipart := false
+	for _, param := range params {
+		switch getString(param, "in") {
+		case "body":
+			types := consumes
+			if len(types) == 0 {
+				types = []string{"application/json"}
+			}
+			schema := p.inline(param["schema"], nil)
+			content := make(map[string]any, len(types))
+			for _, t := range types {
+				content[t] = schema
+			}
+			operation.RequestBody = &RequestBody{
+				Required:    getBool(param, "required"),
+				Description: getString(param, "description"),
+				Content:     content,
+			}
+		case "formData":
+			if formProperties == nil {
+				formProperties = make(map[string]any)
+			}
+			schema := v2Schema(param)
+			if getString(param, "type") == "file" {
+				schema = map[string]any{"type": "string", "format": "binary"}
+				multipart = true
+			}
+			formProperties[getString(param, "name")] = p.inline(schema, nil)
+			if getBool(param, "required") {
+				formRequired = append(formRequired, getString(param, "name"))
+			}
+		default:
+			operation.Parameters = append(operation.Parameters, Parameter{
+				Name:        getString(param, "name"),
+				In:          getString(param, "in"),
+				Required:    getBool(param, "required"),
+				Description: getString(param, "description"),
+				Schema:      p.inline(v2Schema(param), nil),
+			})
+		}
+	}
+
+	if formProperties != nil && operation.RequestBody == nil {
+		mediaType := "application/x-www-form-urlencoded"
+		for _, t := range consumes {
+			if t == "multipart/form-data" {
+				multipart = true
+			}
+		}
+		if multipart {
+			mediaType = "multipart/form-data"
+		}
+		schema := map[string]any{"type": "object", "properties": formProperties}
+		if len(formRequired) > 0 {
+			schema["required"] = formRequired
+		}
+		operation.RequestBody = &RequestBody{
+			Required: len(formRequired) > 0,
+			Content:  map[string]any{mediaType: schema},
+		}
+	}
+}
+
+// v2Schema builds a schema from the type fields Swagger 2.0 puts on non-body parameters
+func v2Schema(param map[string]any) map[string]any {
+	schema := make(map[string]any)
+	for key, value := range param {
+		switch key {
+		case "name", "in", "required", "description", "allowEmptyValue":
+			continue
+		}
+		schema[key] = value
+	}
+	return schema
+}
+
+func (p *parser) v3Parameter(param map[string]any) Parameter {
+	schema := p.inline(param["schema"], nil)
+	if schema == nil {
+		// parameters can describe their value with a single media type instead of a schema
+		content := p.content(getMap(param, "content"))
+		for _, t := range sortedKeys(content) {
+			schema = content[t]
+			break
+		}
+	}
+	return Parameter{
+		Name:        getString(param, "name"),
+		In:          getString(param, "in"),
+		Required:    getBool(param, "required"),
+		Description: getString(param, "description"),
+		Schema:      schema,
+	}
+}
+
+// content maps the media types of an OpenAPI 3 content object to their schemas
+func (p *parser) content(content map[string]any) map[string]any {
+	result := make(map[string]any, len(content))
+	for mediaType, raw := range content {
+		schema := p.inline(getMap(p.deref(raw), "schema"), nil)
+		if schema == nil {
+			schema = map[string]any{}
+		}
+		result[mediaType] = schema
+	}
+	return result
+}
+
+func (p *parser) v3ResponseTypes(responses map[string]any) []string {
+	seen := make(map[string]bool)
+	var types []string
+	for _, raw := range responses {
+		for mediaType := range getMap(p.deref(raw), "content") {
+			if !seen[mediaType] {
+				seen[mediaType] = true
+				types = append(types, mediaType)
+			}
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// security resolves the requirement objects against the declared security schemes
+func (p *parser) security(requirements []any) [][]SecurityScheme {
+	var definitions map[string]any
+	if p.v2 {
+		definitions = getMap(p.root, "securityDefinitions")
+	} else {
+		definitions = getMap(getMap(p.root, "components"), "securitySchemes")
+	}
+
+	if requirements == nil {
+		return nil
+	}
+	result := [][]SecurityScheme{} // an empty list means no authentication
+	for _, raw := range requirements {
+		requirement, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		alternative := []SecurityScheme{}
+		for _, name := range sortedKeys(requirement) {
+			scheme := SecurityScheme{Name: name}
+			for _, scope := range asList(requirement[name]) {
+				if s, ok := scope.(string); ok {
+					scheme.Scopes = append(scheme.Scopes, s)
+				}
+			}
+			definition := p.deref(definitions[name])
+			if definition == nil {
+				p.warn("security scheme '%s' is not defined", name)
+			} else {
+				scheme.Type = getString(definition, "type")
+				scheme.Scheme = getString(definition, "scheme")
+				scheme.In = getString(definition, "in")
+				scheme.ParamName = getString(definition, "name")
+				if scheme.Type == "basic" {
+					scheme.Type = "http"
+					scheme.Scheme = "basic"
+				}
+			}
+			alternative = append(alternative, scheme)
+		}
+		result = append(result, alternative)
+	}
+	return result
+}
+
+// specServers returns the base URLs declared at the top of the spec
+func (p *parser) specServers() []string {
+	if !p.v2 {
+		return p.servers(getList(p.root, "servers"))
+	}
+
+	host := getString(p.root, "host")
+	basePath := getString(p.root, "basePath")
+	schemes := stringList(p.root, "schemes")
+	if host == "" {
+		if basePath == "" {
+			return nil
+		}
+		return []string{basePath}
+	}
+	if len(schemes) == 0 {
+		schemes = []string{"https"}
+	}
+	servers := make([]string, len(schemes))
+	for i, scheme := range schemes {
+		servers[i] = scheme + "://" + host + basePath
+	}
+	return servers
+}
+
+// servers returns the URLs of OpenAPI 3 server objects with their variables set to the defaults
+func (p *parser) servers(list []any) []string {
+	var servers []string
+	for _, raw := range list {
+		server, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		serverURL := getString(server, "url")
+		for name, variable := range getMap(server, "variables") {
+			value := getString(asMap(variable), "default")
+			serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", value)
+		}
+		if serverURL != "" {
+			servers = append(servers, serverURL)
+		}
+	}
+	return servers
+}
+
+// deref follows $ref until it reaches an object, it returns nil for anything else
+func (p *parser) deref(v any) map[string]any {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	ref, ok := m["$ref"].(string)
+	if !ok {
+		return m
+	}
+	target, ok := p.follow(ref)
+	if !ok {
+		return nil
+	}
+	return asMap(target)
+}
+
+// follow resolves a reference and the references its target is an alias for. A chain that comes back
+// to one of its references never reaches a value and fails the parse.
+func (p *parser) follow(ref string) (any, bool) {
+	seen := make(map[string]bool)
+	for {
+		if seen[ref] {
+			p.fail(fmt.Errorf("cyclic reference '%s'", ref))
+			return nil, false
+		}
+		seen[ref] = true
+		target, err := p.lookup(ref)
+		if err != nil {
+			p.warn("%v", err)
+			return nil, false
+		}
+		next, ok := asMap(target)["$ref"].(string)
+		if !ok {
+			return target, true
+		}
+		ref = next
+	}
+}
+
+// inline returns a copy of a schema with its local references replaced by what they point to.
+// A reference to a schema that is already being inlined is kept to stop recursive schemas.
+func (p *parser) inline(v any, stack []string) any {
+	switch value := v.(type) {
+	case map[string]any:
+		if ref, ok := value["$ref"].(string); ok {
+			for _, seen := range stack {
+				if seen == ref {
+					return map[string]any{"$ref": ref}
+				}
+			}
+			target, ok := p.follow(ref)
+			if !ok {
+				return map[string]any{"$ref": ref}
+			}
+			return p.inline(target, append(stack[:len(stack):len(stack)], ref))
+		}
+		result := make(map[string]any, len(value))
+		for key, item := range value {
+			result[key] = p.inline(item, stack)
+		}
+		return result
+	case []any:
+		result := make([]any, len(value))
+		for i, item := range value {
+			result[i] = p.inline(item, stack)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// lookup resolves a local JSON pointer reference such as #/components/schemas/User
+func (p *parser) lookup(ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("external reference '%s' is not supported", ref)
+	}
+	var current any = p.root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("reference '%s' not found", ref)
+		}
+		if current, ok = m[token]; !ok {
+			return nil, fmt.Errorf("reference '%s' not found", ref)
+		}
+	}
+	return current, nil
+}
+
+// decode reads a JSON or YAML document into plain maps and slices
+func decode(data []byte) (map[string]any, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	var root any
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &root); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %v", err)
+		}
+		root = normalize(root)
+	}
+	m, ok := root.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("document is not an object")
+	}
+	return m, nil
+}
+
+// normalize turns the map[any]any YAML uses for non-string keys (such as response codes)
+// into map[string]any so the document can be walked and marshalled as JSON
+func normalize(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = normalize(item)
+		}
+		return value
+	case map[any]any:
+		result := make(map[string]any, len(value))
+		for key, item := range value {
+			result[fmt.Sprint(key)] = normalize(item)
+		}
+		return result
+	case []any:
+		for i, item := range value {
+			value[i] = normalize(item)
+		}
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339)
+	default:
+		return v
+	}
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+func asList(v any) []any {
+	list, _ := v.([]any)
+	return list
+}
+
+func getMap(m map[string]any, key string) map[string]any {
+	return asMap(m[key])
+}
+
+func getList(m map[string]any, key string) []any {
+	return asList(m[key])
+}
+
+func getString(m map[string]any, key string) string {
+	switch value := m[key].(type) {
+	case string:
+		return value
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func getBool(m map[string]any, key string) bool {
+	b, _ := m[key].(bool)
+	return b
+}
+
+// stringList returns nil when the key is missing so callers can fall back to a default
+func stringList(m map[string]any, key string) []string {
+	list, ok := m[key].([]any)
+	if !ok {
+		return nil
+	}
+	result := []string{}
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
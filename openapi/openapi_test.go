@@ -0,0 +1,393 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testV3 = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Users"},
+  "servers": [{"url": "https://{env}.example.com/v1", "variables": {"env": {"default": "api"}}}],
+  "security": [{"bearer": []}],
+  "components": {
+    "securitySchemes": {
+      "bearer": {"type": "http", "scheme": "bearer"},
+      "key": {"type": "apiKey", "in": "header", "name": "X-Api-Key"},
+      "oauth": {"$ref": "#/components/securitySchemes/oauthDefinition"},
+      "oauthDefinition": {"type": "oauth2"}
+    },
+    "parameters": {
+      "Id": {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+      "Limit": {"$ref": "#/components/parameters/LimitDefinition"},
+      "LimitDefinition": {"name": "limit", "in": "query", "schema": {"$ref": "#/components/schemas/Limit"}}
+    },
+    "schemas": {
+      "Limit": {"type": "integer", "maximum": 100},
+      "User": {"type": "object", "properties": {"name": {"type": "string"}, "friend": {"$ref": "#/components/schemas/User"}}}
+    },
+    "requestBodies": {
+      "User": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}
+    }
+  },
+  "paths": {
+    "/users": {
+      "servers": [{"url": "https://users.example.com"}],
+      "get": {
+        "operationId": "listUsers",
+        "tags": ["users"],
+        "parameters": [{"$ref": "#/components/parameters/Limit"}],
+        "responses": {
+          "200": {"content": {"application/json": {}}},
+          "400": {"content": {"application/problem+json": {}, "application/json": {}}}
+        }
+      },
+      "post": {
+        "servers": [{"url": "https://write.example.com"}],
+        "requestBody": {"$ref": "#/components/requestBodies/User"},
+        "security": [],
+        "responses": {"201": {"description": "created"}}
+      }
+    },
+    "/users/{id}": {
+      "summary": "One user",
+      "parameters": [
+        {"$ref": "#/components/parameters/Id"},
+        {"name": "verbose", "in": "query", "schema": {"type": "boolean"}}
+      ],
+      "get": {
+        "deprecated": true,
+        "parameters": [
+          {"name": "verbose", "in": "query", "description": "more fields", "schema": {"type": "string"}},
+          {"name": "verbose", "in": "header", "schema": {"type": "string"}}
+        ],
+        "security": [{"key": [], "oauth": ["read", "write"]}, {"missing": []}]
+      },
+      "delete": {
+        "summary": "Delete a user",
+        "parameters": [{"$ref": "#/components/parameters/Missing"}]
+      }
+    }
+  }
+}`
+
+func TestParseV3(t *testing.T) {
+	spec, err := Parse([]byte(testV3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Version != "3.0.3" || spec.Title != "Users" {
+		t.Errorf("got version %q title %q, want 3.0.3 Users", spec.Version, spec.Title)
+	}
+
+	bearer := [][]SecurityScheme{{{Name: "bearer", Type: "http", Scheme: "bearer"}}}
+	idParam := Parameter{Name: "id", In: "path", Required: true, Schema: map[string]any{"type": "integer"}}
+	want := []*Operation{
+		{
+			Method:        "GET",
+			Path:          "/users",
+			Servers:       []string{"https://users.example.com"},
+			OperationId:   "listUsers",
+			Tags:          []string{"users"},
+			Parameters:    []Parameter{{Name: "limit", In: "query", Schema: map[string]any{"type": "integer", "maximum": float64(100)}}},
+			Security:      bearer,
+			ResponseTypes: []string{"application/json", "application/problem+json"},
+		},
+		{
+			Method:  "POST",
+			Path:    "/users",
+			Servers: []string{"https://write.example.com"},
+			RequestBody: &RequestBody{
+				Required: true,
+				Content: map[string]any{"application/json": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":   map[string]any{"type": "string"},
+						"friend": map[string]any{"$ref": "#/components/schemas/User"}, // recursive schemas keep the reference
+					},
+				}},
+			},
+			Security: [][]SecurityScheme{}, // security: [] turns authentication off
+		},
+		{
+			Method:     "GET",
+			Path:       "/users/{id}",
+			Servers:    []string{"https://api.example.com/v1"},
+			Summary:    "One user",
+			Deprecated: true,
+			Parameters: []Parameter{
+				idParam,
+				{Name: "verbose", In: "query", Description: "more fields", Schema: map[string]any{"type": "string"}},
+				{Name: "verbose", In: "header", Schema: map[string]any{"type": "string"}},
+			},
+			Security: [][]SecurityScheme{
+				{
+					{Name: "key", Type: "apiKey", In: "header", ParamName: "X-Api-Key"},
+					{Name: "oauth", Type: "oauth2", Scopes: []string{"read", "write"}},
+				},
+				{{Name: "missing"}},
+			},
+		},
+		{
+			Method:  "DELETE",
+			Path:    "/users/{id}",
+			Servers: []string{"https://api.example.com/v1"},
+			Summary: "Delete a user",
+			Parameters: []Parameter{
+				idParam,
+				{Name: "verbose", In: "query", Schema: map[string]any{"type": "boolean"}},
+			},
+			Security: bearer,
+		},
+	}
+	compareOperations(t, spec.Operations, want)
+
+	wantWarnings := []string{
+		"security scheme 'missing' is not defined",
+		"reference '#/components/parameters/Missing' not found",
+	}
+	if !reflect.DeepEqual(spec.Warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", spec.Warnings, wantWarnings)
+	}
+}
+
+const testV2 = `swagger: "2.0"
+info:
+  title: Pets
+host: api.example.com
+basePath: /v2
+schemes: [http, https]
+consumes: [application/json]
+produces: [application/json]
+securityDefinitions:
+  basicAuth:
+    type: basic
+  key:
+    type: apiKey
+    in: query
+    name: api_key
+security:
+  - key: []
+definitions:
+  Pet:
+    type: object
+    properties:
+      name:
+        type: string
+paths:
+  /pets:
+    parameters:
+      - name: limit
+        in: query
+        type: integer
+    post:
+      parameters:
+        - name: body
+          in: body
+          required: true
+          schema:
+            $ref: "#/definitions/Pet"
+      security:
+        - basicAuth: []
+      responses:
+        201:
+          description: created
+  /pets/{id}/photo:
+    put:
+      consumes: [application/x-www-form-urlencoded]
+      produces: [image/png]
+      parameters:
+        - name: id
+          in: path
+          required: true
+          type: string
+        - name: caption
+          in: formData
+          type: string
+        - name: file
+          in: formData
+          type: file
+          required: true
+    patch:
+      parameters:
+        - name: note
+          in: formData
+          type: string
+`
+
+func TestParseV2(t *testing.T) {
+	spec, err := Parse([]byte(testV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Version != "2.0" || spec.Title != "Pets" {
+		t.Errorf("got version %q title %q, want 2.0 Pets", spec.Version, spec.Title)
+	}
+
+	servers := []string{"http://api.example.com/v2", "https://api.example.com/v2"}
+	key := [][]SecurityScheme{{{Name: "key", Type: "apiKey", In: "query", ParamName: "api_key"}}}
+	want := []*Operation{
+		{
+			Method:     "POST",
+			Path:       "/pets",
+			Servers:    servers,
+			Parameters: []Parameter{{Name: "limit", In: "query", Schema: map[string]any{"type": "integer"}}},
+			RequestBody: &RequestBody{
+				Required: true,
+				Content: map[string]any{"application/json": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"name": map[string]any{"type": "string"}},
+				}},
+			},
+			Security:      [][]SecurityScheme{{{Name: "basicAuth", Type: "http", Scheme: "basic"}}},
+			ResponseTypes: []string{"application/json"},
+		},
+		{
+			Method:     "PUT",
+			Path:       "/pets/{id}/photo",
+			Servers:    servers,
+			Parameters: []Parameter{{Name: "id", In: "path", Required: true, Schema: map[string]any{"type": "string"}}},
+			RequestBody: &RequestBody{
+				Required: true,
+				Content: map[string]any{"multipart/form-data": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"caption": map[string]any{"type": "string"},
+						"file":    map[string]any{"type": "string", "format": "binary"},
+					},
+					"required": []any{"file"},
+				}},
+			},
+			Security:      key,
+			ResponseTypes: []string{"image/png"},
+		},
+		{
+			Method:  "PATCH",
+			Path:    "/pets/{id}/photo",
+			Servers: servers,
+			RequestBody: &RequestBody{
+				Content: map[string]any{"application/x-www-form-urlencoded": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"note": map[string]any{"type": "string"}},
+				}},
+			},
+			Security:      key,
+			ResponseTypes: []string{"application/json"},
+		},
+	}
+	compareOperations(t, spec.Operations, want)
+	if len(spec.Warnings) > 0 {
+		t.Errorf("got warnings %q, want none", spec.Warnings)
+	}
+}
+
+func TestParseServers(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want []string
+	}{
+		{"v2 host without schemes", `{"swagger": "2.0", "host": "example.com", "basePath": "/api", "paths": {"/a": {"get": {}}}}`, []string{"https://example.com/api"}},
+		{"v2 base path only", `{"swagger": "2.0", "basePath": "/api", "paths": {"/a": {"get": {}}}}`, []string{"/api"}},
+		{"v2 no host", `{"swagger": "2.0", "paths": {"/a": {"get": {}}}}`, nil},
+		{"v3 no servers", `{"openapi": "3.1.0", "paths": {"/a": {"get": {}}}}`, nil},
+		{"v3 several servers", `{"openapi": "3.1.0", "servers": [{"url": "https://a.example.com"}, {"url": ""}, {"url": "/relative"}], "paths": {"/a": {"get": {}}}}`, []string{"https://a.example.com", "/relative"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := Parse([]byte(tt.spec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(spec.Operations) != 1 {
+				t.Fatalf("got %d operations, want 1", len(spec.Operations))
+			}
+			if got := spec.Operations[0].Servers; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got servers %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"invalid JSON", `{"openapi": `, "invalid JSON"},
+		{"invalid YAML", "openapi: [3.0", "invalid YAML"},
+		{"not an object", "- a\n- b", "document is not an object"},
+		{"no version", `{"info": {"title": "x"}, "paths": {}}`, "missing openapi or swagger field"},
+		{
+			name: "cyclic parameter reference",
+			spec: `{"openapi": "3.0.0", "components": {"parameters": {
+				"A": {"$ref": "#/components/parameters/B"},
+				"B": {"$ref": "#/components/parameters/A"}}},
+				"paths": {"/a": {"get": {"parameters": [{"$ref": "#/components/parameters/A"}]}}}}`,
+			want: "cyclic reference '#/components/parameters/A'",
+		},
+		{
+			name: "self referencing path item",
+			spec: `{"openapi": "3.0.0", "paths": {"/a": {"$ref": "#/paths/~1a"}}}`,
+			want: "cyclic reference '#/paths/~1a'",
+		},
+		{
+			name: "cyclic schema alias",
+			spec: `{"openapi": "3.0.0", "components": {"schemas": {
+				"A": {"$ref": "#/components/schemas/B"},
+				"B": {"$ref": "#/components/schemas/C"},
+				"C": {"$ref": "#/components/schemas/A"}}},
+				"paths": {"/a": {"post": {"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/B"}}}}}}}}`,
+			want: "cyclic reference '#/components/schemas/B'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.spec))
+			if err == nil {
+				t.Fatalf("got no error, want %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReferenceWarnings(t *testing.T) {
+	spec, err := Parse([]byte(`{"openapi": "3.0.0", "paths": {"/a": {"post": {
+		"parameters": [{"$ref": "other.yaml#/components/parameters/A"}],
+		"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Missing"}}}}}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantWarnings := []string{
+		"external reference 'other.yaml#/components/parameters/A' is not supported",
+		"reference '#/components/schemas/Missing' not found",
+	}
+	if !reflect.DeepEqual(spec.Warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", spec.Warnings, wantWarnings)
+	}
+	// unresolved schemas keep their reference
+	body := spec.Operations[0].RequestBody
+	want := map[string]any{"application/json": map[string]any{"$ref": "#/components/schemas/Missing"}}
+	if body == nil || !reflect.DeepEqual(body.Content, want) {
+		t.Errorf("got request body %+v, want content %v", body, want)
+	}
+}
+
+func compareOperations(t *testing.T, got, want []*Operation) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d operations, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("operation %d (%s %s):\n got %+v\nwant %+v", i, want[i].Method, want[i].Path, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package pathnorm
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Rule replaces a whole path segment with a placeholder when it matches
+type Rule struct {
+	Name        string
+	Placeholder string
+	Match       func(segment string) bool
+}
+
+// CustomPattern is a user supplied regular expression matched against whole path segments
+type CustomPattern struct {
+	Pattern     string
+	Placeholder string
+}
+
+var (
+	uuidRegex  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	intRegex   = regexp.MustCompile(`^[0-9]+$`)
+	dateRegex  = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}([T ][0-9]{2}:[0-9]{2}(:[0-9]{2}(\.[0-9]+)?)?(Z|[+-][0-9]{2}:?[0-9]{2})?)?$`)
+	emailRegex = regexp.MustCompile(`^[^@\s/]+@[^@\s/]+\.[^@\s/]+$`)
+	hexRegex   = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	tokenRegex = regexp.MustCompile(`^[A-Za-z0-9_\-+=.~]{20,}$`)
+	digitRegex = regexp.MustCompile(`[0-9]`)
+	alphaRegex = regexp.MustCompile(`[A-Za-z]`)
+)
+
+// DefaultRules detect the usual variable segments of REST APIs, in the order they are tried
+var DefaultRules = []Rule{
+	{Name: "uuid", Placeholder: "{uuid}", Match: uuidRegex.MatchString},
+	{Name: "int", Placeholder: "{id}", Match: intRegex.MatchString},
+	{Name: "date", Placeholder: "{date}", Match: dateRegex.MatchString},
+	{Name: "email", Placeholder: "{email}", Match: emailRegex.MatchString},
+	{Name: "hex", Placeholder: "{hash}", Match: func(s string) bool {
+		return hexRegex.MatchString(s) && digitRegex.MatchString(s)
+	}},
+	// long mixed tokens such as base64 ids, JWTs or session keys, plain words never contain digits
+	{Name: "token", Placeholder: "{token}", Match: func(s string) bool {
+		return tokenRegex.MatchString(s) && digitRegex.MatchString(s) && alphaRegex.MatchString(s)
+	}},
+}
+
+// Normalizer turns concrete paths like /users/123 into templates like /users/{id}
+type Normalizer struct {
+	rules []Rule
+}
+
+// New creates a normalizer that tries the custom patterns first and then the default rules
+func New(custom ...CustomPattern) (*Normalizer, error) {
+	rules := make([]Rule, 0, len(custom)+len(DefaultRules))
+	for _, c := range custom {
+		re, err := regexp.Compile("^(?:" + c.Pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %v", c.Pattern, err)
+		}
+		rules = append(rules, Rule{
+			Name:        c.Pattern,
+			Placeholder: Placeholder(c.Placeholder),
+			Match:       re.MatchString,
+		})
+	}
+	rules = append(rules, DefaultRules...)
+	return &Normalizer{rules: rules}, nil
+}
+
+// Default returns a normalizer using only the default rules
+func Default() *Normalizer {
+	return &Normalizer{rules: DefaultRules}
+}
+
+// Placeholder wraps a name in braces unless it already has them
+func Placeholder(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}") {
+		return name
+	}
+	return "{" + name + "}"
+}
+
+// Normalize replaces every variable segment of the path with its placeholder
+func (n *Normalizer) Normalize(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = n.segment(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (n *Normalizer) segment(segment string) string {
+	if segment == "" || IsPlaceholder(segment) {
+		return segment
+	}
+	decoded, err := url.PathUnescape(segment)
+	if err != nil {
+		decoded = segment
+	}
+	for _, rule := range n.rules {
+		if rule.Match(decoded) {
+			return rule.Placeholder
+		}
+	}
+	return segment
+}
+
+// IsPlaceholder reports whether a path segment is already a template placeholder
+func IsPlaceholder(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+var templateParamRegex = regexp.MustCompile(`\{[^{}/]+\}`)
+
+// Template matches concrete paths against a path template such as /users/{userId}/posts,
+// every placeholder matches any text within its segment
+type Template struct {
+	regex    *regexp.Regexp
+	literals int
+}
+
+// CompileTemplate builds a template from a templated path
+func CompileTemplate(path string) *Template {
+	segments := strings.Split(path, "/")
+	literals := 0
+	for i, segment := range segments {
+		params := templateParamRegex.FindAllStringIndex(segment, -1)
+		if len(params) == 0 {
+			if segment != "" {
+				literals++
+			}
+			segments[i] = regexp.QuoteMeta(segment)
+			continue
+		}
+		var pattern strings.Builder
+		last := 0
+		for _, param := range params {
+			pattern.WriteString(regexp.QuoteMeta(segment[last:param[0]]))
+			pattern.WriteString(`[^/]+`)
+			last = param[1]
+		}
+		pattern.WriteString(regexp.QuoteMeta(segment[last:]))
+		segments[i] = pattern.String()
+	}
+	return &Template{
+		regex:    regexp.MustCompile("^" + strings.Join(segments, "/") + "$"),
+		literals: literals,
+	}
+}
+
+// Match reports whether a concrete path fits the template
+func (t *Template) Match(path string) bool {
+	return t.regex.MatchString(path)
+}
+
+// Literals is the number of segments without placeholders, more literals means a more specific template
+func (t *Template) Literals() int {
+	return t.literals
+}
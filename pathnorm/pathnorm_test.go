@@ -0,0 +1,111 @@
+package pathnorm
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/users", "/users"},
+		{"/users/123", "/users/{id}"},
+		{"/users/123/", "/users/{id}/"},
+		{"/users/123/posts/456", "/users/{id}/posts/{id}"},
+		{"/v1/users", "/v1/users"},
+		{"/items/550e8400-e29b-41d4-a716-446655440000", "/items/{uuid}"},
+		{"/items/550E8400-E29B-41D4-A716-446655440000", "/items/{uuid}"},
+		{"/reports/2024-01-31", "/reports/{date}"},
+		{"/reports/2024-01-31T10:20:30Z", "/reports/{date}"},
+		{"/reports/2024-01-31T10:20:30.123+07:00", "/reports/{date}"},
+		{"/users/a@example.com", "/users/{email}"},
+		{"/users/a%40example.com", "/users/{email}"},
+		{"/files/d41d8cd98f00b204e9800998ecf8427e", "/files/{hash}"},
+		{"/files/abcdefabcdefabcdef", "/files/abcdefabcdefabcdef"}, // hex letters only is a word
+		{"/s/eyJhbGciOiJIUzI1NiJ9", "/s/{token}"},
+		{"/docs/getting-started-with-the-api", "/docs/getting-started-with-the-api"},
+		{"/users/{id}/posts/7", "/users/{id}/posts/{id}"},
+		{"/users/%zz", "/users/%zz"}, // invalid escapes are kept
+		{"/a/12b", "/a/12b"},
+	}
+	normalizer := Default()
+	for _, tt := range tests {
+		if got := normalizer.Normalize(tt.path); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNewCustomPatterns(t *testing.T) {
+	normalizer, err := New(
+		CustomPattern{Pattern: `[a-z]{2}-[A-Z]{2}`, Placeholder: "locale"},
+		CustomPattern{Pattern: `v[0-9]+`, Placeholder: "{version}"},
+		CustomPattern{Pattern: `[0-9]{4}`, Placeholder: " year "},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/en-US/docs", "/{locale}/docs"},
+		{"/api/v2/users/15", "/api/{version}/users/{id}"},
+		{"/archive/2024/12345", "/archive/{year}/{id}"}, // custom patterns come before the defaults
+		{"/xen-USx", "/xen-USx"},                        // patterns match whole segments
+	}
+	for _, tt := range tests {
+		if got := normalizer.Normalize(tt.path); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := New(CustomPattern{Pattern: `(`, Placeholder: "x"}); err == nil {
+		t.Error("New with an invalid pattern: got no error")
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		want     bool
+	}{
+		{"/users/{id}", "/users/123", true},
+		{"/users/{id}", "/users/me", true},
+		{"/users/{id}", "/users/", false},
+		{"/users/{id}", "/users/1/posts", false},
+		{"/users/{id}/posts/{postId}", "/users/1/posts/2", true},
+		{"/files/{name}.{ext}", "/files/report.pdf", true},
+		{"/files/{name}.{ext}", "/files/report", false},
+		{"/v1.0/users", "/v1x0/users", false}, // literals are not regular expressions
+		{"/users", "/users", true},
+		{"/users", "/Users", false},
+	}
+	for _, tt := range tests {
+		if got := CompileTemplate(tt.template).Match(tt.path); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.template, tt.path, got, tt.want)
+		}
+	}
+
+	if got := CompileTemplate("/users/{id}/posts").Literals(); got != 2 {
+		t.Errorf("got %d literals, want 2", got)
+	}
+	if got := CompileTemplate("/users/me").Literals(); got != 2 {
+		t.Errorf("got %d literals, want 2", got)
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"id", "{id}"},
+		{"{id}", "{id}"},
+		{" id ", "{id}"},
+	}
+	for _, tt := range tests {
+		if got := Placeholder(tt.name); got != tt.want {
+			t.Errorf("Placeholder(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
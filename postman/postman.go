@@ -0,0 +1,470 @@
+// Package postman reads Postman Collection v2.1 files into requests, resolving folders,
+// collection variables and inherited auth
+package postman
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+type Collection struct {
+	Info struct {
+		Name   string `json:"name"`
+		Schema string `json:"schema"`
+	} `json:"info"`
+	Item     []Item     `json:"item"`
+	Variable []Variable `json:"variable"`
+	Auth     *Auth      `json:"auth"`
+}
+
+// Item is either a folder (Item is set) or a request
+type Item struct {
+	Name        string          `json:"name"`
+	Description json.RawMessage `json:"description"`
+	Item        []Item          `json:"item"`
+	Request     *ItemRequest    `json:"request"`
+	Variable    []Variable      `json:"variable"`
+	Auth        *Auth           `json:"auth"`
+}
+
+type ItemRequest struct {
+	Method      string          `json:"method"`
+	Header      []KeyValue      `json:"header"`
+	URL         json.RawMessage `json:"url"` // a string or a URL object
+	Body        *Body           `json:"body"`
+	Auth        *Auth           `json:"auth"`
+	Description json.RawMessage `json:"description"`
+}
+
+type URL struct {
+	Raw      string     `json:"raw"`
+	Protocol string     `json:"protocol"`
+	Host     any        `json:"host"` // a string or a list of labels
+	Port     string     `json:"port"`
+	Path     any        `json:"path"` // a string or a list of segments
+	Query    []KeyValue `json:"query"`
+	Variable []KeyValue `json:"variable"`
+}
+
+type Body struct {
+	Mode       string     `json:"mode"`
+	Raw        string     `json:"raw"`
+	URLEncoded []KeyValue `json:"urlencoded"`
+	FormData   []KeyValue `json:"formdata"`
+	GraphQL    *struct {
+		Query     string `json:"query"`
+		Variables string `json:"variables"`
+	} `json:"graphql"`
+	Options struct {
+		Raw struct {
+			Language string `json:"language"`
+		} `json:"raw"`
+	} `json:"options"`
+	Disabled bool `json:"disabled"`
+}
+
+type KeyValue struct {
+	Key      string `json:"key"`
+	Value    any    `json:"value"`
+	Type     string `json:"type"`
+	Src      any    `json:"src"`
+	Disabled bool   `json:"disabled"`
+}
+
+type Variable struct {
+	Key      string `json:"key"`
+	Value    any    `json:"value"`
+	Disabled bool   `json:"disabled"`
+}
+
+// Auth is an auth block, the parameters of each type are a list of key/values in v2.1
+// and an object in v2.0
+type Auth struct {
+	Type   string          `json:"type"`
+	Basic  json.RawMessage `json:"basic"`
+	Bearer json.RawMessage `json:"bearer"`
+	APIKey json.RawMessage `json:"apikey"`
+	OAuth2 json.RawMessage `json:"oauth2"`
+}
+
+// Request is a request of a collection with variables and auth resolved
+type Request struct {
+	Name        string // folder path and item name
+	Description string
+	Method      string
+	URL         string
+	Headers     []models.Header
+	Body        string
+	Warnings    []string
+}
+
+// Parse reads a collection and returns its requests in order
+func Parse(data []byte) ([]*Request, error) {
+	var collection Collection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, err
+	}
+	if collection.Info.Schema != "" && !strings.Contains(collection.Info.Schema, "v2.") {
+		return nil, fmt.Errorf("unsupported collection schema '%s', export as Collection v2.1", collection.Info.Schema)
+	}
+
+	variables := map[string]string{}
+	addVariables(variables, collection.Variable)
+
+	var requests []*Request
+	var walk func(items []Item, path []string, auth *Auth, variables map[string]string)
+	walk = func(items []Item, path []string, auth *Auth, variables map[string]string) {
+		for _, item := range items {
+			itemVariables := variables
+			if len(item.Variable) > 0 {
+				itemVariables = make(map[string]string, len(variables))
+				for k, v := range variables {
+					itemVariables[k] = v
+				}
+				addVariables(itemVariables, item.Variable)
+			}
+			itemAuth := auth
+			if item.Auth != nil && item.Auth.Type != "inherit" {
+				itemAuth = item.Auth
+			}
+
+			if item.Request == nil {
+				walk(item.Item, append(path[:len(path):len(path)], item.Name), itemAuth, itemVariables)
+				continue
+			}
+			if item.Request.Auth != nil && item.Request.Auth.Type != "inherit" {
+				itemAuth = item.Request.Auth
+			}
+			req := buildRequest(item, itemAuth, itemVariables)
+			req.Name = strings.Join(append(path, item.Name), " / ")
+			requests = append(requests, req)
+		}
+	}
+	walk(collection.Item, nil, collection.Auth, variables)
+	return requests, nil
+}
+
+func addVariables(variables map[string]string, list []Variable) {
+	for _, v := range list {
+		if !v.Disabled && v.Key != "" {
+			variables[v.Key] = valueString(v.Value)
+		}
+	}
+}
+
+var variablePattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// resolver substitutes {{variables}} and remembers the ones it could not resolve
+type resolver struct {
+	variables  map[string]string
+	unresolved map[string]bool
+}
+
+func (r *resolver) resolve(s string) string {
+	// variables may refer to other variables, resolve a few levels deep
+	for range 5 {
+		if !variablePattern.MatchString(s) {
+			break
+		}
+		s = variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+			name := variablePattern.FindStringSubmatch(match)[1]
+			if value, ok := r.variables[name]; ok {
+				return value
+			}
+			return match
+		})
+	}
+	for _, m := range variablePattern.FindAllStringSubmatch(s, -1) {
+		// dynamic variables like {{$guid}} are generated by Postman at send time
+		if !strings.HasPrefix(m[1], "$") {
+			r.unresolved[m[1]] = true
+		}
+	}
+	return s
+}
+
+func buildRequest(item Item, auth *Auth, variables map[string]string) *Request {
+	r := &resolver{variables: variables, unresolved: map[string]bool{}}
+	src := item.Request
+	req := &Request{
+		Method:      strings.ToUpper(r.resolve(src.Method)),
+		Description: description(src.Description),
+	}
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+	if req.Description == "" {
+		req.Description = description(item.Description)
+	}
+
+	req.URL = r.resolve(buildURL(src.URL, r))
+	for _, h := range src.Header {
+		if !h.Disabled {
+			req.Headers = append(req.Headers, models.Header{Name: r.resolve(h.Key), Value: r.resolve(valueString(h.Value))})
+		}
+	}
+
+	if src.Body != nil && !src.Body.Disabled {
+		req.Body, req.Headers = buildBody(src.Body, req.Headers, r)
+	}
+
+	if auth != nil {
+		var warning string
+		req.URL, req.Headers, warning = applyAuth(auth, req.URL, req.Headers, r)
+		if warning != "" {
+			req.Warnings = append(req.Warnings, warning)
+		}
+	}
+
+	for name := range r.unresolved {
+		req.Warnings = append(req.Warnings, fmt.Sprintf("unresolved variable {{%s}}", name))
+	}
+	return req
+}
+
+// pathVariablePattern matches Postman path variables like :id
+var pathVariablePattern = regexp.MustCompile(`^:([A-Za-z_][A-Za-z0-9_]*)$`)
+
+func buildURL(raw json.RawMessage, r *resolver) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var u URL
+	if json.Unmarshal(raw, &u) != nil {
+		return ""
+	}
+
+	pathValues := map[string]string{}
+	for _, v := range u.Variable {
+		if value := valueString(v.Value); value != "" {
+			pathValues[v.Key] = value
+		}
+	}
+
+	// the URL object is preferred over raw since it has the path variable and disabled query information
+	host := joinAny(u.Host, ".")
+	if host == "" {
+		return u.Raw
+	}
+	var b strings.Builder
+	if u.Protocol != "" {
+		b.WriteString(u.Protocol + "://")
+	}
+	b.WriteString(host)
+	if u.Port != "" {
+		b.WriteString(":" + u.Port)
+	}
+
+	segments := toStrings(u.Path)
+	for _, segment := range segments {
+		if m := pathVariablePattern.FindStringSubmatch(segment); m != nil {
+			if value, ok := pathValues[m[1]]; ok {
+				segment = value
+			} else {
+				// unresolved path variables become endpoint placeholders
+				segment = "{" + m[1] + "}"
+			}
+		}
+		b.WriteString("/" + segment)
+	}
+	if len(segments) == 0 {
+		b.WriteString("/")
+	}
+
+	var query []string
+	for _, q := range u.Query {
+		if q.Disabled {
+			continue
+		}
+		if q.Value == nil {
+			query = append(query, r.resolve(q.Key))
+		} else {
+			query = append(query, r.resolve(q.Key)+"="+r.resolve(valueString(q.Value)))
+		}
+	}
+	if len(query) > 0 {
+		b.WriteString("?" + strings.Join(query, "&"))
+	}
+
+	s = b.String()
+	if !strings.Contains(r.resolve(s), "://") {
+		s = "http://" + s // Postman's default scheme
+	}
+	return s
+}
+
+func buildBody(body *Body, headers []models.Header, r *resolver) (string, []models.Header) {
+	switch body.Mode {
+	case "raw":
+		if body.Options.Raw.Language == "json" {
+			headers = setDefaultHeader(headers, "Content-Type", "application/json")
+		}
+		return r.resolve(body.Raw), headers
+	case "urlencoded":
+		values := url.Values{}
+		var keys []string
+		for _, kv := range body.URLEncoded {
+			if !kv.Disabled {
+				key := r.resolve(kv.Key)
+				if _, exists := values[key]; !exists {
+					keys = append(keys, key)
+				}
+				values.Add(key, r.resolve(valueString(kv.Value)))
+			}
+		}
+		var parts []string
+		for _, key := range keys {
+			for _, value := range values[key] {
+				parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+			}
+		}
+		return strings.Join(parts, "&"), setDefaultHeader(headers, "Content-Type", "application/x-www-form-urlencoded")
+	case "formdata":
+		var lines []string
+		for _, kv := range body.FormData {
+			if kv.Disabled {
+				continue
+			}
+			if kv.Type == "file" {
+				lines = append(lines, fmt.Sprintf("%s=@%s", r.resolve(kv.Key), valueString(kv.Src)))
+			} else {
+				lines = append(lines, r.resolve(kv.Key)+"="+r.resolve(valueString(kv.Value)))
+			}
+		}
+		return strings.Join(lines, "\n"), setDefaultHeader(headers, "Content-Type", "multipart/form-data")
+	case "graphql":
+		if body.GraphQL == nil {
+			return "", headers
+		}
+		payload := map[string]any{"query": r.resolve(body.GraphQL.Query)}
+		if variables := strings.TrimSpace(r.resolve(body.GraphQL.Variables)); variables != "" {
+			payload["variables"] = json.RawMessage(variables)
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			// variables that aren't valid JSON are kept as a string
+			payload["variables"] = r.resolve(body.GraphQL.Variables)
+			data, _ = json.Marshal(payload)
+		}
+		return string(data), setDefaultHeader(headers, "Content-Type", "application/json")
+	}
+	return "", headers
+}
+
+// applyAuth adds the credentials of an auth block to the request
+func applyAuth(auth *Auth, rawURL string, headers []models.Header, r *resolver) (string, []models.Header, string) {
+	switch auth.Type {
+	case "", "noauth":
+	case "basic":
+		params := authParams(auth.Basic, r)
+		credentials := base64.StdEncoding.EncodeToString([]byte(params["username"] + ":" + params["password"]))
+		headers = setDefaultHeader(headers, "Authorization", "Basic "+credentials)
+	case "bearer":
+		headers = setDefaultHeader(headers, "Authorization", "Bearer "+authParams(auth.Bearer, r)["token"])
+	case "oauth2":
+		if token := authParams(auth.OAuth2, r)["accessToken"]; token != "" {
+			headers = setDefaultHeader(headers, "Authorization", "Bearer "+token)
+		}
+	case "apikey":
+		params := authParams(auth.APIKey, r)
+		if params["in"] == "query" {
+			separator := "?"
+			if strings.Contains(rawURL, "?") {
+				separator = "&"
+			}
+			rawURL += separator + url.QueryEscape(params["key"]) + "=" + url.QueryEscape(params["value"])
+		} else {
+			headers = setDefaultHeader(headers, params["key"], params["value"])
+		}
+	default:
+		return rawURL, headers, fmt.Sprintf("%s auth is not supported", auth.Type)
+	}
+	return rawURL, headers, ""
+}
+
+// authParams reads the parameters of an auth type, either a v2.1 list or a v2.0 object
+func authParams(raw json.RawMessage, r *resolver) map[string]string {
+	params := map[string]string{}
+	var list []KeyValue
+	if json.Unmarshal(raw, &list) == nil {
+		for _, kv := range list {
+			params[kv.Key] = r.resolve(valueString(kv.Value))
+		}
+		return params
+	}
+	var object map[string]any
+	if json.Unmarshal(raw, &object) == nil {
+		for k, v := range object {
+			params[k] = r.resolve(valueString(v))
+		}
+	}
+	return params
+}
+
+func setDefaultHeader(headers []models.Header, name, value string) []models.Header {
+	if name == "" {
+		return headers
+	}
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return headers
+		}
+	}
+	return append(headers, models.Header{Name: name, Value: value})
+}
+
+// description reads a description, either a string or an object with content
+func description(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var object struct {
+		Content string `json:"content"`
+	}
+	json.Unmarshal(raw, &object)
+	return object.Content
+}
+
+func valueString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool, float64:
+		return fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func toStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Split(strings.Trim(v, "/"), "/")
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func joinAny(v any, separator string) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return strings.Join(toStrings(v), separator)
+}
@@ -0,0 +1,258 @@
+package postman
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+const testCollection = `{
+  "info": {"name": "API", "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},
+  "variable": [
+    {"key": "baseUrl", "value": "https://api.example.com"},
+    {"key": "token", "value": "t0k"},
+    {"key": "major", "value": 2},
+    {"key": "version", "value": "v{{major}}"},
+    {"key": "unused", "value": "x", "disabled": true}
+  ],
+  "auth": {"type": "bearer", "bearer": [{"key": "token", "value": "{{token}}", "type": "string"}]},
+  "item": [
+    {
+      "name": "List users",
+      "description": "All users",
+      "request": {
+        "method": "GET",
+        "header": [
+          {"key": "Accept", "value": "application/json"},
+          {"key": "X-Debug", "value": "1", "disabled": true}
+        ],
+        "url": "{{baseUrl}}/users?page=1"
+      }
+    },
+    {
+      "name": "Admin",
+      "variable": [{"key": "pw", "value": "secret"}],
+      "auth": {"type": "basic", "basic": {"username": "admin", "password": "{{pw}}"}},
+      "item": [
+        {
+          "name": "Get user",
+          "request": {
+            "method": "get",
+            "description": {"content": "Fetch one user", "type": "text/plain"},
+            "url": {
+              "raw": "https://api.example.com/{{version}}/users/:id/:other?fields=name&debug=1&flag",
+              "protocol": "https",
+              "host": ["api", "example", "com"],
+              "path": ["{{version}}", "users", ":id", ":other"],
+              "query": [
+                {"key": "fields", "value": "name"},
+                {"key": "debug", "value": "1", "disabled": true},
+                {"key": "flag", "value": null}
+              ],
+              "variable": [{"key": "id", "value": "7"}]
+            }
+          }
+        },
+        {
+          "name": "Create user",
+          "request": {
+            "method": "POST",
+            "auth": {"type": "inherit"},
+            "url": "{{baseUrl}}/users",
+            "body": {"mode": "raw", "raw": "{\"name\":\"{{name}}\"}", "options": {"raw": {"language": "json"}}}
+          }
+        }
+      ]
+    },
+    {
+      "name": "Login",
+      "request": {
+        "method": "POST",
+        "auth": {"type": "noauth"},
+        "url": {"host": "example.com", "path": "/login"},
+        "body": {
+          "mode": "urlencoded",
+          "urlencoded": [
+            {"key": "user", "value": "a b"},
+            {"key": "pass", "value": "p&q"},
+            {"key": "user", "value": "c"},
+            {"key": "remember", "value": "1", "disabled": true}
+          ]
+        }
+      }
+    },
+    {
+      "name": "Upload",
+      "request": {
+        "method": "POST",
+        "auth": {"type": "apikey", "apikey": [{"key": "in", "value": "query"}, {"key": "key", "value": "api_key"}, {"key": "value", "value": "k 1"}]},
+        "url": "{{baseUrl}}/upload?x=1",
+        "body": {
+          "mode": "formdata",
+          "formdata": [
+            {"key": "note", "value": "hi", "type": "text"},
+            {"key": "file", "src": "/tmp/a.png", "type": "file"},
+            {"key": "skip", "value": "no", "type": "text", "disabled": true}
+          ]
+        }
+      }
+    },
+    {
+      "name": "GraphQL",
+      "request": {
+        "method": "POST",
+        "header": [{"key": "X-Request-Id", "value": "{{$guid}}"}],
+        "url": "{{baseUrl}}/graphql",
+        "body": {"mode": "graphql", "graphql": {"query": "{ me { id } }", "variables": "{\"a\": 1}"}}
+      }
+    },
+    {
+      "name": "Header API key",
+      "request": {
+        "auth": {"type": "apikey", "apikey": {"key": "X-Api-Key", "value": "abc"}},
+        "url": "{{baseUrl}}/keyed"
+      }
+    },
+    {
+      "name": "Digest",
+      "request": {
+        "auth": {"type": "digest", "digest": [{"key": "username", "value": "u"}]},
+        "url": "{{baseUrl}}/digest"
+      }
+    }
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	requests, err := Parse([]byte(testCollection))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bearer := models.Header{Name: "Authorization", Value: "Bearer t0k"}
+	basic := models.Header{Name: "Authorization", Value: "Basic YWRtaW46c2VjcmV0"} // admin:secret
+	want := []*Request{
+		{
+			Name:        "List users",
+			Description: "All users",
+			Method:      "GET",
+			URL:         "https://api.example.com/users?page=1",
+			Headers:     []models.Header{{Name: "Accept", Value: "application/json"}, bearer},
+		},
+		{
+			Name:        "Admin / Get user",
+			Description: "Fetch one user",
+			Method:      "GET",
+			URL:         "https://api.example.com/v2/users/7/{other}?fields=name&flag",
+			Headers:     []models.Header{basic},
+		},
+		{
+			Name:     "Admin / Create user",
+			Method:   "POST",
+			URL:      "https://api.example.com/users",
+			Headers:  []models.Header{{Name: "Content-Type", Value: "application/json"}, basic},
+			Body:     `{"name":"{{name}}"}`,
+			Warnings: []string{"unresolved variable {{name}}"},
+		},
+		{
+			Name:    "Login",
+			Method:  "POST",
+			URL:     "http://example.com/login",
+			Headers: []models.Header{{Name: "Content-Type", Value: "application/x-www-form-urlencoded"}},
+			Body:    "user=a+b&user=c&pass=p%26q",
+		},
+		{
+			Name:    "Upload",
+			Method:  "POST",
+			URL:     "https://api.example.com/upload?x=1&api_key=k+1",
+			Headers: []models.Header{{Name: "Content-Type", Value: "multipart/form-data"}},
+			Body:    "note=hi\nfile=@/tmp/a.png",
+		},
+		{
+			Name:    "GraphQL",
+			Method:  "POST",
+			URL:     "https://api.example.com/graphql",
+			Headers: []models.Header{{Name: "X-Request-Id", Value: "{{$guid}}"}, {Name: "Content-Type", Value: "application/json"}, bearer},
+			Body:    `{"query":"{ me { id } }","variables":{"a":1}}`,
+		},
+		{
+			Name:    "Header API key",
+			Method:  "GET",
+			URL:     "https://api.example.com/keyed",
+			Headers: []models.Header{{Name: "X-Api-Key", Value: "abc"}},
+		},
+		{
+			Name:     "Digest",
+			Method:   "GET",
+			URL:      "https://api.example.com/digest",
+			Warnings: []string{"digest auth is not supported"},
+		},
+	}
+
+	if len(requests) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(requests), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(requests[i], want[i]) {
+			t.Errorf("request %d:\n got %+v\nwant %+v", i, requests[i], want[i])
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"string", `"https://example.com/a?b=1"`, "https://example.com/a?b=1"},
+		{"object without host uses raw", `{"raw": "https://example.com/raw"}`, "https://example.com/raw"},
+		{"host string and port", `{"protocol": "http", "host": "localhost", "port": "8080", "path": ["api", "items"]}`, "http://localhost:8080/api/items"},
+		{"no path", `{"protocol": "https", "host": ["example", "com"]}`, "https://example.com/"},
+		{"host variable with scheme", `{"host": ["{{baseUrl}}"], "path": ["a"]}`, "https://example.com/a"},
+		{"unknown path variable", `{"host": "example.com", "path": [":id"], "variable": [{"key": "id", "value": ""}]}`, "http://example.com/{id}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{"info": {"schema": "v2.1.0"}, "variable": [{"key": "baseUrl", "value": "https://example.com"}],
+				"item": [{"name": "r", "request": {"method": "GET", "url": ` + tt.url + `}}]}`
+			requests, err := Parse([]byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			if requests[0].URL != tt.want {
+				t.Errorf("got URL %q, want %q", requests[0].URL, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"invalid JSON", `{"info": `, "unexpected end of JSON input"},
+		{"not an object", `[1, 2]`, "cannot unmarshal array"},
+		{"collection v1", `{"info": {"schema": "https://schema.getpostman.com/json/collection/v1.0.0/collection.json"}}`, "unsupported collection schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if err == nil {
+				t.Fatalf("got no error, want %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
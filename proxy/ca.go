@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// CA is the local certificate authority the proxy signs per-host certificates with.
+// Clients have to trust its certificate for HTTPS interception to work.
+type CA struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM []byte
+
+	leafKey *ecdsa.PrivateKey // shared by every host certificate, generating one per host is slow
+
+	mu    sync.Mutex
+	cache map[string]*tls.Certificate
+}
+
+// NewCA generates a new certificate authority in memory
+func NewCA() (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "RequesterBackend Proxy CA", Organization: []string{"RequesterBackend"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return newCA(der, key)
+}
+
+// LoadOrCreateCA reads the CA from PEM files, generating and saving a new one when they don't exist
+func LoadOrCreateCA(certFile, keyFile string) (*CA, error) {
+	certPEM, certErr := os.ReadFile(certFile)
+	keyPEM, keyErr := os.ReadFile(keyFile)
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		ca, err := NewCA()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate CA: %v", err)
+		}
+		keyDER, err := x509.MarshalPKCS8PrivateKey(ca.key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save CA key: %v", err)
+		}
+		if err := os.WriteFile(certFile, ca.certPEM, 0644); err != nil {
+			return nil, fmt.Errorf("failed to save CA certificate: %v", err)
+		}
+		return ca, nil
+	}
+	if certErr != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %v", certErr)
+	}
+	if keyErr != nil {
+		return nil, fmt.Errorf("failed to read CA key: %v", keyErr)
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA files: %v", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type")
+	}
+	return newCA(pair.Certificate[0], key)
+}
+
+func newCA(der []byte, key crypto.Signer) (*CA, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate is not a CA")
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		leafKey: leafKey,
+		cache:   make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// Certificate returns the CA certificate
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// CertPEM returns the CA certificate in PEM form, for clients to install
+func (ca *CA) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// CertFor returns a certificate for a host name or IP address signed by the CA
+func (ca *CA) CertFor(host string) (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert, ok := ca.cache[host]; ok && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, ca.leafKey.Public(), ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate for %s: %v", host, err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  ca.leafKey,
+		Leaf:        leaf,
+	}
+	ca.cache[host] = cert
+	return cert, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
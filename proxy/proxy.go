@@ -0,0 +1,358 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBodySize is how much of each request and response body is kept for recording
+const DefaultMaxBodySize = 10 << 20
+
+// Exchange is a request forwarded by the proxy together with the response it got
+type Exchange struct {
+	Request      *http.Request // as sent upstream, URL is absolute
+	RequestBody  []byte
+	Response     *http.Response // nil when Err is set
+	ResponseBody []byte         // as received, still content-encoded
+	Truncated    bool           // a body was larger than MaxBodySize
+	Started      time.Time
+	Latency      time.Duration // from sending the request until the response body was read
+	Err          error
+}
+
+// Recorder receives every exchange once its response body has been read or the request failed.
+// Record is called from the connection's goroutine and should not block.
+type Recorder interface {
+	Record(exchange *Exchange)
+}
+
+// Proxy is an HTTP proxy that forwards plain HTTP requests and intercepts CONNECT tunnels,
+// terminating TLS with certificates from CA, and hands every exchange to Recorder.
+type Proxy struct {
+	CA          *CA
+	Recorder    Recorder
+	Transport   http.RoundTripper // used to reach upstream servers, http.DefaultTransport when nil
+	MaxBodySize int64             // DefaultMaxBodySize when zero
+	ErrorLog    *log.Logger
+
+	once    sync.Once
+	reverse *httputil.ReverseProxy
+}
+
+// New creates a proxy signing intercepted hosts with ca and recording to recorder
+func New(ca *CA, recorder Recorder) *Proxy {
+	return &Proxy{CA: ca, Recorder: recorder}
+}
+
+func (p *Proxy) init() {
+	p.once.Do(func() {
+		p.reverse = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				// the outgoing URL is already absolute, only the Host header has to be kept
+				pr.Out.Host = pr.In.Host
+			},
+			Transport:     &recordingTransport{proxy: p},
+			FlushInterval: -1,
+			ErrorLog:      p.ErrorLog,
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				p.logf("proxy: %s %s: %v", r.Method, r.URL, err)
+				http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			},
+		}
+	})
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.init()
+	switch {
+	case r.Method == http.MethodConnect:
+		p.intercept(w, r)
+	case r.URL.IsAbs():
+		p.reverse.ServeHTTP(w, r)
+	case r.URL.Path == "/ca.pem" && p.CA != nil:
+		// clients point their browser at the proxy itself to download the certificate to trust
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Header().Set("Content-Disposition", `attachment; filename="requester-proxy-ca.pem"`)
+		w.Write(p.CA.CertPEM())
+	default:
+		http.Error(w, "This is a proxy, configure it as the HTTP proxy of the client or download the CA certificate at /ca.pem", http.StatusBadRequest)
+	}
+}
+
+// intercept takes over a CONNECT tunnel and serves the requests sent through it, over TLS unless the client speaks plain HTTP
+func (p *Proxy) intercept(w http.ResponseWriter, r *http.Request) {
+	authority := r.Host
+	if _, _, err := net.SplitHostPort(authority); err != nil {
+		authority = net.JoinHostPort(authority, "443")
+	}
+	hostname, _, _ := net.SplitHostPort(authority)
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "CONNECT is not supported", http.StatusInternalServerError)
+		return
+	}
+	clientConn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		p.logf("proxy: hijacking CONNECT %s: %v", authority, err)
+		return
+	}
+	if _, err := clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		clientConn.Close()
+		return
+	}
+
+	conn := &bufferedConn{Conn: clientConn, reader: buffered.Reader}
+	first, err := conn.reader.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	scheme := "http"
+	var tunnel net.Conn = conn
+	if first[0] == 0x16 { // TLS handshake record
+		if p.CA == nil {
+			conn.Close()
+			return
+		}
+		scheme = "https"
+		tlsConn := tls.Server(conn, &tls.Config{
+			NextProtos: []string{"http/1.1"},
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				name := hello.ServerName
+				if name == "" {
+					name = hostname
+				}
+				return p.CA.CertFor(name)
+			},
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			p.logf("proxy: TLS handshake with client for %s: %v", authority, err)
+			tlsConn.Close()
+			return
+		}
+		tunnel = tlsConn
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// requests inside the tunnel carry only the path, the tunnel tells where they go
+			req.URL.Scheme = scheme
+			req.URL.Host = tunnelHost(scheme, authority)
+			p.reverse.ServeHTTP(w, req)
+		}),
+		ErrorLog: p.ErrorLog,
+	}
+	server.Serve(newSingleConnListener(tunnel))
+}
+
+// tunnelHost drops the port when it is the default one of the scheme so recorded URLs look like the browser's
+func tunnelHost(scheme, authority string) string {
+	host, port, _ := net.SplitHostPort(authority)
+	if (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return authority
+}
+
+func (p *Proxy) maxBodySize() int64 {
+	if p.MaxBodySize > 0 {
+		return p.MaxBodySize
+	}
+	return DefaultMaxBodySize
+}
+
+func (p *Proxy) transport() http.RoundTripper {
+	if p.Transport != nil {
+		return p.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (p *Proxy) record(exchange *Exchange) {
+	if p.Recorder != nil {
+		p.Recorder.Record(exchange)
+	}
+}
+
+func (p *Proxy) logf(format string, args ...any) {
+	if p.ErrorLog != nil {
+		p.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// recordingTransport forwards requests upstream, keeping a copy of both bodies while they stream through
+type recordingTransport struct {
+	proxy *Proxy
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody := &capture{max: t.proxy.maxBodySize()}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &teeReadCloser{ReadCloser: req.Body, capture: requestBody}
+	}
+
+	started := time.Now()
+	resp, err := t.proxy.transport().RoundTrip(req)
+	if err != nil {
+		t.proxy.record(&Exchange{
+			Request:     req,
+			RequestBody: requestBody.Bytes(),
+			Truncated:   requestBody.Truncated(),
+			Started:     started,
+			Latency:     time.Since(started),
+			Err:         err,
+		})
+		return nil, err
+	}
+
+	responseBody := &capture{max: t.proxy.maxBodySize()}
+	body := &teeReadCloser{ReadCloser: resp.Body, capture: responseBody}
+	body.done = func() {
+		t.proxy.record(&Exchange{
+			Request:      req,
+			RequestBody:  requestBody.Bytes(),
+			Response:     resp,
+			ResponseBody: responseBody.Bytes(),
+			Truncated:    requestBody.Truncated() || responseBody.Truncated(),
+			Started:      started,
+			Latency:      time.Since(started),
+		})
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// capture keeps the first max bytes written to it. The transport may still be writing
+// the request body when the response arrives, so it is safe for concurrent use.
+type capture struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	room := c.max - int64(c.buf.Len())
+	if int64(len(p)) > room {
+		c.truncated = true
+		if room > 0 {
+			c.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+func (c *capture) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Clone(c.buf.Bytes())
+}
+
+func (c *capture) Truncated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.truncated
+}
+
+// teeReadCloser copies what is read into a capture and calls done once, at EOF or on Close
+type teeReadCloser struct {
+	io.ReadCloser
+	capture *capture
+	done    func()
+	once    sync.Once
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.capture.Write(p[:n])
+	}
+	if err == io.EOF {
+		t.finish()
+	}
+	return n, err
+}
+
+func (t *teeReadCloser) Close() error {
+	err := t.ReadCloser.Close()
+	t.finish()
+	return err
+}
+
+func (t *teeReadCloser) finish() {
+	if t.done != nil {
+		t.once.Do(t.done)
+	}
+}
+
+// bufferedConn reads through the buffer the CONNECT request was parsed with, it may already hold the client's first bytes
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// singleConnListener hands out one connection and then blocks until that connection is closed,
+// letting an http.Server handle the keep-alive requests of a tunnel
+type singleConnListener struct {
+	conn   net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	l := &singleConnListener{closed: make(chan struct{})}
+	l.conn = &notifyCloseConn{Conn: conn, closed: l.closed}
+	return l
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() { conn = l.conn })
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *singleConnListener) Close() error {
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+type notifyCloseConn struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *notifyCloseConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { close(c.closed) })
+	return err
+}
@@ -0,0 +1,254 @@
+package proxy_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/proxy"
+	"github.com/linn221/RequesterBackend/services"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// upstream answers with the path and body of the request after a short delay, so exchanges have a latency
+var upstream = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	time.Sleep(20 * time.Millisecond)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"path":%q,"body":%q}`, r.URL.Path, body)
+})
+
+// chanRecorder hands the recorded exchanges to the test
+type chanRecorder chan *proxy.Exchange
+
+func (r chanRecorder) Record(exchange *proxy.Exchange) {
+	r <- exchange
+}
+
+func (r chanRecorder) next(t *testing.T) *proxy.Exchange {
+	t.Helper()
+	select {
+	case exchange := <-r:
+		return exchange
+	case <-time.After(5 * time.Second):
+		t.Fatal("no exchange was recorded")
+		return nil
+	}
+}
+
+// notifyRecorder tells the test when the exchange was handed to the wrapped recorder
+type notifyRecorder struct {
+	proxy.Recorder
+	recorded chan struct{}
+}
+
+func (r *notifyRecorder) Record(exchange *proxy.Exchange) {
+	r.Recorder.Record(exchange)
+	r.recorded <- struct{}{}
+}
+
+// startProxy serves a proxy recording to recorder and returns a client using it that trusts the proxy's CA
+func startProxy(t *testing.T, recorder proxy.Recorder, transport http.RoundTripper) (*http.Client, *proxy.CA, string) {
+	t.Helper()
+	ca, err := proxy.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := proxy.New(ca, recorder)
+	p.Transport = transport
+	server := httptest.NewServer(p)
+	t.Cleanup(server.Close)
+
+	proxyURL, _ := url.Parse(server.URL)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	transportToProxy := &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}
+	t.Cleanup(transportToProxy.CloseIdleConnections)
+	return &http.Client{Transport: transportToProxy}, ca, server.URL
+}
+
+func TestProxyHTTP(t *testing.T) {
+	target := httptest.NewServer(upstream)
+	defer target.Close()
+	recorder := make(chanRecorder, 1)
+	client, _, _ := startProxy(t, recorder, nil)
+
+	resp, err := client.Post(target.URL+"/login?next=%2F", "application/json", strings.NewReader(`{"user":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	want := `{"path":"/login","body":"{\"user\":\"a\"}"}`
+	if resp.StatusCode != http.StatusOK || string(body) != want {
+		t.Fatalf("got %d %s, want 200 %s", resp.StatusCode, body, want)
+	}
+
+	exchange := recorder.next(t)
+	if exchange.Err != nil {
+		t.Fatal(exchange.Err)
+	}
+	if got := exchange.Request.URL.String(); got != target.URL+"/login?next=%2F" {
+		t.Errorf("got URL %s, want %s", got, target.URL+"/login?next=%2F")
+	}
+	if exchange.Request.Method != http.MethodPost || string(exchange.RequestBody) != `{"user":"a"}` {
+		t.Errorf("got %s with body %s", exchange.Request.Method, exchange.RequestBody)
+	}
+	if exchange.Response.StatusCode != http.StatusOK || string(exchange.ResponseBody) != want {
+		t.Errorf("got response %d %s", exchange.Response.StatusCode, exchange.ResponseBody)
+	}
+	if exchange.Latency < 20*time.Millisecond || exchange.Started.IsZero() {
+		t.Errorf("got latency %s started at %s", exchange.Latency, exchange.Started)
+	}
+}
+
+func TestProxyUpstreamDown(t *testing.T) {
+	target := httptest.NewServer(upstream)
+	target.Close()
+	recorder := make(chanRecorder, 1)
+	client, _, _ := startProxy(t, recorder, nil)
+
+	resp, err := client.Get(target.URL + "/gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("got status %d, want 502", resp.StatusCode)
+	}
+	if exchange := recorder.next(t); exchange.Err == nil || exchange.Response != nil {
+		t.Errorf("got error %v and response %v, want the error only", exchange.Err, exchange.Response)
+	}
+}
+
+func TestProxyConnectTLS(t *testing.T) {
+	target := httptest.NewTLSServer(upstream)
+	defer target.Close()
+	recorder := make(chanRecorder, 1)
+	// the proxy trusts the test server, the client only trusts the proxy's CA
+	client, ca, _ := startProxy(t, recorder, target.Client().Transport)
+
+	resp, err := client.Get(target.URL + "/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != `{"path":"/users/1","body":""}` {
+		t.Fatalf("got %d %s", resp.StatusCode, body)
+	}
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		t.Fatal("the response did not come over TLS")
+	}
+	leaf := resp.TLS.PeerCertificates[0]
+	if err := leaf.CheckSignatureFrom(ca.Certificate()); err != nil {
+		t.Errorf("the certificate the client got is not signed by the proxy's CA: %v", err)
+	}
+
+	exchange := recorder.next(t)
+	if exchange.Err != nil {
+		t.Fatal(exchange.Err)
+	}
+	if got := exchange.Request.URL.String(); got != target.URL+"/users/1" {
+		t.Errorf("got URL %s, want %s", got, target.URL+"/users/1")
+	}
+	if string(exchange.ResponseBody) != string(body) {
+		t.Errorf("got response body %s, want %s", exchange.ResponseBody, body)
+	}
+}
+
+func TestProxyCACertificate(t *testing.T) {
+	_, ca, proxyURL := startProxy(t, nil, nil)
+
+	resp, err := http.Get(proxyURL + "/ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != string(ca.CertPEM()) {
+		t.Errorf("got %d %q, want the CA certificate", resp.StatusCode, body)
+	}
+}
+
+func TestProxyRecorder(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&models.Program{}, &models.ImportJob{}, &models.Tag{}, &models.Taggable{},
+		&models.PathPattern{}, &models.ScopeRule{}, &models.Endpoint{}, &models.MyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := &models.Program{Name: "test", Domains: "127.0.0.1"}
+	if err := db.Create(program).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	target := httptest.NewTLSServer(upstream)
+	defer target.Close()
+	recorder := services.NewProxyRecorder(db, "test", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		recorder.Run(ctx)
+		close(stopped)
+	}()
+	notify := &notifyRecorder{Recorder: recorder, recorded: make(chan struct{}, 1)}
+	client, _, _ := startProxy(t, notify, target.Client().Transport)
+
+	resp, err := client.Get(target.URL + "/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	select {
+	case <-notify.recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no exchange was recorded")
+	}
+	cancel() // saves what is queued
+	<-stopped
+
+	var requests []*models.MyRequest
+	if err := db.Find(&requests).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+	if req.ProgramId == nil || *req.ProgramId != program.Id {
+		t.Errorf("got program %v, want %d", req.ProgramId, program.Id)
+	}
+	if req.LatencyMs < 20 {
+		t.Errorf("got latency %dms, want at least 20ms", req.LatencyMs)
+	}
+	if req.URL != target.URL+"/users/1" || req.Method != http.MethodGet || req.ResStatus != http.StatusOK {
+		t.Errorf("got %s %s %d", req.Method, req.URL, req.ResStatus)
+	}
+	var endpoint models.Endpoint
+	if err := db.First(&endpoint, req.EndpointId).Error; err != nil {
+		t.Fatalf("the request has no endpoint: %v", err)
+	}
+	if endpoint.ProgramId != program.Id || endpoint.Domain != "127.0.0.1" || endpoint.URI != "/users/{id}" {
+		t.Errorf("got endpoint %d %s %s", endpoint.ProgramId, endpoint.Domain, endpoint.URI)
+	}
+}
@@ -0,0 +1,119 @@
+package rawhttp
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"github.com/linn221/RequesterBackend/models"
+)
+
+// MaxDecodedSize is how much of a decoded body is kept, so a small compressed body can't expand
+// without bounds. It is the size the proxy keeps of each body.
+const MaxDecodedSize = 10 << 20
+
+// ErrTruncated is returned with the first MaxDecodedSize bytes of a body that decodes to more
+var ErrTruncated = errors.New("the decoded body is larger than 10 MiB and was truncated")
+
+// IsBinary reports whether data can't be stored and returned as text
+func IsBinary(data []byte) bool {
+	return !utf8.Valid(data) || bytes.IndexByte(data, 0) != -1
+}
+
+// DecodeContent undoes the Content-Encoding (gzip, deflate, br) of a body. Captures often store the decoded
+// body even when the header is still present, so data that doesn't look encoded is returned unchanged.
+// On error the body is returned as it was together with the error, except for ErrTruncated which comes
+// with the truncated decoded body.
+func DecodeContent(data []byte, headers []models.Header) ([]byte, error) {
+	for _, encoding := range contentEncodings(headers) {
+		decoded, err := decompress(data, encoding)
+		if errors.Is(err, ErrTruncated) {
+			return decoded, fmt.Errorf("%s body: %w", encoding, err)
+		}
+		if err != nil {
+			return data, fmt.Errorf("failed to decode %s body: %v", encoding, err)
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+// contentEncodings returns the Content-Encoding values in the order they have to be undone
+func contentEncodings(headers []models.Header) []string {
+	var encodings []string
+	for _, h := range headers {
+		if !strings.EqualFold(h.Name, "Content-Encoding") {
+			continue
+		}
+		for _, value := range strings.Split(h.Value, ",") {
+			value = strings.ToLower(strings.TrimSpace(value))
+			if value != "" && value != "identity" {
+				encodings = append(encodings, value)
+			}
+		}
+	}
+	// the last applied encoding is listed last
+	for i, j := 0, len(encodings)-1; i < j; i, j = i+1, j-1 {
+		encodings[i], encodings[j] = encodings[j], encodings[i]
+	}
+	return encodings
+}
+
+func decompress(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+			return data, nil
+		}
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return readLimited(r)
+	case "deflate":
+		if !IsBinary(data) {
+			return data, nil
+		}
+		// deflate is usually sent zlib wrapped, but some servers send the raw stream
+		if r, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+			defer r.Close()
+			if decoded, err := readLimited(r); err == nil || errors.Is(err, ErrTruncated) {
+				return decoded, err
+			}
+		}
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		return readLimited(r)
+	case "br":
+		// brotli streams have no magic number, bodies that are already text were stored decoded
+		if !IsBinary(data) {
+			return data, nil
+		}
+		return readLimited(brotli.NewReader(bytes.NewReader(data)))
+	default:
+		if !IsBinary(data) {
+			return data, nil
+		}
+		return nil, fmt.Errorf("unsupported content encoding")
+	}
+}
+
+// readLimited reads a decoder up to MaxDecodedSize, longer output is cut and returned with ErrTruncated
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxDecodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxDecodedSize {
+		return data[:MaxDecodedSize], ErrTruncated
+	}
+	return data, nil
+}
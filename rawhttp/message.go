@@ -0,0 +1,240 @@
+// Package rawhttp parses raw HTTP/1.x messages as captured by intercepting proxies. Parsing is
+// done with net/http where possible, with fallbacks for the malformed or edited traffic that
+// shows up in captures, and HTTP/2 messages written in HTTP/1 form with pseudo-headers.
+package rawhttp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+// Request is a parsed raw HTTP request
+type Request struct {
+	Method  string
+	Target  string // request target as sent, usually the path and query
+	Proto   string
+	Host    string          // Host header, or the :authority pseudo-header of HTTP/2 messages
+	Headers []models.Header // in their original order and case, without pseudo-headers
+	Body    []byte          // with the transfer and content encodings undone
+}
+
+// Response is a parsed raw HTTP response
+type Response struct {
+	Proto      string
+	StatusCode int
+	Headers    []models.Header // in their original order and case, without pseudo-headers
+	Body       []byte          // with the transfer and content encodings undone
+}
+
+// ParseRequest parses a raw HTTP request. Problems that don't prevent parsing, like a truncated
+// chunked body, are returned as warnings and the body is kept as it was captured.
+func ParseRequest(data []byte) (*Request, []string, error) {
+	startLine, headerLines, rest := splitStartLine(data)
+	headers, pseudo := parseHeaderLines(headerLines)
+
+	req := &Request{Headers: headers}
+	fields := strings.Fields(startLine)
+	if len(fields) > 0 && strings.HasPrefix(strings.ToUpper(fields[len(fields)-1]), "HTTP/") {
+		req.Proto = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) > 0 {
+		req.Method = fields[0]
+	}
+	if len(fields) > 1 {
+		// a target with unescaped spaces is split by Fields
+		req.Target = strings.Join(fields[1:], " ")
+	}
+	if req.Method == "" {
+		req.Method = pseudo[":method"]
+	}
+	if req.Target == "" {
+		req.Target = pseudo[":path"]
+	}
+	if req.Method == "" || req.Target == "" {
+		return nil, nil, fmt.Errorf("invalid request line '%s'", startLine)
+	}
+	req.Host = headerValue(headers, "Host")
+	if req.Host == "" {
+		req.Host = pseudo[":authority"]
+	}
+
+	var warnings []string
+	head := fmt.Sprintf("%s %s HTTP/1.1\r\n", req.Method, strings.ReplaceAll(req.Target, " ", "%20"))
+	body, err := readBody(head, headers, rest, func(r *bufio.Reader) (io.ReadCloser, int64, []string, error) {
+		parsed, err := http.ReadRequest(r)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return parsed.Body, parsed.ContentLength, parsed.TransferEncoding, nil
+	})
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("request body kept as captured: %v", err))
+	}
+	if req.Body, err = DecodeContent(body, headers); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	return req, warnings, nil
+}
+
+// ParseResponse parses a raw HTTP response. Problems that don't prevent parsing, like a truncated
+// chunked body, are returned as warnings and the body is kept as it was captured.
+func ParseResponse(data []byte) (*Response, []string, error) {
+	startLine, headerLines, rest := splitStartLine(data)
+	headers, pseudo := parseHeaderLines(headerLines)
+
+	res := &Response{Headers: headers}
+	fields := strings.Fields(startLine)
+	if len(fields) > 0 && strings.HasPrefix(strings.ToUpper(fields[0]), "HTTP/") {
+		res.Proto = fields[0]
+		if len(fields) > 1 {
+			res.StatusCode, _ = strconv.Atoi(fields[1])
+		}
+	}
+	if res.StatusCode == 0 {
+		res.StatusCode, _ = strconv.Atoi(pseudo[":status"])
+	}
+	if res.StatusCode < 100 || res.StatusCode > 999 {
+		return nil, nil, fmt.Errorf("invalid status line '%s'", startLine)
+	}
+
+	var warnings []string
+	head := fmt.Sprintf("HTTP/1.1 %d %s\r\n", res.StatusCode, http.StatusText(res.StatusCode))
+	body, err := readBody(head, headers, rest, func(r *bufio.Reader) (io.ReadCloser, int64, []string, error) {
+		parsed, err := http.ReadResponse(r, nil)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return parsed.Body, parsed.ContentLength, parsed.TransferEncoding, nil
+	})
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("response body kept as captured: %v", err))
+	}
+	if res.Body, err = DecodeContent(body, headers); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	return res, warnings, nil
+}
+
+// readBody lets net/http read the body so chunked transfer encoding and Content-Length are honoured.
+// The message is rebuilt as HTTP/1.1 from the parsed head, since net/http rejects HTTP/2 versions and
+// pseudo-headers. When net/http fails, or finds no body where the capture has one (HTTP/2 requests
+// carry no Content-Length), the captured bytes after the head are returned.
+func readBody(head string, headers []models.Header, rest []byte, read func(*bufio.Reader) (io.ReadCloser, int64, []string, error)) ([]byte, error) {
+	var msg bytes.Buffer
+	msg.WriteString(head)
+	for _, h := range headers {
+		if validHeaderName(h.Name) {
+			fmt.Fprintf(&msg, "%s: %s\r\n", h.Name, h.Value)
+		}
+	}
+	msg.WriteString("\r\n")
+	msg.Write(rest)
+
+	body, contentLength, transferEncoding, err := read(bufio.NewReader(&msg))
+	if err != nil {
+		return rest, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return rest, err
+	}
+	if len(data) == 0 && contentLength <= 0 && len(transferEncoding) == 0 {
+		return rest, nil
+	}
+	return data, nil
+}
+
+// splitStartLine splits a message into its start line, header lines and body. HTTP/2 messages may
+// have no start line and begin with their pseudo-headers, the start line is empty then.
+func splitStartLine(data []byte) (string, []string, []byte) {
+	lines, rest := splitHead(data)
+	if strings.HasPrefix(lines[0], ":") {
+		return "", lines, rest
+	}
+	return lines[0], lines[1:], rest
+}
+
+// splitHead splits a message into its head lines, with CR stripped, and the bytes after the blank line
+func splitHead(data []byte) ([]string, []byte) {
+	var head, rest []byte
+	crlf := bytes.Index(data, []byte("\r\n\r\n"))
+	lf := bytes.Index(data, []byte("\n\n"))
+	switch {
+	case crlf != -1 && (lf == -1 || crlf < lf):
+		head, rest = data[:crlf], data[crlf+4:]
+	case lf != -1:
+		head, rest = data[:lf], data[lf+2:]
+	default:
+		head = data
+	}
+
+	lines := strings.Split(string(head), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, rest
+}
+
+// parseHeaderLines parses header lines, unfolding obsolete line folding. HTTP/2 pseudo-headers
+// (:method, :path, :authority, :scheme, :status) are returned separately.
+func parseHeaderLines(lines []string) ([]models.Header, map[string]string) {
+	var headers []models.Header
+	pseudo := make(map[string]string)
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		start := 0
+		if line[0] == ':' {
+			start = 1
+		}
+		colon := strings.IndexByte(line[start:], ':')
+		if colon == -1 {
+			continue
+		}
+		name := strings.TrimSpace(line[:start+colon])
+		value := strings.TrimSpace(line[start+colon+1:])
+		if start == 1 {
+			pseudo[strings.ToLower(name)] = value
+			continue
+		}
+		headers = append(headers, models.Header{Name: name, Value: value})
+	}
+	return headers, pseudo
+}
+
+func headerValue(headers []models.Header, name string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// validHeaderName reports whether net/http accepts name as a header field name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
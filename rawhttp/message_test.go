@@ -0,0 +1,232 @@
+package rawhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+func gzipped(t *testing.T, text string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(text))
+	w.Close()
+	return buf.String()
+}
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		want        Request
+		wantWarning string
+		wantErr     bool
+	}{
+		{
+			name: "GET",
+			raw:  "GET /users?id=1 HTTP/1.1\r\nHost: example.com\r\nAccept: */*\r\n\r\n",
+			want: Request{Method: "GET", Target: "/users?id=1", Proto: "HTTP/1.1", Host: "example.com",
+				Headers: []models.Header{{Name: "Host", Value: "example.com"}, {Name: "Accept", Value: "*/*"}}},
+		},
+		{
+			name: "LF line endings and header case",
+			raw:  "POST /login HTTP/1.1\nhost: example.com\nX-Custom-HEADER:  a b \n\nuser=a",
+			want: Request{Method: "POST", Target: "/login", Proto: "HTTP/1.1", Host: "example.com",
+				Headers: []models.Header{{Name: "host", Value: "example.com"}, {Name: "X-Custom-HEADER", Value: "a b"}}, Body: []byte("user=a")},
+		},
+		{
+			name: "Content-Length",
+			raw:  "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\n\r\nabcdef",
+			want: Request{Method: "POST", Target: "/", Proto: "HTTP/1.1", Host: "a",
+				Headers: []models.Header{{Name: "Host", Value: "a"}, {Name: "Content-Length", Value: "3"}}, Body: []byte("abc")},
+		},
+		{
+			name: "chunked",
+			raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n",
+			want: Request{Method: "POST", Target: "/", Proto: "HTTP/1.1", Host: "a",
+				Headers: []models.Header{{Name: "Host", Value: "a"}, {Name: "Transfer-Encoding", Value: "chunked"}}, Body: []byte("abcde")},
+		},
+		{
+			name: "truncated chunked body is kept as captured",
+			raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nab",
+			want: Request{Method: "POST", Target: "/", Proto: "HTTP/1.1", Host: "a",
+				Headers: []models.Header{{Name: "Host", Value: "a"}, {Name: "Transfer-Encoding", Value: "chunked"}}, Body: []byte("5\r\nab")},
+			wantWarning: "request body kept as captured",
+		},
+		{
+			name: "HTTP/2 pseudo-headers",
+			raw:  ":method: PUT\r\n:path: /items/1\r\n:authority: api.example.com\r\n:scheme: https\r\ncontent-type: application/json\r\n\r\n{\"a\":1}",
+			want: Request{Method: "PUT", Target: "/items/1", Host: "api.example.com",
+				Headers: []models.Header{{Name: "content-type", Value: "application/json"}}, Body: []byte(`{"a":1}`)},
+		},
+		{
+			name: "HTTP/2 request line without Content-Length",
+			raw:  "POST /graphql HTTP/2\r\n:authority: api.example.com\r\n\r\n{\"query\":\"{}\"}",
+			want: Request{Method: "POST", Target: "/graphql", Proto: "HTTP/2", Host: "api.example.com", Body: []byte(`{"query":"{}"}`)},
+		},
+		{
+			name: "Host header wins over :authority",
+			raw:  "GET / HTTP/2\r\n:authority: a.example.com\r\nHost: b.example.com\r\n\r\n",
+			want: Request{Method: "GET", Target: "/", Proto: "HTTP/2", Host: "b.example.com",
+				Headers: []models.Header{{Name: "Host", Value: "b.example.com"}}},
+		},
+		{
+			name: "target with spaces",
+			raw:  "GET /a b/c HTTP/1.1\r\nHost: a\r\n\r\n",
+			want: Request{Method: "GET", Target: "/a b/c", Proto: "HTTP/1.1", Host: "a",
+				Headers: []models.Header{{Name: "Host", Value: "a"}}},
+		},
+		{
+			name: "no version",
+			raw:  "DELETE /x\r\nHost: a\r\n\r\n",
+			want: Request{Method: "DELETE", Target: "/x", Host: "a", Headers: []models.Header{{Name: "Host", Value: "a"}}},
+		},
+		{
+			name: "folded header and invalid lines",
+			raw:  "GET / HTTP/1.1\r\nHost: a\r\nX-Long: one\r\n  two\r\nnot a header\r\n\r\n",
+			want: Request{Method: "GET", Target: "/", Proto: "HTTP/1.1", Host: "a",
+				Headers: []models.Header{{Name: "Host", Value: "a"}, {Name: "X-Long", Value: "one two"}}},
+		},
+		{
+			name: "invalid header name is kept but not parsed by net/http",
+			raw:  "POST / HTTP/1.1\r\nHost: a\r\nBad Name: x\r\nContent-Length: 2\r\n\r\nok",
+			want: Request{Method: "POST", Target: "/", Proto: "HTTP/1.1", Host: "a",
+				Headers: []models.Header{{Name: "Host", Value: "a"}, {Name: "Bad Name", Value: "x"}, {Name: "Content-Length", Value: "2"}}, Body: []byte("ok")},
+		},
+		{
+			name: "gzip body",
+			raw:  "POST / HTTP/1.1\r\nHost: a\r\nContent-Encoding: gzip\r\n\r\n" + gzipped(t, "hello"),
+			want: Request{Method: "POST", Target: "/", Proto: "HTTP/1.1", Host: "a",
+				Headers: []models.Header{{Name: "Host", Value: "a"}, {Name: "Content-Encoding", Value: "gzip"}}, Body: []byte("hello")},
+		},
+		{name: "method only", raw: "GET\r\n\r\n", wantErr: true},
+		{name: "empty", raw: "", wantErr: true},
+		{name: "pseudo-headers without :path", raw: ":method: GET\r\n:authority: a\r\n\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings, err := ParseRequest([]byte(tt.raw))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Method != tt.want.Method || got.Target != tt.want.Target || got.Proto != tt.want.Proto || got.Host != tt.want.Host {
+				t.Errorf("got %s %s %s host %s, want %s %s %s host %s", got.Method, got.Target, got.Proto, got.Host,
+					tt.want.Method, tt.want.Target, tt.want.Proto, tt.want.Host)
+			}
+			if fmt.Sprint(got.Headers) != fmt.Sprint(tt.want.Headers) {
+				t.Errorf("got headers %v, want %v", got.Headers, tt.want.Headers)
+			}
+			if !bytes.Equal(got.Body, tt.want.Body) {
+				t.Errorf("got body %q, want %q", got.Body, tt.want.Body)
+			}
+			checkWarnings(t, warnings, tt.wantWarning)
+		})
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		want        Response
+		wantWarning string
+		wantErr     bool
+	}{
+		{
+			name: "OK",
+			raw:  "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\nhello",
+			want: Response{Proto: "HTTP/1.1", StatusCode: 200,
+				Headers: []models.Header{{Name: "Content-Type", Value: "text/plain"}, {Name: "Content-Length", Value: "5"}}, Body: []byte("hello")},
+		},
+		{
+			name: "no reason phrase",
+			raw:  "HTTP/1.1 204\r\n\r\n",
+			want: Response{Proto: "HTTP/1.1", StatusCode: 204},
+		},
+		{
+			name: "body without length",
+			raw:  "HTTP/1.0 200 OK\nServer: x\n\n<html></html>",
+			want: Response{Proto: "HTTP/1.0", StatusCode: 200, Headers: []models.Header{{Name: "Server", Value: "x"}}, Body: []byte("<html></html>")},
+		},
+		{
+			name: "HTTP/2 :status",
+			raw:  ":status: 404\r\ncontent-type: text/html\r\n\r\nmissing",
+			want: Response{StatusCode: 404, Headers: []models.Header{{Name: "content-type", Value: "text/html"}}, Body: []byte("missing")},
+		},
+		{
+			name: "HTTP/2 status line",
+			raw:  "HTTP/2 301\r\nlocation: /new\r\n\r\n",
+			want: Response{Proto: "HTTP/2", StatusCode: 301, Headers: []models.Header{{Name: "location", Value: "/new"}}},
+		},
+		{
+			name: "chunked gzip",
+			raw: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nContent-Encoding: gzip\r\n\r\n" +
+				fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", len(gzipped(t, "compressed")), gzipped(t, "compressed")),
+			want: Response{Proto: "HTTP/1.1", StatusCode: 200,
+				Headers: []models.Header{{Name: "Transfer-Encoding", Value: "chunked"}, {Name: "Content-Encoding", Value: "gzip"}}, Body: []byte("compressed")},
+		},
+		{
+			name: "body stored decoded despite Content-Encoding",
+			raw:  "HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\n\r\nplain",
+			want: Response{Proto: "HTTP/1.1", StatusCode: 200, Headers: []models.Header{{Name: "Content-Encoding", Value: "gzip"}}, Body: []byte("plain")},
+		},
+		{
+			name: "corrupt gzip",
+			raw:  "HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\n\r\n\x1f\x8b\x00\x01",
+			want: Response{Proto: "HTTP/1.1", StatusCode: 200, Headers: []models.Header{{Name: "Content-Encoding", Value: "gzip"}}, Body: []byte("\x1f\x8b\x00\x01")},
+			wantWarning: "failed to decode gzip body",
+		},
+		{name: "no status", raw: "HTTP/1.1\r\n\r\n", wantErr: true},
+		{name: "status out of range", raw: "HTTP/1.1 42 Nope\r\n\r\n", wantErr: true},
+		{name: "not a response", raw: "GET / HTTP/1.1\r\n\r\n", wantErr: true},
+		{name: "invalid :status", raw: ":status: abc\r\n\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings, err := ParseResponse([]byte(tt.raw))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Proto != tt.want.Proto || got.StatusCode != tt.want.StatusCode {
+				t.Errorf("got %s %d, want %s %d", got.Proto, got.StatusCode, tt.want.Proto, tt.want.StatusCode)
+			}
+			if fmt.Sprint(got.Headers) != fmt.Sprint(tt.want.Headers) {
+				t.Errorf("got headers %v, want %v", got.Headers, tt.want.Headers)
+			}
+			if !bytes.Equal(got.Body, tt.want.Body) {
+				t.Errorf("got body %q, want %q", got.Body, tt.want.Body)
+			}
+			checkWarnings(t, warnings, tt.wantWarning)
+		})
+	}
+}
+
+func checkWarnings(t *testing.T, warnings []string, want string) {
+	t.Helper()
+	if want == "" {
+		if len(warnings) > 0 {
+			t.Errorf("got warnings %v, want none", warnings)
+		}
+		return
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], want) {
+		t.Errorf("got warnings %v, want %q", warnings, want)
+	}
+}
@@ -0,0 +1,186 @@
+package scope
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Status is the result of checking a URL against a scope
+type Status string
+
+const (
+	In      Status = "in"
+	Out     Status = "out"
+	Unknown Status = "unknown" // the scope has no in-scope rules, nothing can be said
+)
+
+// Valid reports whether s is one of the statuses
+func (s Status) Valid() bool {
+	return s == In || s == Out || s == Unknown
+}
+
+// Rule matches URLs on host, scheme, port and path prefix, empty fields match anything.
+// Host is an exact host, a wildcard like *.example.com matching subdomains only, or a CIDR like 10.0.0.0/8.
+// PathPrefix /api matches /api and everything under /api/ but not /apiv2.
+type Rule struct {
+	Host       string
+	Scheme     string
+	Port       int
+	PathPrefix string
+
+	wildcard bool
+	network  *net.IPNet
+}
+
+// Compile validates the rule and prepares it for matching
+func (r *Rule) Compile() error {
+	r.Host = strings.ToLower(strings.TrimSpace(r.Host))
+	r.Scheme = strings.ToLower(strings.TrimSpace(r.Scheme))
+	r.wildcard = false
+	r.network = nil
+
+	switch {
+	case r.Host == "" || r.Host == "*":
+		r.Host = ""
+	case strings.Contains(r.Host, "/"):
+		_, network, err := net.ParseCIDR(r.Host)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR '%s'", r.Host)
+		}
+		r.network = network
+	case strings.HasPrefix(r.Host, "*."):
+		if strings.Contains(r.Host[2:], "*") || len(r.Host) == 2 {
+			return fmt.Errorf("invalid wildcard host '%s', only a leading *. is supported", r.Host)
+		}
+		r.wildcard = true
+	case strings.Contains(r.Host, "*"):
+		return fmt.Errorf("invalid wildcard host '%s', only a leading *. is supported", r.Host)
+	case strings.Contains(r.Host, ":") && net.ParseIP(r.Host) == nil:
+		return fmt.Errorf("invalid host '%s', set the port separately", r.Host)
+	}
+
+	if r.Scheme != "" && r.Scheme != "http" && r.Scheme != "https" {
+		return fmt.Errorf("invalid scheme '%s', expected http or https", r.Scheme)
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		return fmt.Errorf("invalid port %d", r.Port)
+	}
+	if r.PathPrefix != "" && !strings.HasPrefix(r.PathPrefix, "/") {
+		return fmt.Errorf("invalid path prefix '%s', it must start with /", r.PathPrefix)
+	}
+	return nil
+}
+
+// Match reports whether the URL fits the rule. Parts the URL lacks are not checked,
+// so a URL without scheme matches rules on any scheme and port.
+func (r *Rule) Match(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case r.network != nil:
+		ip := net.ParseIP(host)
+		if ip == nil || !r.network.Contains(ip) {
+			return false
+		}
+	case r.wildcard:
+		if !strings.HasSuffix(host, r.Host[1:]) {
+			return false
+		}
+	case r.Host != "":
+		if host != r.Host {
+			return false
+		}
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if r.Scheme != "" && scheme != "" && scheme != r.Scheme {
+		return false
+	}
+	if r.Port != 0 && scheme != "" && port(u) != r.Port {
+		return false
+	}
+
+	if r.PathPrefix != "" && r.PathPrefix != "/" {
+		path := u.Path
+		if path == "" {
+			path = "/"
+		}
+		prefix := strings.TrimSuffix(r.PathPrefix, "/")
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// String describes the rule in URL form, like https://*.example.com:8443/api
+func (r *Rule) String() string {
+	var b strings.Builder
+	if r.Scheme != "" {
+		b.WriteString(r.Scheme + "://")
+	}
+	if r.Host != "" {
+		b.WriteString(r.Host)
+	} else {
+		b.WriteString("*")
+	}
+	if r.Port != 0 {
+		b.WriteString(":" + strconv.Itoa(r.Port))
+	}
+	b.WriteString(r.PathPrefix)
+	return b.String()
+}
+
+// port returns the port of the URL, the default one of its scheme when it has none
+func port(u *url.URL) int {
+	if p, err := strconv.Atoi(u.Port()); err == nil {
+		return p
+	}
+	if strings.EqualFold(u.Scheme, "http") {
+		return 80
+	}
+	return 443
+}
+
+// Scope is the set of in-scope and out-of-scope rules of a program
+type Scope struct {
+	In  []*Rule
+	Out []*Rule
+}
+
+// Check tells whether the URL is in scope and returns the deciding rule. Out-of-scope rules win over
+// in-scope ones, URLs matching no in-scope rule are out, and everything is unknown without in-scope rules.
+func (s *Scope) Check(u *url.URL) (Status, *Rule) {
+	for _, rule := range s.Out {
+		if rule.Match(u) {
+			return Out, rule
+		}
+	}
+	if len(s.In) == 0 {
+		return Unknown, nil
+	}
+	for _, rule := range s.In {
+		if rule.Match(u) {
+			return In, rule
+		}
+	}
+	return Out, nil
+}
+
+// CheckURL is Check for a URL string, an unparsable URL is unknown
+func (s *Scope) CheckURL(rawURL string) Status {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Unknown
+	}
+	status, _ := s.Check(u)
+	return status
+}
+
+// CheckHostPath checks a host and path without scheme, rules on schemes and ports are ignored
+func (s *Scope) CheckHostPath(host, path string) Status {
+	status, _ := s.Check(&url.URL{Host: host, Path: path})
+	return status
+}
@@ -0,0 +1,164 @@
+package scope
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRuleCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "host", rule: Rule{Host: " Example.COM "}},
+		{name: "any host", rule: Rule{Host: "*"}},
+		{name: "wildcard", rule: Rule{Host: "*.example.com"}},
+		{name: "IPv4 CIDR", rule: Rule{Host: "10.0.0.0/8"}},
+		{name: "IPv6 CIDR", rule: Rule{Host: "fd00::/8"}},
+		{name: "IPv6 host", rule: Rule{Host: "::1"}},
+		{name: "scheme, port and path", rule: Rule{Host: "example.com", Scheme: "HTTPS", Port: 8443, PathPrefix: "/api"}},
+		{name: "bare wildcard", rule: Rule{Host: "*."}, wantErr: true},
+		{name: "inner wildcard", rule: Rule{Host: "api.*.example.com"}, wantErr: true},
+		{name: "second wildcard", rule: Rule{Host: "*.*.example.com"}, wantErr: true},
+		{name: "trailing wildcard", rule: Rule{Host: "example.*"}, wantErr: true},
+		{name: "invalid CIDR", rule: Rule{Host: "10.0.0.0/33"}, wantErr: true},
+		{name: "path in host", rule: Rule{Host: "example.com/api"}, wantErr: true},
+		{name: "port in host", rule: Rule{Host: "example.com:8080"}, wantErr: true},
+		{name: "scheme", rule: Rule{Scheme: "ftp"}, wantErr: true},
+		{name: "negative port", rule: Rule{Port: -1}, wantErr: true},
+		{name: "port too large", rule: Rule{Port: 65536}, wantErr: true},
+		{name: "relative path", rule: Rule{PathPrefix: "api"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Compile()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		url  string
+		want bool
+	}{
+		{name: "exact host", rule: Rule{Host: "example.com"}, url: "https://example.com/", want: true},
+		{name: "host case", rule: Rule{Host: "Example.com"}, url: "https://EXAMPLE.com/", want: true},
+		{name: "other host", rule: Rule{Host: "example.com"}, url: "https://api.example.com/"},
+		{name: "any host", rule: Rule{Host: "*"}, url: "http://anything.test/", want: true},
+
+		{name: "wildcard subdomain", rule: Rule{Host: "*.example.com"}, url: "https://api.example.com/", want: true},
+		{name: "wildcard deep subdomain", rule: Rule{Host: "*.example.com"}, url: "https://a.b.example.com/", want: true},
+		{name: "wildcard apex", rule: Rule{Host: "*.example.com"}, url: "https://example.com/"},
+		{name: "wildcard lookalike", rule: Rule{Host: "*.example.com"}, url: "https://evilexample.com/"},
+		{name: "wildcard suffix domain", rule: Rule{Host: "*.example.com"}, url: "https://api.example.com.evil.test/"},
+
+		{name: "CIDR", rule: Rule{Host: "10.0.0.0/8"}, url: "http://10.1.2.3/", want: true},
+		{name: "CIDR outside", rule: Rule{Host: "10.0.0.0/8"}, url: "http://11.0.0.1/"},
+		{name: "CIDR single address", rule: Rule{Host: "192.168.1.5/32"}, url: "http://192.168.1.5:8080/", want: true},
+		{name: "CIDR host name", rule: Rule{Host: "10.0.0.0/8"}, url: "http://10.example.com/"},
+		{name: "CIDR IPv6", rule: Rule{Host: "fd00::/8"}, url: "http://[fd12::1]/", want: true},
+		{name: "CIDR IPv6 outside", rule: Rule{Host: "fd00::/8"}, url: "http://[fe80::1]/"},
+		{name: "IPv6 host", rule: Rule{Host: "::1"}, url: "http://[::1]:3000/", want: true},
+
+		{name: "scheme", rule: Rule{Scheme: "https"}, url: "https://example.com/", want: true},
+		{name: "other scheme", rule: Rule{Scheme: "https"}, url: "http://example.com/"},
+		{name: "scheme not known", rule: Rule{Scheme: "https"}, url: "//example.com/", want: true},
+
+		{name: "explicit port", rule: Rule{Port: 8443}, url: "https://example.com:8443/", want: true},
+		{name: "other port", rule: Rule{Port: 8443}, url: "https://example.com:8080/"},
+		{name: "default https port", rule: Rule{Port: 443}, url: "https://example.com/", want: true},
+		{name: "default http port", rule: Rule{Port: 80}, url: "http://example.com/", want: true},
+		{name: "default port of the other scheme", rule: Rule{Port: 443}, url: "http://example.com/"},
+		{name: "port without scheme", rule: Rule{Port: 8443}, url: "//example.com/", want: true},
+
+		{name: "path prefix", rule: Rule{PathPrefix: "/api"}, url: "https://example.com/api", want: true},
+		{name: "path under prefix", rule: Rule{PathPrefix: "/api"}, url: "https://example.com/api/users", want: true},
+		{name: "path prefix with slash", rule: Rule{PathPrefix: "/api/"}, url: "https://example.com/api", want: true},
+		{name: "path sibling", rule: Rule{PathPrefix: "/api"}, url: "https://example.com/apiv2"},
+		{name: "path root prefix", rule: Rule{PathPrefix: "/"}, url: "https://example.com", want: true},
+		{name: "empty path", rule: Rule{PathPrefix: "/api"}, url: "https://example.com"},
+
+		{name: "all parts", rule: Rule{Host: "*.example.com", Scheme: "https", Port: 8443, PathPrefix: "/api"}, url: "https://a.example.com:8443/api/x", want: true},
+		{name: "all parts but the port", rule: Rule{Host: "*.example.com", Scheme: "https", Port: 8443, PathPrefix: "/api"}, url: "https://a.example.com/api/x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Compile(); err != nil {
+				t.Fatal(err)
+			}
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.rule.Match(u); got != tt.want {
+				t.Errorf("%s matching %s = %v, want %v", tt.rule.String(), tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeCheck(t *testing.T) {
+	compile := func(rules ...*Rule) []*Rule {
+		for _, rule := range rules {
+			if err := rule.Compile(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rules
+	}
+	scope := &Scope{
+		In:  compile(&Rule{Host: "*.example.com"}, &Rule{Host: "example.com"}, &Rule{Host: "10.0.0.0/8"}),
+		Out: compile(&Rule{Host: "admin.example.com"}, &Rule{Host: "*.example.com", PathPrefix: "/logout"}),
+	}
+	tests := []struct {
+		url  string
+		want Status
+	}{
+		{"https://api.example.com/users", In},
+		{"https://example.com/", In},
+		{"http://10.0.0.1/", In},
+		{"https://admin.example.com/", Out},         // out-of-scope rules win
+		{"https://api.example.com/logout", Out},     // on the path too
+		{"https://api.example.com/logout-page", In}, // prefixes end at a segment
+		{"https://other.test/", Out},                // no in-scope rule matches
+		{"://bad", Unknown},                         // unparsable
+	}
+	for _, tt := range tests {
+		if got := scope.CheckURL(tt.url); got != tt.want {
+			t.Errorf("CheckURL(%q) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+
+	if got := scope.CheckHostPath("api.example.com", "/logout/now"); got != Out {
+		t.Errorf("CheckHostPath = %s, want out", got)
+	}
+	if got := (&Scope{Out: scope.Out}).CheckURL("https://api.example.com/"); got != Unknown {
+		t.Errorf("without in-scope rules got %s, want unknown", got)
+	}
+	if got := (&Scope{Out: scope.Out}).CheckURL("https://admin.example.com/"); got != Out {
+		t.Errorf("without in-scope rules an out-of-scope URL got %s, want out", got)
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		want string
+	}{
+		{Rule{}, "*"},
+		{Rule{Host: "*.example.com", Scheme: "https", Port: 8443, PathPrefix: "/api"}, "https://*.example.com:8443/api"},
+		{Rule{Host: "10.0.0.0/8"}, "10.0.0.0/8"},
+		{Rule{Scheme: "http", PathPrefix: "/admin"}, "http://*/admin"},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
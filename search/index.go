@@ -0,0 +1,78 @@
+package search
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// sqliteTable is the FTS4 index of my_requests on SQLite, kept in sync by triggers
+	sqliteTable = "request_search"
+	// mysqlColumns is the column list of the FULLTEXT index searched by unscoped terms on MySQL
+	mysqlColumns = "url, req_headers, req_body, res_headers, res_body"
+)
+
+// Migrate creates the full-text index of requests if it is missing. SQLite indexes through an FTS4
+// table and triggers, MySQL through FULLTEXT indexes which it maintains itself.
+// Other databases are left alone, their searches fail.
+func Migrate(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return migrateSQLite(db)
+	case "mysql":
+		return migrateMySQL(db)
+	}
+	return nil
+}
+
+func migrateSQLite(db *gorm.DB) error {
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", sqliteTable).Scan(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	columns := mysqlColumns
+	newColumns := "new.url, new.req_headers, new.req_body, new.res_headers, new.res_body"
+	statements := []string{
+		"CREATE VIRTUAL TABLE " + sqliteTable + " USING fts4(content=\"my_requests\", " + columns + ")",
+		"CREATE TRIGGER " + sqliteTable + "_bu BEFORE UPDATE OF " + columns + " ON my_requests BEGIN " +
+			"DELETE FROM " + sqliteTable + " WHERE docid = old.rowid; END",
+		"CREATE TRIGGER " + sqliteTable + "_bd BEFORE DELETE ON my_requests BEGIN " +
+			"DELETE FROM " + sqliteTable + " WHERE docid = old.rowid; END",
+		"CREATE TRIGGER " + sqliteTable + "_au AFTER UPDATE OF " + columns + " ON my_requests BEGIN " +
+			"INSERT INTO " + sqliteTable + "(docid, " + columns + ") VALUES (new.rowid, " + newColumns + "); END",
+		"CREATE TRIGGER " + sqliteTable + "_ai AFTER INSERT ON my_requests BEGIN " +
+			"INSERT INTO " + sqliteTable + "(docid, " + columns + ") VALUES (new.rowid, " + newColumns + "); END",
+		// index the requests saved before the table existed
+		"INSERT INTO " + sqliteTable + "(" + sqliteTable + ") VALUES ('rebuild')",
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("error creating the search index: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+func migrateMySQL(db *gorm.DB) error {
+	// MATCH needs an index over exactly its columns: one for unscoped terms and one per field
+	indexes := map[string]string{"idx_request_search": mysqlColumns}
+	for _, f := range fields {
+		indexes["idx_request_search_"+f.column] = f.column
+	}
+	for name, columns := range indexes {
+		if db.Migrator().HasIndex("my_requests", name) {
+			continue
+		}
+		if err := db.Exec("CREATE FULLTEXT INDEX " + name + " ON my_requests (" + columns + ")").Error; err != nil {
+			return fmt.Errorf("error creating the search index %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// fields maps the searchable field names to their request columns, in the order snippets are taken
+var fields = []struct {
+	name   string
+	column string
+}{
+	{"url", "url"},
+	{"req.headers", "req_headers"},
+	{"req.body", "req_body"},
+	{"res.headers", "res_headers"},
+	{"res.body", "res_body"},
+}
+
+// Term is a word, a prefix or a phrase, optionally scoped to a field
+type Term struct {
+	Field  string   // field name, empty for every field
+	Tokens []string // lower cased, several for a phrase
+	Prefix bool     // the last token is a prefix
+	Negate bool     // requests matching the term are left out
+}
+
+// Query is a parsed search, every term must match
+type Query struct {
+	Terms []Term
+}
+
+// Parse reads a search made of space separated terms: words, prefixes like tok*, "quoted phrases",
+// field scoped terms like res.body:"access denied" and terms negated with a leading -.
+// Words are split like the index splits text, so a@b.com searches the phrase "a b com".
+func Parse(input string) (*Query, error) {
+	query := &Query{}
+	rest := strings.TrimSpace(input)
+	for rest != "" {
+		var term Term
+		if strings.HasPrefix(rest, "-") && len(rest) > 1 {
+			term.Negate = true
+			rest = rest[1:]
+		}
+		// a known field name before a colon scopes the term, other words with colons like URLs are searched
+		if name, value, ok := strings.Cut(rest, ":"); ok && !strings.ContainsAny(name, " \t\n\"") {
+			if knownField(name) {
+				term.Field, rest = name, value
+			} else if strings.Contains(name, ".") && !strings.Contains(name, "/") {
+				return nil, fmt.Errorf("unknown field '%s', expected one of %s", name, strings.Join(Fields(), ", "))
+			}
+		}
+
+		var text string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in '%s'", rest)
+			}
+			text, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			text, rest = rest[:end], rest[end:]
+		}
+		rest = strings.TrimSpace(rest)
+
+		term.Prefix = strings.HasSuffix(text, "*")
+		for _, token := range tokenize(text) {
+			term.Tokens = append(term.Tokens, token.text)
+		}
+		if len(term.Tokens) == 0 {
+			if term.Field != "" || term.Negate {
+				return nil, fmt.Errorf("missing search words in '%s'", input)
+			}
+			continue // lone punctuation
+		}
+		query.Terms = append(query.Terms, term)
+	}
+
+	for _, term := range query.Terms {
+		if !term.Negate {
+			return query, nil
+		}
+	}
+	return nil, fmt.Errorf("the search needs at least one word that isn't negated")
+}
+
+// Fields lists the field names a search can be scoped to
+func Fields() []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func knownField(name string) bool {
+	return column(name) != ""
+}
+
+func column(name string) string {
+	for _, f := range fields {
+		if f.name == name {
+			return f.column
+		}
+	}
+	return ""
+}
+
+// Apply adds the search to a GORM query on requests, through the index of the database
+func (q *Query) Apply(db *gorm.DB) (*gorm.DB, error) {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return db.Where("id IN (SELECT docid FROM "+sqliteTable+" WHERE "+sqliteTable+" MATCH ?)", q.fts4()), nil
+	case "mysql":
+		for _, term := range q.Terms {
+			columns := mysqlColumns
+			if term.Field != "" {
+				columns = column(term.Field)
+			}
+			condition := "MATCH(" + columns + ") AGAINST (? IN BOOLEAN MODE)"
+			if term.Negate {
+				condition = "NOT " + condition
+			}
+			db = db.Where(condition, term.mysql())
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("full-text search is not supported on %s", db.Dialector.Name())
+	}
+}
+
+// fts4 compiles the query to an FTS4 MATCH expression, negated terms follow the others
+func (q *Query) fts4() string {
+	var b strings.Builder
+	for _, term := range q.Terms {
+		if !term.Negate {
+			if b.Len() > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString(term.fts4())
+		}
+	}
+	for _, term := range q.Terms {
+		if term.Negate {
+			b.WriteString(" NOT " + term.fts4())
+		}
+	}
+	return b.String()
+}
+
+func (t Term) fts4() string {
+	tokens := append([]string(nil), t.Tokens...)
+	if t.Prefix {
+		tokens[len(tokens)-1] += "*"
+	}
+	if len(tokens) == 1 {
+		if t.Field != "" {
+			return column(t.Field) + ":" + tokens[0]
+		}
+		return tokens[0]
+	}
+	phrase := `"` + strings.Join(tokens, " ") + `"`
+	if t.Field == "" {
+		return phrase
+	}
+	// FTS4 can't scope a phrase to a column: the phrase must occur and its words must be next to each other in the column
+	near := make([]string, len(tokens))
+	for i, token := range tokens {
+		near[i] = column(t.Field) + ":" + token
+	}
+	return "(" + phrase + " " + strings.Join(near, " NEAR/0 ") + ")"
+}
+
+// mysql compiles the term to a boolean mode FULLTEXT search, phrases can't end with a prefix there
+func (t Term) mysql() string {
+	if len(t.Tokens) == 1 {
+		if t.Prefix {
+			return "+" + t.Tokens[0] + "*"
+		}
+		return "+" + t.Tokens[0]
+	}
+	return `+"` + strings.Join(t.Tokens, " ") + `"`
+}
+
+// token is a word of a text and its byte offsets
+type token struct {
+	text       string
+	start, end int
+}
+
+// tokenize splits text like the FTS4 simple tokenizer: ASCII letters and digits and every
+// non-ASCII character make words, ASCII letters are lower cased
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if isTokenRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{text: asciiLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{text: asciiLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+func isTokenRune(r rune) bool {
+	return r >= 0x80 || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
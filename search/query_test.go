@@ -0,0 +1,180 @@
+package search
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Term
+	}{
+		{"token", []Term{{Tokens: []string{"token"}}}},
+		{"  Access   DENIED ", []Term{{Tokens: []string{"access"}}, {Tokens: []string{"denied"}}}},
+		{"tok*", []Term{{Tokens: []string{"tok"}, Prefix: true}}},
+		{`"access denied"`, []Term{{Tokens: []string{"access", "denied"}}}},
+		{`res.body:"access denied"`, []Term{{Field: "res.body", Tokens: []string{"access", "denied"}}}},
+		{"req.headers:bearer", []Term{{Field: "req.headers", Tokens: []string{"bearer"}}}},
+		{"url:api* -url:health", []Term{{Field: "url", Tokens: []string{"api"}, Prefix: true}, {Field: "url", Tokens: []string{"health"}, Negate: true}}},
+		{"a@b.com", []Term{{Tokens: []string{"a", "b", "com"}}}},
+		{"https://example.com/api", []Term{{Tokens: []string{"https", "example", "com", "api"}}}},
+		{"token ! ,", []Term{{Tokens: []string{"token"}}}},
+		{"naïve", []Term{{Tokens: []string{"naïve"}}}},
+		{`"a"b`, []Term{{Tokens: []string{"a"}}, {Tokens: []string{"b"}}}},
+	}
+	for _, tt := range tests {
+		query, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if fmt.Sprint(query.Terms) != fmt.Sprint(tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.input, query.Terms, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "the search needs at least one word that isn't negated"},
+		{"-token", "the search needs at least one word that isn't negated"},
+		{"-", "the search needs at least one word that isn't negated"},
+		{"...", "the search needs at least one word that isn't negated"},
+		{`"access denied`, "unterminated quote"},
+		{"res.status:200", "unknown field 'res.status'"},
+		{"url:", "missing search words"},
+		{"url:!!", "missing search words"},
+		{"token -!!", "missing search words"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q): got error %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantFTS4  string
+		wantMySQL []string
+	}{
+		{"token", "token", []string{"+token"}},
+		{"tok*", "tok*", []string{"+tok*"}},
+		{"-debug token", "token NOT debug", []string{"+debug", "+token"}},
+		{`"access denied"`, `"access denied"`, []string{`+"access denied"`}},
+		{`"access den*"`, `"access den*"`, []string{`+"access den"`}},
+		{"url:api", "url:api", []string{"+api"}},
+		{`res.body:"access denied"`, `("access denied" res_body:access NEAR/0 res_body:denied)`, []string{`+"access denied"`}},
+		{"a@b.com", `"a b com"`, []string{`+"a b com"`}},
+		// quotes and operators in the input can't reach the expression as syntax
+		{`x" OR y`, "x or y", []string{"+x", "+or", "+y"}},
+		{`-(a NEAR b`, "near b NOT a", []string{"+a", "+near", "+b"}},
+	}
+	for _, tt := range tests {
+		query, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.input, err)
+		}
+		if got := query.fts4(); got != tt.wantFTS4 {
+			t.Errorf("%q: got FTS4 %q, want %q", tt.input, got, tt.wantFTS4)
+		}
+		mysql := make([]string, len(query.Terms))
+		for i, term := range query.Terms {
+			mysql[i] = term.mysql()
+		}
+		if strings.Join(mysql, " ") != strings.Join(tt.wantMySQL, " ") {
+			t.Errorf("%q: got MySQL %q, want %q", tt.input, mysql, tt.wantMySQL)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("GET /api/v1?q=Héllo wörld")
+	var got []string
+	for _, token := range tokens {
+		got = append(got, fmt.Sprintf("%s@%d-%d", token.text, token.start, token.end))
+	}
+	want := []string{"get@0-3", "api@5-8", "v1@9-11", "q@12-13", "héllo@14-20", "wörld@21-27"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestApplySQLite(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.MyRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	requests := []*models.MyRequest{
+		{URL: "https://example.com/api/login", ReqBody: `{"user":"admin"}`, ResBody: "access denied for admin"},
+		{URL: "https://example.com/api/health", ResBody: "ok", ResHeaders: `[{"name":"X-Debug","value":"token123"}]`},
+		{URL: "https://example.com/admin", ResBody: "denied access"},
+	}
+	for _, req := range requests {
+		req.Method, req.Domain = "GET", "example.com"
+		if err := db.Create(req).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  []int // indexes into requests
+	}{
+		{"admin", []int{0, 2}},
+		{"adm*", []int{0, 2}},
+		{`"access denied"`, []int{0}},
+		{`res.body:"access denied"`, []int{0}},
+		{`res.body:"denied access"`, []int{2}},
+		{"res.body:admin", []int{0}},
+		{"url:admin", []int{2}},
+		{"api -health", []int{0}},
+		{"token123", []int{1}},
+		{"res.headers:debug", []int{1}},
+		{"nothing", nil},
+		{`admin" OR health`, nil},
+	}
+	for _, tt := range tests {
+		query, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.input, err)
+		}
+		filtered, err := query.Apply(db.Model(&models.MyRequest{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		if err := filtered.Pluck("id", &ids).Error; err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		sort.Ints(ids)
+		var want []int
+		for _, i := range tt.want {
+			want = append(want, requests[i].Id)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(want) {
+			t.Errorf("%q matched %v, want %v", tt.input, ids, want)
+		}
+	}
+}
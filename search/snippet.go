@@ -0,0 +1,140 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// snippetWidth is about how many bytes of text a snippet shows around its first match
+const snippetWidth = 120
+
+// Snippet is an excerpt of a field showing where the search matched, HTML escaped with the
+// matching words wrapped in <mark>
+type Snippet struct {
+	Field string
+	Text  string
+}
+
+// Snippets excerpts the fields of a request that the non-negated terms match, at most max of them.
+// values maps field names to their text, fields without a match are skipped.
+func (q *Query) Snippets(values map[string]string, max int) []Snippet {
+	var snippets []Snippet
+	for _, f := range fields {
+		if len(snippets) >= max {
+			break
+		}
+		text := values[f.name]
+		if text == "" {
+			continue
+		}
+		matches := q.matches(f.name, tokenize(text))
+		if len(matches) == 0 {
+			continue
+		}
+		snippets = append(snippets, Snippet{Field: f.name, Text: excerpt(text, matches)})
+	}
+	return snippets
+}
+
+// span is the byte range of a match in a text
+type span struct {
+	start, end int
+}
+
+// matches finds the token sequences of the field matching a non-negated term, in text order
+func (q *Query) matches(field string, tokens []token) []span {
+	var spans []span
+	for i := range tokens {
+		for _, term := range q.Terms {
+			if term.Negate || (term.Field != "" && term.Field != field) {
+				continue
+			}
+			if n := len(term.Tokens); term.matchAt(tokens, i) {
+				spans = append(spans, span{tokens[i].start, tokens[i+n-1].end})
+				break
+			}
+		}
+	}
+	return spans
+}
+
+func (t Term) matchAt(tokens []token, i int) bool {
+	if i+len(t.Tokens) > len(tokens) {
+		return false
+	}
+	for j, want := range t.Tokens {
+		got := tokens[i+j].text
+		if t.Prefix && j == len(t.Tokens)-1 {
+			if !strings.HasPrefix(got, want) {
+				return false
+			}
+		} else if got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// excerpt cuts a window of the text around the first match and highlights the matches inside it
+func excerpt(text string, matches []span) string {
+	first := matches[0]
+	start := first.start - (snippetWidth-(first.end-first.start))/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetWidth
+	if end < first.end {
+		end = first.end
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, match := range matches {
+		if match.start < pos || match.end > end {
+			continue
+		}
+		b.WriteString(flatten(text[pos:match.start]))
+		b.WriteString("<mark>" + flatten(text[match.start:match.end]) + "</mark>")
+		pos = match.end
+	}
+	b.WriteString(flatten(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// flatten escapes text for HTML and puts it on one line, runs of white space become a single space
+func flatten(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range html.EscapeString(text) {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/pathnorm"
+	"github.com/linn221/RequesterBackend/scope"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// endpointResolver maps imported requests onto the endpoints of a program.
+// Endpoints are keyed on domain:method:templated path; existing endpoints are
+// reused and only the missing ones are created. Paths matching the template of an
+// endpoint documented by an OpenAPI spec are mapped onto it before normalization.
+// Requests and the endpoints created for them get their scope from the program's scope rules.
+type endpointResolver struct {
+	db         *gorm.DB
+	programId  int
+	note       string
+	normalizer *pathnorm.Normalizer
+	ids        map[string]int
+	documented map[string][]*documentedEndpoint // keyed on domain:method
+	scope      *scope.Scope
+}
+
+type documentedEndpoint struct {
+	id       int
+	template *pathnorm.Template
+}
+
+// newEndpointResolver loads the existing endpoints of the program, note is used for endpoints it creates
+func newEndpointResolver(ctx context.Context, db *gorm.DB, programId int, note string) (*endpointResolver, error) {
+	var endpoints []*models.Endpoint
+	err := db.WithContext(ctx).
+		Select("id", "domain", "method", "uri", "documented").
+		Where("program_id = ?", programId).
+		Order("id ASC").
+		Find(&endpoints).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load endpoints: %v", err)
+	}
+
+	normalizer, err := loadPathNormalizer(ctx, db, programId)
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := loadScope(ctx, db, programId)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &endpointResolver{
+		db:         db,
+		programId:  programId,
+		note:       note,
+		normalizer: normalizer,
+		ids:        make(map[string]int, len(endpoints)),
+		documented: make(map[string][]*documentedEndpoint),
+		scope:      loaded.scope,
+	}
+	for _, endpoint := range endpoints {
+		key := endpointKey(endpoint.Domain, endpoint.Method, endpoint.URI)
+		// keep the oldest endpoint when duplicates exist from earlier imports
+		if _, exists := r.ids[key]; !exists {
+			r.ids[key] = endpoint.Id
+		}
+		if endpoint.Documented {
+			methodKey := endpointKey(endpoint.Domain, endpoint.Method, "")
+			r.documented[methodKey] = append(r.documented[methodKey], &documentedEndpoint{
+				id:       endpoint.Id,
+				template: pathnorm.CompileTemplate(endpoint.URI),
+			})
+		}
+	}
+	return r, nil
+}
+
+// matchDocumented returns the documented endpoint whose template fits the path,
+// preferring the one with the most literal segments so /users/me wins over /users/{id}
+func (r *endpointResolver) matchDocumented(domain, method, path string) (int, bool) {
+	var best *documentedEndpoint
+	for _, endpoint := range r.documented[endpointKey(domain, method, "")] {
+		if !endpoint.template.Match(path) {
+			continue
+		}
+		if best == nil || endpoint.template.Literals() > best.template.Literals() {
+			best = endpoint
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	return best.id, true
+}
+
+// endpointKey builds the key endpoints are grouped by
+func endpointKey(domain, method, path string) string {
+	return fmt.Sprintf("%s:%s:%s", domain, method, path)
+}
+
+// endpointPath returns the path part of a request URL used for endpoint grouping
+func endpointPath(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Path == "" {
+		return "/", nil
+	}
+	return u.Path, nil
+}
+
+// Assign sets EndpointId and Scope on every request, creating the endpoints that don't exist yet.
+// Requests must have Domain, Method and URL set.
+func (r *endpointResolver) Assign(ctx context.Context, requests []*models.MyRequest) error {
+	keys := make([]string, len(requests))
+	documentedIds := make([]int, len(requests))
+	var missing []*models.Endpoint
+	for i, req := range requests {
+		path, err := endpointPath(req.URL)
+		if err != nil {
+			return fmt.Errorf("invalid request URL '%s': %v", req.URL, err)
+		}
+		req.Scope = string(r.scope.CheckURL(req.URL))
+		if id, ok := r.matchDocumented(req.Domain, req.Method, path); ok {
+			documentedIds[i] = id
+			continue
+		}
+		path = r.normalizer.Normalize(path)
+		keys[i] = endpointKey(req.Domain, req.Method, path)
+		if _, exists := r.ids[keys[i]]; exists {
+			continue
+		}
+		endpoint := &models.Endpoint{
+			ProgramId:    r.programId,
+			Method:       req.Method,
+			Domain:       req.Domain,
+			URI:          path,
+			EndpointType: models.EndpointTypeAPI, // Default to API
+			Note:         r.note,
+			Scope:        string(r.scope.CheckHostPath(req.Domain, path)),
+		}
+		missing = append(missing, endpoint)
+		r.ids[keys[i]] = 0 // reserved until the endpoint is created
+	}
+
+	if err := r.create(ctx, missing); err != nil {
+		return err
+	}
+
+	for i, req := range requests {
+		if documentedIds[i] != 0 {
+			req.EndpointId = documentedIds[i]
+			continue
+		}
+		req.EndpointId = r.ids[keys[i]]
+	}
+	return nil
+}
+
+// create inserts endpoints and records their ids under their keys. Another import of the program may create
+// the same endpoints meanwhile, the unique key lets one of them win and the ids are read back rather than
+// trusted from the insert.
+func (r *endpointResolver) create(ctx context.Context, missing []*models.Endpoint) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(missing, importBatchSize).Error
+	if err != nil {
+		return fmt.Errorf("failed to create endpoints: %v", err)
+	}
+	return r.loadCreated(ctx, missing)
+}
+
+// loadCreated reads the ids of endpoints just created, by this resolver or by a concurrent one
+func (r *endpointResolver) loadCreated(ctx context.Context, created []*models.Endpoint) error {
+	keys := make(map[string]string, len(created)) // key hash to resolver key
+	hashes := make([]string, 0, len(created))
+	for _, endpoint := range created {
+		keys[*endpoint.KeyHash] = endpointKey(endpoint.Domain, endpoint.Method, endpoint.URI)
+		hashes = append(hashes, *endpoint.KeyHash)
+	}
+	for start := 0; start < len(hashes); start += importBatchSize {
+		chunk := hashes[start:min(start+importBatchSize, len(hashes))]
+		query := r.db.WithContext(ctx).Model(&models.Endpoint{}).Select("id", "key_hash").
+			Where("program_id = ? AND key_hash IN ?", r.programId, chunk)
+		if r.db.Dialector.Name() == "mysql" {
+			// a locking read sees the endpoints committed by others since the transaction started
+			query = query.Clauses(clause.Locking{Strength: "SHARE"})
+		}
+		var endpoints []*models.Endpoint
+		if err := query.Find(&endpoints).Error; err != nil {
+			return fmt.Errorf("failed to load endpoints: %v", err)
+		}
+		for _, endpoint := range endpoints {
+			r.ids[keys[*endpoint.KeyHash]] = endpoint.Id
+		}
+	}
+	for _, endpoint := range created {
+		if key := keys[*endpoint.KeyHash]; r.ids[key] == 0 {
+			return fmt.Errorf("failed to create endpoint %s", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+func TestEndpointResolverAssignConcurrentImports(t *testing.T) {
+	db, programId := newTestDB(t)
+	ctx := context.Background()
+
+	// both resolvers load the endpoints before either creates any, as two imports running side by side do
+	first, err := newEndpointResolver(ctx, db, programId, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newEndpointResolver(ctx, db, programId, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRequests := func() []*models.MyRequest {
+		return []*models.MyRequest{
+			{Domain: "example.com", Method: "GET", URL: "https://example.com/users/1"},
+			{Domain: "example.com", Method: "GET", URL: "https://example.com/users/2"},
+			{Domain: "example.com", Method: "POST", URL: "https://example.com/login"},
+		}
+	}
+	firstRequests, secondRequests := newRequests(), newRequests()
+	if err := first.Assign(ctx, firstRequests); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Assign(ctx, secondRequests); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	if err := db.Model(&models.Endpoint{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got %d endpoints, want 2", count)
+	}
+	for i := range firstRequests {
+		if firstRequests[i].EndpointId == 0 || firstRequests[i].EndpointId != secondRequests[i].EndpointId {
+			t.Errorf("request %d: endpoint %d and %d, want the same one", i, firstRequests[i].EndpointId, secondRequests[i].EndpointId)
+		}
+	}
+}
+
+func TestEndpointServiceCreateDuplicate(t *testing.T) {
+	db, programId := newTestDB(t)
+	ctx := context.Background()
+	service := &EndpointService{DB: db}
+
+	newEndpoint := func(uri string) *models.Endpoint {
+		return &models.Endpoint{ProgramId: programId, Domain: "example.com", Method: "GET", URI: uri}
+	}
+	if _, err := service.Create(ctx, newEndpoint("/users")); err != nil {
+		t.Fatal(err)
+	}
+	id, err := service.Create(ctx, newEndpoint("/posts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Create(ctx, newEndpoint("/users")); !errors.Is(err, utils.ErrBadRequest) {
+		t.Errorf("create duplicate: got %v, want a bad request", err)
+	}
+	if _, err := service.Update(ctx, id, newEndpoint("/users")); !errors.Is(err, utils.ErrBadRequest) {
+		t.Errorf("update onto another endpoint: got %v, want a bad request", err)
+	}
+	if _, err := service.Update(ctx, id, newEndpoint("/posts")); err != nil {
+		t.Errorf("update keeping the URI: %v", err)
+	}
+}
+
+func TestEndpointServiceNormalizeRekeys(t *testing.T) {
+	db, programId := newTestDB(t)
+	ctx := context.Background()
+
+	var ids []int
+	for _, uri := range []string{"/users/1", "/users/2", "/users/{id}"} {
+		endpoint := &models.Endpoint{ProgramId: programId, Domain: "example.com", Method: "GET", URI: uri}
+		if err := db.Create(endpoint).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, endpoint.Id)
+	}
+
+	// the oldest endpoint is kept and takes the URI of the newest one it absorbs
+	result, err := (&EndpointService{DB: db}).Normalize(ctx, programId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.EndpointsMerged != 2 || result.EndpointsUpdated != 1 {
+		t.Errorf("got %d merged and %d updated, want 2 and 1", result.EndpointsMerged, result.EndpointsUpdated)
+	}
+	var endpoints []*models.Endpoint
+	if err := db.Find(&endpoints).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].Id != ids[0] || endpoints[0].URI != "/users/{id}" {
+		t.Fatalf("got %+v, want endpoint %d with /users/{id}", endpoints, ids[0])
+	}
+	want := models.EndpointKeyHash("example.com", "GET", "/users/{id}")
+	if endpoints[0].KeyHash == nil || *endpoints[0].KeyHash != want {
+		t.Errorf("got key hash %v, want %s", endpoints[0].KeyHash, want)
+	}
+}
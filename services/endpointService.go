@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/utils"
 	"gorm.io/gorm"
 )
 
@@ -11,6 +12,19 @@ type EndpointService struct {
 	DB *gorm.DB
 }
 
+// endpointSorts are the sort keys of the endpoint list
+var endpointSorts = Sorts{
+	"program_id":    "program_id",
+	"domain":        "domain",
+	"uri":           "uri",
+	"method":        "method",
+	"endpoint_type": "endpoint_type",
+	"documented":    "documented",
+	"scope":         "scope",
+	"created_at":    "created_at",
+	"updated_at":    "updated_at",
+}
+
 // NewInstance returns a copy of the service with a new transaction
 func (s *EndpointService) NewInstance(ctx context.Context) (*EndpointService, func(), func() error) {
 	tx := s.DB.WithContext(ctx).Begin()
@@ -31,6 +45,16 @@ func (s *EndpointService) CloneWithDb(db *gorm.DB) *EndpointService {
 }
 
 func (s *EndpointService) validate(db *gorm.DB, id int, input *models.Endpoint) error {
+	var count int64
+	err := db.Model(&models.Endpoint{}).
+		Where("program_id = ? AND key_hash = ? AND id <> ?", input.ProgramId, models.EndpointKeyHash(input.Domain, input.Method, input.URI), id).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return utils.BadRequest("the program already has an endpoint with this domain, method and URI")
+	}
 	return nil
 }
 
@@ -39,6 +63,11 @@ func (s *EndpointService) Create(ctx context.Context, endpoint *models.Endpoint)
 	if err := s.validate(s.DB.WithContext(ctx), 0, endpoint); err != nil {
 		return 0, err
 	}
+	loaded, err := loadScope(ctx, s.DB, endpoint.ProgramId)
+	if err != nil {
+		return 0, err
+	}
+	endpoint.Scope = string(loaded.scope.CheckHostPath(endpoint.Domain, endpoint.URI))
 	if err := s.DB.WithContext(ctx).Create(endpoint).Error; err != nil {
 		return 0, err
 	}
@@ -54,12 +83,49 @@ func (s *EndpointService) Get(ctx context.Context, id int) (*models.Endpoint, er
 	return &endpoint, nil
 }
 
-// List retrieves all endpoints
-func (s *EndpointService) List(ctx context.Context) ([]*models.Endpoint, error) {
+// List retrieves all endpoints, optionally filtered by program, scope, whether a spec documents them
+// and whether traffic (requests other than templates) was captured for them
+func (s *EndpointService) List(ctx context.Context, programId *int, scope string, documented, exercised *bool, page *Page, fields Fields) ([]*models.Endpoint, error) {
+	query := s.DB.WithContext(ctx).Model(&models.Endpoint{})
+	if programId != nil {
+		query = query.Where("program_id = ?", *programId)
+	}
+	if scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if documented != nil {
+		query = query.Where("documented = ?", *documented)
+	}
+	if exercised != nil {
+		exists := "EXISTS (SELECT 1 FROM my_requests WHERE my_requests.endpoint_id = endpoints.id AND my_requests.is_template = ?)"
+		if *exercised {
+			query = query.Where(exists, false)
+		} else {
+			query = query.Where("NOT "+exists, false)
+		}
+	}
+
+	query, err := page.apply(query, endpointSorts, "")
+	if err != nil {
+		return nil, err
+	}
+	if fields.Has("program_name", "text") {
+		query = query.Preload("Program")
+	}
+	if fields.Has("text") {
+		query = query.Preload("Notes").Preload("Attachments")
+	}
+	if fields.Has("tags") {
+		query = query.Preload("Taggables.Tag")
+	}
+
 	var endpoints []*models.Endpoint
-	if err := s.DB.WithContext(ctx).Preload("Program").Preload("Notes").Preload("Attachments").Preload("Taggables.Tag").Find(&endpoints).Error; err != nil {
+	if err := query.Find(&endpoints).Error; err != nil {
 		return nil, err
 	}
+	if len(endpoints) > 0 {
+		page.next(len(endpoints), endpoints[len(endpoints)-1])
+	}
 	return endpoints, nil
 }
 
@@ -74,6 +140,10 @@ func (s *EndpointService) Update(ctx context.Context, id int, input *models.Endp
 	if err != nil {
 		return 0, err
 	}
+	loaded, err := loadScope(ctx, s.DB, input.ProgramId)
+	if err != nil {
+		return 0, err
+	}
 	updates := map[string]any{ // from EndpointInput
 		"ProgramId":    input.ProgramId,
 		"Method":       input.Method,
@@ -81,6 +151,8 @@ func (s *EndpointService) Update(ctx context.Context, id int, input *models.Endp
 		"URI":          input.URI,
 		"EndpointType": input.EndpointType,
 		"Note":         input.Note,
+		"Scope":        string(loaded.scope.CheckHostPath(input.Domain, input.URI)),
+		"KeyHash":      models.EndpointKeyHash(input.Domain, input.Method, input.URI),
 	}
 	if err := s.DB.WithContext(ctx).Model(&endpoint).Updates(updates).Error; err != nil {
 		return 0, err
@@ -115,3 +187,100 @@ func (s *EndpointService) Delete(ctx context.Context, id int) (int, error) {
 
 	return endpoint.Id, tx.Commit().Error
 }
+
+// EndpointNormalizeResult summarizes a re-normalization of a program's endpoints
+type EndpointNormalizeResult struct {
+	EndpointsUpdated int
+	EndpointsMerged  int
+	RequestsMoved    int64
+}
+
+// Normalize re-templates the URIs of a program's endpoints with its current path patterns.
+// Endpoints that end up with the same domain, method and URI are merged into the documented or oldest one,
+// their requests, notes, attachments, images and tags are moved over.
+func (s *EndpointService) Normalize(ctx context.Context, programId int) (*EndpointNormalizeResult, error) {
+	if _, err := first[models.Program](s.DB.WithContext(ctx), programId); err != nil {
+		return nil, err
+	}
+	normalizer, err := loadPathNormalizer(ctx, s.DB, programId)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []*models.Endpoint
+	// documented endpoints come first so they are kept when others collapse onto their URI
+	if err := s.DB.WithContext(ctx).Where("program_id = ?", programId).Order("documented DESC, id ASC").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	result := &EndpointNormalizeResult{}
+	keepers := make(map[string]int, len(endpoints))
+	var rekeyed []*models.Endpoint // keepers with a new URI, or without a key hash
+	for _, endpoint := range endpoints {
+		uri := endpoint.URI
+		if !endpoint.Documented { // the URIs of a spec are already templated
+			uri = normalizer.Normalize(endpoint.URI)
+		}
+		key := endpointKey(endpoint.Domain, endpoint.Method, uri)
+
+		keeperId, exists := keepers[key]
+		if !exists {
+			keepers[key] = endpoint.Id
+			if uri != endpoint.URI {
+				endpoint.URI = uri
+				rekeyed = append(rekeyed, endpoint)
+				result.EndpointsUpdated++
+			} else if endpoint.KeyHash == nil {
+				rekeyed = append(rekeyed, endpoint)
+			}
+			continue
+		}
+
+		// merge into the keeper
+		moved := tx.Model(&models.MyRequest{}).Where("endpoint_id = ?", endpoint.Id).Update("endpoint_id", keeperId)
+		if moved.Error != nil {
+			return nil, moved.Error
+		}
+		result.RequestsMoved += moved.RowsAffected
+		for _, model := range []any{&models.Note{}, &models.Attachment{}, &models.Image{}} {
+			err := tx.Model(model).
+				Where("reference_type = ? AND reference_id = ?", models.TaggableTypeEndpoints, endpoint.Id).
+				Update("reference_id", keeperId).Error
+			if err != nil {
+				return nil, err
+			}
+		}
+		err := tx.Model(&models.Taggable{}).
+			Where("taggable_type = ? AND taggable_id = ?", models.TaggableTypeEndpoints, endpoint.Id).
+			Update("taggable_id", keeperId).Error
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Delete(endpoint).Error; err != nil {
+			return nil, err
+		}
+		result.EndpointsMerged++
+	}
+
+	// the merged endpoints are gone, the keys of the keepers are cleared before they are set again so that
+	// one keeper can take the URI another one leaves
+	for _, endpoint := range rekeyed {
+		if err := tx.Model(endpoint).Update("KeyHash", nil).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, endpoint := range rekeyed {
+		updates := map[string]any{
+			"URI":     endpoint.URI,
+			"KeyHash": models.EndpointKeyHash(endpoint.Domain, endpoint.Method, endpoint.URI),
+		}
+		if err := tx.Model(endpoint).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return result, tx.Commit().Error
+}
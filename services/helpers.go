@@ -1,6 +1,31 @@
 package services
 
-import "gorm.io/gorm"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+// importBatchSize is how many requests are inserted per batch during imports
+const importBatchSize = 100
+
+// setRequestHashes sets the hashes requests are deduplicated by, the same whatever the source: the
+// method, URL, body and headers of the request, and the status, headers and body of the response
+func setRequestHashes(req *models.MyRequest, reqHeaders, resHeaders []models.Header, resBody []byte) {
+	req.ReqHash = utils.HashString(req.Method + " " + req.URL + " " + req.ReqBody + " " + models.HeaderSlice(reqHeaders).EchoAll())
+	req.ReqHash1 = req.ReqHash
+	req.ResHash = utils.HashString(fmt.Sprintf("%d %s", req.ResStatus, models.HeaderSlice(resHeaders).EchoAll()) + string(resBody))
+	req.ResBodyHash = utils.HashString(string(resBody))
+}
 
 func first[T any](db *gorm.DB, id int) (*T, error) {
 	var v T
@@ -10,3 +35,123 @@ func first[T any](db *gorm.DB, id int) (*T, error) {
 
 	return &v, nil
 }
+
+// saveImportFile stores an uploaded import file under uploadDir/imports so a worker can process it later
+func saveImportFile(uploadDir string, file io.Reader, filename string) (string, error) {
+	dir := filepath.Join(uploadDir, "imports")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create import directory: %v", err)
+	}
+
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	filePath := filepath.Join(dir, hex.EncodeToString(bytes)+filepath.Ext(filename))
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create import file: %v", err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, file); err != nil {
+		os.Remove(filePath)
+		return "", fmt.Errorf("failed to save import file: %v", err)
+	}
+	return filePath, nil
+}
+
+// filterHeaders filters out ignored headers from a HeaderSlice
+func filterHeaders(headers []models.Header, ignoredHeaders string) []models.Header {
+	if ignoredHeaders == "" {
+		return headers
+	}
+
+	ignoredList := strings.Split(ignoredHeaders, ",")
+	ignoredMap := make(map[string]struct{})
+	for _, h := range ignoredList {
+		ignoredMap[strings.ToLower(strings.TrimSpace(h))] = struct{}{}
+	}
+
+	var filtered []models.Header
+	for _, h := range headers {
+		if _, ignored := ignoredMap[strings.ToLower(h.Name)]; !ignored {
+			filtered = append(filtered, h)
+		}
+	}
+
+	return filtered
+}
+
+// idChunkSize keeps IN clauses below the bound variable limit of SQLite
+const idChunkSize = 500
+
+// chunkIds splits ids into slices of at most idChunkSize elements
+func chunkIds(ids []int) [][]int {
+	var chunks [][]int
+	for start := 0; start < len(ids); start += idChunkSize {
+		chunks = append(chunks, ids[start:min(start+idChunkSize, len(ids))])
+	}
+	return chunks
+}
+
+// chunkStrings splits values into slices of at most idChunkSize elements
+func chunkStrings(values []string) [][]string {
+	var chunks [][]string
+	for start := 0; start < len(values); start += idChunkSize {
+		chunks = append(chunks, values[start:min(start+idChunkSize, len(values))])
+	}
+	return chunks
+}
+
+// deleteReferences removes the notes, attachments, images and tags attached to the given resources.
+// It returns the paths of the deleted attachment and image files so the caller can remove them
+// from disk once the transaction has been committed.
+func deleteReferences(tx *gorm.DB, referenceType string, ids []int) ([]string, error) {
+	var filePaths []string
+	for _, chunk := range chunkIds(ids) {
+		var noteIds []int
+		if err := tx.Model(&models.Note{}).Where("reference_type = ? AND reference_id IN ?", referenceType, chunk).Pluck("id", &noteIds).Error; err != nil {
+			return nil, err
+		}
+		for _, noteChunk := range chunkIds(noteIds) {
+			if err := tx.Where("taggable_type = ? AND taggable_id IN ?", models.TaggableTypeNotes, noteChunk).Delete(&models.Taggable{}).Error; err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Where("reference_type = ? AND reference_id IN ?", referenceType, chunk).Delete(&models.Note{}).Error; err != nil {
+			return nil, err
+		}
+
+		var paths []string
+		if err := tx.Model(&models.Attachment{}).Where("reference_type = ? AND reference_id IN ?", referenceType, chunk).Pluck("file_path", &paths).Error; err != nil {
+			return nil, err
+		}
+		filePaths = append(filePaths, paths...)
+		if err := tx.Where("reference_type = ? AND reference_id IN ?", referenceType, chunk).Delete(&models.Attachment{}).Error; err != nil {
+			return nil, err
+		}
+
+		paths = nil
+		if err := tx.Model(&models.Image{}).Where("reference_type = ? AND reference_id IN ?", referenceType, chunk).Pluck("file_path", &paths).Error; err != nil {
+			return nil, err
+		}
+		filePaths = append(filePaths, paths...)
+		if err := tx.Where("reference_type = ? AND reference_id IN ?", referenceType, chunk).Delete(&models.Image{}).Error; err != nil {
+			return nil, err
+		}
+
+		if err := tx.Where("taggable_type = ? AND taggable_id IN ?", referenceType, chunk).Delete(&models.Taggable{}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return filePaths, nil
+}
+
+// removeFiles deletes files from disk, ignoring files that are already gone
+func removeFiles(filePaths []string) {
+	for _, filePath := range filePaths {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove file %s: %v", filePath, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/search"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a migrated SQLite database holding one program, whose id is returned
+func newTestDB(t *testing.T) (*gorm.DB, int) {
+	t.Helper()
+	// transactions take the write lock when they begin, so concurrent ones queue up instead of failing
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_txlock=immediate&_busy_timeout=10000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(
+		&models.Program{},
+		&models.ImportJob{},
+		&models.IngestBatch{},
+		&models.Tag{},
+		&models.Taggable{},
+		&models.PathPattern{},
+		&models.ScopeRule{},
+		&models.Endpoint{},
+		&models.MyRequest{},
+		&models.Vuln{},
+		&models.Attachment{},
+		&models.Image{},
+		&models.Note{},
+		&models.PatternSearch{},
+		&models.PatternMatch{},
+		&models.SavedSearch{},
+		&models.CollectionItem{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := search.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	program := &models.Program{Name: "test", Domains: "example.com"}
+	if err := db.Create(program).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db, program.Id
+}
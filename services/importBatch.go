@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/linn221/RequesterBackend/models"
+	"gorm.io/gorm"
+)
+
+// queueImport stores an uploaded file and queues job to import it, returning the job id.
+// The file path, original name and status of the job are set here.
+func queueImport(ctx context.Context, db *gorm.DB, runner *JobRunner, uploadDir string, file io.Reader, filename string, job *models.ImportJob) (int, error) {
+	filePath, err := saveImportFile(uploadDir, file, filename)
+	if err != nil {
+		return 0, err
+	}
+	job.FilePath = filePath
+	job.OriginalName = filename
+	job.Status = models.JobStatusQueued
+
+	if err := db.WithContext(ctx).Create(job).Error; err != nil {
+		os.Remove(filePath)
+		return 0, fmt.Errorf("failed to create import job: %v", err)
+	}
+
+	runner.Enqueue(job.Id)
+	return job.Id, nil
+}
+
+// importRequests saves the requests read by next in bounded batches and reports progress with each batch.
+// next returns io.EOF after the last item and a nil request for items it skips. New endpoints get note,
+// filter is nil for imports that keep every request.
+func importRequests(ctx context.Context, db *gorm.DB, job *models.ImportJob, progress *JobProgress, note string, filter *importFilter, next func(sequence int) (*models.MyRequest, error)) error {
+	if job.ProgramId == nil {
+		return fmt.Errorf("import job has no program")
+	}
+	programId := *job.ProgramId
+
+	endpoints, err := newEndpointResolver(ctx, db, programId, note)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]*models.MyRequest, 0, importBatchSize)
+	pending := 0
+	saveBatch := func() error {
+		if len(batch) > 0 {
+			if err := endpoints.Assign(ctx, batch); err != nil {
+				return err
+			}
+			if err := db.WithContext(ctx).Create(batch).Error; err != nil {
+				return fmt.Errorf("failed to create requests: %v", err)
+			}
+		}
+		if err := progress.Add(ctx, pending); err != nil {
+			return err
+		}
+		// the counts are saved with every batch so they match the saved requests when the job fails or is cancelled
+		if filter != nil {
+			if err := filter.Save(ctx, db, job); err != nil {
+				return err
+			}
+		}
+		batch = make([]*models.MyRequest, 0, importBatchSize)
+		pending = 0
+		return nil
+	}
+
+	for sequence := 1; ; sequence++ {
+		req, err := next(sequence)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		pending++
+
+		if req != nil && (filter == nil || filter.Check(req.URL) == filterKeep) {
+			req.Sequence = sequence
+			req.ImportJobId = job.Id
+			req.ProgramId = &programId
+			batch = append(batch, req)
+		}
+		// skipped items make up a batch too so progress keeps moving
+		if pending >= importBatchSize {
+			if err := saveBatch(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return saveBatch()
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+func TestImportRequests(t *testing.T) {
+	db, programId := newTestDB(t)
+	ctx := context.Background()
+	job := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypeImportHar, Title: "batches", Status: models.JobStatusRunning,
+		ApplyScope: true}
+	if err := db.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newImportFilter(ctx, db, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress := &JobProgress{db: db, events: NewJobEvents(), job: job, every: importBatchSize}
+
+	// every third item is skipped, every fifth one is out of scope
+	const items = 2*importBatchSize + 10
+	var saved []int
+	err = importRequests(ctx, db, job, progress, "batches", filter, func(sequence int) (*models.MyRequest, error) {
+		switch {
+		case sequence > items:
+			return nil, io.EOF
+		case sequence%3 == 0:
+			return nil, nil
+		case sequence%5 == 0:
+			return &models.MyRequest{Method: "GET", URL: "https://other.test/", Domain: "other.test"}, nil
+		}
+		saved = append(saved, sequence)
+		return &models.MyRequest{Method: "GET", URL: fmt.Sprintf("https://example.com/%d", sequence), Domain: "example.com"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []*models.MyRequest
+	if err := db.Where("import_job_id = ?", job.Id).Order("sequence ASC").Find(&requests).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != len(saved) {
+		t.Fatalf("got %d requests, want %d", len(requests), len(saved))
+	}
+	for i, request := range requests {
+		if request.Sequence != saved[i] || request.ProgramId == nil || *request.ProgramId != programId || request.EndpointId == 0 {
+			t.Errorf("got request %d with sequence %d, program %v, endpoint %d", i, request.Sequence, request.ProgramId, request.EndpointId)
+		}
+	}
+
+	stored, err := first[models.ImportJob](db, job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the runner flushes the progress of the last batch when the job finishes
+	if job.ProcessedItems != items || stored.KeptItems != len(saved) || stored.OutOfScopeItems != items/5-items/15 {
+		t.Errorf("got processed %d, kept %d, out of scope %d", job.ProcessedItems, stored.KeptItems, stored.OutOfScopeItems)
+	}
+}
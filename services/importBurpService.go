@@ -8,53 +8,20 @@ import (
 	"io"
 	"log"
 	"net/url"
+	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/linn221/RequesterBackend/models"
-	"github.com/linn221/RequesterBackend/utils"
+	"github.com/linn221/RequesterBackend/rawhttp"
 	"gorm.io/gorm"
 )
 
 type ImportBurpService struct {
-	DB *gorm.DB
-}
-
-// filterHeaders filters out ignored headers from a HeaderSlice
-func (s *ImportBurpService) filterHeaders(headers []models.Header, ignoredHeaders string) []models.Header {
-	if ignoredHeaders == "" {
-		return headers
-	}
-
-	ignoredList := strings.Split(ignoredHeaders, ",")
-	ignoredMap := make(map[string]struct{})
-	for _, h := range ignoredList {
-		ignoredMap[strings.ToLower(strings.TrimSpace(h))] = struct{}{}
-	}
-
-	var filtered []models.Header
-	for _, h := range headers {
-		if _, ignored := ignoredMap[strings.ToLower(h.Name)]; !ignored {
-			filtered = append(filtered, h)
-		}
-	}
-
-	return filtered
-}
-
-// resHashFunc is used to generate request and response hashes
-func (s *ImportBurpService) resHashFunc(req *models.MyRequest) (string, string) {
-	// Generate request text
-	reqHeadersFromJSON, _ := models.HeaderSliceFromJSON(req.ReqHeaders)
-	requestText := req.Method + " " + req.URL + " " + req.ReqBody + " " + reqHeadersFromJSON.EchoAll()
-
-	// Generate response text
-	resHeadersFromJSON, _ := models.HeaderSliceFromJSON(req.ResHeaders)
-	responseText := fmt.Sprintf("%d %s", req.ResStatus, resHeadersFromJSON.EchoAll()) + req.ResBody
-
-	return requestText, responseText
+	DB              *gorm.DB
+	Runner          *JobRunner
+	UploadDirectory string
 }
 
 // BurpXML represents the structure of a Burp Suite XML file
@@ -72,201 +39,133 @@ type BurpItem struct {
 	Path      string `xml:"path"`
 	Extension string `xml:"extension"`
 	Request   struct {
-		Base64 string `xml:",chardata"`
+		IsBase64 string `xml:"base64,attr"`
+		Base64   string `xml:",chardata"`
 	} `xml:"request"`
-	Response struct {
-		Base64 string `xml:",chardata"`
+	Status         int    `xml:"status"`
+	ResponseLength int    `xml:"responselength"`
+	MimeType       string `xml:"mimetype"`
+	Response       struct {
+		IsBase64 string `xml:"base64,attr"`
+		Base64   string `xml:",chardata"`
 	} `xml:"response"`
 	Comment string `xml:"comment"`
 }
 
-// ImportBurpXML processes a Burp XML file and creates an import job with associated requests and endpoints
-func (s *ImportBurpService) ImportBurpXML(ctx context.Context, file io.Reader, filename string, programId int, ignoredHeaders string) (int, error) {
-	// Read the file content
-	fileContent, err := io.ReadAll(file)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read file: %v", err)
+// decodeBurpData returns the raw bytes of a request or response element, Burp only base64 encodes
+// them when "Base64-encode requests and responses" is checked
+func decodeBurpData(data, isBase64 string) ([]byte, error) {
+	if isBase64 == "false" {
+		return []byte(data), nil
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+}
+
+// ImportBurpXML stores the uploaded Burp XML file and queues an import job for it, returning the job id.
+// filter chooses the items dropped before they are saved.
+func (s *ImportBurpService) ImportBurpXML(ctx context.Context, file io.Reader, filename string, programId int, ignoredHeaders string, filter ImportFilterOptions) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
 	}
 
 	// Create import job
 	job := &models.ImportJob{
 		ProgramId:      &programId,
-		JobType:        "import_burp_xml",
+		JobType:        models.JobTypeImportBurpXML,
 		Title:          fmt.Sprintf("Import Burp XML: %s", filepath.Base(filename)),
-		Progress:       0,
 		Description:    fmt.Sprintf("Importing Burp XML file: %s", filename),
 		IgnoredHeaders: ignoredHeaders,
 	}
+	filter.apply(job)
+
+	return queueImport(ctx, s.DB, s.Runner, s.UploadDirectory, file, filename, job)
+}
 
-	if err := s.DB.WithContext(ctx).Create(job).Error; err != nil {
-		return 0, fmt.Errorf("failed to create import job: %v", err)
+// ProcessJob imports the Burp XML file of a queued job, it is run by the JobRunner
+func (s *ImportBurpService) ProcessJob(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+	if job.ProgramId == nil {
+		return fmt.Errorf("import job has no program")
 	}
+	programId := *job.ProgramId
+	filename := job.OriginalName
+	ignoredHeaders := job.IgnoredHeaders
 
-	// Update progress
-	job.Progress = 10
-	s.DB.WithContext(ctx).Model(job).Update("Progress", job.Progress)
+	fileContent, err := os.ReadFile(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
 
 	// Parse Burp XML file
 	var burpXML BurpXML
 	if err := xml.Unmarshal(fileContent, &burpXML); err != nil {
-		return 0, fmt.Errorf("failed to parse Burp XML file: %v", err)
+		return fmt.Errorf("failed to parse Burp XML file: %v", err)
 	}
 
-	// Update progress
-	job.Progress = 30
-	s.DB.WithContext(ctx).Model(job).Update("Progress", job.Progress)
-
-	// Group requests by domain and method to create endpoints
-	endpointMap := make(map[string]*models.Endpoint)
-	var endpoints []*models.Endpoint
-
-	// Process each item in the Burp XML
-	for _, item := range burpXML.Items {
-		// Decode base64 request
-		requestData, err := base64.StdEncoding.DecodeString(item.Request.Base64)
-		if err != nil {
-			continue // Skip items with invalid base64 data
-		}
-
-		// Parse the request to extract headers and body
-		requestText := string(requestData)
-		requestLines := strings.Split(requestText, "\n")
-		if len(requestLines) < 2 {
-			continue // Skip malformed requests
-		}
-
-		// Extract method and URI from first line
-		firstLine := requestLines[0]
-		parts := strings.Split(firstLine, " ")
-		if len(parts) < 3 {
-			continue
-		}
-
-		method := parts[0]
-		uri := parts[1]
-
-		// Construct full URL using host, port, and protocol from Burp XML
-		var scheme string
-		if item.Protocol == "https" {
-			scheme = "https"
-		} else {
-			scheme = "http"
-		}
-
-		var port string
-		if item.Port != 0 && item.Port != 80 && item.Port != 443 {
-			port = fmt.Sprintf(":%d", item.Port)
-		}
-
-		// Use the URL from the XML if available, otherwise construct it
-		var requestURL string
-		if item.URL != "" {
-			requestURL = item.URL
-		} else {
-			requestURL = fmt.Sprintf("%s://%s%s%s", scheme, item.Host, port, uri)
-		}
-
-		// Skip detailed parsing for endpoint creation - we only need URL info
+	if err := progress.SetTotal(ctx, len(burpXML.Items)); err != nil {
+		return err
+	}
 
-		// Parse URL to get domain and path
-		parsedURL, err := url.Parse(requestURL)
-		if err != nil {
-			continue
-		}
+	endpoints, err := newEndpointResolver(ctx, s.DB, programId, fmt.Sprintf("Auto-generated from Burp XML import: %s", filename))
+	if err != nil {
+		return err
+	}
+	filter, err := newImportFilter(ctx, s.DB, job)
+	if err != nil {
+		return err
+	}
 
-		domain := parsedURL.Hostname() // Use Hostname() to get just the domain without port
+	// Process requests and create MyRequest objects
+	var requests []*models.MyRequest
 
-		// Validate that domain is set - this is critical
-		if domain == "" {
-			// Try to extract domain from host field as fallback
-			if item.Host != "" {
-				domain = item.Host
-				// Remove port if present
-				if colonIndex := strings.Index(domain, ":"); colonIndex != -1 {
-					domain = domain[:colonIndex]
-				}
-				log.Printf("Burp Import: Extracted domain '%s' from host field '%s' as fallback", domain, item.Host)
-			} else {
-				// Skip items without valid domain
-				log.Printf("Burp Import: Skipping item with invalid URL '%s' - cannot extract domain", requestURL)
-				continue
+	saveRequests := func() error {
+		if len(requests) > 0 {
+			if err := endpoints.Assign(ctx, requests); err != nil {
+				return err
 			}
-		} else {
-			log.Printf("Burp Import: Using domain '%s' for URL '%s'", domain, requestURL)
-		}
-
-		path := parsedURL.Path
-		if path == "" {
-			path = "/"
-		}
-
-		// Create endpoint key (domain + method + path)
-		endpointKey := fmt.Sprintf("%s:%s:%s", domain, method, path)
-
-		if _, exists := endpointMap[endpointKey]; !exists {
-			endpoint := &models.Endpoint{
-				ProgramId:    programId,
-				Method:       method,
-				Domain:       domain,
-				URI:          path,
-				EndpointType: models.EndpointTypeAPI, // Default to API
-				Note:         fmt.Sprintf("Auto-generated from Burp XML import: %s", filename),
+			if err := s.DB.WithContext(ctx).Create(requests).Error; err != nil {
+				return fmt.Errorf("failed to create requests: %v", err)
 			}
-
-			endpointMap[endpointKey] = endpoint
-			endpoints = append(endpoints, endpoint)
+			requests = requests[:0]
 		}
+		// the counts are saved with every batch so they match the saved requests when the job fails or is cancelled
+		return filter.Save(ctx, s.DB, job)
 	}
 
-	// Save endpoints
-	if len(endpoints) > 0 {
-		if err := s.DB.WithContext(ctx).CreateInBatches(endpoints, 100).Error; err != nil {
-			return 0, fmt.Errorf("failed to create endpoints: %v", err)
+	for i, item := range burpXML.Items {
+		if err := progress.Add(ctx, 1); err != nil {
+			return err
+		}
+		// items dropped by the filter make up a batch too, their counts are saved with it
+		if i > 0 && i%importBatchSize == 0 {
+			if err := saveRequests(); err != nil {
+				return err
+			}
 		}
-	}
-
-	// Update progress
-	job.Progress = 60
-	s.DB.WithContext(ctx).Model(job).Update("Progress", job.Progress)
-
-	// Create a map of endpoint key to endpoint ID for quick lookup
-	endpointKeyToID := make(map[string]int)
-	for _, endpoint := range endpoints {
-		endpointKey := fmt.Sprintf("%s:%s:%s", endpoint.Domain, endpoint.Method, endpoint.URI)
-		endpointKeyToID[endpointKey] = endpoint.Id
-	}
-
-	// Process requests and create MyRequest objects
-	var requests []*models.MyRequest
 
-	for i, item := range burpXML.Items {
 		// Decode base64 request and response
-		requestData, err := base64.StdEncoding.DecodeString(item.Request.Base64)
+		requestData, err := decodeBurpData(item.Request.Base64, item.Request.IsBase64)
 		if err != nil {
+			progress.Warn("Skipping item %d with invalid base64 request", i+1)
 			continue
 		}
 
-		responseData, err := base64.StdEncoding.DecodeString(item.Response.Base64)
+		responseData, err := decodeBurpData(item.Response.Base64, item.Response.IsBase64)
 		if err != nil {
+			progress.Warn("Skipping item %d with invalid base64 response", i+1)
 			continue
 		}
 
 		// Parse the request
-		requestText := string(requestData)
-		requestLines := strings.Split(requestText, "\n")
-		if len(requestLines) < 2 {
+		rawRequest, warnings, err := rawhttp.ParseRequest(requestData)
+		if err != nil {
+			progress.Warn("Skipping item %d: %v", i+1, err)
 			continue
 		}
-
-		// Extract method and URI from first line
-		firstLine := requestLines[0]
-		parts := strings.Split(firstLine, " ")
-		if len(parts) < 3 {
-			continue
+		for _, warning := range warnings {
+			progress.Warn("Item %d: %s", i+1, warning)
 		}
-
-		method := parts[0]
-		uri := parts[1]
+		method := rawRequest.Method
+		uri := rawRequest.Target
 
 		// Construct full URL using host, port, and protocol from Burp XML
 		var scheme string
@@ -285,38 +184,23 @@ func (s *ImportBurpService) ImportBurpXML(ctx context.Context, file io.Reader, f
 		var requestURL string
 		if item.URL != "" {
 			requestURL = item.URL
+		} else if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+			requestURL = uri // absolute-form target sent to a proxy
 		} else {
-			requestURL = fmt.Sprintf("%s://%s%s%s", scheme, item.Host, port, uri)
-		}
-
-		// Parse headers
-		var headers []models.Header
-		bodyStart := 0
-		for i, line := range requestLines[1:] {
-			if line == "" {
-				bodyStart = i + 2
-				break
-			}
-			if strings.Contains(line, ":") {
-				headerParts := strings.SplitN(line, ":", 2)
-				if len(headerParts) == 2 {
-					headers = append(headers, models.Header{
-						Name:  strings.TrimSpace(headerParts[0]),
-						Value: strings.TrimSpace(headerParts[1]),
-					})
-				}
+			host := item.Host
+			if host == "" {
+				host = rawRequest.Host
 			}
+			requestURL = fmt.Sprintf("%s://%s%s%s", scheme, host, port, uri)
 		}
 
-		// Extract body
-		var body string
-		if bodyStart < len(requestLines) {
-			body = strings.Join(requestLines[bodyStart:], "\n")
-		}
+		headers := rawRequest.Headers
+		body := string(rawRequest.Body)
 
 		// Parse URL to get domain and path
 		parsedURL, err := url.Parse(requestURL)
 		if err != nil {
+			progress.Warn("Skipping request with invalid URL '%s': %v", requestURL, err)
 			continue
 		}
 
@@ -334,66 +218,39 @@ func (s *ImportBurpService) ImportBurpXML(ctx context.Context, file io.Reader, f
 				log.Printf("Burp Import: Extracted domain '%s' from host field '%s' as fallback for request", domain, item.Host)
 			} else {
 				// Skip items without valid domain
-				log.Printf("Burp Import: Skipping request with invalid URL '%s' - cannot extract domain", requestURL)
+				progress.Warn("Skipping request with invalid URL '%s' - cannot extract domain", requestURL)
 				continue
 			}
-		} else {
-			log.Printf("Burp Import: Using domain '%s' for request URL '%s'", domain, requestURL)
 		}
-
-		path := parsedURL.Path
-		if path == "" {
-			path = "/"
+		if filter.Check(requestURL) != filterKeep {
+			continue
 		}
 
-		// Parse response to extract status code, headers, and body
-		responseText := string(responseData)
-		responseLines := strings.Split(responseText, "\n")
-		var statusCode int = 200 // Default status code
+		// Parse response to extract status code, headers, and body. Burp's own status is used
+		// when there is no response or it can't be parsed
+		statusCode := item.Status
 		var responseHeaders []models.Header
-		var responseBody string
-
-		if len(responseLines) > 0 {
-			// Extract status code from first line
-			statusLine := responseLines[0]
-			if strings.HasPrefix(statusLine, "HTTP/") {
-				statusParts := strings.Split(statusLine, " ")
-				if len(statusParts) >= 2 {
-					if code, err := strconv.Atoi(statusParts[1]); err == nil {
-						statusCode = code
-					}
-				}
-			}
-
-			// Parse response headers - look for the empty line that separates headers from body
-			responseBodyStart := 0
-			for i, line := range responseLines[1:] {
-				// Check for empty line that separates headers from body
-				if strings.TrimSpace(line) == "" {
-					responseBodyStart = i + 2 // +2 because we're iterating from responseLines[1:]
-					break
-				}
-				// Parse header lines (format: "Header-Name: Header-Value")
-				if strings.Contains(line, ":") {
-					headerParts := strings.SplitN(line, ":", 2)
-					if len(headerParts) == 2 {
-						responseHeaders = append(responseHeaders, models.Header{
-							Name:  strings.TrimSpace(headerParts[0]),
-							Value: strings.TrimSpace(headerParts[1]),
-						})
-					}
+		var responseBody []byte
+		var responseProto string
+		if len(responseData) > 0 {
+			rawResponse, warnings, err := rawhttp.ParseResponse(responseData)
+			if err != nil {
+				progress.Warn("Item %d: response kept as captured: %v", i+1, err)
+				responseBody = responseData
+			} else {
+				for _, warning := range warnings {
+					progress.Warn("Item %d: %s", i+1, warning)
 				}
-			}
-
-			// Extract response body - everything after the empty line
-			if responseBodyStart > 0 && responseBodyStart < len(responseLines) {
-				responseBody = strings.Join(responseLines[responseBodyStart:], "\n")
+				statusCode = rawResponse.StatusCode
+				responseHeaders = rawResponse.Headers
+				responseBody = rawResponse.Body
+				responseProto = rawResponse.Proto
 			}
 		}
 
 		// Filter headers based on ignored headers
-		filteredReqHeaders := s.filterHeaders(headers, ignoredHeaders)
-		filteredResHeaders := s.filterHeaders(responseHeaders, ignoredHeaders)
+		filteredReqHeaders := filterHeaders(headers, ignoredHeaders)
+		filteredResHeaders := filterHeaders(responseHeaders, ignoredHeaders)
 
 		// Parse time for latency calculation
 		var latencyMs int64 = 0
@@ -413,71 +270,42 @@ func (s *ImportBurpService) ImportBurpXML(ctx context.Context, file io.Reader, f
 			requestTime = time.Now().Format(time.RFC3339)
 		}
 
-		// Create endpoint key
-		endpointKey := fmt.Sprintf("%s:%s:%s", domain, method, path)
-
 		// Create MyRequest object with all fields
 		request := &models.MyRequest{
-			Sequence:    i + 1, // Add sequence number
-			URL:         requestURL,
-			Method:      method,
-			Domain:      domain,
-			ReqBody:     body,
-			ResBody:     responseBody,
-			ResStatus:   statusCode,
-			RespSize:    len(responseBody), // Add response size
-			LatencyMs:   latencyMs,         // Add latency
-			RequestTime: requestTime,       // Add request time
-			ProgramId:   &programId,
-			ImportJobId: job.Id,
-		}
-
-		// Set endpoint ID if found
-		if endpointID, exists := endpointKeyToID[endpointKey]; exists {
-			request.EndpointId = endpointID
+			Sequence:        i + 1, // Add sequence number
+			URL:             requestURL,
+			Method:          method,
+			Domain:          domain,
+			ReqBody:         body,
+			ResStatus:       statusCode,
+			RespSize:        len(responseBody), // Add response size
+			ResDeclaredSize: item.ResponseLength,
+			ResMimeType:     item.MimeType,
+			LatencyMs:       latencyMs,   // Add latency
+			RequestTime:     requestTime, // Add request time
+			HTTPVersion:     rawRequest.Proto,
+			ResHTTPVersion:  responseProto,
+			Comment:         item.Comment,
+			ProgramId:       &programId,
+			ImportJobId:     job.Id,
 		}
+		request.SetResBody(responseBody, rawhttp.IsBinary(responseBody))
 
-		// Convert filtered headers to JSON and truncate if too long
-		reqHeadersSlice := models.HeaderSlice(filteredReqHeaders)
-		resHeadersSlice := models.HeaderSlice(filteredResHeaders)
-		reqHeadersJSON, _ := reqHeadersSlice.ToJSON()
-		resHeadersJSON, _ := resHeadersSlice.ToJSON()
-
-		// Truncate headers if they exceed MySQL TEXT column limit (65,535 characters)
+		// Headers have to fit the MySQL TEXT column (65,535 bytes), whole headers are dropped so the JSON stays valid
 		const maxTextLength = 65000 // Leave some buffer
-		if len(reqHeadersJSON) > maxTextLength {
-			reqHeadersJSON = reqHeadersJSON[:maxTextLength]
-		}
-		if len(resHeadersJSON) > maxTextLength {
-			resHeadersJSON = resHeadersJSON[:maxTextLength]
-		}
+		reqHeadersJSON, _ := models.HeaderSlice(filteredReqHeaders).ToJSONWithin(maxTextLength)
+		resHeadersJSON, _ := models.HeaderSlice(filteredResHeaders).ToJSONWithin(maxTextLength)
 
 		request.ReqHeaders = reqHeadersJSON
 		request.ResHeaders = resHeadersJSON
 
-		// Calculate hashes using the resHashFunc
-		reqText, resText := s.resHashFunc(request)
-		request.ReqHash = utils.HashString(reqText)
-		request.ResHash = utils.HashString(resText)
-		request.ResBodyHash = utils.HashString(request.ResBody)
-		reqHeadersFromJSON, _ := models.HeaderSliceFromJSON(request.ReqHeaders)
-		request.ReqHash1 = utils.HashString(request.Method + " " + request.URL + " " + request.ReqBody + " " + reqHeadersFromJSON.EchoAll())
+		setRequestHashes(request, filteredReqHeaders, filteredResHeaders, responseBody)
 
 		requests = append(requests, request)
 	}
 
-	// Save requests in batches
-	if len(requests) > 0 {
-		if err := s.DB.WithContext(ctx).CreateInBatches(requests, 100).Error; err != nil {
-			return 0, fmt.Errorf("failed to create requests: %v", err)
-		}
-	}
-
-	// Update progress to complete
-	job.Progress = 100
-	s.DB.WithContext(ctx).Model(job).Update("Progress", job.Progress)
-
-	return job.Id, nil
+	// Save the remaining requests
+	return saveRequests()
 }
 
 // GetImportJob retrieves an import job by ID
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/linn221/RequesterBackend/curl"
+	"github.com/linn221/RequesterBackend/models"
+	"gorm.io/gorm"
+)
+
+type ImportCurlService struct {
+	DB              *gorm.DB
+	Runner          *JobRunner
+	UploadDirectory string
+}
+
+// ImportCurl stores a list of curl commands and queues an import job for it, returning the job id
+func (s *ImportCurlService) ImportCurl(ctx context.Context, file io.Reader, filename string, programId int, ignoredHeaders string) (int, error) {
+	// Create import job
+	job := &models.ImportJob{
+		ProgramId:      &programId,
+		JobType:        models.JobTypeImportCurl,
+		Title:          fmt.Sprintf("Import curl: %s", filepath.Base(filename)),
+		Description:    fmt.Sprintf("Importing curl commands: %s", filename),
+		IgnoredHeaders: ignoredHeaders,
+	}
+
+	return queueImport(ctx, s.DB, s.Runner, s.UploadDirectory, file, filename, job)
+}
+
+// ProcessJob imports the curl commands of a queued job as template requests, it is run by the JobRunner
+func (s *ImportCurlService) ProcessJob(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+	fileContent, err := os.ReadFile(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+
+	commands, err := curl.Parse(string(fileContent))
+	if err != nil {
+		return fmt.Errorf("failed to parse curl commands: %v", err)
+	}
+
+	templates := make([]*templateRequest, len(commands))
+	for i, cmd := range commands {
+		templates[i] = &templateRequest{
+			Method:   cmd.Method,
+			URL:      cmd.URL,
+			Headers:  cmd.Headers,
+			Body:     cmd.Body,
+			Comment:  fmt.Sprintf("curl command on line %d", cmd.Line),
+			Warnings: cmd.Warnings,
+		}
+	}
+
+	return saveTemplateRequests(ctx, s.DB, job, progress, fmt.Sprintf("Auto-generated from curl import: %s", job.OriginalName), templates)
+}
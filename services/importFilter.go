@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/scope"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+// DefaultStaticExtensions are the path extensions dropped as static files when an import skips them without naming its own.
+// Scripts and source maps are kept, they are worth reading.
+const DefaultStaticExtensions = "png,jpg,jpeg,gif,webp,svg,ico,bmp,avif,woff,woff2,ttf,otf,eot,css,mp4,webm,mp3,wav,ogg"
+
+// ImportFilterOptions choose which entries of a capture are dropped before anything is saved
+type ImportFilterOptions struct {
+	ApplyScope       bool   // drop entries the program's scope rules and domains put out of scope
+	DenyHosts        string // comma separated hosts dropped as out of scope, *.example.com for subdomains or CIDRs
+	StaticExtensions string // comma separated path extensions dropped as static files, empty keeps them
+}
+
+// Validate normalizes the lists and checks the deny-listed hosts
+func (o *ImportFilterOptions) Validate() error {
+	hosts := splitList(o.DenyHosts)
+	for _, host := range hosts {
+		rule := &scope.Rule{Host: host}
+		if err := rule.Compile(); err != nil {
+			return utils.BadRequest(fmt.Sprintf("invalid deny_hosts: %v", err))
+		}
+	}
+	o.DenyHosts = strings.Join(hosts, ",")
+
+	extensions := splitList(o.StaticExtensions)
+	for i, extension := range extensions {
+		extensions[i] = strings.TrimPrefix(extension, ".")
+	}
+	o.StaticExtensions = strings.Join(extensions, ",")
+	return nil
+}
+
+// apply stores the options on a job
+func (o ImportFilterOptions) apply(job *models.ImportJob) {
+	job.ApplyScope = o.ApplyScope
+	job.DenyHosts = o.DenyHosts
+	job.StaticExtensions = o.StaticExtensions
+}
+
+// importFilter drops the entries of an import job that are out of scope or static files, counting what it drops
+type importFilter struct {
+	scope      *scope.Scope // nil when the job doesn't apply the scope
+	denyHosts  []*scope.Rule
+	extensions map[string]bool
+
+	kept       int
+	outOfScope int
+	static     int
+}
+
+type filterResult int
+
+const (
+	filterKeep filterResult = iota
+	filterOutOfScope
+	filterStatic
+)
+
+// newImportFilter builds the filter of a job from its options
+func newImportFilter(ctx context.Context, db *gorm.DB, job *models.ImportJob) (*importFilter, error) {
+	f := &importFilter{extensions: make(map[string]bool)}
+	if job.ApplyScope && job.ProgramId != nil {
+		loaded, err := loadScope(ctx, db, *job.ProgramId)
+		if err != nil {
+			return nil, err
+		}
+		f.scope = loaded.scope
+	}
+	for _, host := range splitList(job.DenyHosts) {
+		rule := &scope.Rule{Host: host}
+		if err := rule.Compile(); err != nil {
+			return nil, fmt.Errorf("invalid deny-listed host: %v", err)
+		}
+		f.denyHosts = append(f.denyHosts, rule)
+	}
+	for _, extension := range splitList(job.StaticExtensions) {
+		f.extensions["."+strings.TrimPrefix(extension, ".")] = true
+	}
+	return f, nil
+}
+
+// Check tells whether the request URL is kept and counts the result. URLs the scope can't decide on,
+// because the program has no in-scope rules, are kept.
+func (f *importFilter) Check(rawURL string) filterResult {
+	result := f.check(rawURL)
+	switch result {
+	case filterOutOfScope:
+		f.outOfScope++
+	case filterStatic:
+		f.static++
+	default:
+		f.kept++
+	}
+	return result
+}
+
+func (f *importFilter) check(rawURL string) filterResult {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return filterKeep // reported by the importer
+	}
+	for _, rule := range f.denyHosts {
+		if rule.Match(u) {
+			return filterOutOfScope
+		}
+	}
+	if f.scope != nil {
+		if status, _ := f.scope.Check(u); status == scope.Out {
+			return filterOutOfScope
+		}
+	}
+	if len(f.extensions) > 0 && f.extensions[strings.ToLower(path.Ext(u.Path))] {
+		return filterStatic
+	}
+	return filterKeep
+}
+
+// Save records the counts on the job
+func (f *importFilter) Save(ctx context.Context, db *gorm.DB, job *models.ImportJob) error {
+	return db.WithContext(ctx).Model(job).Updates(map[string]any{
+		"KeptItems":       f.kept,
+		"OutOfScopeItems": f.outOfScope,
+		"StaticItems":     f.static,
+	}).Error
+}
+
+// splitList splits a comma, space or new line separated list, lower casing its values
+func splitList(list string) []string {
+	values := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+	for i, value := range values {
+		values[i] = strings.ToLower(value)
+	}
+	return values
+}
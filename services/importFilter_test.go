@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+func TestImportFilterCheck(t *testing.T) {
+	db, programId := newTestDB(t)
+	// example.com is the program's domain
+	rules := []*models.ScopeRule{
+		{ProgramId: programId, Kind: models.ScopeRuleIn, Host: "*.example.com"},
+		{ProgramId: programId, Kind: models.ScopeRuleOut, Host: "admin.example.com"},
+		{ProgramId: programId, Kind: models.ScopeRuleOut, PathPrefix: "/logout"},
+	}
+	if err := db.Create(rules).Error; err != nil {
+		t.Fatal(err)
+	}
+	unscoped := &models.Program{Name: "unscoped"}
+	if err := db.Create(unscoped).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		programId  int
+		applyScope bool
+		denyHosts  string
+		extensions string
+		want       filterResult
+	}{
+		{name: "program domain", url: "https://example.com/", applyScope: true, want: filterKeep},
+		{name: "in-scope rule", url: "https://api.example.com/users", applyScope: true, want: filterKeep},
+		{name: "no in-scope rule", url: "https://other.test/", applyScope: true, want: filterOutOfScope},
+		{name: "out-of-scope rule", url: "https://admin.example.com/", applyScope: true, want: filterOutOfScope},
+		{name: "out-of-scope path", url: "https://example.com/logout", applyScope: true, want: filterOutOfScope},
+		{name: "scope not applied", url: "https://other.test/", want: filterKeep},
+		{name: "program without scope", url: "https://other.test/", programId: unscoped.Id, applyScope: true, want: filterKeep},
+
+		{name: "deny-listed host", url: "https://cdn.test/app.js", denyHosts: "cdn.test", want: filterOutOfScope},
+		{name: "deny-listed subdomain", url: "https://a.tracker.test/", denyHosts: "*.tracker.test", want: filterOutOfScope},
+		{name: "deny-listed CIDR", url: "http://10.1.2.3/", denyHosts: "10.0.0.0/8", want: filterOutOfScope},
+		{name: "host not deny-listed", url: "https://tracker.test/", denyHosts: "*.tracker.test", want: filterKeep},
+		{name: "deny list over scope", url: "https://api.example.com/", applyScope: true, denyHosts: "api.example.com", want: filterOutOfScope},
+
+		{name: "static extension", url: "https://example.com/logo.PNG?v=2", extensions: DefaultStaticExtensions, want: filterStatic},
+		{name: "script kept", url: "https://example.com/app.js", extensions: DefaultStaticExtensions, want: filterKeep},
+		{name: "extension with dot", url: "https://example.com/site.css", extensions: ".css", want: filterStatic},
+		{name: "extension in query only", url: "https://example.com/image?name=a.png", extensions: "png", want: filterKeep},
+		{name: "no extensions", url: "https://example.com/logo.png", want: filterKeep},
+		{name: "out of scope before static", url: "https://other.test/logo.png", applyScope: true, extensions: "png", want: filterOutOfScope},
+
+		{name: "invalid URL", url: "https://example.com/%zz", applyScope: true, extensions: "png", want: filterKeep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &models.ImportJob{ProgramId: &programId, ApplyScope: tt.applyScope, DenyHosts: tt.denyHosts, StaticExtensions: tt.extensions}
+			if tt.programId != 0 {
+				job.ProgramId = &tt.programId
+			}
+			filter, err := newImportFilter(context.Background(), db, job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Check(tt.url); got != tt.want {
+				t.Errorf("Check(%q) = %d, want %d", tt.url, got, tt.want)
+			}
+			counts := []int{filter.kept, filter.outOfScope, filter.static}
+			if counts[tt.want] != 1 || filter.kept+filter.outOfScope+filter.static != 1 {
+				t.Errorf("got kept %d, out of scope %d, static %d, want the result counted once", filter.kept, filter.outOfScope, filter.static)
+			}
+		})
+	}
+}
+
+func TestImportFilterOptionsValidate(t *testing.T) {
+	options := ImportFilterOptions{DenyHosts: " CDN.test,\n*.tracker.test  10.0.0.0/8", StaticExtensions: ".PNG, css"}
+	if err := options.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if options.DenyHosts != "cdn.test,*.tracker.test,10.0.0.0/8" || options.StaticExtensions != "png,css" {
+		t.Errorf("got deny hosts %q and extensions %q", options.DenyHosts, options.StaticExtensions)
+	}
+
+	options = ImportFilterOptions{DenyHosts: "example.com/api"}
+	if err := options.Validate(); err == nil {
+		t.Error("got no error for a deny-listed host with a path")
+	}
+}
+
+// a job failing after its first batch keeps the filter counts of the requests it saved
+func TestHarImportFilterCountsOnFailure(t *testing.T) {
+	db, programId := newTestDB(t)
+	ctx := context.Background()
+
+	const entry = `{"startedDateTime":"2024-01-01T00:00:00Z","time":12,` +
+		`"request":{"method":"GET","url":"%s","headers":[]},` +
+		`"response":{"status":200,"headers":[],"content":{"size":0,"mimeType":"text/plain"}}}`
+	var entries []string
+	for i := range importBatchSize {
+		switch {
+		case i%10 == 0:
+			entries = append(entries, fmt.Sprintf(entry, fmt.Sprintf("https://other.test/%d", i)))
+		case i%10 == 1:
+			entries = append(entries, fmt.Sprintf(entry, fmt.Sprintf("https://example.com/%d.png", i)))
+		default:
+			entries = append(entries, fmt.Sprintf(entry, fmt.Sprintf("https://example.com/%d", i)))
+		}
+	}
+	// the entry after the first batch is counted but fails to decode
+	entries = append(entries, `{"request":{"url":1}}`)
+	filePath := filepath.Join(t.TempDir(), "capture.har")
+	content := `{"log":{"entries":[` + strings.Join(entries, ",") + `]}}`
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	job := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypeImportHar, Title: "capture", FilePath: filePath,
+		Status: models.JobStatusRunning, ApplyScope: true, StaticExtensions: "png"}
+	if err := db.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+	service := &ImportHarService{DB: db}
+	progress := &JobProgress{db: db, events: NewJobEvents(), job: job, every: importBatchSize}
+	if err := service.ProcessJob(ctx, job, progress); err == nil {
+		t.Fatal("got no error for the malformed entry")
+	}
+
+	stored, err := first[models.ImportJob](db, job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := importBatchSize / 10
+	if stored.KeptItems != importBatchSize-2*want || stored.OutOfScopeItems != want || stored.StaticItems != want {
+		t.Errorf("got kept %d, out of scope %d, static %d, want %d, %d, %d",
+			stored.KeptItems, stored.OutOfScopeItems, stored.StaticItems, importBatchSize-2*want, want, want)
+	}
+	var requests int64
+	if err := db.Model(&models.MyRequest{}).Where("import_job_id = ?", job.Id).Count(&requests).Error; err != nil {
+		t.Fatal(err)
+	}
+	if int(requests) != stored.KeptItems {
+		t.Errorf("got %d saved requests, want the %d kept", requests, stored.KeptItems)
+	}
+}
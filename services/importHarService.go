@@ -1,11 +1,13 @@
 package services
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/url"
+	"os"
 	"path/filepath"
 
 	"github.com/linn221/RequesterBackend/har"
@@ -14,157 +16,118 @@ import (
 )
 
 type ImportHarService struct {
-	DB *gorm.DB
+	DB              *gorm.DB
+	Runner          *JobRunner
+	UploadDirectory string
 }
 
-// ImportHAR processes a HAR file and creates an import job with associated requests and endpoints
-func (s *ImportHarService) ImportHAR(ctx context.Context, file io.Reader, filename string, programId int, ignoredHeaders string) (int, error) {
-	// Read the file content
-	fileContent, err := io.ReadAll(file)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read file: %v", err)
+// ImportHAR stores the uploaded HAR file and queues an import job for it, returning the job id.
+// filter chooses the entries dropped before they are saved.
+func (s *ImportHarService) ImportHAR(ctx context.Context, file io.Reader, filename string, programId int, ignoredHeaders string, filter ImportFilterOptions) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
 	}
 
 	// Create import job
 	job := &models.ImportJob{
 		ProgramId:      &programId,
-		JobType:        "import_har",
+		JobType:        models.JobTypeImportHar,
 		Title:          fmt.Sprintf("Import HAR: %s", filepath.Base(filename)),
-		Progress:       0,
 		Description:    fmt.Sprintf("Importing HAR file: %s", filename),
 		IgnoredHeaders: ignoredHeaders,
 	}
+	filter.apply(job)
 
-	if err := s.DB.WithContext(ctx).Create(job).Error; err != nil {
-		return 0, fmt.Errorf("failed to create import job: %v", err)
-	}
+	return queueImport(ctx, s.DB, s.Runner, s.UploadDirectory, file, filename, job)
+}
 
-	// Update progress
-	job.Progress = 10
-	s.DB.WithContext(ctx).Model(job).Update("Progress", job.Progress)
+// ProcessJob imports the HAR file of a queued job, it is run by the JobRunner
+func (s *ImportHarService) ProcessJob(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+	return s.processHAR(ctx, job, progress, "HAR")
+}
 
-	// Parse HAR file
-	requests, err := har.ParseHAR(fileContent, s.resHashFunc)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse HAR file: %v", err)
+// processHAR imports the HAR file of a job, source names the tool that exported it in the notes of new endpoints
+func (s *ImportHarService) processHAR(ctx context.Context, job *models.ImportJob, progress *JobProgress, source string) error {
+	if job.ProgramId == nil {
+		return fmt.Errorf("import job has no program")
 	}
 
-	// Update progress
-	job.Progress = 30
-	s.DB.WithContext(ctx).Model(job).Update("Progress", job.Progress)
+	// Count the entries first so progress can be reported, the file is streamed twice
+	// to keep memory use independent of its size
+	total, err := s.countEntries(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse HAR file: %v", err)
+	}
+	if err := progress.SetTotal(ctx, total); err != nil {
+		return err
+	}
 
-	// Group requests by domain and method to create endpoints
-	endpointMap := make(map[string]*models.Endpoint)
-	var endpoints []*models.Endpoint
+	filter, err := newImportFilter(ctx, s.DB, job)
+	if err != nil {
+		return err
+	}
 
-	for _, req := range requests {
-		// Validate that domain is set - this is critical
-		if req.Domain == "" {
-			// Try to extract domain from URL as fallback
-			u, err := url.Parse(req.URL)
-			if err == nil && u.Hostname() != "" {
-				req.Domain = u.Hostname()
-				log.Printf("HAR Import: Extracted domain '%s' from URL '%s' as fallback", req.Domain, req.URL)
-			} else {
-				// Skip requests without valid domain
-				log.Printf("HAR Import: Skipping request with invalid URL '%s' - cannot extract domain", req.URL)
-				continue
-			}
-		} else {
-			log.Printf("HAR Import: Using domain '%s' for URL '%s'", req.Domain, req.URL)
+	file, err := os.Open(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+	defer file.Close()
+
+	reader := har.NewReader(bufio.NewReader(file))
+	note := fmt.Sprintf("Auto-generated from %s import: %s", source, job.OriginalName)
+	return importRequests(ctx, s.DB, job, progress, note, filter, func(sequence int) (*models.MyRequest, error) {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			return nil, err
 		}
-
-		// Create endpoint key (domain + method + path)
-		u, err := url.Parse(req.URL)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed to parse HAR file: %v", err)
 		}
 
-		path := u.Path
-		if path == "" {
-			path = "/"
-		}
-
-		endpointKey := fmt.Sprintf("%s:%s:%s", req.Domain, req.Method, path)
-
-		if _, exists := endpointMap[endpointKey]; !exists {
-			endpoint := &models.Endpoint{
-				ProgramId:    programId,
-				Method:       req.Method,
-				Domain:       req.Domain,
-				URI:          path,
-				EndpointType: models.EndpointTypeAPI, // Default to API
-				Note:         fmt.Sprintf("Auto-generated from HAR import: %s", filename),
-			}
-
-			endpointMap[endpointKey] = endpoint
-			endpoints = append(endpoints, endpoint)
+		req, warnings, err := har.ToMyRequest(entry, sequence, setRequestHashes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse HAR entry %d: %v", sequence, err)
 		}
-	}
-
-	// Save endpoints
-	if len(endpoints) > 0 {
-		if err := s.DB.WithContext(ctx).CreateInBatches(endpoints, 100).Error; err != nil {
-			return 0, fmt.Errorf("failed to create endpoints: %v", err)
+		for _, warning := range warnings {
+			progress.Warn("Entry %d (%s): %s", sequence, req.URL, warning)
 		}
-	}
-
-	// Update progress
-	job.Progress = 60
-	s.DB.WithContext(ctx).Model(job).Update("Progress", job.Progress)
-
-	// Create a map of endpoint key to endpoint ID for quick lookup
-	endpointKeyToID := make(map[string]int)
-	for _, endpoint := range endpoints {
-		endpointKey := fmt.Sprintf("%s:%s:%s", endpoint.Domain, endpoint.Method, endpoint.URI)
-		endpointKeyToID[endpointKey] = endpoint.Id
-	}
-
-	// Update requests with endpoint IDs, import job ID, and program ID
-	for i := range requests {
-		u, err := url.Parse(requests[i].URL)
-		if err != nil {
-			continue
+		// Validate that domain is set - this is critical
+		if req.Domain == "" {
+			// Try to extract domain from URL as fallback
+			u, err := url.Parse(req.URL)
+			if err != nil || u.Hostname() == "" {
+				progress.Warn("Skipping request with invalid URL '%s' - cannot extract domain", req.URL)
+				return nil, nil
+			}
+			req.Domain = u.Hostname()
+			log.Printf("HAR Import: Extracted domain '%s' from URL '%s' as fallback", req.Domain, req.URL)
 		}
-
-		path := u.Path
-		if path == "" {
-			path = "/"
+		if _, err := endpointPath(req.URL); err != nil {
+			progress.Warn("Skipping request with invalid URL '%s': %v", req.URL, err)
+			return nil, nil
 		}
+		return req, nil
+	})
+}
 
-		endpointKey := fmt.Sprintf("%s:%s:%s", requests[i].Domain, requests[i].Method, path)
-		if endpointID, exists := endpointKeyToID[endpointKey]; exists {
-			requests[i].EndpointId = endpointID
-		}
-		requests[i].ImportJobId = job.Id
-		requests[i].ProgramId = &programId // Set the program_id from the import form
+// countEntries returns the number of entries in a HAR file without keeping them in memory
+func (s *ImportHarService) countEntries(filePath string) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
 	}
-
-	// Save requests in batches
-	if len(requests) > 0 {
-		if err := s.DB.WithContext(ctx).CreateInBatches(requests, 100).Error; err != nil {
-			return 0, fmt.Errorf("failed to create requests: %v", err)
+	defer file.Close()
+
+	reader := har.NewReader(bufio.NewReader(file))
+	count := 0
+	for {
+		if err := reader.Skip(); err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return 0, err
 		}
+		count++
 	}
-
-	// Update progress to complete
-	job.Progress = 100
-	s.DB.WithContext(ctx).Model(job).Update("Progress", job.Progress)
-
-	return job.Id, nil
-}
-
-// resHashFunc is used by the HAR parser to generate request and response hashes
-func (s *ImportHarService) resHashFunc(req *models.MyRequest) (string, string) {
-	// Generate request text
-	reqHeadersFromJSON, _ := models.HeaderSliceFromJSON(req.ReqHeaders)
-	requestText := req.Method + " " + req.URL + " " + req.ReqBody + " " + reqHeadersFromJSON.EchoAll()
-
-	// Generate response text
-	resHeadersFromJSON, _ := models.HeaderSliceFromJSON(req.ResHeaders)
-	responseText := fmt.Sprintf("%d %s", req.ResStatus, resHeadersFromJSON.EchoAll()) + req.ResBody
-
-	return requestText, responseText
 }
 
 // GetImportJob retrieves an import job by ID
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/linn221/RequesterBackend/mitm"
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/rawhttp"
+	"gorm.io/gorm"
+)
+
+type ImportMitmproxyService struct {
+	DB              *gorm.DB
+	Runner          *JobRunner
+	UploadDirectory string
+}
+
+// ImportMitmproxy stores the uploaded mitmproxy flow dump and queues an import job for it, returning the job id
+func (s *ImportMitmproxyService) ImportMitmproxy(ctx context.Context, file io.Reader, filename string, programId int, ignoredHeaders string) (int, error) {
+	// Create import job
+	job := &models.ImportJob{
+		ProgramId:      &programId,
+		JobType:        models.JobTypeImportMitmproxy,
+		Title:          fmt.Sprintf("Import mitmproxy: %s", filepath.Base(filename)),
+		Description:    fmt.Sprintf("Importing mitmproxy flows: %s", filename),
+		IgnoredHeaders: ignoredHeaders,
+	}
+
+	return queueImport(ctx, s.DB, s.Runner, s.UploadDirectory, file, filename, job)
+}
+
+// ProcessJob imports the flow dump of a queued job, it is run by the JobRunner
+func (s *ImportMitmproxyService) ProcessJob(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+	if job.ProgramId == nil {
+		return fmt.Errorf("import job has no program")
+	}
+
+	// Count the flows first so progress can be reported
+	total, err := s.countFlows(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse mitmproxy flows: %v", err)
+	}
+	if err := progress.SetTotal(ctx, total); err != nil {
+		return err
+	}
+
+	file, err := os.Open(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+	defer file.Close()
+
+	reader := mitm.NewReader(file)
+	note := fmt.Sprintf("Auto-generated from mitmproxy import: %s", job.OriginalName)
+	return importRequests(ctx, s.DB, job, progress, note, nil, func(sequence int) (*models.MyRequest, error) {
+		flow, err := reader.Next()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse mitmproxy flows: %v", err)
+		}
+
+		if flow.Request == nil {
+			progress.Warn("Skipping flow %d of type '%s'", sequence, flow.Type)
+			return nil, nil
+		}
+		req, warnings, err := s.toMyRequest(flow, job.IgnoredHeaders)
+		if err != nil {
+			progress.Warn("Skipping flow %d: %v", sequence, err)
+			return nil, nil
+		}
+		for _, warning := range warnings {
+			progress.Warn("Flow %d (%s): %s", sequence, req.URL, warning)
+		}
+		return req, nil
+	})
+}
+
+// toMyRequest converts an HTTP flow into a request
+func (s *ImportMitmproxyService) toMyRequest(flow *mitm.Flow, ignoredHeaders string) (*models.MyRequest, []string, error) {
+	parsedURL, err := url.Parse(flow.Request.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid URL '%s': %v", flow.Request.URL, err)
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, nil, fmt.Errorf("invalid URL '%s' - cannot extract domain", flow.Request.URL)
+	}
+
+	// flows keep the bodies as they went over the wire
+	var warnings []string
+	reqBody, err := rawhttp.DecodeContent(flow.Request.Content, flow.Request.Headers)
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+
+	var statusCode int
+	var responseHeaders []models.Header
+	var responseBody []byte
+	var responseProto string
+	if flow.Response != nil {
+		statusCode = flow.Response.StatusCode
+		responseHeaders = flow.Response.Headers
+		responseProto = flow.Response.HTTPVersion
+		if responseBody, err = rawhttp.DecodeContent(flow.Response.Content, responseHeaders); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	} else if flow.Error != "" {
+		warnings = append(warnings, fmt.Sprintf("no response: %s", flow.Error))
+	}
+
+	reqHeaders := filterHeaders(flow.Request.Headers, ignoredHeaders)
+	resHeaders := filterHeaders(responseHeaders, ignoredHeaders)
+	reqHeadersJSON, err := models.HeaderSlice(reqHeaders).ToJSON()
+	if err != nil {
+		return nil, nil, err
+	}
+	resHeadersJSON, err := models.HeaderSlice(resHeaders).ToJSON()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request := &models.MyRequest{
+		URL:             flow.Request.URL,
+		Method:          flow.Request.Method,
+		Domain:          parsedURL.Hostname(),
+		ReqHeaders:      reqHeadersJSON,
+		ReqBody:         string(reqBody),
+		ResStatus:       statusCode,
+		ResHeaders:      resHeadersJSON,
+		RespSize:        len(responseBody),
+		LatencyMs:       flow.LatencyMs(),
+		RequestTime:     flow.RequestTime(),
+		HTTPVersion:     flow.Request.HTTPVersion,
+		ResHTTPVersion:  responseProto,
+		ServerIPAddress: flow.ServerIP,
+		Comment:         flow.Comment,
+	}
+	request.SetResBody(responseBody, rawhttp.IsBinary(responseBody))
+	request.SetTimings(flow.Timings())
+
+	setRequestHashes(request, reqHeaders, resHeaders, responseBody)
+
+	return request, warnings, nil
+}
+
+// countFlows returns the number of flows in a dump without keeping them in memory
+func (s *ImportMitmproxyService) countFlows(filePath string) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := mitm.NewReader(file)
+	count := 0
+	for {
+		if _, err := reader.Next(); err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return 0, err
+		}
+		count++
+	}
+}
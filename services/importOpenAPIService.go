@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/openapi"
+	"gorm.io/gorm"
+)
+
+type ImportOpenAPIService struct {
+	DB              *gorm.DB
+	Runner          *JobRunner
+	UploadDirectory string
+}
+
+// ImportOpenAPI stores the uploaded spec and queues an import job for it, returning the job id.
+// domain is used for specs that don't declare a host and overrides the one they declare otherwise.
+func (s *ImportOpenAPIService) ImportOpenAPI(ctx context.Context, file io.Reader, filename string, programId int, domain string) (int, error) {
+	// Create import job
+	job := &models.ImportJob{
+		ProgramId:   &programId,
+		JobType:     models.JobTypeImportOpenAPI,
+		Title:       fmt.Sprintf("Import OpenAPI: %s", filepath.Base(filename)),
+		Description: fmt.Sprintf("Importing OpenAPI spec: %s", filename),
+		Domain:      domain,
+	}
+
+	return queueImport(ctx, s.DB, s.Runner, s.UploadDirectory, file, filename, job)
+}
+
+// ProcessJob creates a documented endpoint for every operation of the spec, it is run by the JobRunner.
+// Endpoints that already exist with the same domain, method and URI get the documentation added.
+func (s *ImportOpenAPIService) ProcessJob(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+	if job.ProgramId == nil {
+		return fmt.Errorf("import job has no program")
+	}
+	programId := *job.ProgramId
+
+	fileContent, err := os.ReadFile(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+
+	spec, err := openapi.Parse(fileContent)
+	if err != nil {
+		return fmt.Errorf("failed to parse OpenAPI spec: %v", err)
+	}
+	for _, warning := range spec.Warnings {
+		progress.Warn("%s", warning)
+	}
+
+	if err := progress.SetTotal(ctx, len(spec.Operations)); err != nil {
+		return err
+	}
+
+	loaded, err := loadScope(ctx, s.DB, programId)
+	if err != nil {
+		return err
+	}
+
+	var existing []*models.Endpoint
+	err = s.DB.WithContext(ctx).
+		Select("id", "domain", "method", "uri", "note").
+		Where("program_id = ?", programId).
+		Order("id ASC").
+		Find(&existing).Error
+	if err != nil {
+		return fmt.Errorf("failed to load endpoints: %v", err)
+	}
+	endpoints := make(map[string]*models.Endpoint, len(existing))
+	for _, endpoint := range existing {
+		key := endpointKey(endpoint.Domain, endpoint.Method, endpoint.URI)
+		if _, exists := endpoints[key]; !exists {
+			endpoints[key] = endpoint
+		}
+	}
+	resolver := &endpointResolver{db: s.DB, programId: programId, ids: make(map[string]int)}
+
+	var missing []*models.Endpoint
+	warnedServers := false
+	for i, op := range spec.Operations {
+		if len(op.Servers) > 1 && !warnedServers {
+			progress.Warn("Only the first server of the spec is used: %s", op.Servers[0])
+			warnedServers = true
+		}
+		endpoint, err := s.toEndpoint(op, job.Domain)
+		if err != nil {
+			progress.Warn("Skipping operation %d (%s %s): %v", i+1, op.Method, op.Path, err)
+		} else {
+			endpoint.ProgramId = programId
+			endpoint.Scope = string(loaded.scope.CheckHostPath(endpoint.Domain, endpoint.URI))
+			key := endpointKey(endpoint.Domain, endpoint.Method, endpoint.URI)
+			if current, exists := endpoints[key]; !exists {
+				endpoints[key] = endpoint
+				missing = append(missing, endpoint)
+			} else if current.Id == 0 {
+				*current = *endpoint // not created yet, the later operation wins like on existing endpoints
+			} else if err := s.document(ctx, current, endpoint); err != nil {
+				return err
+			}
+		}
+
+		if len(missing) >= importBatchSize {
+			if err := s.createEndpoints(ctx, resolver, missing); err != nil {
+				return err
+			}
+			missing = nil
+		}
+		if err := progress.Add(ctx, 1); err != nil {
+			return err
+		}
+	}
+
+	return s.createEndpoints(ctx, resolver, missing)
+}
+
+// createEndpoints inserts the endpoints of the spec that were missing when the import started. An import,
+// ingest batch, the proxy or a manual request may have created some of them since, those are kept and get
+// the documentation added instead.
+func (s *ImportOpenAPIService) createEndpoints(ctx context.Context, resolver *endpointResolver, missing []*models.Endpoint) error {
+	if err := resolver.create(ctx, missing); err != nil {
+		return err
+	}
+
+	documented := make(map[int]*models.Endpoint, len(missing))
+	ids := make([]int, 0, len(missing))
+	for _, endpoint := range missing {
+		endpoint.Id = resolver.ids[endpointKey(endpoint.Domain, endpoint.Method, endpoint.URI)]
+		documented[endpoint.Id] = endpoint
+		ids = append(ids, endpoint.Id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var skipped []*models.Endpoint
+	err := s.DB.WithContext(ctx).Select("id", "note").Where("id IN ? AND documented = ?", ids, false).Find(&skipped).Error
+	if err != nil {
+		return fmt.Errorf("failed to load endpoints: %v", err)
+	}
+	for _, current := range skipped {
+		if err := s.document(ctx, current, documented[current.Id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// document adds the documentation of endpoint to the existing endpoint current, a note written by hand is kept
+func (s *ImportOpenAPIService) document(ctx context.Context, current, endpoint *models.Endpoint) error {
+	updates := map[string]any{
+		"Documented":        true,
+		"EndpointType":      endpoint.EndpointType,
+		"Parameters":        endpoint.Parameters,
+		"RequestBodySchema": endpoint.RequestBodySchema,
+		"Security":          endpoint.Security,
+	}
+	if current.Note == "" || strings.HasPrefix(current.Note, "Auto-generated") {
+		updates["Note"] = endpoint.Note
+	}
+	if err := s.DB.WithContext(ctx).Model(current).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update endpoint: %v", err)
+	}
+	return nil
+}
+
+// toEndpoint builds the endpoint of an operation, its URI is the path of the server joined with the operation path
+func (s *ImportOpenAPIService) toEndpoint(op *openapi.Operation, domain string) (*models.Endpoint, error) {
+	var basePath string
+	if len(op.Servers) > 0 {
+		serverURL, err := url.Parse(op.Servers[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid server URL '%s': %v", op.Servers[0], err)
+		}
+		if domain == "" {
+			domain = serverURL.Hostname()
+		}
+		basePath = strings.TrimSuffix(serverURL.Path, "/")
+	}
+	if domain == "" {
+		return nil, fmt.Errorf("the spec declares no host, set the domain of the import")
+	}
+	if len(op.Method) > 10 {
+		return nil, fmt.Errorf("invalid method '%s'", op.Method)
+	}
+
+	uri := basePath + "/" + strings.TrimPrefix(op.Path, "/")
+
+	params := op.Parameters
+	if params == nil {
+		params = []openapi.Parameter{}
+	}
+	parameters, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	security, err := json.Marshal(op.Security)
+	if err != nil {
+		return nil, err
+	}
+	var requestBody []byte
+	if op.RequestBody != nil {
+		if requestBody, err = json.Marshal(op.RequestBody); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.Endpoint{
+		Method:            op.Method,
+		Domain:            domain,
+		URI:               uri,
+		EndpointType:      openAPIEndpointType(uri, op.ResponseTypes),
+		Note:              openAPIEndpointNote(op),
+		Documented:        true,
+		Parameters:        string(parameters),
+		RequestBodySchema: string(requestBody),
+		Security:          string(security),
+	}, nil
+}
+
+// openAPIEndpointType tells GraphQL endpoints by their path and web pages by responding only with HTML
+func openAPIEndpointType(uri string, responseTypes []string) models.EndpointType {
+	if strings.Contains(strings.ToLower(uri), "graphql") {
+		return models.EndpointTypeGraphQL
+	}
+	if len(responseTypes) == 0 {
+		return models.EndpointTypeAPI
+	}
+	for _, t := range responseTypes {
+		if !strings.HasPrefix(strings.ToLower(t), "text/html") {
+			return models.EndpointTypeAPI
+		}
+	}
+	return models.EndpointTypeWeb
+}
+
+// openAPIEndpointNote describes the operation with its summary, description, id and tags
+func openAPIEndpointNote(op *openapi.Operation) string {
+	var lines []string
+	if op.Summary != "" {
+		lines = append(lines, op.Summary)
+	}
+	if op.Description != "" && op.Description != op.Summary {
+		lines = append(lines, op.Description)
+	}
+	if op.OperationId != "" {
+		lines = append(lines, "Operation: "+op.OperationId)
+	}
+	if len(op.Tags) > 0 {
+		lines = append(lines, "Tags: "+strings.Join(op.Tags, ", "))
+	}
+	if op.Deprecated {
+		lines = append(lines, "Deprecated")
+	}
+	return strings.Join(lines, "\n")
+}
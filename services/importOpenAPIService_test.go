@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+	"gorm.io/gorm"
+)
+
+const testOpenAPISpec = `{
+  "openapi": "3.0.0",
+  "servers": [{"url": "https://example.com/api"}],
+  "paths": {
+    "/users": {"get": {"summary": "List users"}},
+    "/users/{id}": {"get": {"summary": "Get a user"}, "delete": {"summary": "Delete a user"}}
+  }
+}`
+
+func TestOpenAPIImportEndpointCreatedMeanwhile(t *testing.T) {
+	db, programId := newTestDB(t)
+	ctx := context.Background()
+
+	filePath := filepath.Join(t.TempDir(), "spec.json")
+	if err := os.WriteFile(filePath, []byte(testOpenAPISpec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	job := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypeImportOpenAPI, Title: "spec", FilePath: filePath, Status: models.JobStatusRunning}
+	if err := db.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// a HAR import creates one of the spec's endpoints after the import loaded the existing ones
+	seeded := &models.Endpoint{ProgramId: programId, Domain: "example.com", Method: "GET", URI: "/api/users/{id}", Note: "Auto-generated from HAR import", EndpointType: models.EndpointTypeAPI}
+	err := db.Callback().Create().Before("gorm:create").Register("test:seed_endpoint", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.([]*models.Endpoint); !ok || seeded.Id != 0 {
+			return
+		}
+		if err := tx.Session(&gorm.Session{NewDB: true}).Create(seeded).Error; err != nil {
+			tx.AddError(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := &ImportOpenAPIService{DB: db}
+	progress := &JobProgress{db: db, events: NewJobEvents(), job: job, every: 1}
+	if err := service.ProcessJob(ctx, job, progress); err != nil {
+		t.Fatal(err)
+	}
+	if seeded.Id == 0 {
+		t.Fatal("the endpoint was not seeded during the import")
+	}
+
+	var endpoints []*models.Endpoint
+	if err := db.Where("program_id = ?", programId).Order("id ASC").Find(&endpoints).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 3 {
+		t.Fatalf("got %d endpoints, want 3", len(endpoints))
+	}
+	for _, endpoint := range endpoints {
+		if !endpoint.Documented {
+			t.Errorf("endpoint %s %s is not documented", endpoint.Method, endpoint.URI)
+		}
+		if endpoint.Id == seeded.Id && endpoint.Note != "Get a user" {
+			t.Errorf("got note %q on the endpoint created meanwhile, want the spec's summary", endpoint.Note)
+		}
+	}
+}
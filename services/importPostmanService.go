@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/postman"
+	"gorm.io/gorm"
+)
+
+type ImportPostmanService struct {
+	DB              *gorm.DB
+	Runner          *JobRunner
+	UploadDirectory string
+}
+
+// ImportPostman stores the uploaded Postman collection and queues an import job for it, returning the job id
+func (s *ImportPostmanService) ImportPostman(ctx context.Context, file io.Reader, filename string, programId int, ignoredHeaders string) (int, error) {
+	// Create import job
+	job := &models.ImportJob{
+		ProgramId:      &programId,
+		JobType:        models.JobTypeImportPostman,
+		Title:          fmt.Sprintf("Import Postman: %s", filepath.Base(filename)),
+		Description:    fmt.Sprintf("Importing Postman collection: %s", filename),
+		IgnoredHeaders: ignoredHeaders,
+	}
+
+	return queueImport(ctx, s.DB, s.Runner, s.UploadDirectory, file, filename, job)
+}
+
+// ProcessJob imports the collection of a queued job as template requests, it is run by the JobRunner
+func (s *ImportPostmanService) ProcessJob(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+	fileContent, err := os.ReadFile(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+
+	requests, err := postman.Parse(fileContent)
+	if err != nil {
+		return fmt.Errorf("failed to parse Postman collection: %v", err)
+	}
+
+	templates := make([]*templateRequest, len(requests))
+	for i, req := range requests {
+		comment := req.Name
+		if req.Description != "" {
+			comment += "\n\n" + req.Description
+		}
+		templates[i] = &templateRequest{
+			Method:   req.Method,
+			URL:      req.URL,
+			Headers:  req.Headers,
+			Body:     req.Body,
+			Comment:  comment,
+			Warnings: req.Warnings,
+		}
+	}
+
+	return saveTemplateRequests(ctx, s.DB, job, progress, fmt.Sprintf("Auto-generated from Postman import: %s", job.OriginalName), templates)
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/linn221/RequesterBackend/models"
+	"gorm.io/gorm"
+)
+
+// templateRequest is a request taken from API documentation (a Postman collection, curl commands)
+// rather than observed traffic, so it has no response
+type templateRequest struct {
+	Method   string
+	URL      string
+	Headers  []models.Header
+	Body     string
+	Comment  string
+	Warnings []string
+}
+
+// saveTemplateRequests creates the requests of a template import and their endpoints
+func saveTemplateRequests(ctx context.Context, db *gorm.DB, job *models.ImportJob, progress *JobProgress, note string, templates []*templateRequest) error {
+	if job.ProgramId == nil {
+		return fmt.Errorf("import job has no program")
+	}
+	programId := *job.ProgramId
+
+	if err := progress.SetTotal(ctx, len(templates)); err != nil {
+		return err
+	}
+
+	endpoints, err := newEndpointResolver(ctx, db, programId, note)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(templates); start += importBatchSize {
+		end := min(start+importBatchSize, len(templates))
+
+		batch := make([]*models.MyRequest, 0, end-start)
+		for i := start; i < end; i++ {
+			template := templates[i]
+			for _, warning := range template.Warnings {
+				progress.Warn("Request %d (%s): %s", i+1, template.URL, warning)
+			}
+			req, err := newTemplateRequest(template, job.IgnoredHeaders)
+			if err != nil {
+				progress.Warn("Skipping request %d: %v", i+1, err)
+				continue
+			}
+			req.Sequence = i + 1
+			req.ImportJobId = job.Id
+			req.ProgramId = &programId
+			batch = append(batch, req)
+		}
+
+		if len(batch) > 0 {
+			if err := endpoints.Assign(ctx, batch); err != nil {
+				return err
+			}
+			if err := db.WithContext(ctx).Create(batch).Error; err != nil {
+				return fmt.Errorf("failed to create requests: %v", err)
+			}
+		}
+		if err := progress.Add(ctx, end-start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTemplateRequest(template *templateRequest, ignoredHeaders string) (*models.MyRequest, error) {
+	parsedURL, err := url.Parse(template.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL '%s': %v", template.URL, err)
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, fmt.Errorf("invalid URL '%s' - cannot extract domain", template.URL)
+	}
+	if len(template.Method) > 10 {
+		return nil, fmt.Errorf("invalid method '%s'", template.Method)
+	}
+
+	reqHeaders := filterHeaders(template.Headers, ignoredHeaders)
+	reqHeadersJSON, err := models.HeaderSlice(reqHeaders).ToJSON()
+	if err != nil {
+		return nil, err
+	}
+	resHeadersJSON, err := models.HeaderSlice{}.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &models.MyRequest{
+		URL:        template.URL,
+		Method:     template.Method,
+		Domain:     parsedURL.Hostname(),
+		ReqHeaders: reqHeadersJSON,
+		ReqBody:    template.Body,
+		ResHeaders: resHeadersJSON,
+		Comment:    template.Comment,
+		IsTemplate: true,
+	}
+
+	setRequestHashes(request, reqHeaders, nil, nil)
+	return request, nil
+}
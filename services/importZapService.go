@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/rawhttp"
+	"github.com/linn221/RequesterBackend/zap"
+	"gorm.io/gorm"
+)
+
+type ImportZapService struct {
+	DB              *gorm.DB
+	Runner          *JobRunner
+	UploadDirectory string
+}
+
+// ImportZAP stores the uploaded ZAP export and queues an import job for it, returning the job id
+func (s *ImportZapService) ImportZAP(ctx context.Context, file io.Reader, filename string, programId int, ignoredHeaders string) (int, error) {
+	// Create import job
+	job := &models.ImportJob{
+		ProgramId:      &programId,
+		JobType:        models.JobTypeImportZap,
+		Title:          fmt.Sprintf("Import ZAP: %s", filepath.Base(filename)),
+		Description:    fmt.Sprintf("Importing ZAP export: %s", filename),
+		IgnoredHeaders: ignoredHeaders,
+	}
+
+	return queueImport(ctx, s.DB, s.Runner, s.UploadDirectory, file, filename, job)
+}
+
+// ProcessJob imports the ZAP export of a queued job, it is run by the JobRunner
+func (s *ImportZapService) ProcessJob(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+	if job.ProgramId == nil {
+		return fmt.Errorf("import job has no program")
+	}
+
+	format, err := s.detectFormat(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read ZAP export: %v", err)
+	}
+	if format == zap.FormatHAR {
+		// ZAP's HAR export is plain HAR, its message note is kept as the request comment
+		harService := ImportHarService{DB: s.DB}
+		return harService.processHAR(ctx, job, progress, "ZAP")
+	}
+
+	// Count the messages first so progress can be reported
+	total, err := s.countMessages(job.FilePath, format)
+	if err != nil {
+		return fmt.Errorf("failed to parse ZAP export: %v", err)
+	}
+	if err := progress.SetTotal(ctx, total); err != nil {
+		return err
+	}
+
+	file, err := os.Open(job.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := zap.NewReader(bufio.NewReader(file), format)
+	if err != nil {
+		return err
+	}
+
+	note := fmt.Sprintf("Auto-generated from ZAP import: %s", job.OriginalName)
+	return importRequests(ctx, s.DB, job, progress, note, nil, func(sequence int) (*models.MyRequest, error) {
+		msg, err := reader.Next()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ZAP export: %v", err)
+		}
+
+		req, warnings, err := s.toMyRequest(msg, job.IgnoredHeaders)
+		if err != nil {
+			progress.Warn("Skipping message %d: %v", msg.Id, err)
+			return nil, nil
+		}
+		for _, warning := range warnings {
+			progress.Warn("Message %d: %s", msg.Id, warning)
+		}
+		return req, nil
+	})
+}
+
+// toMyRequest converts a ZAP message into a request
+func (s *ImportZapService) toMyRequest(msg *zap.Message, ignoredHeaders string) (*models.MyRequest, []string, error) {
+	rawRequest, warnings, err := rawhttp.ParseRequest(msg.Request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// ZAP writes the absolute URL in the request line
+	requestURL := rawRequest.Target
+	if !strings.HasPrefix(requestURL, "http://") && !strings.HasPrefix(requestURL, "https://") {
+		requestURL = fmt.Sprintf("http://%s%s", rawRequest.Host, rawRequest.Target)
+	}
+	parsedURL, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid URL '%s': %v", requestURL, err)
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, nil, fmt.Errorf("invalid URL '%s' - cannot extract domain", requestURL)
+	}
+
+	var statusCode int
+	var responseHeaders []models.Header
+	var responseBody []byte
+	var responseProto string
+	if len(msg.Response) > 0 {
+		rawResponse, resWarnings, err := rawhttp.ParseResponse(msg.Response)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("response kept as captured: %v", err))
+			responseBody = msg.Response
+		} else {
+			warnings = append(warnings, resWarnings...)
+			statusCode = rawResponse.StatusCode
+			responseHeaders = rawResponse.Headers
+			responseBody = rawResponse.Body
+			responseProto = rawResponse.Proto
+		}
+	}
+
+	requestTime := time.Now().Format(time.RFC3339)
+	if !msg.Timestamp.IsZero() {
+		requestTime = msg.Timestamp.Format(time.RFC3339)
+	}
+
+	reqHeaders := filterHeaders(rawRequest.Headers, ignoredHeaders)
+	resHeaders := filterHeaders(responseHeaders, ignoredHeaders)
+	reqHeadersJSON, err := models.HeaderSlice(reqHeaders).ToJSON()
+	if err != nil {
+		return nil, nil, err
+	}
+	resHeadersJSON, err := models.HeaderSlice(resHeaders).ToJSON()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request := &models.MyRequest{
+		URL:            requestURL,
+		Method:         rawRequest.Method,
+		Domain:         parsedURL.Hostname(),
+		ReqHeaders:     reqHeadersJSON,
+		ReqBody:        string(rawRequest.Body),
+		ResStatus:      statusCode,
+		ResHeaders:     resHeadersJSON,
+		RespSize:       len(responseBody),
+		LatencyMs:      msg.RTT,
+		RequestTime:    requestTime,
+		HTTPVersion:    rawRequest.Proto,
+		ResHTTPVersion: responseProto,
+		Comment:        msg.Note,
+	}
+	request.SetResBody(responseBody, rawhttp.IsBinary(responseBody))
+
+	setRequestHashes(request, reqHeaders, resHeaders, responseBody)
+
+	return request, warnings, nil
+}
+
+func (s *ImportZapService) detectFormat(filePath string) (zap.Format, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return zap.DetectFormat(file)
+}
+
+// countMessages returns the number of messages in a ZAP export without keeping them in memory
+func (s *ImportZapService) countMessages(filePath string, format zap.Format) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader, err := zap.NewReader(bufio.NewReader(file), format)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for {
+		if _, err := reader.Next(); err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return 0, err
+		}
+		count++
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+// a HAR export of ZAP labels the endpoints it creates as a ZAP import
+func TestZapImportHarEndpointNote(t *testing.T) {
+	db, programId := newTestDB(t)
+	ctx := context.Background()
+
+	content := `{"log":{"entries":[{"startedDateTime":"2024-01-01T00:00:00Z","time":12,` +
+		`"request":{"method":"GET","url":"https://example.com/api","headers":[]},` +
+		`"response":{"status":200,"headers":[],"content":{"size":0,"mimeType":"text/plain"}}}]}}`
+	filePath := filepath.Join(t.TempDir(), "zap.har")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	job := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypeImportZap, Title: "zap", FilePath: filePath,
+		OriginalName: "zap.har", Status: models.JobStatusRunning}
+	if err := db.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+	service := &ImportZapService{DB: db}
+	progress := &JobProgress{db: db, events: NewJobEvents(), job: job, every: importBatchSize}
+	if err := service.ProcessJob(ctx, job, progress); err != nil {
+		t.Fatal(err)
+	}
+
+	var endpoint models.Endpoint
+	if err := db.Where("program_id = ? AND uri = ?", programId, "/api").First(&endpoint).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := "Auto-generated from ZAP import: zap.har"; endpoint.Note != want {
+		t.Errorf("got endpoint note %q, want %q", endpoint.Note, want)
+	}
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linn221/RequesterBackend/har"
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/scope"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sessionJobMaxItems is how many requests a session's job takes before a new one is started
+const sessionJobMaxItems = 10000
+
+type IngestService struct {
+	DB *gorm.DB
+}
+
+// IngestResult summarizes what happened to the entries of a batch
+type IngestResult struct {
+	Accepted   int
+	Duplicates int
+	Skipped    int
+	JobIds     []int
+	Warnings   []string
+	Replayed   bool // the idempotency key was seen before, nothing was imported
+}
+
+// IngestBatch imports HAR entries captured by a browser extension. Entries go to programId when it is set,
+// otherwise to the program whose domains match their host. Entries out of every program's scope, or out of
+// the whole scope of the program they go to, are skipped, the latter are counted on the session's job.
+// Requests are appended to the rolling job of the session in each program. A batch retried with the same
+// idempotency key returns the first outcome, and entries already in the session's job (same ReqHash1 and
+// start time) are counted as duplicates, so partially delivered batches can be sent again.
+func (s *IngestService) IngestBatch(ctx context.Context, session, idempotencyKey string, programId *int, entries []*har.Entry) (*IngestResult, error) {
+	if session == "" {
+		session = "default"
+	}
+	if idempotencyKey != "" {
+		if result, err := s.replay(ctx, idempotencyKey); result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	if programId != nil {
+		if _, err := first[models.Program](s.DB.WithContext(ctx), *programId); err != nil {
+			return nil, err
+		}
+	}
+	scopes, err := loadProgramScope(ctx, s.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &IngestResult{}
+	requestsByProgram := make(map[int][]*models.MyRequest)
+	outOfScope := make(map[int]int)
+	var programIds []int
+	for i, entry := range entries {
+		if entry == nil {
+			result.Skipped++
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Entry %d: null entry", i+1))
+			continue
+		}
+		req, warnings, err := har.ToMyRequest(entry, 0, setRequestHashes)
+		if err != nil {
+			result.Skipped++
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Entry %d: %v", i+1, err))
+			continue
+		}
+		for _, warning := range warnings {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Entry %d (%s): %s", i+1, req.URL, warning))
+		}
+		if req.Domain == "" {
+			result.Skipped++
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Entry %d: invalid URL '%s' - cannot extract domain", i+1, req.URL))
+			continue
+		}
+		if _, err := endpointPath(req.URL); err != nil {
+			result.Skipped++
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Entry %d: invalid URL '%s': %v", i+1, req.URL, err))
+			continue
+		}
+
+		id := 0
+		if programId != nil {
+			id = *programId
+		} else if scoped, ok := scopes.ProgramFor(req.Domain); ok {
+			id = scoped
+		} else {
+			result.Skipped++
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Entry %d: %s is not in the scope of any program", i+1, req.Domain))
+			continue
+		}
+		if _, exists := requestsByProgram[id]; !exists {
+			programIds = append(programIds, id)
+			requestsByProgram[id] = nil
+		}
+		if scopes.Check(id, req.URL) == scope.Out {
+			result.Skipped++
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Entry %d: %s is out of the scope of program %d", i+1, req.URL, id))
+			outOfScope[id]++
+			continue
+		}
+		req.ProgramId = &id
+		requestsByProgram[id] = append(requestsByProgram[id], req)
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	var batch *models.IngestBatch
+	if idempotencyKey != "" {
+		batch = &models.IngestBatch{IdempotencyKey: idempotencyKey, Session: session}
+		if err := tx.Create(batch).Error; err != nil {
+			// a concurrent request with the same key got there first
+			tx.Rollback()
+			if result, replayErr := s.replay(ctx, idempotencyKey); result != nil {
+				return result, replayErr
+			}
+			return nil, fmt.Errorf("failed to record ingest batch: %v", err)
+		}
+	}
+
+	// session jobs are locked in program order, so two batches spanning the same programs can't wait on each other
+	sort.Ints(programIds)
+	for _, id := range programIds {
+		accepted, duplicates, jobId, err := s.appendToSession(ctx, tx, id, session, requestsByProgram[id], outOfScope[id])
+		if err != nil {
+			return nil, err
+		}
+		result.Accepted += accepted
+		result.Duplicates += duplicates
+		if jobId != 0 {
+			result.JobIds = append(result.JobIds, jobId)
+		}
+	}
+
+	if batch != nil {
+		jobIds := make([]string, len(result.JobIds))
+		for i, id := range result.JobIds {
+			jobIds[i] = strconv.Itoa(id)
+		}
+		err := tx.Model(batch).Updates(map[string]any{
+			"Accepted":   result.Accepted,
+			"Duplicates": result.Duplicates,
+			"Skipped":    result.Skipped,
+			"JobIds":     strings.Join(jobIds, ","),
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, tx.Commit().Error
+}
+
+// replay returns the outcome of an already ingested batch, nil when the key is new
+func (s *IngestService) replay(ctx context.Context, idempotencyKey string) (*IngestResult, error) {
+	var batches []*models.IngestBatch
+	if err := s.DB.WithContext(ctx).Where("idempotency_key = ?", idempotencyKey).Limit(1).Find(&batches).Error; err != nil {
+		return nil, err
+	}
+	if len(batches) == 0 {
+		return nil, nil
+	}
+	batch := batches[0]
+	result := &IngestResult{
+		Accepted:   batch.Accepted,
+		Duplicates: batch.Duplicates,
+		Skipped:    batch.Skipped,
+		Replayed:   true,
+	}
+	for _, id := range strings.Split(batch.JobIds, ",") {
+		if jobId, err := strconv.Atoi(id); err == nil {
+			result.JobIds = append(result.JobIds, jobId)
+		}
+	}
+	return result, nil
+}
+
+// appendToSession saves the requests of one program under the session's job, leaving out the ones the session already holds,
+// and counts the entries the program's scope left out on the job. It returns the number of requests saved, the number of
+// duplicates and the job id.
+func (s *IngestService) appendToSession(ctx context.Context, tx *gorm.DB, programId int, session string, requests []*models.MyRequest, outOfScope int) (int, int, int, error) {
+	// the job is locked first, the duplicate check below must not miss requests a concurrent batch is saving
+	job, err := sessionJob(ctx, tx, models.JobTypeIngest, programId, session)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	// earlier jobs of the session are checked too, a retry can arrive after the job rolled over
+	sessionJobs := tx.Model(&models.ImportJob{}).
+		Select("id").
+		Where("program_id = ? AND job_type = ? AND session = ?", programId, models.JobTypeIngest, session)
+
+	hashes := make([]string, len(requests))
+	for i, req := range requests {
+		hashes[i] = req.ReqHash1
+	}
+	type seenRequest struct {
+		ReqHash1    string
+		RequestTime string
+	}
+	seen := make(map[seenRequest]bool)
+	for _, chunk := range chunkStrings(hashes) {
+		var existing []seenRequest
+		err := tx.Model(&models.MyRequest{}).
+			Select("req_hash1", "request_time").
+			Where("import_job_id IN (?) AND req_hash1 IN ?", sessionJobs, chunk).
+			Find(&existing).Error
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, e := range existing {
+			seen[e] = true
+		}
+	}
+
+	sequence, err := nextSequence(ctx, tx, job.Id)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	fresh := make([]*models.MyRequest, 0, len(requests))
+	for _, req := range requests {
+		key := seenRequest{ReqHash1: req.ReqHash1, RequestTime: req.RequestTime}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		req.ImportJobId = job.Id
+		req.Sequence = sequence + len(fresh)
+		fresh = append(fresh, req)
+	}
+	duplicates := len(requests) - len(fresh)
+	if len(fresh) == 0 && outOfScope == 0 {
+		return 0, duplicates, job.Id, nil
+	}
+
+	if len(fresh) > 0 {
+		endpoints, err := newEndpointResolver(ctx, tx, programId, fmt.Sprintf("Auto-generated from ingest session: %s", session))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for start := 0; start < len(fresh); start += importBatchSize {
+			batch := fresh[start:min(start+importBatchSize, len(fresh))]
+			if err := endpoints.Assign(ctx, batch); err != nil {
+				return 0, 0, 0, err
+			}
+			if err := tx.Create(batch).Error; err != nil {
+				return 0, 0, 0, fmt.Errorf("failed to create requests: %v", err)
+			}
+		}
+	}
+
+	if err := addSessionJobItems(ctx, tx, job, len(fresh), outOfScope); err != nil {
+		return 0, 0, 0, err
+	}
+	return len(fresh), duplicates, job.Id, nil
+}
+
+// addSessionJobItems counts the requests saved under a session's job and the entries left out as out of scope
+func addSessionJobItems(ctx context.Context, tx *gorm.DB, job *models.ImportJob, saved int, outOfScope int) error {
+	now := time.Now()
+	return tx.WithContext(ctx).Model(job).Updates(map[string]any{
+		"TotalItems":      gorm.Expr("total_items + ?", saved),
+		"ProcessedItems":  gorm.Expr("processed_items + ?", saved),
+		"OutOfScopeItems": gorm.Expr("out_of_scope_items + ?", outOfScope),
+		"FinishedAt":      &now,
+	}).Error
+}
+
+// sessionJob returns the job collecting a session's traffic for a program, a new one is started
+// once the current one holds sessionJobMaxItems requests. jobType is JobTypeIngest or JobTypeProxy.
+// The job stays locked until tx ends, so concurrent batches of the session are saved one after another.
+func sessionJob(ctx context.Context, tx *gorm.DB, jobType string, programId int, session string) (*models.ImportJob, error) {
+	var jobs []*models.ImportJob
+	err := tx.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("program_id = ? AND job_type = ? AND session = ?", programId, jobType, session).
+		Order("id DESC").
+		Limit(1).
+		Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) > 0 && jobs[0].TotalItems < sessionJobMaxItems {
+		return jobs[0], nil
+	}
+
+	generation := 1
+	if len(jobs) > 0 && jobs[0].Generation != nil {
+		generation = *jobs[0].Generation + 1
+	}
+	now := time.Now()
+	job := &models.ImportJob{
+		ProgramId:  &programId,
+		JobType:    jobType,
+		Progress:   100,
+		Status:     models.JobStatusDone,
+		Session:    session,
+		Generation: &generation,
+		StartedAt:  &now,
+		FinishedAt: &now,
+	}
+	switch jobType {
+	case models.JobTypeProxy:
+		job.Title = fmt.Sprintf("Proxy: %s", session)
+		job.Description = fmt.Sprintf("Traffic recorded by the proxy in session %s", session)
+	default:
+		job.Title = fmt.Sprintf("Ingest: %s", session)
+		job.Description = fmt.Sprintf("Traffic sent to POST /ingest/batch by session %s", session)
+	}
+	// concurrent batches may race to start the job, the session index keeps one of them
+	if err := tx.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to create %s job: %v", jobType, err)
+	}
+
+	job = &models.ImportJob{}
+	err = tx.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("program_id = ? AND job_type = ? AND session = ? AND generation = ?", programId, jobType, session, generation).
+		First(job).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s job: %v", jobType, err)
+	}
+	return job, nil
+}
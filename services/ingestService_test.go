@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/har"
+	"github.com/linn221/RequesterBackend/models"
+)
+
+func ingestEntry(url, started string) *har.Entry {
+	entry := &har.Entry{StartedDateTime: started}
+	entry.Request.Method = "GET"
+	entry.Request.URL = url
+	entry.Request.HTTPVersion = "HTTP/1.1"
+	entry.Response.Status = 200
+	return entry
+}
+
+func TestIngestBatchConcurrent(t *testing.T) {
+	db, programId := newTestDB(t)
+	service := &IngestService{DB: db}
+
+	const n = 8
+	const perBatch = 3
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	results := make(chan *IngestResult, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entries := []*har.Entry{
+				// every batch carries the same entry, only one of them may save it
+				ingestEntry("https://example.com/shared", "2024-01-01T00:00:00Z"),
+			}
+			for j := range perBatch {
+				entries = append(entries, ingestEntry(fmt.Sprintf("https://example.com/items/%d/%d", i, j), "2024-01-01T00:00:01Z"))
+			}
+			result, err := service.IngestBatch(context.Background(), "browser", "", &programId, entries)
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- result
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	close(results)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	accepted, duplicates := 0, 0
+	for result := range results {
+		accepted += result.Accepted
+		duplicates += result.Duplicates
+	}
+	if want := n*perBatch + 1; accepted != want {
+		t.Errorf("accepted %d requests, want %d", accepted, want)
+	}
+	if duplicates != n-1 {
+		t.Errorf("got %d duplicates, want %d", duplicates, n-1)
+	}
+
+	var jobs []*models.ImportJob
+	err := db.Where("program_id = ? AND job_type = ? AND session = ?", programId, models.JobTypeIngest, "browser").Find(&jobs).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("got %d session jobs, want 1", len(jobs))
+	}
+	if jobs[0].TotalItems != accepted {
+		t.Errorf("job total items = %d, want %d", jobs[0].TotalItems, accepted)
+	}
+	var sequences []int
+	if err := db.Model(&models.MyRequest{}).Where("import_job_id = ?", jobs[0].Id).Pluck("sequence", &sequences).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(sequences) != accepted {
+		t.Fatalf("got %d requests, want %d", len(sequences), accepted)
+	}
+	sort.Ints(sequences)
+	for i, sequence := range sequences {
+		if sequence != i+1 {
+			t.Fatalf("got sequences %v, want 1 to %d", sequences, accepted)
+		}
+	}
+}
+
+func TestSessionJobRollsOver(t *testing.T) {
+	db, programId := newTestDB(t)
+	ctx := context.Background()
+
+	first, err := sessionJob(ctx, db, models.JobTypeProxy, programId, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Generation == nil || *first.Generation != 1 {
+		t.Fatalf("first job generation = %v, want 1", first.Generation)
+	}
+	again, err := sessionJob(ctx, db, models.JobTypeProxy, programId, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Id != first.Id {
+		t.Errorf("got job %d, want the open job %d", again.Id, first.Id)
+	}
+
+	if err := db.Model(first).Update("total_items", sessionJobMaxItems).Error; err != nil {
+		t.Fatal(err)
+	}
+	next, err := sessionJob(ctx, db, models.JobTypeProxy, programId, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Id == first.Id || next.Generation == nil || *next.Generation != 2 {
+		t.Errorf("got job %d generation %v, want a new job with generation 2", next.Id, next.Generation)
+	}
+
+	// a job started by a batch that lost the race is refused by the session index
+	generation := 2
+	duplicate := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypeProxy, Session: "default", Generation: &generation, Title: "Proxy: default"}
+	if err := db.Create(duplicate).Error; err == nil {
+		t.Fatal("created a second job with the same session generation")
+	}
+}
+
+func TestIngestBatchScope(t *testing.T) {
+	db, programId := newTestDB(t)
+	// example.com is the program's domain
+	rules := []*models.ScopeRule{
+		{ProgramId: programId, Kind: models.ScopeRuleIn, Host: "*.example.com"},
+		{ProgramId: programId, Kind: models.ScopeRuleOut, Host: "admin.example.com"},
+		{ProgramId: programId, Kind: models.ScopeRuleOut, PathPrefix: "/logout"},
+	}
+	if err := db.Create(rules).Error; err != nil {
+		t.Fatal(err)
+	}
+	other := &models.Program{Name: "other", Domains: "other.test"}
+	unscoped := &models.Program{Name: "unscoped"}
+	if err := db.Create([]*models.Program{other, unscoped}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		programId      *int
+		url            string
+		wantProgram    int // 0 when the entry is skipped
+		wantOutOfScope int // the program counting the skipped entry on its job
+	}{
+		{name: "program domain", url: "https://example.com/", wantProgram: programId},
+		{name: "in-scope rule", url: "https://api.example.com/users", wantProgram: programId},
+		{name: "other program", url: "https://other.test/", wantProgram: other.Id},
+		{name: "no program", url: "https://unknown.test/"},
+		{name: "out-of-scope host", url: "https://admin.example.com/", wantOutOfScope: programId},
+		{name: "out-of-scope path", url: "https://example.com/logout?next=/", wantOutOfScope: programId},
+		{name: "given program", programId: &programId, url: "https://api.example.com/", wantProgram: programId},
+		{name: "out of the given program", programId: &programId, url: "https://unknown.test/", wantOutOfScope: programId},
+		{name: "given program without scope", programId: &unscoped.Id, url: "https://unknown.test/", wantProgram: unscoped.Id},
+	}
+
+	service := &IngestService{DB: db}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := fmt.Sprintf("scope-%d", i)
+			result, err := service.IngestBatch(context.Background(), session, "", tt.programId, []*har.Entry{ingestEntry(tt.url, "2024-01-01T00:00:00Z")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var jobs []*models.ImportJob
+			if err := db.Where("session = ?", session).Find(&jobs).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantProgram != 0 {
+				if result.Accepted != 1 || len(jobs) != 1 || *jobs[0].ProgramId != tt.wantProgram {
+					t.Errorf("got %+v with jobs %v, want the entry saved for program %d", result, jobs, tt.wantProgram)
+				}
+				return
+			}
+			if result.Accepted != 0 || result.Skipped != 1 || len(result.Warnings) != 1 {
+				t.Errorf("got %+v, want the entry skipped with a warning", result)
+			}
+			if tt.wantOutOfScope == 0 {
+				if len(jobs) != 0 {
+					t.Errorf("got %d jobs for an entry of no program", len(jobs))
+				}
+				return
+			}
+			if len(jobs) != 1 || *jobs[0].ProgramId != tt.wantOutOfScope || jobs[0].OutOfScopeItems != 1 || jobs[0].TotalItems != 0 {
+				t.Errorf("got jobs %+v, want the entry counted as out of scope on the job of program %d", jobs, tt.wantOutOfScope)
+			}
+		})
+	}
+}
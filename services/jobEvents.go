@@ -0,0 +1,123 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+// JobEventType is the kind of update published for a job
+type JobEventType string
+
+const (
+	JobEventProgress JobEventType = "progress"
+	JobEventWarning  JobEventType = "warning"
+	JobEventFinished JobEventType = "finished"
+	JobEventMatch    JobEventType = "match" // a pattern search found a value, Match holds it
+)
+
+// JobEvent is a single update about a job, pushed to subscribers of that job
+type JobEvent struct {
+	Type           JobEventType
+	JobId          int
+	Status         models.JobStatus
+	Progress       int
+	TotalItems     int
+	ProcessedItems int
+	WarningCount   int
+	Message        string
+	Match          *models.PatternMatch
+	Missed         int // events the subscriber missed before this one as it was too slow, warnings included
+}
+
+// NewJobEventFromJob builds an event describing the current state of a job
+func NewJobEventFromJob(eventType JobEventType, job *models.ImportJob, message string) JobEvent {
+	return JobEvent{
+		Type:           eventType,
+		JobId:          job.Id,
+		Status:         job.Status,
+		Progress:       job.Progress,
+		TotalItems:     job.TotalItems,
+		ProcessedItems: job.ProcessedItems,
+		WarningCount:   job.WarningCount,
+		Message:        message,
+	}
+}
+
+// JobEvents fans job updates out to in-process subscribers (SSE clients)
+type JobEvents struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan JobEvent]*subscriber
+}
+
+// subscriber counts the events a subscriber missed since the last one it was sent
+type subscriber struct {
+	missed int
+}
+
+func NewJobEvents() *JobEvents {
+	return &JobEvents{
+		subscribers: make(map[int]map[chan JobEvent]*subscriber),
+	}
+}
+
+// Subscribe returns a channel receiving events for the job and a function to unsubscribe. The channel is
+// closed after the finished event.
+func (e *JobEvents) Subscribe(jobId int) (<-chan JobEvent, func()) {
+	ch := make(chan JobEvent, 64)
+
+	e.mu.Lock()
+	if e.subscribers[jobId] == nil {
+		e.subscribers[jobId] = make(map[chan JobEvent]*subscriber)
+	}
+	e.subscribers[jobId][ch] = &subscriber{}
+	e.mu.Unlock()
+
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subscribers[jobId], ch)
+		if len(e.subscribers[jobId]) == 0 {
+			delete(e.subscribers, jobId)
+		}
+	}
+}
+
+// Publish sends the event to every subscriber of its job. Slow subscribers miss events instead of blocking
+// the job, the next event they get tells how many. The finished event is always delivered, making room by
+// dropping the oldest pending event, then the subscriptions of the job end.
+func (e *JobEvents) Publish(event JobEvent) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	finished := event.Type == JobEventFinished
+	for ch, sub := range e.subscribers[event.JobId] {
+		event.Missed = sub.missed
+		for sent := false; !sent; {
+			select {
+			case ch <- event:
+				sent = true
+				sub.missed = 0
+			default:
+				if !finished {
+					sub.missed++
+					sent = true
+					continue
+				}
+				select {
+				case dropped := <-ch:
+					event.Missed += 1 + dropped.Missed
+				default:
+				}
+			}
+		}
+		if finished {
+			close(ch)
+		}
+	}
+	if finished {
+		delete(e.subscribers, event.JobId)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import "testing"
+
+func progressEvent(jobId int, processed int) JobEvent {
+	return JobEvent{Type: JobEventProgress, JobId: jobId, ProcessedItems: processed}
+}
+
+// drain reads the pending events of a channel, reporting whether it was closed
+func drain(ch <-chan JobEvent) ([]JobEvent, bool) {
+	var events []JobEvent
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events, true
+			}
+			events = append(events, event)
+		default:
+			return events, false
+		}
+	}
+}
+
+func TestJobEventsFullBuffer(t *testing.T) {
+	events := NewJobEvents()
+	ch, unsubscribe := events.Subscribe(1)
+	defer unsubscribe()
+
+	// fill the buffer, then overflow it by 3
+	for i := 1; i <= cap(ch)+3; i++ {
+		events.Publish(progressEvent(1, i))
+	}
+	got, closed := drain(ch)
+	if closed || len(got) != cap(ch) {
+		t.Fatalf("got %d events and closed %v, want %d pending", len(got), closed, cap(ch))
+	}
+	if last := got[len(got)-1]; last.ProcessedItems != cap(ch) || last.Missed != 0 {
+		t.Errorf("got last pending event %+v, want the one filling the buffer", last)
+	}
+
+	// the next event delivered reports the 3 dropped, the one after it none
+	events.Publish(progressEvent(1, 100))
+	events.Publish(progressEvent(1, 101))
+	got, _ = drain(ch)
+	if len(got) != 2 || got[0].Missed != 3 || got[1].Missed != 0 {
+		t.Errorf("got events %+v, want 3 missed reported once", got)
+	}
+}
+
+func TestJobEventsFinishedWithFullBuffer(t *testing.T) {
+	tests := []struct {
+		name       string
+		overflow   int // events dropped before the finished event
+		wantMissed int
+	}{
+		// the oldest pending event is dropped to make room
+		{name: "full buffer", overflow: 0, wantMissed: 1},
+		{name: "events missed before", overflow: 5, wantMissed: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := NewJobEvents()
+			ch, unsubscribe := events.Subscribe(1)
+			defer unsubscribe()
+			for i := 1; i <= cap(ch)+tt.overflow; i++ {
+				events.Publish(progressEvent(1, i))
+			}
+			events.Publish(JobEvent{Type: JobEventFinished, JobId: 1, Message: "done"})
+
+			got, closed := drain(ch)
+			if !closed {
+				t.Error("the channel was not closed after the finished event")
+			}
+			if len(got) != cap(ch) {
+				t.Fatalf("got %d events, want %d", len(got), cap(ch))
+			}
+			if got[0].ProcessedItems != 2 {
+				t.Errorf("got first event %+v, want the oldest one dropped", got[0])
+			}
+			last := got[len(got)-1]
+			if last.Type != JobEventFinished || last.Message != "done" || last.Missed != tt.wantMissed {
+				t.Errorf("got last event %+v, want finished with %d missed", last, tt.wantMissed)
+			}
+		})
+	}
+}
+
+func TestJobEventsSubscribers(t *testing.T) {
+	events := NewJobEvents()
+	slow, unsubscribeSlow := events.Subscribe(1)
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := events.Subscribe(1)
+	defer unsubscribeFast()
+	other, unsubscribeOther := events.Subscribe(2)
+	defer unsubscribeOther()
+	gone, unsubscribeGone := events.Subscribe(1)
+	unsubscribeGone()
+
+	// the slow subscriber missing events does not affect the fast one
+	for i := 1; i <= cap(slow)+2; i++ {
+		events.Publish(progressEvent(1, i))
+		if got, _ := drain(fast); len(got) != 1 || got[0].Missed != 0 {
+			t.Fatalf("fast subscriber got %+v, want event %d", got, i)
+		}
+	}
+	events.Publish(JobEvent{Type: JobEventFinished, JobId: 1})
+
+	if got, closed := drain(fast); !closed || len(got) != 1 || got[0].Missed != 0 {
+		t.Errorf("fast subscriber got %+v closed %v, want the finished event", got, closed)
+	}
+	if got, closed := drain(slow); !closed || got[len(got)-1].Missed != 3 {
+		t.Errorf("slow subscriber got closed %v, want finished with 3 missed", closed)
+	}
+	if got, closed := drain(other); closed || len(got) != 0 {
+		t.Errorf("subscriber of another job got %+v closed %v", got, closed)
+	}
+	if got, closed := drain(gone); closed || len(got) != 0 {
+		t.Errorf("unsubscribed channel got %+v closed %v", got, closed)
+	}
+	if len(events.subscribers[1]) != 0 {
+		t.Errorf("%d subscribers of the finished job are left", len(events.subscribers[1]))
+	}
+
+	// late unsubscribes of the finished job are harmless
+	unsubscribeSlow()
+	var nilEvents *JobEvents
+	nilEvents.Publish(progressEvent(1, 1))
+}
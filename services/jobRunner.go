@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"gorm.io/gorm"
+)
+
+// JobProcessFunc does the actual work of an import job, reporting progress as it goes
+type JobProcessFunc func(ctx context.Context, job *models.ImportJob, progress *JobProgress) error
+
+// JobRunner processes queued import jobs with a fixed pool of workers
+type JobRunner struct {
+	DB            *gorm.DB
+	Workers       int
+	ProgressEvery int // flush progress to the database after every N processed items
+	Events        *JobEvents
+
+	processors map[string]JobProcessFunc
+	queue      chan int
+
+	mu      sync.Mutex
+	running map[int]context.CancelFunc
+}
+
+// NewJobRunner creates a job runner, call Register for each job type and then Start
+func NewJobRunner(db *gorm.DB, events *JobEvents, workers int, progressEvery int) *JobRunner {
+	if workers < 1 {
+		workers = 1
+	}
+	if progressEvery < 1 {
+		progressEvery = 1
+	}
+	return &JobRunner{
+		DB:            db,
+		Workers:       workers,
+		ProgressEvery: progressEvery,
+		Events:        events,
+		processors:    make(map[string]JobProcessFunc),
+		queue:         make(chan int, 1024),
+		running:       make(map[int]context.CancelFunc),
+	}
+}
+
+// Register sets the function that processes jobs of the given type
+func (r *JobRunner) Register(jobType string, fn JobProcessFunc) {
+	r.processors[jobType] = fn
+}
+
+// Start recovers jobs left over from a previous run and starts the workers
+func (r *JobRunner) Start(ctx context.Context) error {
+	if err := r.recoverJobs(ctx); err != nil {
+		return fmt.Errorf("failed to recover import jobs: %v", err)
+	}
+	for i := 0; i < r.Workers; i++ {
+		go r.work(ctx)
+	}
+	return nil
+}
+
+// Enqueue schedules a queued job for processing
+func (r *JobRunner) Enqueue(jobId int) {
+	select {
+	case r.queue <- jobId:
+	default:
+		// queue is full, wait for a free slot without blocking the caller
+		go func() { r.queue <- jobId }()
+	}
+}
+
+// Cancel stops a job running in this process, it reports false when no worker is running the job
+func (r *JobRunner) Cancel(jobId int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancel, ok := r.running[jobId]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func (r *JobRunner) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case jobId := <-r.queue:
+			r.run(ctx, jobId)
+		}
+	}
+}
+
+// recoverJobs re-queues jobs that were queued or running when the server stopped.
+// Interrupted jobs have their partial requests removed and start over, or are
+// marked failed if their original file is gone.
+func (r *JobRunner) recoverJobs(ctx context.Context) error {
+	var jobs []*models.ImportJob
+	err := r.DB.WithContext(ctx).
+		Where("status IN ?", []models.JobStatus{models.JobStatusQueued, models.JobStatusRunning}).
+		Order("id ASC").
+		Find(&jobs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if job.Status == models.JobStatusRunning {
+			// pattern searches read no file
+			if _, err := os.Stat(job.FilePath); err != nil && job.JobType != models.JobTypePatternSearch {
+				r.finish(ctx, job, fmt.Errorf("interrupted by server restart and the original file is missing"))
+				continue
+			}
+			if err := r.resetJob(ctx, job); err != nil {
+				return err
+			}
+			log.Printf("Job runner: resuming interrupted job %d", job.Id)
+		}
+		r.Enqueue(job.Id)
+	}
+	return nil
+}
+
+// resetJob removes the partial data of an interrupted job and puts it back in the queued state
+func (r *JobRunner) resetJob(ctx context.Context, job *models.ImportJob) error {
+	tx := r.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	filePaths, err := deleteJobData(tx, job.Id)
+	if err != nil {
+		return err
+	}
+	updates := map[string]any{
+		"Status":         models.JobStatusQueued,
+		"Progress":       0,
+		"ProcessedItems": 0,
+		"WarningCount":   0,
+		"StartedAt":      nil,
+	}
+	if err := tx.Model(job).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	removeFiles(filePaths)
+	return nil
+}
+
+func (r *JobRunner) run(ctx context.Context, jobId int) {
+	job, err := first[models.ImportJob](r.DB.WithContext(ctx), jobId)
+	if err != nil {
+		log.Printf("Job runner: failed to load job %d: %v", jobId, err)
+		return
+	}
+	if job.Status != models.JobStatusQueued {
+		return
+	}
+
+	process, ok := r.processors[job.JobType]
+	if !ok {
+		r.finish(ctx, job, fmt.Errorf("unknown job type: %s", job.JobType))
+		return
+	}
+
+	now := time.Now()
+	job.Status = models.JobStatusRunning
+	job.Progress, job.ProcessedItems, job.WarningCount = 0, 0, 0
+	updates := map[string]any{
+		"Status":         job.Status,
+		"StartedAt":      &now,
+		"ErrorMessage":   "",
+		"Progress":       0,
+		"ProcessedItems": 0,
+		"WarningCount":   0,
+	}
+	// only start the job if it was not cancelled since it was loaded
+	result := r.DB.WithContext(ctx).Model(job).Where("status = ?", models.JobStatusQueued).Updates(updates)
+	if result.Error != nil {
+		log.Printf("Job runner: failed to start job %d: %v", jobId, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	r.Events.Publish(NewJobEventFromJob(JobEventProgress, job, ""))
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.running[jobId] = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, jobId)
+		r.mu.Unlock()
+		cancel()
+	}()
+
+	progress := &JobProgress{
+		db:     r.DB,
+		events: r.Events,
+		job:    job,
+		every:  r.ProgressEvery,
+	}
+	err = r.safeProcess(jobCtx, process, job, progress)
+	if err != nil && jobCtx.Err() != nil && ctx.Err() == nil {
+		r.cancelled(ctx, job)
+		return
+	}
+	r.finish(ctx, job, err)
+}
+
+// cancelled stores the status of a job stopped by Cancel
+func (r *JobRunner) cancelled(ctx context.Context, job *models.ImportJob) {
+	now := time.Now()
+	job.Status = models.JobStatusCancelled
+	job.ErrorMessage = jobCancelledMessage
+	updates := map[string]any{
+		"Status":         job.Status,
+		"ErrorMessage":   job.ErrorMessage,
+		"FinishedAt":     &now,
+		"Progress":       job.Progress,
+		"ProcessedItems": job.ProcessedItems,
+		"WarningCount":   job.WarningCount,
+	}
+	if err := r.DB.WithContext(ctx).Model(job).Updates(updates).Error; err != nil {
+		log.Printf("Job runner: failed to cancel job %d: %v", job.Id, err)
+	}
+	r.Events.Publish(NewJobEventFromJob(JobEventFinished, job, job.ErrorMessage))
+}
+
+// safeProcess runs the processor, turning a panic into a job failure
+func (r *JobRunner) safeProcess(ctx context.Context, process JobProcessFunc, job *models.ImportJob, progress *JobProgress) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("job panicked: %v", rec)
+		}
+	}()
+	return process(ctx, job, progress)
+}
+
+// finish stores the final status of a job
+func (r *JobRunner) finish(ctx context.Context, job *models.ImportJob, jobErr error) {
+	now := time.Now()
+	updates := map[string]any{
+		"FinishedAt":   &now,
+		"WarningCount": job.WarningCount,
+	}
+	if jobErr != nil {
+		log.Printf("Job runner: job %d failed: %v", job.Id, jobErr)
+		job.Status = models.JobStatusFailed
+		job.ErrorMessage = jobErr.Error()
+		updates["ErrorMessage"] = job.ErrorMessage
+	} else {
+		job.Status = models.JobStatusDone
+		job.Progress = 100
+		job.ProcessedItems = job.TotalItems
+		updates["Progress"] = job.Progress
+		updates["ProcessedItems"] = job.ProcessedItems
+	}
+	updates["Status"] = job.Status
+	if err := r.DB.WithContext(ctx).Model(job).Updates(updates).Error; err != nil {
+		log.Printf("Job runner: failed to finish job %d: %v", job.Id, err)
+	}
+	r.Events.Publish(NewJobEventFromJob(JobEventFinished, job, job.ErrorMessage))
+}
+
+// JobProgress tracks how many items of a running job have been processed
+type JobProgress struct {
+	db         *gorm.DB
+	events     *JobEvents
+	job        *models.ImportJob
+	every      int
+	sinceFlush int
+}
+
+// SetTotal records how many items the job is going to process
+func (p *JobProgress) SetTotal(ctx context.Context, total int) error {
+	p.job.TotalItems = total
+	if err := p.db.WithContext(ctx).Model(p.job).Update("TotalItems", total).Error; err != nil {
+		return err
+	}
+	p.events.Publish(NewJobEventFromJob(JobEventProgress, p.job, ""))
+	return nil
+}
+
+// Add marks n more items as processed, flushing to the database every N items
+func (p *JobProgress) Add(ctx context.Context, n int) error {
+	p.job.ProcessedItems += n
+	p.sinceFlush += n
+	if p.sinceFlush < p.every {
+		return nil
+	}
+	return p.Flush(ctx)
+}
+
+// Flush writes the current processed count and percentage to the database
+func (p *JobProgress) Flush(ctx context.Context) error {
+	p.sinceFlush = 0
+	percent := 0
+	if p.job.TotalItems > 0 {
+		percent = p.job.ProcessedItems * 100 / p.job.TotalItems
+	}
+	// 100 is reserved for finished jobs
+	if percent > 99 {
+		percent = 99
+	}
+	p.job.Progress = percent
+	updates := map[string]any{
+		"Progress":       p.job.Progress,
+		"ProcessedItems": p.job.ProcessedItems,
+		"WarningCount":   p.job.WarningCount,
+	}
+	if err := p.db.WithContext(ctx).Model(p.job).Updates(updates).Error; err != nil {
+		return err
+	}
+	p.events.Publish(NewJobEventFromJob(JobEventProgress, p.job, ""))
+	return nil
+}
+
+// Warn records a non fatal problem with a single item and pushes it to subscribers
+func (p *JobProgress) Warn(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	log.Printf("Job %d: %s", p.job.Id, message)
+	p.job.WarningCount++
+	p.events.Publish(NewJobEventFromJob(JobEventWarning, p.job, message))
+}
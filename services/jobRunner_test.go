@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"gorm.io/gorm"
+)
+
+const testJobType = "test"
+
+// startTestRunner starts a runner with the processor registered for testJobType, it is stopped when the test ends
+func startTestRunner(t *testing.T, db *gorm.DB, process JobProcessFunc, progressEvery int) *JobRunner {
+	t.Helper()
+	runner := NewJobRunner(db, NewJobEvents(), 2, progressEvery)
+	runner.Register(testJobType, process)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := runner.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func createQueuedJob(t *testing.T, db *gorm.DB, programId int, jobType string) *models.ImportJob {
+	t.Helper()
+	job := &models.ImportJob{ProgramId: &programId, JobType: jobType, Title: "test job", Status: models.JobStatusQueued}
+	if err := db.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// waitFinished returns the events of a job up to its finished event
+func waitFinished(t *testing.T, events <-chan JobEvent) []JobEvent {
+	t.Helper()
+	var got []JobEvent
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return got
+			}
+			got = append(got, event)
+		case <-timeout:
+			t.Fatalf("the job did not finish, got events %+v", got)
+		}
+	}
+}
+
+func TestJobRunnerRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		jobType     string
+		process     JobProcessFunc
+		wantStatus  models.JobStatus
+		wantMessage string
+		wantItems   int
+	}{
+		{
+			name:    "done",
+			jobType: testJobType,
+			process: func(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+				if err := progress.SetTotal(ctx, 5); err != nil {
+					return err
+				}
+				for i := range 5 {
+					if i == 2 {
+						progress.Warn("item %d is odd", i)
+					}
+					if err := progress.Add(ctx, 1); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			wantStatus: models.JobStatusDone,
+			wantItems:  5,
+		},
+		{
+			name:    "processor error",
+			jobType: testJobType,
+			process: func(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+				progress.SetTotal(ctx, 5)
+				progress.Add(ctx, 2)
+				return errors.New("file is corrupt")
+			},
+			wantStatus:  models.JobStatusFailed,
+			wantMessage: "file is corrupt",
+			wantItems:   2,
+		},
+		{
+			name:    "processor panic",
+			jobType: testJobType,
+			process: func(context.Context, *models.ImportJob, *JobProgress) error {
+				panic("nil map")
+			},
+			wantStatus:  models.JobStatusFailed,
+			wantMessage: "job panicked: nil map",
+		},
+		{
+			name:        "unknown job type",
+			jobType:     "unknown",
+			wantStatus:  models.JobStatusFailed,
+			wantMessage: "unknown job type: unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, programId := newTestDB(t)
+			runner := startTestRunner(t, db, tt.process, 2)
+			job := createQueuedJob(t, db, programId, tt.jobType)
+			events, unsubscribe := runner.Events.Subscribe(job.Id)
+			defer unsubscribe()
+
+			runner.Enqueue(job.Id)
+			got := waitFinished(t, events)
+
+			last := got[len(got)-1]
+			if last.Type != JobEventFinished || last.Status != tt.wantStatus || last.Message != tt.wantMessage {
+				t.Errorf("got last event %+v, want finished %s %q", last, tt.wantStatus, tt.wantMessage)
+			}
+			stored, err := first[models.ImportJob](db, job.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.wantStatus || stored.ErrorMessage != tt.wantMessage || stored.FinishedAt == nil {
+				t.Errorf("got status %s message %q finished at %v, want %s %q", stored.Status, stored.ErrorMessage, stored.FinishedAt, tt.wantStatus, tt.wantMessage)
+			}
+			if tt.wantStatus == models.JobStatusDone && (stored.Progress != 100 || stored.ProcessedItems != tt.wantItems || stored.TotalItems != tt.wantItems || stored.WarningCount != 1) {
+				t.Errorf("got progress %d, %d of %d items, %d warnings, want 100 %d of %d and 1 warning",
+					stored.Progress, stored.ProcessedItems, stored.TotalItems, stored.WarningCount, tt.wantItems, tt.wantItems)
+			}
+			if tt.wantStatus == models.JobStatusFailed && stored.ProcessedItems != tt.wantItems {
+				t.Errorf("got %d processed items, want the %d flushed before the failure", stored.ProcessedItems, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestJobRunnerProgressEvents(t *testing.T) {
+	db, programId := newTestDB(t)
+	runner := startTestRunner(t, db, func(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+		if err := progress.SetTotal(ctx, 4); err != nil {
+			return err
+		}
+		for range 4 {
+			if err := progress.Add(ctx, 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, 2)
+	job := createQueuedJob(t, db, programId, testJobType)
+	events, unsubscribe := runner.Events.Subscribe(job.Id)
+	defer unsubscribe()
+
+	runner.Enqueue(job.Id)
+	var got []string
+	for _, event := range waitFinished(t, events) {
+		got = append(got, fmt.Sprintf("%s %d/%d %d%%", event.Type, event.ProcessedItems, event.TotalItems, event.Progress))
+	}
+	// started, total set, flushed every 2 items with the last flush capped at 99%, finished
+	want := []string{"progress 0/0 0%", "progress 0/4 0%", "progress 2/4 50%", "progress 4/4 99%", "finished 4/4 100%"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+}
+
+func TestJobRunnerCancel(t *testing.T) {
+	db, programId := newTestDB(t)
+	started := make(chan struct{})
+	runner := startTestRunner(t, db, func(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+		progress.SetTotal(ctx, 10)
+		progress.Add(ctx, 3)
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, 1)
+	job := createQueuedJob(t, db, programId, testJobType)
+	events, unsubscribe := runner.Events.Subscribe(job.Id)
+	defer unsubscribe()
+
+	runner.Enqueue(job.Id)
+	<-started
+	if !runner.Cancel(job.Id) {
+		t.Fatal("Cancel found no worker running the job")
+	}
+	got := waitFinished(t, events)
+
+	if last := got[len(got)-1]; last.Status != models.JobStatusCancelled {
+		t.Errorf("got last event status %s, want cancelled", last.Status)
+	}
+	stored, err := first[models.ImportJob](db, job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.JobStatusCancelled || stored.ErrorMessage != jobCancelledMessage || stored.ProcessedItems != 3 {
+		t.Errorf("got status %s message %q and %d processed items, want cancelled with the 3 processed kept", stored.Status, stored.ErrorMessage, stored.ProcessedItems)
+	}
+	if runner.Cancel(job.Id) {
+		t.Error("Cancel of a finished job found a worker")
+	}
+}
+
+func TestJobRunnerCancelledWhileQueued(t *testing.T) {
+	db, programId := newTestDB(t)
+	ran := false
+	runner := NewJobRunner(db, NewJobEvents(), 1, 1)
+	runner.Register(testJobType, func(context.Context, *models.ImportJob, *JobProgress) error {
+		ran = true
+		return nil
+	})
+	job := createQueuedJob(t, db, programId, testJobType)
+	if err := db.Model(job).Update("Status", models.JobStatusCancelled).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	runner.run(context.Background(), job.Id)
+	if ran {
+		t.Error("a job cancelled while queued was processed")
+	}
+}
+
+func TestJobRunnerRecoverJobs(t *testing.T) {
+	db, programId := newTestDB(t)
+
+	filePath := filepath.Join(t.TempDir(), "capture.har")
+	if err := os.WriteFile(filePath, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	queued := createQueuedJob(t, db, programId, testJobType)
+	interrupted := &models.ImportJob{ProgramId: &programId, JobType: testJobType, Title: "interrupted", Status: models.JobStatusRunning, FilePath: filePath, ProcessedItems: 7, Progress: 40}
+	missingFile := &models.ImportJob{ProgramId: &programId, JobType: testJobType, Title: "missing file", Status: models.JobStatusRunning, FilePath: filepath.Join(t.TempDir(), "gone.har")}
+	search := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypePatternSearch, Title: "search", Status: models.JobStatusRunning}
+	done := &models.ImportJob{ProgramId: &programId, JobType: testJobType, Title: "done", Status: models.JobStatusDone}
+	for _, job := range []*models.ImportJob{interrupted, missingFile, search, done} {
+		if err := db.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the interrupted job saved a request before the restart
+	endpoint := &models.Endpoint{ProgramId: programId, Domain: "example.com", Method: "GET", URI: "/partial"}
+	if err := db.Create(endpoint).Error; err != nil {
+		t.Fatal(err)
+	}
+	partial := &models.MyRequest{ProgramId: &programId, ImportJobId: interrupted.Id, EndpointId: endpoint.Id, Sequence: 1, URL: "https://example.com/partial", Method: "GET", Domain: "example.com"}
+	if err := db.Create(partial).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	processed := make(chan int, 10)
+	process := func(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+		processed <- job.Id
+		return nil
+	}
+	runner := NewJobRunner(db, NewJobEvents(), 1, 1)
+	runner.Register(testJobType, process)
+	runner.Register(models.JobTypePatternSearch, process)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := runner.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[int]bool{}
+	for range 3 {
+		select {
+		case id := <-processed:
+			got[id] = true
+		case <-time.After(10 * time.Second):
+			t.Fatalf("processed jobs %v, want %d, %d and %d", got, queued.Id, interrupted.Id, search.Id)
+		}
+	}
+	if !got[queued.Id] || !got[interrupted.Id] || !got[search.Id] {
+		t.Errorf("processed jobs %v, want %d, %d and %d", got, queued.Id, interrupted.Id, search.Id)
+	}
+
+	stored, err := first[models.ImportJob](db, missingFile.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.JobStatusFailed || !strings.Contains(stored.ErrorMessage, "original file is missing") {
+		t.Errorf("got status %s message %q for the job without its file, want failed", stored.Status, stored.ErrorMessage)
+	}
+	var requests int64
+	if err := db.Model(&models.MyRequest{}).Where("import_job_id = ?", interrupted.Id).Count(&requests).Error; err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Errorf("%d partial requests of the interrupted job are left", requests)
+	}
+	if stored, err := first[models.ImportJob](db, done.Id); err != nil || stored.Status != models.JobStatusDone {
+		t.Errorf("the finished job was touched: %v %v", stored, err)
+	}
+}
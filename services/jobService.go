@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+const jobCancelledMessage = "cancelled by user"
+
+type JobService struct {
+	DB     *gorm.DB
+	Runner *JobRunner
+}
+
+// jobSorts are the sort keys of the job list
+var jobSorts = Sorts{
+	"job_type":        "job_type",
+	"title":           "title",
+	"status":          "status",
+	"progress":        "progress",
+	"total_items":     "total_items",
+	"processed_items": "processed_items",
+	"warning_count":   "warning_count",
+	"started_at":      "started_at",
+	"finished_at":     "finished_at",
+	"created_at":      "created_at",
+}
+
+// Get retrieves an import job by Id
+func (s *JobService) Get(ctx context.Context, id int) (*models.ImportJob, error) {
+	return first[models.ImportJob](s.DB.WithContext(ctx), id)
+}
+
+// List retrieves import jobs
+func (s *JobService) List(ctx context.Context, page *Page) ([]*models.ImportJob, error) {
+	query, err := page.apply(s.DB.WithContext(ctx).Model(&models.ImportJob{}), jobSorts, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*models.ImportJob
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	if len(jobs) > 0 {
+		page.next(len(jobs), jobs[len(jobs)-1])
+	}
+	return jobs, nil
+}
+
+// Cancel stops a queued or running job, requests it already imported are kept
+func (s *JobService) Cancel(ctx context.Context, id int) (int, error) {
+	job, err := first[models.ImportJob](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+	if job.IsFinished() {
+		return 0, utils.BadRequest("job has already finished")
+	}
+
+	// a queued job is cancelled in place, unless a worker picked it up in the meantime
+	if job.Status == models.JobStatusQueued {
+		now := time.Now()
+		result := s.DB.WithContext(ctx).Model(&models.ImportJob{}).
+			Where("id = ? AND status = ?", id, models.JobStatusQueued).
+			Updates(map[string]any{
+				"Status":       models.JobStatusCancelled,
+				"ErrorMessage": jobCancelledMessage,
+				"FinishedAt":   &now,
+			})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected > 0 {
+			job.Status = models.JobStatusCancelled
+			job.ErrorMessage = jobCancelledMessage
+			s.Runner.Events.Publish(NewJobEventFromJob(JobEventFinished, job, job.ErrorMessage))
+			return job.Id, nil
+		}
+	}
+
+	if !s.Runner.Cancel(id) {
+		// the job is marked running but no worker of this process owns it, or its worker has just
+		// finished it, in which case the final status is kept
+		now := time.Now()
+		result := s.DB.WithContext(ctx).Model(&models.ImportJob{}).
+			Where("id = ? AND status = ?", id, models.JobStatusRunning).
+			Updates(map[string]any{
+				"Status":       models.JobStatusCancelled,
+				"ErrorMessage": jobCancelledMessage,
+				"FinishedAt":   &now,
+			})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return 0, utils.BadRequest("job has already finished")
+		}
+		job.Status = models.JobStatusCancelled
+		job.ErrorMessage = jobCancelledMessage
+		s.Runner.Events.Publish(NewJobEventFromJob(JobEventFinished, job, job.ErrorMessage))
+	}
+	return job.Id, nil
+}
+
+// Retry removes everything a finished job created and queues it again using its original file, pattern searches run again
+func (s *JobService) Retry(ctx context.Context, id int) (int, error) {
+	job, err := first[models.ImportJob](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+	if !job.IsFinished() {
+		return 0, utils.BadRequest("only finished, failed or cancelled jobs can be retried")
+	}
+	if job.JobType != models.JobTypePatternSearch {
+		if job.FilePath == "" {
+			return 0, utils.BadRequest("this job has no file to import again")
+		}
+		if _, err := os.Stat(job.FilePath); err != nil {
+			return 0, utils.BadRequest("the original file of this job is no longer available")
+		}
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	filePaths, err := deleteJobData(tx, job.Id)
+	if err != nil {
+		return 0, err
+	}
+	updates := map[string]any{
+		"Status":          models.JobStatusQueued,
+		"ErrorMessage":    "",
+		"Progress":        0,
+		"TotalItems":      0,
+		"ProcessedItems":  0,
+		"WarningCount":    0,
+		"KeptItems":       0,
+		"OutOfScopeItems": 0,
+		"StaticItems":     0,
+		"StartedAt":       nil,
+		"FinishedAt":      nil,
+	}
+	if err := tx.Model(job).Updates(updates).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	removeFiles(filePaths)
+
+	s.Runner.Enqueue(job.Id)
+	return job.Id, nil
+}
+
+// Delete removes a job, its requests with their notes, attachments, images and tags,
+// and the endpoints that no longer have any requests
+func (s *JobService) Delete(ctx context.Context, id int) (int, error) {
+	job, err := first[models.ImportJob](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+	if job.Status == models.JobStatusRunning {
+		return 0, utils.BadRequest("job is running, cancel it first")
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	filePaths, err := deleteJobData(tx, job.Id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Delete(job).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Model(&models.PatternSearch{}).Where("last_job_id = ?", job.Id).Update("last_job_id", nil).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	if job.FilePath != "" {
+		filePaths = append(filePaths, job.FilePath)
+	}
+	removeFiles(filePaths)
+	return job.Id, nil
+}
+
+// deleteJobData removes every request of a job together with their notes, attachments, images and tags,
+// then the endpoints left without requests unless a spec documents them. Pattern matches and collection items of the
+// requests, and the matches found by the job when it is a pattern search, go too.
+// It returns the files to remove once the transaction is committed.
+func deleteJobData(tx *gorm.DB, jobId int) ([]string, error) {
+	if err := tx.Where("import_job_id = ?", jobId).Delete(&models.PatternMatch{}).Error; err != nil {
+		return nil, err
+	}
+
+	var requestIds []int
+	if err := tx.Model(&models.MyRequest{}).Where("import_job_id = ?", jobId).Pluck("id", &requestIds).Error; err != nil {
+		return nil, err
+	}
+	var endpointIds []int
+	if err := tx.Model(&models.MyRequest{}).Where("import_job_id = ?", jobId).Distinct().Pluck("endpoint_id", &endpointIds).Error; err != nil {
+		return nil, err
+	}
+
+	filePaths, err := deleteReferences(tx, string(models.TaggableTypeRequests), requestIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunkIds(requestIds) {
+		if err := tx.Where("request_id IN ?", chunk).Delete(&models.PatternMatch{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("request_id IN ?", chunk).Delete(&models.CollectionItem{}).Error; err != nil {
+			return nil, err
+		}
+		// replays of the deleted requests are kept without their original
+		if err := tx.Model(&models.MyRequest{}).Where("replay_of_id IN ?", chunk).UpdateColumn("replay_of_id", nil).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Where("import_job_id = ?", jobId).Delete(&models.MyRequest{}).Error; err != nil {
+		return nil, err
+	}
+
+	var emptyEndpointIds []int
+	for _, chunk := range chunkIds(endpointIds) {
+		var ids []int
+		err := tx.Model(&models.Endpoint{}).
+			Where("id IN ?", chunk).
+			Where("documented = ?", false).
+			Where("NOT EXISTS (SELECT 1 FROM my_requests WHERE my_requests.endpoint_id = endpoints.id)").
+			Pluck("id", &ids).Error
+		if err != nil {
+			return nil, err
+		}
+		emptyEndpointIds = append(emptyEndpointIds, ids...)
+	}
+
+	endpointFiles, err := deleteReferences(tx, string(models.TaggableTypeEndpoints), emptyEndpointIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunkIds(emptyEndpointIds) {
+		if err := tx.Where("id IN ?", chunk).Delete(&models.Endpoint{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return append(filePaths, endpointFiles...), nil
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+func newTestJobService(t *testing.T) (*JobService, int) {
+	t.Helper()
+	db, programId := newTestDB(t)
+	return &JobService{DB: db, Runner: NewJobRunner(db, NewJobEvents(), 1, 1)}, programId
+}
+
+func createTestJob(t *testing.T, db *gorm.DB, programId int, status models.JobStatus) *models.ImportJob {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "capture.har")
+	if err := os.WriteFile(filePath, []byte(`{"log":{"entries":[]}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	job := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypeImportHar, Title: "Import HAR", Status: status, FilePath: filePath, TotalItems: 3, ProcessedItems: 3}
+	if err := db.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestJobServiceCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup returns the status the job has before Cancel is called
+		setup      func(t *testing.T, service *JobService, job *models.ImportJob) models.JobStatus
+		wantStatus models.JobStatus
+		wantErr    bool
+		wantEvent  bool // a finished event is published by Cancel
+	}{
+		{
+			name:       "queued",
+			setup:      func(*testing.T, *JobService, *models.ImportJob) models.JobStatus { return models.JobStatusQueued },
+			wantStatus: models.JobStatusCancelled,
+			wantEvent:  true,
+		},
+		{
+			name: "running",
+			setup: func(t *testing.T, service *JobService, job *models.ImportJob) models.JobStatus {
+				ctx, cancel := context.WithCancel(context.Background())
+				service.Runner.running[job.Id] = cancel
+				t.Cleanup(func() {
+					if ctx.Err() == nil {
+						t.Error("the worker of the job was not cancelled")
+					}
+				})
+				return models.JobStatusRunning
+			},
+			wantStatus: models.JobStatusRunning, // the worker is stopped and stores the cancelled status itself
+		},
+		{
+			name:       "running without a worker",
+			setup:      func(*testing.T, *JobService, *models.ImportJob) models.JobStatus { return models.JobStatusRunning },
+			wantStatus: models.JobStatusCancelled,
+			wantEvent:  true,
+		},
+		{
+			name: "finished by its worker while cancelling",
+			setup: func(t *testing.T, service *JobService, job *models.ImportJob) models.JobStatus {
+				// the worker marks the job done right after Cancel loaded it as running
+				done := false
+				err := service.DB.Callback().Query().After("gorm:query").Register("test:finish_job", func(tx *gorm.DB) {
+					if _, ok := tx.Statement.Dest.(*models.ImportJob); !ok || done {
+						return
+					}
+					done = true
+					tx.Session(&gorm.Session{NewDB: true}).Model(&models.ImportJob{}).Where("id = ?", job.Id).Update("status", models.JobStatusDone)
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return models.JobStatusRunning
+			},
+			wantStatus: models.JobStatusDone,
+			wantErr:    true,
+		},
+		{
+			name:       "done",
+			setup:      func(*testing.T, *JobService, *models.ImportJob) models.JobStatus { return models.JobStatusDone },
+			wantStatus: models.JobStatusDone,
+			wantErr:    true,
+		},
+		{
+			name:       "failed",
+			setup:      func(*testing.T, *JobService, *models.ImportJob) models.JobStatus { return models.JobStatusFailed },
+			wantStatus: models.JobStatusFailed,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, programId := newTestJobService(t)
+			job := createTestJob(t, service.DB, programId, models.JobStatusQueued)
+			status := tt.setup(t, service, job)
+			if err := service.DB.Model(job).Update("status", status).Error; err != nil {
+				t.Fatal(err)
+			}
+			events, unsubscribe := service.Runner.Events.Subscribe(job.Id)
+			defer unsubscribe()
+
+			_, err := service.Cancel(context.Background(), job.Id)
+			if tt.wantErr {
+				if !errors.Is(err, utils.ErrBadRequest) {
+					t.Fatalf("got error %v, want a bad request", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := service.Get(context.Background(), job.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("got status %s, want %s", got.Status, tt.wantStatus)
+			}
+			if tt.wantStatus == models.JobStatusCancelled && (got.ErrorMessage != jobCancelledMessage || got.FinishedAt == nil) {
+				t.Errorf("got error message %q finished at %v, want the cancelled message and a finish time", got.ErrorMessage, got.FinishedAt)
+			}
+
+			select {
+			case event := <-events:
+				if !tt.wantEvent {
+					t.Errorf("got %s event, want none", event.Type)
+				} else if event.Type != JobEventFinished || event.Status != models.JobStatusCancelled {
+					t.Errorf("got %s event with status %s, want finished cancelled", event.Type, event.Status)
+				}
+			default:
+				if tt.wantEvent {
+					t.Error("got no finished event")
+				}
+			}
+		})
+	}
+}
+
+// jobData is a job with everything its requests are linked to
+type jobData struct {
+	job                *models.ImportJob
+	requests           []*models.MyRequest // of the job
+	other              *models.MyRequest   // of another job, replayed from the job's first request
+	autoEndpoint       *models.Endpoint    // only used by the job, removed with it
+	documentedEndpoint *models.Endpoint    // only used by the job but documented by a spec
+	sharedEndpoint     *models.Endpoint    // used by the other job too
+}
+
+func seedJobData(t *testing.T, db *gorm.DB, programId int, status models.JobStatus) *jobData {
+	t.Helper()
+	d := &jobData{job: createTestJob(t, db, programId, status)}
+	otherJob := createTestJob(t, db, programId, models.JobStatusDone)
+
+	newEndpoint := func(uri string, documented bool) *models.Endpoint {
+		endpoint := &models.Endpoint{ProgramId: programId, Domain: "example.com", Method: "GET", URI: uri, Documented: documented}
+		if err := db.Create(endpoint).Error; err != nil {
+			t.Fatal(err)
+		}
+		return endpoint
+	}
+	d.autoEndpoint = newEndpoint("/auto", false)
+	d.documentedEndpoint = newEndpoint("/documented", true)
+	d.sharedEndpoint = newEndpoint("/shared", false)
+
+	newRequest := func(jobId int, endpoint *models.Endpoint, sequence int) *models.MyRequest {
+		req := &models.MyRequest{ProgramId: &programId, ImportJobId: jobId, EndpointId: endpoint.Id, Sequence: sequence,
+			URL: "https://example.com" + endpoint.URI, Method: "GET", Domain: "example.com"}
+		if err := db.Create(req).Error; err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	d.requests = []*models.MyRequest{
+		newRequest(d.job.Id, d.autoEndpoint, 1),
+		newRequest(d.job.Id, d.documentedEndpoint, 2),
+		newRequest(d.job.Id, d.sharedEndpoint, 3),
+	}
+	d.other = newRequest(otherJob.Id, d.sharedEndpoint, 1)
+	if err := db.Model(d.other).Update("replay_of_id", d.requests[0].Id).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	search := &models.PatternSearch{ProgramId: &programId, Mode: models.PatternModeRegex, Expression: "x", Targets: "url"}
+	if err := db.Create(search).Error; err != nil {
+		t.Fatal(err)
+	}
+	matches := []*models.PatternMatch{
+		{PatternSearchId: search.Id, ImportJobId: otherJob.Id, RequestId: d.requests[0].Id, Field: "url"},
+		{PatternSearchId: search.Id, ImportJobId: otherJob.Id, RequestId: d.other.Id, Field: "url"},
+	}
+	saved := &models.SavedSearch{ProgramId: &programId, Name: "all", Collection: true}
+	if err := db.Create(matches).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	items := []*models.CollectionItem{{SavedSearchId: saved.Id, RequestId: d.requests[1].Id}, {SavedSearchId: saved.Id, RequestId: d.other.Id}}
+	notes := []*models.Note{
+		{ReferenceType: string(models.TaggableTypeRequests), ReferenceID: d.requests[2].Id, Value: "interesting"},
+		{ReferenceType: string(models.TaggableTypeEndpoints), ReferenceID: d.autoEndpoint.Id, Value: "auto"},
+	}
+	if err := db.Create(items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(notes).Error; err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// checkJobDataDeleted checks that the job's requests and what hangs off them are gone and the rest is kept
+func checkJobDataDeleted(t *testing.T, db *gorm.DB, d *jobData) {
+	t.Helper()
+	count := func(model any, query string, args ...any) int64 {
+		t.Helper()
+		var n int64
+		if err := db.Model(model).Where(query, args...).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	requestIds := []int{d.requests[0].Id, d.requests[1].Id, d.requests[2].Id}
+
+	if n := count(&models.MyRequest{}, "import_job_id = ?", d.job.Id); n != 0 {
+		t.Errorf("%d requests of the job are left", n)
+	}
+	if n := count(&models.PatternMatch{}, "request_id IN ?", requestIds); n != 0 {
+		t.Errorf("%d pattern matches of the job's requests are left", n)
+	}
+	if n := count(&models.CollectionItem{}, "request_id IN ?", requestIds); n != 0 {
+		t.Errorf("%d collection items of the job's requests are left", n)
+	}
+	if n := count(&models.Note{}, "reference_type = ? AND reference_id IN ?", models.TaggableTypeRequests, requestIds); n != 0 {
+		t.Errorf("%d notes of the job's requests are left", n)
+	}
+	if n := count(&models.Note{}, "reference_type = ? AND reference_id = ?", models.TaggableTypeEndpoints, d.autoEndpoint.Id); n != 0 {
+		t.Errorf("%d notes of the removed endpoint are left", n)
+	}
+	if n := count(&models.Endpoint{}, "id = ?", d.autoEndpoint.Id); n != 0 {
+		t.Error("the emptied auto-generated endpoint is left")
+	}
+	if n := count(&models.Endpoint{}, "id IN ?", []int{d.documentedEndpoint.Id, d.sharedEndpoint.Id}); n != 2 {
+		t.Errorf("got %d of the documented and shared endpoints, want both kept", n)
+	}
+
+	var other models.MyRequest
+	if err := db.First(&other, d.other.Id).Error; err != nil {
+		t.Fatalf("the other job's request is gone: %v", err)
+	}
+	if other.ReplayOfId != nil {
+		t.Errorf("the replay still links to deleted request %d", *other.ReplayOfId)
+	}
+	if n := count(&models.PatternMatch{}, "request_id = ?", d.other.Id); n != 1 {
+		t.Errorf("got %d pattern matches of the other request, want 1", n)
+	}
+	if n := count(&models.CollectionItem{}, "request_id = ?", d.other.Id); n != 1 {
+		t.Errorf("got %d collection items of the other request, want 1", n)
+	}
+}
+
+func TestJobServiceRetry(t *testing.T) {
+	tests := []struct {
+		status  models.JobStatus
+		wantErr bool
+	}{
+		{models.JobStatusQueued, true},
+		{models.JobStatusRunning, true},
+		{models.JobStatusDone, false},
+		{models.JobStatusFailed, false},
+		{models.JobStatusCancelled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			service, programId := newTestJobService(t)
+			d := seedJobData(t, service.DB, programId, tt.status)
+
+			_, err := service.Retry(context.Background(), d.job.Id)
+			if tt.wantErr {
+				if !errors.Is(err, utils.ErrBadRequest) {
+					t.Fatalf("got error %v, want a bad request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkJobDataDeleted(t, service.DB, d)
+			job, err := service.Get(context.Background(), d.job.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != models.JobStatusQueued || job.TotalItems != 0 || job.ProcessedItems != 0 || job.FinishedAt != nil {
+				t.Errorf("got status %s, %d of %d items, finished at %v, want a reset queued job", job.Status, job.ProcessedItems, job.TotalItems, job.FinishedAt)
+			}
+			select {
+			case id := <-service.Runner.queue:
+				if id != d.job.Id {
+					t.Errorf("queued job %d, want %d", id, d.job.Id)
+				}
+			default:
+				t.Error("the job was not queued")
+			}
+		})
+	}
+}
+
+func TestJobServiceRetryMissingFile(t *testing.T) {
+	service, programId := newTestJobService(t)
+	job := createTestJob(t, service.DB, programId, models.JobStatusFailed)
+	os.Remove(job.FilePath)
+
+	if _, err := service.Retry(context.Background(), job.Id); !errors.Is(err, utils.ErrBadRequest) {
+		t.Fatalf("got error %v, want a bad request", err)
+	}
+}
+
+func TestJobServiceDelete(t *testing.T) {
+	tests := []struct {
+		status  models.JobStatus
+		wantErr bool
+	}{
+		{models.JobStatusQueued, false},
+		{models.JobStatusRunning, true},
+		{models.JobStatusDone, false},
+		{models.JobStatusCancelled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			service, programId := newTestJobService(t)
+			d := seedJobData(t, service.DB, programId, tt.status)
+
+			_, err := service.Delete(context.Background(), d.job.Id)
+			if tt.wantErr {
+				if !errors.Is(err, utils.ErrBadRequest) {
+					t.Fatalf("got error %v, want a bad request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkJobDataDeleted(t, service.DB, d)
+			if _, err := service.Get(context.Background(), d.job.Id); !errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, utils.ErrNotFound) {
+				t.Errorf("got error %v loading the deleted job, want not found", err)
+			}
+			if _, err := os.Stat(d.job.FilePath); !os.IsNotExist(err) {
+				t.Errorf("the job's file is left: %v", err)
+			}
+		})
+	}
+}
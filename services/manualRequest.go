@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/rawhttp"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Create records a single raw HTTP request, and optionally its raw response, as copied from Burp Repeater
+// or the browser devtools. targetURL supplies the scheme and host when the request line only has a path,
+// it can be a base URL such as https://example.com:8443 or just the scheme. The request is filed under the
+// manual job of the program and its endpoint is reused or created like on imports.
+func (s *RequestService) Create(ctx context.Context, programId int, targetURL string, rawRequest, rawResponse []byte, comment string) (int, error) {
+	if _, err := first[models.Program](s.DB.WithContext(ctx), programId); err != nil {
+		return 0, err
+	}
+
+	parsedRequest, warnings, err := rawhttp.ParseRequest(rawRequest)
+	if err != nil {
+		return 0, utils.BadRequest(fmt.Sprintf("invalid raw request: %v", err))
+	}
+	requestURL, err := manualRequestURL(parsedRequest, targetURL)
+	if err != nil {
+		return 0, err
+	}
+	parsedURL, err := url.Parse(requestURL)
+	if err != nil || parsedURL.Hostname() == "" {
+		return 0, utils.BadRequest(fmt.Sprintf("invalid request URL '%s'", requestURL))
+	}
+	if len(parsedRequest.Method) > 10 {
+		return 0, utils.BadRequest(fmt.Sprintf("invalid method '%s'", parsedRequest.Method))
+	}
+
+	request := &models.MyRequest{
+		URL:         requestURL,
+		Method:      parsedRequest.Method,
+		Domain:      parsedURL.Hostname(),
+		ReqBody:     string(parsedRequest.Body),
+		HTTPVersion: parsedRequest.Proto,
+		RequestTime: time.Now().Format(time.RFC3339),
+		Comment:     comment,
+		ProgramId:   &programId,
+	}
+
+	var responseHeaders []models.Header
+	var responseBody []byte
+	if len(rawResponse) > 0 {
+		parsedResponse, responseWarnings, err := rawhttp.ParseResponse(rawResponse)
+		if err != nil {
+			return 0, utils.BadRequest(fmt.Sprintf("invalid raw response: %v", err))
+		}
+		warnings = append(warnings, responseWarnings...)
+		request.ResStatus = parsedResponse.StatusCode
+		request.ResHTTPVersion = parsedResponse.Proto
+		responseHeaders = parsedResponse.Headers
+		responseBody = parsedResponse.Body
+	}
+	for _, warning := range warnings {
+		log.Printf("Manual request %s: %s", requestURL, warning)
+	}
+	request.RespSize = len(responseBody)
+	request.SetResBody(responseBody, rawhttp.IsBinary(responseBody))
+
+	reqHeadersJSON, err := models.HeaderSlice(parsedRequest.Headers).ToJSON()
+	if err != nil {
+		return 0, err
+	}
+	resHeadersJSON, err := models.HeaderSlice(responseHeaders).ToJSON()
+	if err != nil {
+		return 0, err
+	}
+	request.ReqHeaders = reqHeadersJSON
+	request.ResHeaders = resHeadersJSON
+
+	setRequestHashes(request, parsedRequest.Headers, responseHeaders, responseBody)
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	job, err := programJob(ctx, tx, models.JobTypeManual, programId)
+	if err != nil {
+		return 0, err
+	}
+	sequence, err := nextSequence(ctx, tx, job.Id)
+	if err != nil {
+		return 0, err
+	}
+	request.ImportJobId = job.Id
+	request.Sequence = sequence
+
+	endpoints, err := newEndpointResolver(ctx, tx, programId, "Auto-generated from manual request")
+	if err != nil {
+		return 0, err
+	}
+	if err := endpoints.Assign(ctx, []*models.MyRequest{request}); err != nil {
+		return 0, err
+	}
+	if err := tx.Create(request).Error; err != nil {
+		return 0, fmt.Errorf("failed to create request: %v", err)
+	}
+	err = tx.Model(job).Updates(map[string]any{
+		"TotalItems":     gorm.Expr("total_items + 1"),
+		"ProcessedItems": gorm.Expr("processed_items + 1"),
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return request.Id, tx.Commit().Error
+}
+
+// manualRequestURL builds the absolute URL of a pasted request from its request target and the target URL
+func manualRequestURL(req *rawhttp.Request, targetURL string) (string, error) {
+	if strings.HasPrefix(req.Target, "http://") || strings.HasPrefix(req.Target, "https://") {
+		return req.Target, nil // absolute-form target sent to a proxy
+	}
+
+	scheme := "https"
+	host := req.Host
+	targetURL = strings.TrimSpace(targetURL)
+	switch strings.ToLower(targetURL) {
+	case "":
+	case "http", "https":
+		scheme = strings.ToLower(targetURL)
+	default:
+		target, err := url.Parse(targetURL)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return "", utils.BadRequest(fmt.Sprintf("invalid url '%s', expected a scheme or a base URL like https://example.com", targetURL))
+		}
+		scheme = target.Scheme
+		host = target.Host
+	}
+	if host == "" {
+		return "", utils.BadRequest("the request has no Host header, set url")
+	}
+
+	path := req.Target
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return scheme + "://" + host + path, nil
+}
+
+// programJob returns the job holding the manually added or the replayed requests of a program, creating it on first use.
+// The job stays locked until tx ends, so the requests saved under it meanwhile get their sequences one after another.
+func programJob(ctx context.Context, tx *gorm.DB, jobType string, programId int) (*models.ImportJob, error) {
+	var count int64
+	err := tx.WithContext(ctx).Model(&models.ImportJob{}).Where("program_id = ? AND job_type = ?", programId, jobType).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		now := time.Now()
+		job := models.ImportJob{
+			ProgramId:  &programId,
+			JobType:    jobType,
+			Singleton:  &jobType,
+			Progress:   100,
+			Status:     models.JobStatusDone,
+			StartedAt:  &now,
+			FinishedAt: &now,
+		}
+		switch jobType {
+		case models.JobTypeReplay:
+			job.Title = "Replayed requests"
+			job.Description = "Requests sent again with POST /requests/{id}/replay"
+		default:
+			job.Title = "Manual requests"
+			job.Description = "Requests added one by one with POST /requests"
+		}
+		// the first requests of a program may race to create the job, the singleton index keeps one of them
+		if err := tx.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&job).Error; err != nil {
+			return nil, fmt.Errorf("failed to create %s job: %v", jobType, err)
+		}
+	}
+
+	var job models.ImportJob
+	err = tx.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("program_id = ? AND job_type = ?", programId, jobType).
+		Order("id ASC").
+		First(&job).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s job: %v", jobType, err)
+	}
+	return &job, nil
+}
+
+// nextSequence returns the sequence of the next request saved under the job, which the caller has locked with programJob.
+// The read locks too, it has to see the requests committed since the transaction started.
+func nextSequence(ctx context.Context, tx *gorm.DB, jobId int) (int, error) {
+	var sequence int
+	err := tx.WithContext(ctx).Model(&models.MyRequest{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("import_job_id = ?", jobId).
+		Select("COALESCE(MAX(sequence), 0)").
+		Scan(&sequence).Error
+	if err != nil {
+		return 0, err
+	}
+	return sequence + 1, nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+func TestRequestServiceCreateConcurrent(t *testing.T) {
+	db, programId := newTestDB(t)
+	service := &RequestService{DB: db}
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			raw := fmt.Sprintf("GET /items/%d HTTP/1.1\r\nHost: example.com\r\n\r\n", i)
+			if _, err := service.Create(context.Background(), programId, "https", []byte(raw), nil, ""); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	var jobs []*models.ImportJob
+	if err := db.Where("program_id = ? AND job_type = ?", programId, models.JobTypeManual).Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("got %d manual jobs, want 1", len(jobs))
+	}
+	var sequences []int
+	if err := db.Model(&models.MyRequest{}).Where("import_job_id = ?", jobs[0].Id).Pluck("sequence", &sequences).Error; err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(sequences)
+	for i, sequence := range sequences {
+		if sequence != i+1 {
+			t.Fatalf("got sequences %v, want 1 to %d", sequences, n)
+		}
+	}
+	if len(sequences) != n {
+		t.Errorf("got %d requests, want %d", len(sequences), n)
+	}
+}
+
+func TestProgramJobSingleton(t *testing.T) {
+	db, programId := newTestDB(t)
+	ctx := context.Background()
+
+	first, err := programJob(ctx, db, models.JobTypeReplay, programId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second replay job made by a request that lost the race is refused by the unique index
+	jobType := models.JobTypeReplay
+	duplicate := &models.ImportJob{ProgramId: &programId, JobType: jobType, Singleton: &jobType, Title: "Replayed requests"}
+	if err := db.Create(duplicate).Error; err == nil {
+		t.Fatal("created a second replay job for the program")
+	}
+	again, err := programJob(ctx, db, models.JobTypeReplay, programId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Id != first.Id {
+		t.Errorf("got job %d, want %d", again.Id, first.Id)
+	}
+	manual, err := programJob(ctx, db, models.JobTypeManual, programId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manual.Id == first.Id {
+		t.Error("the manual and replay jobs are the same")
+	}
+}
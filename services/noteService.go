@@ -11,6 +11,14 @@ type NoteService struct {
 	DB *gorm.DB
 }
 
+// noteSorts are the sort keys of the note list
+var noteSorts = Sorts{
+	"reference_type": "reference_type",
+	"reference_id":   "reference_id",
+	"created_at":     "created_at",
+	"updated_at":     "updated_at",
+}
+
 // NewInstance returns a copy of the service with a new transaction
 func (s *NoteService) NewInstance(ctx context.Context) (*NoteService, func(), func() error) {
 	tx := s.DB.WithContext(ctx).Begin()
@@ -55,9 +63,8 @@ func (s *NoteService) Get(ctx context.Context, id int) (*models.Note, error) {
 }
 
 // List retrieves all notes with optional filtering
-func (s *NoteService) List(ctx context.Context, referenceType string, search string) ([]*models.Note, error) {
-	var notes []*models.Note
-	query := s.DB.WithContext(ctx)
+func (s *NoteService) List(ctx context.Context, referenceType string, search string, page *Page) ([]*models.Note, error) {
+	query := s.DB.WithContext(ctx).Model(&models.Note{})
 
 	if referenceType != "" {
 		query = query.Where("reference_type = ?", referenceType)
@@ -67,9 +74,18 @@ func (s *NoteService) List(ctx context.Context, referenceType string, search str
 		query = query.Where("value LIKE ?", "%"+search+"%")
 	}
 
-	if err := query.Preload("Taggables.Tag").Find(&notes).Error; err != nil {
+	query, err := page.apply(query, noteSorts, "")
+	if err != nil {
 		return nil, err
 	}
+
+	var notes []*models.Note
+	if err := query.Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	if len(notes) > 0 {
+		page.next(len(notes), notes[len(notes)-1])
+	}
 	return notes, nil
 }
 
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Page selects a slice of a list, by offset or by the cursor of the previous page, in the order of Sort.
+// The list fills in Total and NextCursor, a nil page lists every row.
+type Page struct {
+	Limit  int    // 0 returns every row
+	Offset int    // ignored with a cursor
+	Cursor string // NextCursor of the previous page, only valid with the same Sort
+	Sort   string // like -status,latency, the keys are checked against the Sorts of the list
+
+	Total      int64  // rows matching the filters, whatever the page
+	NextCursor string // empty on the last page
+
+	order clause.OrderBy  // the columns the rows are sorted by, id last
+	keys  []*schema.Field // the fields of the order columns, to read and decode cursor values
+}
+
+// apply counts the rows of query, which must hold the model and filters only, then sorts and limits it.
+// The page's Sort, or defaultSort when it has none, replaces the id order. A cursor holds the sort values
+// of the last row of the previous page, so pages don't skip or repeat rows while others are added.
+func (p *Page) apply(query *gorm.DB, sorts Sorts, defaultSort string) (*gorm.DB, error) {
+	by := defaultSort
+	if p != nil && p.Sort != "" {
+		by = p.Sort
+	}
+	order, err := sorts.order(by)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return query.Order(order), nil
+	}
+
+	if err := query.Session(&gorm.Session{}).Count(&p.Total).Error; err != nil {
+		return nil, err
+	}
+	p.order = order
+	stmt := &gorm.Statement{DB: query}
+	if err := stmt.Parse(query.Statement.Model); err != nil {
+		return nil, err
+	}
+	p.keys = make([]*schema.Field, len(order.Columns))
+	for i, column := range order.Columns {
+		if p.keys[i] = stmt.Schema.LookUpField(column.Column.Name); p.keys[i] == nil {
+			return nil, fmt.Errorf("%s can't be sorted by %s", stmt.Schema.Table, column.Column.Name)
+		}
+	}
+
+	if p.Cursor != "" {
+		values, err := p.decodeCursor()
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(after(order.Columns, values))
+	} else if p.Offset > 0 {
+		query = query.Offset(p.Offset)
+	}
+	query = query.Order(order)
+	if p.Limit > 0 {
+		query = query.Limit(p.Limit)
+	}
+	return query, nil
+}
+
+// columns returns the columns the page is sorted by, lists that select their columns have to load them
+// for the next cursor
+func (p *Page) columns() []string {
+	if p == nil {
+		return nil
+	}
+	columns := make([]string, len(p.order.Columns))
+	for i, column := range p.order.Columns {
+		columns[i] = column.Column.Name
+	}
+	return columns
+}
+
+// after builds the condition of the rows that come after values in the order of columns. NULLs sort first
+// in ascending order and last in descending order, as in MySQL and SQLite. Ids are never NULL and end the
+// order, so it is a strict order.
+func after(columns []clause.OrderByColumn, values []any) clause.Expression {
+	column, value := clause.Column{Name: columns[0].Column.Name}, values[0]
+	op := ">"
+	if columns[0].Desc {
+		op = "<"
+	}
+	var rest clause.Expression
+	if len(columns) > 1 {
+		rest = after(columns[1:], values[1:])
+	}
+
+	if value == nil {
+		if rest == nil {
+			return clause.Expr{SQL: "1 = 0"}
+		}
+		tied := clause.And(clause.Expr{SQL: "? IS NULL", Vars: []any{column}}, rest)
+		if columns[0].Desc {
+			return tied
+		}
+		return clause.Or(tied, clause.Expr{SQL: "? IS NOT NULL", Vars: []any{column}})
+	}
+	conditions := []clause.Expression{clause.Expr{SQL: "? " + op + " ?", Vars: []any{column, value}}}
+	if rest != nil {
+		conditions = append(conditions, clause.And(clause.Eq{Column: column, Value: value}, rest))
+	}
+	if columns[0].Desc {
+		conditions = append(conditions, clause.Expr{SQL: "? IS NULL", Vars: []any{column}})
+	}
+	if len(conditions) == 1 {
+		return conditions[0] // gorm joins a single OR condition to the previous one with OR
+	}
+	return clause.Or(conditions...)
+}
+
+// Sorts maps the sort keys of a list to their columns, id can always be sorted by
+type Sorts map[string]string
+
+// order builds the ORDER BY clause of a sort like -status,latency,url: comma separated keys,
+// descending when prefixed with -. Ties are broken by id so that pages don't overlap, an empty sort is id order.
+func (s Sorts) order(by string) (clause.OrderBy, error) {
+	var order clause.OrderBy
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(by, ",") {
+		key = strings.TrimSpace(key)
+		desc := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+		if key == "" {
+			continue
+		}
+		column, ok := s[key]
+		if key == "id" {
+			column, ok = "id", true
+		}
+		if !ok {
+			return order, utils.BadRequest(fmt.Sprintf("invalid sort '%s', expected %s", key, strings.Join(s.keys(), ", ")))
+		}
+		if seen[key] {
+			return order, utils.BadRequest(fmt.Sprintf("'%s' is sorted by twice", key))
+		}
+		seen[key] = true
+		order.Columns = append(order.Columns, clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: desc})
+	}
+	if !seen["id"] {
+		order.Columns = append(order.Columns, clause.OrderByColumn{Column: clause.Column{Name: "id"}})
+	}
+	return order, nil
+}
+
+func (s Sorts) keys() []string {
+	keys := []string{"id"}
+	for key := range s {
+		if key != "id" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys[1:])
+	return keys
+}
+
+// next sets NextCursor after a page of n rows was loaded, last is the last row. Only full pages have
+// a next page.
+func (p *Page) next(n int, last any) {
+	if p == nil || p.Limit <= 0 || n < p.Limit {
+		return
+	}
+	row := reflect.ValueOf(last)
+	if p.sortedById() {
+		id, _ := p.keys[0].ValueOf(context.Background(), row)
+		p.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id.(int))))
+		return
+	}
+	c := cursor{Sort: p.sortKey(), After: make([]json.RawMessage, len(p.keys))}
+	for i, field := range p.keys {
+		value, _ := field.ValueOf(context.Background(), row)
+		var err error
+		if c.After[i], err = json.Marshal(value); err != nil {
+			return // the list has no next cursor, offsets still work
+		}
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	p.NextCursor = base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursor is the next cursor of a sorted list, the values of the sort columns of the last row with its id
+type cursor struct {
+	Sort  string            `json:"s"`
+	After []json.RawMessage `json:"a"`
+}
+
+// sortedById reports whether the page is in plain id order, whose cursors are the last id only
+func (p *Page) sortedById() bool {
+	return len(p.order.Columns) == 1 && !p.order.Columns[0].Desc
+}
+
+// sortKey identifies the order of the page in its cursors, a cursor is only valid in the same order
+func (p *Page) sortKey() string {
+	keys := make([]string, len(p.order.Columns))
+	for i, column := range p.order.Columns {
+		keys[i] = column.Column.Name
+		if column.Desc {
+			keys[i] = "-" + keys[i]
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+// decodeCursor returns the values of the sort columns a cursor holds, typed like the fields of the model
+func (p *Page) decodeCursor() ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, utils.BadRequest("invalid cursor")
+	}
+	if p.sortedById() {
+		id, err := strconv.Atoi(string(data))
+		if err != nil {
+			return nil, utils.BadRequest("invalid cursor")
+		}
+		return []any{id}, nil
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.After) != len(p.keys) {
+		return nil, utils.BadRequest("invalid cursor")
+	}
+	if c.Sort != p.sortKey() {
+		return nil, utils.BadRequest("the cursor was made for another sort, use the sort of the previous page")
+	}
+	values := make([]any, len(p.keys))
+	for i, field := range p.keys {
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(c.After[i], value.Interface()); err != nil {
+			return nil, utils.BadRequest("invalid cursor")
+		}
+		if value.Elem().Kind() == reflect.Pointer {
+			if value.Elem().IsNil() {
+				continue // NULL
+			}
+			value = value.Elem()
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
+
+// Fields is the projection of a list, the JSON field names the client asked for. Lists skip
+// the columns and associations no wanted field needs, nil wants every field.
+type Fields map[string]bool
+
+// Has reports whether any of the fields is wanted
+func (f Fields) Has(names ...string) bool {
+	if f == nil {
+		return true
+	}
+	for _, name := range names {
+		if f[name] {
+			return true
+		}
+	}
+	return false
+}
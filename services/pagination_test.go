@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+// createTestPrograms adds n programs after the one of newTestDB, returning the ids of all of them
+func createTestPrograms(t *testing.T, db *gorm.DB, programId int, n int) []int {
+	t.Helper()
+	ids := []int{programId}
+	for i := range n {
+		program := &models.Program{Name: fmt.Sprintf("program %d", i)}
+		if err := db.Create(program).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, program.Id)
+	}
+	return ids
+}
+
+func programIds(programs []*models.Program) []int {
+	ids := make([]int, len(programs))
+	for i, program := range programs {
+		ids[i] = program.Id
+	}
+	return ids
+}
+
+func TestPageLimitOffset(t *testing.T) {
+	db, programId := newTestDB(t)
+	ids := createTestPrograms(t, db, programId, 6)
+	service := &ProgramService{DB: db}
+
+	tests := []struct {
+		name       string
+		page       *Page
+		want       []int
+		wantCursor bool
+	}{
+		{name: "no page", page: nil, want: ids},
+		{name: "no limit", page: &Page{}, want: ids},
+		{name: "first page", page: &Page{Limit: 3}, want: ids[:3], wantCursor: true},
+		{name: "offset", page: &Page{Limit: 3, Offset: 3}, want: ids[3:6], wantCursor: true},
+		{name: "last page", page: &Page{Limit: 3, Offset: 6}, want: ids[6:]},
+		{name: "offset without limit", page: &Page{Offset: 5}, want: ids[5:]},
+		{name: "past the end", page: &Page{Limit: 3, Offset: 10}, want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			programs, err := service.List(context.Background(), tt.page, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := programIds(programs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got programs %v, want %v", got, tt.want)
+			}
+			if tt.page == nil {
+				return
+			}
+			if tt.page.Total != int64(len(ids)) {
+				t.Errorf("got total %d, want %d", tt.page.Total, len(ids))
+			}
+			if (tt.page.NextCursor != "") != tt.wantCursor {
+				t.Errorf("got next cursor %q, want one %v", tt.page.NextCursor, tt.wantCursor)
+			}
+		})
+	}
+}
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	db, programId := newTestDB(t)
+	ids := createTestPrograms(t, db, programId, 6)
+	service := &ProgramService{DB: db}
+	ctx := context.Background()
+
+	var got []int
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(ids) {
+			t.Fatalf("the cursors don't end, got programs %v", got)
+		}
+		page := &Page{Limit: 3, Cursor: cursor}
+		programs, err := service.List(ctx, page, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, programIds(programs)...)
+		if page.Total != int64(len(ids)) {
+			t.Errorf("page %d: got total %d, want %d", pages, page.Total, len(ids))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+		// rows added while paging come last instead of shifting the pages
+		if pages == 0 {
+			added := &models.Program{Name: "added while paging"}
+			if err := db.Create(added).Error; err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, added.Id)
+		}
+	}
+	if !reflect.DeepEqual(got, ids) {
+		t.Errorf("got programs %v, want %v", got, ids)
+	}
+
+	_, err := service.List(ctx, &Page{Limit: 3, Cursor: "not a cursor!"}, nil)
+	if !errors.Is(err, utils.ErrBadRequest) {
+		t.Errorf("got error %v for an invalid cursor, want a bad request", err)
+	}
+}
+
+func TestRequestListFields(t *testing.T) {
+	db, programId := newTestDB(t)
+	endpoint := &models.Endpoint{ProgramId: programId, Domain: "example.com", Method: "GET", URI: "/users"}
+	if err := db.Create(endpoint).Error; err != nil {
+		t.Fatal(err)
+	}
+	job := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypeManual, Title: "manual", Status: models.JobStatusDone}
+	if err := db.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+	request := &models.MyRequest{ProgramId: &programId, ImportJobId: job.Id, EndpointId: endpoint.Id, Sequence: 1,
+		URL: "https://example.com/users", Method: "GET", Domain: "example.com", ResStatus: 200,
+		ReqHeaders: `{"Accept":"*/*"}`, ReqBody: "request body", ResHeaders: `{"Server":"test"}`, ResBody: "response body"}
+	if err := db.Create(request).Error; err != nil {
+		t.Fatal(err)
+	}
+	tag := &models.Tag{Name: "interesting"}
+	if err := db.Create(tag).Error; err != nil {
+		t.Fatal(err)
+	}
+	taggable := &models.Taggable{TagID: tag.Id, TaggableType: string(models.TaggableTypeRequests), TaggableID: request.Id}
+	if err := db.Create(taggable).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		fields       Fields
+		wantBodies   bool
+		wantProgram  bool
+		wantEndpoint bool
+		wantTags     bool
+	}{
+		{name: "every field", fields: nil, wantBodies: true, wantProgram: true, wantEndpoint: true, wantTags: true},
+		{name: "columns only", fields: Fields{"id": true, "url": true, "status_code": true}},
+		{name: "program name", fields: Fields{"id": true, "program_name": true}, wantProgram: true},
+		{name: "endpoint name", fields: Fields{"id": true, "endpoint_name": true}, wantEndpoint: true},
+		{name: "tags", fields: Fields{"id": true, "tags": true}, wantTags: true},
+		{name: "text", fields: Fields{"id": true, "text": true}, wantBodies: true, wantProgram: true, wantEndpoint: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, err := findRequestList(db.Model(&models.MyRequest{}), &Page{}, tt.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			got := requests[0]
+			if got.URL != request.URL || got.ResStatus != 200 {
+				t.Errorf("got url %q status %d, the list columns are always loaded", got.URL, got.ResStatus)
+			}
+			if bodies := got.ReqBody != "" && got.ResBody != "" && got.ReqHeaders != "" && got.ResHeaders != ""; bodies != tt.wantBodies {
+				t.Errorf("got bodies and headers loaded %v, want %v", bodies, tt.wantBodies)
+			}
+			if (got.Program != nil) != tt.wantProgram {
+				t.Errorf("got program loaded %v, want %v", got.Program != nil, tt.wantProgram)
+			}
+			if (got.Endpoint != nil) != tt.wantEndpoint {
+				t.Errorf("got endpoint loaded %v, want %v", got.Endpoint != nil, tt.wantEndpoint)
+			}
+			if tags := len(got.Taggables) == 1 && got.Taggables[0].Tag.Name == tag.Name; tags != tt.wantTags {
+				t.Errorf("got tags loaded %v, want %v", tags, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestSortsOrder(t *testing.T) {
+	tests := []struct {
+		by      string
+		want    string
+		wantErr string
+	}{
+		{by: "", want: "id"},
+		{by: "status", want: "res_status, id"},
+		{by: "-status,latency", want: "res_status DESC, latency_ms, id"},
+		{by: " content_type , -created_at ,", want: "res_content_type, created_at DESC, id"},
+		{by: "id", want: "id"},
+		{by: "-id", want: "id DESC"},
+		{by: "-id,status", want: "id DESC, res_status"},
+		{by: "bogus", wantErr: "invalid sort 'bogus', expected id, content_type"},
+		{by: "status,res_status", wantErr: "invalid sort 'res_status'"},
+		{by: "--status", wantErr: "invalid sort '-status'"},
+		{by: "status,-status", wantErr: "'status' is sorted by twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			order, err := requestSorts.order(tt.by)
+			if tt.wantErr != "" {
+				if !errors.Is(err, utils.ErrBadRequest) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want a bad request with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			columns := make([]string, len(order.Columns))
+			for i, column := range order.Columns {
+				columns[i] = column.Column.Name
+				if column.Desc {
+					columns[i] += " DESC"
+				}
+			}
+			if got := strings.Join(columns, ", "); got != tt.want {
+				t.Errorf("got order %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageKeysetCursor(t *testing.T) {
+	db, programId := newTestDB(t)
+	endpoint := &models.Endpoint{ProgramId: programId, Domain: "example.com", Method: "GET", URI: "/"}
+	if err := db.Create(endpoint).Error; err != nil {
+		t.Fatal(err)
+	}
+	job := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypeManual, Title: "manual", Status: models.JobStatusDone}
+	if err := db.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+	// many equal sort values, so pages end between rows the sort can't tell apart
+	rows := []struct {
+		status  int
+		latency int64
+		program bool // false leaves program_id NULL
+	}{
+		{200, 30, true},
+		{404, 10, false},
+		{200, 10, true},
+		{500, 20, true},
+		{200, 30, false},
+		{404, 10, true},
+		{200, 20, true},
+		{500, 20, false},
+	}
+	// the same creation time, its cursor values have to survive the JSON round trip
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	ids := make([]int, len(rows))
+	for i, row := range rows {
+		request := &models.MyRequest{ImportJobId: job.Id, EndpointId: endpoint.Id, Sequence: i + 1, URL: fmt.Sprintf("https://example.com/%d", i),
+			Method: "GET", Domain: "example.com", ResStatus: row.status, LatencyMs: row.latency, CreatedAt: createdAt}
+		if row.program {
+			request.ProgramId = &programId
+		}
+		if err := db.Create(request).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = request.Id
+	}
+
+	tests := []struct {
+		sort string
+		want []int // indexes of rows
+	}{
+		{sort: "", want: []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{sort: "-id", want: []int{7, 6, 5, 4, 3, 2, 1, 0}},
+		{sort: "status", want: []int{0, 2, 4, 6, 1, 5, 3, 7}},
+		{sort: "-status", want: []int{3, 7, 1, 5, 0, 2, 4, 6}},
+		{sort: "status,-latency", want: []int{0, 4, 6, 2, 1, 5, 3, 7}},
+		{sort: "-latency,status", want: []int{0, 4, 6, 3, 7, 2, 1, 5}},
+		{sort: "-status,-id", want: []int{7, 3, 5, 1, 6, 4, 2, 0}},
+		// NULLs sort first in ascending order and last in descending order
+		{sort: "program_id", want: []int{1, 4, 7, 0, 2, 3, 5, 6}},
+		{sort: "-program_id", want: []int{0, 2, 3, 5, 6, 1, 4, 7}},
+		{sort: "program_id,-status", want: []int{7, 1, 4, 3, 5, 0, 2, 6}},
+		{sort: "-program_id,latency", want: []int{2, 5, 3, 6, 0, 1, 7, 4}},
+		{sort: "created_at,status", want: []int{0, 2, 4, 6, 1, 5, 3, 7}},
+	}
+
+	for _, tt := range tests {
+		want := make([]int, len(tt.want))
+		for i, index := range tt.want {
+			want[i] = ids[index]
+		}
+		for _, limit := range []int{0, 1, 3} {
+			t.Run(fmt.Sprintf("%s by %d", tt.sort, limit), func(t *testing.T) {
+				var got []int
+				cursor := ""
+				for pages := 0; pages <= len(rows); pages++ {
+					page := &Page{Limit: limit, Cursor: cursor, Sort: tt.sort}
+					requests, err := findRequestList(db.Model(&models.MyRequest{}), page, Fields{"id": true})
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, request := range requests {
+						got = append(got, request.Id)
+					}
+					if cursor = page.NextCursor; cursor == "" {
+						break
+					}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got requests %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestPageCursorErrors(t *testing.T) {
+	db, _ := newTestDB(t)
+	page := &Page{Limit: 1, Sort: "-name"}
+	if _, err := (&ProgramService{DB: db}).List(context.Background(), page, nil); err != nil {
+		t.Fatal(err)
+	}
+	nameCursor := page.NextCursor
+	if nameCursor == "" {
+		t.Fatal("got no next cursor for a full page")
+	}
+
+	tests := []struct {
+		name    string
+		page    *Page
+		wantErr string
+	}{
+		{name: "another sort", page: &Page{Limit: 1, Sort: "name", Cursor: nameCursor}, wantErr: "the cursor was made for another sort"},
+		{name: "id cursor in a sorted list", page: &Page{Limit: 1, Sort: "-name", Cursor: "MQ"}, wantErr: "invalid cursor"},
+		{name: "sorted cursor in id order", page: &Page{Limit: 1, Cursor: nameCursor}, wantErr: "invalid cursor"},
+		{name: "not base64", page: &Page{Limit: 1, Cursor: "%%"}, wantErr: "invalid cursor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&ProgramService{DB: db}).List(context.Background(), tt.page, nil)
+			if !errors.Is(err, utils.ErrBadRequest) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want a bad request with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/pathnorm"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+type PathPatternService struct {
+	DB *gorm.DB
+}
+
+func (s *PathPatternService) validate(db *gorm.DB, input *models.PathPattern) error {
+	if _, err := pathnorm.New(pathnorm.CustomPattern{Pattern: input.Pattern, Placeholder: input.Placeholder}); err != nil {
+		return utils.BadRequest(err.Error())
+	}
+	if _, err := first[models.Program](db, input.ProgramId); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.BadRequest(fmt.Sprintf("program with ID %d not found", input.ProgramId))
+		}
+		return err
+	}
+	return nil
+}
+
+// Create creates a new path pattern and returns its Id
+func (s *PathPatternService) Create(ctx context.Context, pattern *models.PathPattern) (int, error) {
+	pattern.Placeholder = pathnorm.Placeholder(pattern.Placeholder)
+	if err := s.validate(s.DB.WithContext(ctx), pattern); err != nil {
+		return 0, err
+	}
+	if err := s.DB.WithContext(ctx).Create(pattern).Error; err != nil {
+		return 0, err
+	}
+	return pattern.Id, nil
+}
+
+// List retrieves path patterns, optionally only those of one program
+func (s *PathPatternService) List(ctx context.Context, programId *int) ([]*models.PathPattern, error) {
+	var patterns []*models.PathPattern
+	query := s.DB.WithContext(ctx)
+	if programId != nil {
+		query = query.Where("program_id = ?", *programId)
+	}
+	if err := query.Order("priority DESC, id ASC").Find(&patterns).Error; err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// Delete deletes a path pattern by Id and returns the deleted Id
+func (s *PathPatternService) Delete(ctx context.Context, id int) (int, error) {
+	pattern, err := first[models.PathPattern](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.DB.WithContext(ctx).Delete(pattern).Error; err != nil {
+		return 0, err
+	}
+	return pattern.Id, nil
+}
+
+// loadPathNormalizer builds the path normalizer of a program from its custom patterns and the default rules
+func loadPathNormalizer(ctx context.Context, db *gorm.DB, programId int) (*pathnorm.Normalizer, error) {
+	var patterns []*models.PathPattern
+	if err := db.WithContext(ctx).Where("program_id = ?", programId).Order("priority DESC, id ASC").Find(&patterns).Error; err != nil {
+		return nil, fmt.Errorf("failed to load path patterns: %v", err)
+	}
+	custom := make([]pathnorm.CustomPattern, len(patterns))
+	for i, p := range patterns {
+		custom[i] = pathnorm.CustomPattern{Pattern: p.Pattern, Placeholder: p.Placeholder}
+	}
+	return pathnorm.New(custom...)
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/linn221/RequesterBackend/jsonpath"
+	"github.com/linn221/RequesterBackend/models"
+)
+
+// patternFields are the request fields a pattern search can look at, JSONPath only reads the bodies
+var patternFields = []string{"url", "req.headers", "req.body", "res.headers", "res.body"}
+
+const (
+	maxMatchesPerRequest = 100  // more matches in a single request are dropped
+	maxMatchValue        = 1024 // longer matched values are cut, in bytes
+)
+
+// patternMatcher finds the values a regex or a JSONPath selects in the fields of a request
+type patternMatcher struct {
+	regex   *regexp.Regexp
+	path    *jsonpath.Path
+	targets map[string]bool
+}
+
+// newPatternMatcher compiles the expression of a search, errors are meant for the user
+func newPatternMatcher(mode, expression, targets string) (*patternMatcher, error) {
+	m := &patternMatcher{targets: make(map[string]bool)}
+	var err error
+	switch mode {
+	case models.PatternModeRegex:
+		if m.regex, err = regexp.Compile(expression); err != nil {
+			return nil, fmt.Errorf("invalid regex: %v", err)
+		}
+	case models.PatternModeJSONPath:
+		if m.path, err = jsonpath.Compile(expression); err != nil {
+			return nil, fmt.Errorf("invalid JSONPath: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid mode '%s', expected regex or jsonpath", mode)
+	}
+
+	fields, err := patternTargets(mode, targets)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		m.targets[field] = true
+	}
+	return m, nil
+}
+
+// patternTargets checks a comma separated list of fields, an empty list is every field the mode can read
+func patternTargets(mode, targets string) ([]string, error) {
+	allowed := patternFields
+	if mode == models.PatternModeJSONPath {
+		allowed = []string{"req.body", "res.body"}
+	}
+	fields := splitList(targets)
+	if len(fields) == 0 {
+		return allowed, nil
+	}
+	for _, field := range fields {
+		if !contains(allowed, field) {
+			return nil, fmt.Errorf("invalid target '%s' for %s, expected %s", field, mode, strings.Join(allowed, ", "))
+		}
+	}
+	return fields, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the matches in a request, at most maxMatchesPerRequest of them
+func (m *patternMatcher) Match(request *models.MyRequest) []*models.PatternMatch {
+	var matches []*models.PatternMatch
+	add := func(field, path string, offset int, value string) bool {
+		matches = append(matches, &models.PatternMatch{
+			RequestId: request.Id,
+			Field:     field,
+			Path:      path,
+			Offset:    offset,
+			Value:     cutValue(value),
+		})
+		return len(matches) < maxMatchesPerRequest
+	}
+
+	texts := map[string]string{
+		"url":         request.URL,
+		"req.headers": request.ReqHeaders,
+		"req.body":    request.ReqBody,
+		"res.headers": request.ResHeaders,
+		"res.body":    request.ResBody,
+	}
+	for _, field := range patternFields {
+		if !m.targets[field] || texts[field] == "" {
+			continue
+		}
+		var more bool
+		switch {
+		case m.path != nil:
+			more = m.matchJSON(texts[field], func(path, value string) bool { return add(field, path, 0, value) })
+		case field == "req.headers" || field == "res.headers":
+			more = m.matchHeaders(texts[field], func(name string, offset int, value string) bool { return add(field, name, offset, value) })
+		default:
+			more = m.matchText(texts[field], func(offset int, value string) bool { return add(field, "", offset, value) })
+		}
+		if !more {
+			break
+		}
+	}
+	return matches
+}
+
+// matchText reports every regex match of the text, or its first group when the regex has groups.
+// It returns false once add asks to stop.
+func (m *patternMatcher) matchText(text string, add func(offset int, value string) bool) bool {
+	for _, loc := range m.regex.FindAllStringSubmatchIndex(text, maxMatchesPerRequest) {
+		start, end := loc[0], loc[1]
+		if len(loc) > 2 {
+			if loc[2] < 0 {
+				continue // the group didn't take part in the match
+			}
+			start, end = loc[2], loc[3]
+		}
+		if !add(start, text[start:end]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHeaders runs the regex over each "Name: value" header line, offsets are in the line
+func (m *patternMatcher) matchHeaders(headersJSON string, add func(name string, offset int, value string) bool) bool {
+	headers, err := models.HeaderSliceFromJSON(headersJSON)
+	if err != nil {
+		return true
+	}
+	for _, header := range headers {
+		more := m.matchText(header.Name+": "+header.Value, func(offset int, value string) bool {
+			return add(header.Name, offset, value)
+		})
+		if !more {
+			return false
+		}
+	}
+	return true
+}
+
+// matchJSON reports the values the path selects in a JSON body, other bodies have none
+func (m *patternMatcher) matchJSON(body string, add func(path, value string) bool) bool {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return true
+	}
+	for _, result := range m.path.Find(doc) {
+		if !add(result.Path, jsonValue(result.Value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonValue formats a selected value, strings as they are and anything else as compact JSON
+func jsonValue(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// cutValue keeps the first maxMatchValue bytes of a value, on a character boundary
+func cutValue(value string) string {
+	if len(value) <= maxMatchValue {
+		return value
+	}
+	end := maxMatchValue
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+	return value[:end] + "…"
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+type PatternSearchService struct {
+	DB     *gorm.DB
+	Runner *JobRunner
+}
+
+// patternSearchSorts are the sort keys of the pattern search list
+var patternSearchSorts = Sorts{
+	"program_id": "program_id",
+	"name":       "name",
+	"mode":       "mode",
+	"created_at": "created_at",
+}
+
+// patternMatchSorts are the sort keys of the match list
+var patternMatchSorts = Sorts{
+	"request_id": "request_id",
+	"field":      "field",
+	"path":       "path",
+	"offset":     "offset",
+	"value":      "value",
+}
+
+// Create validates and saves a pattern search, then queues its first run. It returns the search id.
+func (s *PatternSearchService) Create(ctx context.Context, search *models.PatternSearch) (int, error) {
+	if search.ProgramId != nil {
+		if _, err := first[models.Program](s.DB.WithContext(ctx), *search.ProgramId); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := newPatternMatcher(search.Mode, search.Expression, search.Targets); err != nil {
+		return 0, utils.BadRequest(err.Error())
+	}
+	targets, _ := patternTargets(search.Mode, search.Targets)
+	search.Targets = strings.Join(targets, ",")
+	if search.Filter != "" {
+		if _, err := applyFilter(s.DB.Model(&models.MyRequest{}), search.Filter); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := s.DB.WithContext(ctx).Create(search).Error; err != nil {
+		return 0, err
+	}
+	if _, err := s.Run(ctx, search.Id, false); err != nil {
+		return 0, err
+	}
+	return search.Id, nil
+}
+
+// Get retrieves a pattern search by Id
+func (s *PatternSearchService) Get(ctx context.Context, id int) (*models.PatternSearch, error) {
+	return first[models.PatternSearch](s.DB.WithContext(ctx), id)
+}
+
+// List retrieves pattern searches, optionally only those of one program
+func (s *PatternSearchService) List(ctx context.Context, programId *int, page *Page) ([]*models.PatternSearch, error) {
+	query := s.DB.WithContext(ctx).Model(&models.PatternSearch{})
+	if programId != nil {
+		query = query.Where("program_id = ?", *programId)
+	}
+	query, err := page.apply(query, patternSearchSorts, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var searches []*models.PatternSearch
+	if err := query.Find(&searches).Error; err != nil {
+		return nil, err
+	}
+	if len(searches) > 0 {
+		page.next(len(searches), searches[len(searches)-1])
+	}
+	return searches, nil
+}
+
+// Run queues a new run of a search and returns its job id. With onlyNew, only the requests saved
+// since the previous run are searched.
+func (s *PatternSearchService) Run(ctx context.Context, id int, onlyNew bool) (int, error) {
+	search, err := first[models.PatternSearch](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+
+	title := search.Name
+	if title == "" {
+		title = search.Expression
+	}
+	job := &models.ImportJob{
+		ProgramId:       search.ProgramId,
+		JobType:         models.JobTypePatternSearch,
+		Title:           fmt.Sprintf("Pattern search: %s", title),
+		Description:     fmt.Sprintf("Searching %s for the %s %s", search.Targets, search.Mode, search.Expression),
+		Status:          models.JobStatusQueued,
+		PatternSearchId: &search.Id,
+	}
+	if onlyNew {
+		job.AfterRequestId = search.LastRequestId
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	if err := tx.Create(job).Error; err != nil {
+		return 0, fmt.Errorf("failed to create search job: %v", err)
+	}
+	if err := tx.Model(search).Update("LastJobId", job.Id).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	s.Runner.Enqueue(job.Id)
+	return job.Id, nil
+}
+
+// ListMatches retrieves the matches of a run of a search, the latest run when jobId is nil
+func (s *PatternSearchService) ListMatches(ctx context.Context, id int, jobId *int, requestId *int, page *Page) ([]*models.PatternMatch, error) {
+	search, err := first[models.PatternSearch](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if jobId == nil {
+		jobId = search.LastJobId
+	}
+	if jobId == nil {
+		return []*models.PatternMatch{}, nil
+	}
+
+	query := s.DB.WithContext(ctx).Model(&models.PatternMatch{}).
+		Where("pattern_search_id = ? AND import_job_id = ?", search.Id, *jobId)
+	if requestId != nil {
+		query = query.Where("request_id = ?", *requestId)
+	}
+	query, err = page.apply(query, patternMatchSorts, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*models.PatternMatch
+	if err := query.Find(&matches).Error; err != nil {
+		return nil, err
+	}
+	if len(matches) > 0 {
+		page.next(len(matches), matches[len(matches)-1])
+	}
+	return matches, nil
+}
+
+// Delete removes a search with its runs and their matches, runs in progress must be cancelled first
+func (s *PatternSearchService) Delete(ctx context.Context, id int) (int, error) {
+	search, err := first[models.PatternSearch](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+	var active int64
+	err = s.DB.WithContext(ctx).Model(&models.ImportJob{}).
+		Where("pattern_search_id = ? AND status IN ?", search.Id, []models.JobStatus{models.JobStatusQueued, models.JobStatusRunning}).
+		Count(&active).Error
+	if err != nil {
+		return 0, err
+	}
+	if active > 0 {
+		return 0, utils.BadRequest("the search is running, cancel its job first")
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	if err := tx.Where("pattern_search_id = ?", search.Id).Delete(&models.PatternMatch{}).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Where("pattern_search_id = ?", search.Id).Delete(&models.ImportJob{}).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Delete(search).Error; err != nil {
+		return 0, err
+	}
+	return search.Id, tx.Commit().Error
+}
+
+// ProcessJob runs a pattern search over the requests of its program in id order, it is run by the JobRunner.
+// Matches are saved batch by batch and pushed to the job's subscribers as match events.
+func (s *PatternSearchService) ProcessJob(ctx context.Context, job *models.ImportJob, progress *JobProgress) error {
+	if job.PatternSearchId == nil {
+		return fmt.Errorf("search job has no pattern search")
+	}
+	search, err := first[models.PatternSearch](s.DB.WithContext(ctx), *job.PatternSearchId)
+	if err != nil {
+		return fmt.Errorf("failed to load the pattern search: %v", err)
+	}
+	matcher, err := newPatternMatcher(search.Mode, search.Expression, search.Targets)
+	if err != nil {
+		return err
+	}
+
+	query := s.DB.WithContext(ctx).Model(&models.MyRequest{}).Where("id > ?", job.AfterRequestId)
+	if search.ProgramId != nil {
+		query = query.Where("program_id = ?", *search.ProgramId)
+	}
+	if search.Filter != "" {
+		if query, err = applyFilter(query, search.Filter); err != nil {
+			return err
+		}
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return err
+	}
+	if err := progress.SetTotal(ctx, int(total)); err != nil {
+		return err
+	}
+
+	columns := []string{"id", "url"}
+	for _, field := range patternFields {
+		if matcher.targets[field] && field != "url" {
+			columns = append(columns, strings.ReplaceAll(field, ".", "_"))
+		}
+	}
+	lastId := job.AfterRequestId
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var requests []*models.MyRequest
+		err := query.Session(&gorm.Session{}).Select(columns).Where("id > ?", lastId).
+			Order("id ASC").Limit(importBatchSize).Find(&requests).Error
+		if err != nil {
+			return fmt.Errorf("failed to load requests: %v", err)
+		}
+		if len(requests) == 0 {
+			break
+		}
+
+		var matches []*models.PatternMatch
+		for _, request := range requests {
+			for _, match := range matcher.Match(request) {
+				match.PatternSearchId = search.Id
+				match.ImportJobId = job.Id
+				matches = append(matches, match)
+			}
+		}
+		if len(matches) > 0 {
+			if err := s.DB.WithContext(ctx).CreateInBatches(matches, importBatchSize).Error; err != nil {
+				return fmt.Errorf("failed to save matches: %v", err)
+			}
+			for _, match := range matches {
+				event := NewJobEventFromJob(JobEventMatch, job, "")
+				event.Match = match
+				progress.events.Publish(event)
+			}
+		}
+
+		lastId = requests[len(requests)-1].Id
+		if err := progress.Add(ctx, len(requests)); err != nil {
+			return err
+		}
+	}
+
+	// later runs of new requests start after the last one searched
+	if lastId > search.LastRequestId {
+		if err := s.DB.WithContext(ctx).Model(search).Update("LastRequestId", lastId).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/scope"
+	"gorm.io/gorm"
+)
+
+// programScope picks the program captured traffic belongs to from the domains listed on the programs
+// and the hosts of their in-scope rules. "example.com" matches that host only, "*.example.com" matches its subdomains.
+// Traffic of a program is then checked against its whole scope, its out-of-scope rules included.
+type programScope struct {
+	domains []scopeDomain
+	scopes  map[int]*scope.Scope
+}
+
+type scopeDomain struct {
+	programId int
+	domain    string
+	wildcard  bool
+}
+
+// loadProgramScope reads the domains and scope rules of every program. Programs are picked by their domains
+// and in-scope host rules, CIDR rules and rules on any host are left out.
+func loadProgramScope(ctx context.Context, db *gorm.DB) (*programScope, error) {
+	var programs []*models.Program
+	if err := db.WithContext(ctx).Select("id", "domains").Order("id ASC").Find(&programs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load programs: %v", err)
+	}
+	var rules []*models.ScopeRule
+	if err := db.WithContext(ctx).Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load scope rules: %v", err)
+	}
+	rulesByProgram := make(map[int][]*models.ScopeRule)
+	hosts := make(map[int][]string)
+	for _, rule := range rules {
+		rulesByProgram[rule.ProgramId] = append(rulesByProgram[rule.ProgramId], rule)
+		if rule.Kind == models.ScopeRuleIn && rule.Host != "" && !strings.Contains(rule.Host, "/") {
+			hosts[rule.ProgramId] = append(hosts[rule.ProgramId], rule.Host)
+		}
+	}
+
+	loaded := &programScope{scopes: make(map[int]*scope.Scope, len(programs))}
+	for _, program := range programs {
+		loaded.scopes[program.Id] = newLoadedScope(program, rulesByProgram[program.Id]).scope
+		for _, domain := range append(parseProgramDomains(program.Domains), hosts[program.Id]...) {
+			entry := scopeDomain{programId: program.Id, domain: domain}
+			if strings.HasPrefix(domain, "*.") {
+				entry.domain = domain[2:]
+				entry.wildcard = true
+			}
+			loaded.domains = append(loaded.domains, entry)
+		}
+	}
+	return loaded, nil
+}
+
+// parseProgramDomains accepts a JSON list or domains separated by commas, spaces or new lines
+func parseProgramDomains(domains string) []string {
+	var list []string
+	if err := json.Unmarshal([]byte(domains), &list); err != nil {
+		list = strings.FieldsFunc(domains, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+		})
+	}
+	result := make([]string, 0, len(list))
+	for _, domain := range list {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" {
+			result = append(result, domain)
+		}
+	}
+	return result
+}
+
+// ProgramFor returns the program of a host. Exact domains win over wildcards and longer domains
+// over shorter ones, so a program scoped to api.example.com gets its traffic before *.example.com.
+func (s *programScope) ProgramFor(host string) (int, bool) {
+	host = strings.ToLower(host)
+	var best *scopeDomain
+	for i := range s.domains {
+		d := &s.domains[i]
+		if d.wildcard {
+			if !strings.HasSuffix(host, "."+d.domain) {
+				continue
+			}
+		} else if host != d.domain {
+			continue
+		}
+		if best == nil || (best.wildcard && !d.wildcard) || (best.wildcard == d.wildcard && len(d.domain) > len(best.domain)) {
+			best = d
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	return best.programId, true
+}
+
+// Check tells whether a request URL is in the scope of a program, out-of-scope rules win over the domain
+// that picked the program. It is Unknown for programs without domains or in-scope rules.
+func (s *programScope) Check(programId int, rawURL string) scope.Status {
+	program, ok := s.scopes[programId]
+	if !ok {
+		return scope.Unknown
+	}
+	return program.CheckURL(rawURL)
+}
@@ -11,6 +11,14 @@ type ProgramService struct {
 	DB *gorm.DB
 }
 
+// programSorts are the sort keys of the program list
+var programSorts = Sorts{
+	"name":       "name",
+	"url":        "url",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
 // NewInstance returns a copy of the service with a new transaction
 func (s *ProgramService) NewInstance(ctx context.Context) (*ProgramService, func(), func() error) {
 	tx := s.DB.WithContext(ctx).Begin()
@@ -54,12 +62,23 @@ func (s *ProgramService) Get(ctx context.Context, id int) (*models.Program, erro
 	return &program, nil
 }
 
-// List retrieves all programs
-func (s *ProgramService) List(ctx context.Context) ([]*models.Program, error) {
+// List retrieves programs, the list only carries their tags
+func (s *ProgramService) List(ctx context.Context, page *Page, fields Fields) ([]*models.Program, error) {
+	query, err := page.apply(s.DB.WithContext(ctx).Model(&models.Program{}), programSorts, "")
+	if err != nil {
+		return nil, err
+	}
+	if fields.Has("tags") {
+		query = query.Preload("Taggables.Tag")
+	}
+
 	var programs []*models.Program
-	if err := s.DB.WithContext(ctx).Preload("Endpoints").Preload("Requests").Preload("Notes").Preload("Taggables.Tag").Find(&programs).Error; err != nil {
+	if err := query.Find(&programs).Error; err != nil {
 		return nil, err
 	}
+	if len(programs) > 0 {
+		page.next(len(programs), programs[len(programs)-1])
+	}
 	return programs, nil
 }
 
@@ -74,6 +93,7 @@ func (s *ProgramService) Update(ctx context.Context, id int, input *models.Progr
 	if err != nil {
 		return 0, err
 	}
+	domainsChanged := input.Domains != program.Domains
 	updates := map[string]any{ // from ProgramInput
 		"Name":    input.Name,
 		"URL":     input.URL,
@@ -84,6 +104,12 @@ func (s *ProgramService) Update(ctx context.Context, id int, input *models.Progr
 	if err := s.DB.WithContext(ctx).Model(&program).Updates(updates).Error; err != nil {
 		return 0, err
 	}
+	// the domains are in-scope rules
+	if domainsChanged {
+		if err := recomputeScope(ctx, s.DB, program.Id); err != nil {
+			return 0, err
+		}
+	}
 	return program.Id, nil
 }
 
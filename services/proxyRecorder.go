@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/proxy"
+	"github.com/linn221/RequesterBackend/rawhttp"
+	"github.com/linn221/RequesterBackend/scope"
+	"gorm.io/gorm"
+)
+
+// proxyQueueSize is how many exchanges can wait to be saved before new ones are dropped
+const proxyQueueSize = 1000
+
+// ProxyRecorder saves the traffic of the recording proxy. Exchanges go to ProgramId when it is set,
+// otherwise to the program whose domains match their host. Traffic out of every program's scope, or out
+// of the whole scope of the program it goes to, is not recorded, the latter is counted on the session's
+// job. Requests are appended to the rolling proxy job of the session in each program and
+// grouped into endpoints the same way as imported ones.
+type ProxyRecorder struct {
+	DB        *gorm.DB
+	Session   string
+	ProgramId *int
+
+	exchanges chan *proxy.Exchange
+}
+
+func NewProxyRecorder(db *gorm.DB, session string, programId *int) *ProxyRecorder {
+	if session == "" {
+		session = "default"
+	}
+	return &ProxyRecorder{
+		DB:        db,
+		Session:   session,
+		ProgramId: programId,
+		exchanges: make(chan *proxy.Exchange, proxyQueueSize),
+	}
+}
+
+// Record queues an exchange to be saved by Run, it never blocks the proxied connection
+func (r *ProxyRecorder) Record(exchange *proxy.Exchange) {
+	select {
+	case r.exchanges <- exchange:
+	default:
+		log.Printf("Proxy recorder is behind, dropped %s %s", exchange.Request.Method, exchange.Request.URL)
+	}
+}
+
+// Run saves the queued exchanges in batches, at least once a second, until ctx is cancelled.
+// What is still queued at that point is saved before it returns.
+func (r *ProxyRecorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var pending []*proxy.Exchange
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		// saving is not cut short by ctx, the batch would be lost
+		if err := r.save(context.Background(), pending); err != nil {
+			log.Printf("Failed to save %d proxied requests: %v", len(pending), err)
+		}
+		pending = nil
+	}
+
+	for {
+		select {
+		case exchange := <-r.exchanges:
+			pending = append(pending, exchange)
+			if len(pending) >= importBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case exchange := <-r.exchanges:
+					pending = append(pending, exchange)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// save stores a batch of exchanges, the scope is read again every time so program changes apply right away
+func (r *ProxyRecorder) save(ctx context.Context, exchanges []*proxy.Exchange) error {
+	scopes, err := loadProgramScope(ctx, r.DB)
+	if err != nil {
+		return err
+	}
+
+	requestsByProgram := make(map[int][]*models.MyRequest)
+	outOfScope := make(map[int]int)
+	var programIds []int
+	for _, exchange := range exchanges {
+		req, warnings, err := proxyRequest(exchange)
+		if err != nil {
+			log.Printf("Proxy: not recording %s %s: %v", exchange.Request.Method, exchange.Request.URL, err)
+			continue
+		}
+		for _, warning := range warnings {
+			log.Printf("Proxy: %s: %s", req.URL, warning)
+		}
+
+		id := 0
+		if r.ProgramId != nil {
+			id = *r.ProgramId
+		} else if scoped, ok := scopes.ProgramFor(req.Domain); ok {
+			id = scoped
+		} else {
+			continue
+		}
+		if _, exists := requestsByProgram[id]; !exists {
+			programIds = append(programIds, id)
+			requestsByProgram[id] = nil
+		}
+		if scopes.Check(id, req.URL) == scope.Out {
+			outOfScope[id]++
+			continue
+		}
+		req.ProgramId = &id
+		requestsByProgram[id] = append(requestsByProgram[id], req)
+	}
+	if len(programIds) == 0 {
+		return nil
+	}
+
+	tx := r.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	// session jobs are locked in program order like on ingest batches
+	sort.Ints(programIds)
+	for _, programId := range programIds {
+		requests := requestsByProgram[programId]
+		job, err := sessionJob(ctx, tx, models.JobTypeProxy, programId, r.Session)
+		if err != nil {
+			return err
+		}
+		if len(requests) > 0 {
+			if err := r.create(ctx, tx, job, programId, requests); err != nil {
+				return err
+			}
+		}
+		if err := addSessionJobItems(ctx, tx, job, len(requests), outOfScope[programId]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// create saves the requests of a program under the session's job
+func (r *ProxyRecorder) create(ctx context.Context, tx *gorm.DB, job *models.ImportJob, programId int, requests []*models.MyRequest) error {
+	sequence, err := nextSequence(ctx, tx, job.Id)
+	if err != nil {
+		return err
+	}
+	for i, req := range requests {
+		req.ImportJobId = job.Id
+		req.Sequence = sequence + i
+	}
+
+	endpoints, err := newEndpointResolver(ctx, tx, programId, fmt.Sprintf("Auto-generated from proxy session: %s", r.Session))
+	if err != nil {
+		return err
+	}
+	if err := endpoints.Assign(ctx, requests); err != nil {
+		return err
+	}
+	if err := tx.Create(requests).Error; err != nil {
+		return fmt.Errorf("failed to create requests: %v", err)
+	}
+	return nil
+}
+
+// proxyRequest converts an exchange into a request, the response body is stored decoded like on imports.
+// Failed exchanges are kept with status 0 and the error as comment.
+func proxyRequest(exchange *proxy.Exchange) (*models.MyRequest, []string, error) {
+	r := exchange.Request
+	if r.URL.Hostname() == "" {
+		return nil, nil, fmt.Errorf("no host in URL")
+	}
+	if len(r.Method) > 10 {
+		return nil, nil, fmt.Errorf("invalid method '%s'", r.Method)
+	}
+
+	request := &models.MyRequest{
+		URL:         r.URL.String(),
+		Method:      r.Method,
+		Domain:      r.URL.Hostname(),
+		ReqBody:     string(exchange.RequestBody),
+		ReqMimeType: r.Header.Get("Content-Type"),
+		HTTPVersion: r.Proto,
+		LatencyMs:   exchange.Latency.Milliseconds(),
+		RequestTime: exchange.Started.Format(time.RFC3339),
+	}
+	if _, err := endpointPath(request.URL); err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	var resHeaders []models.Header
+	var resBody []byte
+	if exchange.Err != nil {
+		request.Comment = fmt.Sprintf("Proxy error: %v", exchange.Err)
+	} else {
+		resp := exchange.Response
+		resHeaders = proxyHeaders("", resp.Header)
+		request.ResStatus = resp.StatusCode
+		request.ResHTTPVersion = resp.Proto
+		request.ResMimeType = resp.Header.Get("Content-Type")
+		request.RedirectURL = resp.Header.Get("Location")
+		if resp.ContentLength > 0 {
+			request.ResDeclaredSize = int(resp.ContentLength)
+		}
+
+		var err error
+		resBody, err = rawhttp.DecodeContent(exchange.ResponseBody, resHeaders)
+		if err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+	if exchange.Truncated {
+		if request.Comment != "" {
+			request.Comment += ", body truncated"
+		} else {
+			request.Comment = "Body truncated by the proxy"
+		}
+	}
+	request.RespSize = len(resBody)
+	request.SetResBody(resBody, rawhttp.IsBinary(resBody))
+
+	reqHeaders := proxyHeaders(r.Host, r.Header)
+	reqHeadersJSON, err := models.HeaderSlice(reqHeaders).ToJSON()
+	if err != nil {
+		return nil, nil, err
+	}
+	resHeadersJSON, err := models.HeaderSlice(resHeaders).ToJSON()
+	if err != nil {
+		return nil, nil, err
+	}
+	request.ReqHeaders = reqHeadersJSON
+	request.ResHeaders = resHeadersJSON
+
+	setRequestHashes(request, reqHeaders, resHeaders, resBody)
+
+	return request, warnings, nil
+}
+
+// proxyHeaders flattens Go's header map sorted by name, host is added first as the Host header when set
+func proxyHeaders(host string, header http.Header) []models.Header {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := make([]models.Header, 0, len(header)+1)
+	if host != "" {
+		headers = append(headers, models.Header{Name: "Host", Value: host})
+	}
+	for _, name := range names {
+		for _, value := range header[name] {
+			headers = append(headers, models.Header{Name: name, Value: value})
+		}
+	}
+	return headers
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/proxy"
+)
+
+func TestProxyRequestComment(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		truncated bool
+		want      string
+	}{
+		{name: "recorded", want: ""},
+		{name: "truncated", truncated: true, want: "Body truncated by the proxy"},
+		{name: "failed", err: errors.New("connection refused"), want: "Proxy error: connection refused"},
+		{name: "failed and truncated", err: errors.New("connection reset"), truncated: true, want: "Proxy error: connection reset, body truncated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, _ := url.Parse("https://example.com/upload")
+			exchange := &proxy.Exchange{
+				Request:     &http.Request{Method: "POST", URL: target, Host: "example.com", Proto: "HTTP/1.1", Header: http.Header{}},
+				RequestBody: []byte("data"),
+				Truncated:   tt.truncated,
+				Started:     time.Now(),
+				Err:         tt.err,
+			}
+			if tt.err == nil {
+				exchange.Response = &http.Response{StatusCode: 200, Proto: "HTTP/1.1", Header: http.Header{}}
+			}
+
+			req, _, err := proxyRequest(exchange)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.Comment != tt.want {
+				t.Errorf("got comment %q, want %q", req.Comment, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyRecorderScope(t *testing.T) {
+	db, programId := newTestDB(t)
+	// example.com is the program's domain
+	rule := &models.ScopeRule{ProgramId: programId, Kind: models.ScopeRuleOut, PathPrefix: "/logout"}
+	if err := db.Create(rule).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var exchanges []*proxy.Exchange
+	for _, rawURL := range []string{"https://example.com/", "https://example.com/logout", "https://example.com/logout/all", "https://unknown.test/"} {
+		target, _ := url.Parse(rawURL)
+		exchanges = append(exchanges, &proxy.Exchange{
+			Request:  &http.Request{Method: "GET", URL: target, Host: target.Host, Proto: "HTTP/1.1", Header: http.Header{}},
+			Response: &http.Response{StatusCode: 200, Proto: "HTTP/1.1", Header: http.Header{}},
+			Started:  time.Now(),
+		})
+	}
+	recorder := NewProxyRecorder(db, "scope", nil)
+	if err := recorder.save(context.Background(), exchanges); err != nil {
+		t.Fatal(err)
+	}
+
+	var urls []string
+	if err := db.Model(&models.MyRequest{}).Order("id ASC").Pluck("url", &urls).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://example.com/"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("got requests %v, want %v", urls, want)
+	}
+	var jobs []*models.ImportJob
+	if err := db.Where("job_type = ?", models.JobTypeProxy).Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].TotalItems != 1 || jobs[0].OutOfScopeItems != 2 {
+		t.Errorf("got jobs %+v, want 1 request and 2 out of scope", jobs)
+	}
+
+	// a batch of out-of-scope traffic only is counted too
+	if err := recorder.save(context.Background(), exchanges[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := first[models.ImportJob](db, jobs[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.TotalItems != 1 || stored.OutOfScopeItems != 3 {
+		t.Errorf("got %d requests and %d out of scope, want 1 and 3", stored.TotalItems, stored.OutOfScopeItems)
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/linn221/RequesterBackend/scope"
+	"github.com/linn221/RequesterBackend/utils"
+)
+
+// RequestQuery holds the filters and search of a request list, as given by the query parameters of GET /requests
+type RequestQuery struct {
+	ProgramId  *int
+	EndpointId *int
+	JobId      *int
+	ReplayOfId *int // replays of a request
+
+	Search            string // full-text search
+	Filter            string // filter query, like status:>=400 method:POST
+	RawSQL            string // passed to the database as it is, callers decide whether it is allowed
+	Domain            string
+	IncludeSubdomains bool
+	URLContains       string
+	URLMatch          string
+	ResourceType      string
+	Scope             string
+	IsTemplate        *bool
+}
+
+// RequestQueryParams are the query parameters ParseRequestQuery reads
+var RequestQueryParams = []string{
+	"program_id", "endpoint_id", "job_id", "replay_of_id", "search", "filter", "raw_sql", "domain", "includeSubdomains",
+	"url_contains", "url_match", "resource_type", "scope", "is_template",
+}
+
+// ParseRequestQuery reads the list parameters of requests, pagination and sort parameters are left to the caller
+func ParseRequestQuery(values url.Values) (*RequestQuery, error) {
+	q := &RequestQuery{
+		Search:            values.Get("search"),
+		Filter:            values.Get("filter"),
+		RawSQL:            values.Get("raw_sql"),
+		Domain:            values.Get("domain"),
+		IncludeSubdomains: values.Get("includeSubdomains") == "1",
+		URLContains:       values.Get("url_contains"),
+		URLMatch:          values.Get("url_match"),
+		ResourceType:      values.Get("resource_type"),
+		Scope:             values.Get("scope"),
+	}
+
+	ids := []struct {
+		name string
+		dest **int
+	}{{"program_id", &q.ProgramId}, {"endpoint_id", &q.EndpointId}, {"job_id", &q.JobId}, {"replay_of_id", &q.ReplayOfId}}
+	for _, id := range ids {
+		if value := values.Get(id.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, utils.BadRequest("invalid " + id.name)
+			}
+			*id.dest = &n
+		}
+	}
+
+	if q.Scope != "" && !scope.Status(q.Scope).Valid() {
+		return nil, utils.BadRequest("invalid scope, expected in, out or unknown")
+	}
+	if isTemplateStr := values.Get("is_template"); isTemplateStr != "" {
+		v, err := strconv.ParseBool(isTemplateStr)
+		if err != nil {
+			return nil, utils.BadRequest("invalid is_template")
+		}
+		q.IsTemplate = &v
+	}
+	return q, nil
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/proxy"
+	"github.com/linn221/RequesterBackend/rawhttp"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultReplayTimeout = 30 * time.Second
+	maxReplayRedirects   = 10
+)
+
+// replaySkippedHeaders are computed by the HTTP client when the request is sent, HTTP/2 pseudo-headers
+// (:authority, :path...) are skipped as well
+var replaySkippedHeaders = map[string]bool{
+	"host":              true, // the host of the URL unless it is set in the edits
+	"content-length":    true,
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// ReplayOptions edits a stored request before it is sent again, empty fields keep the original
+type ReplayOptions struct {
+	Method        string
+	URL           string
+	SetHeaders    []models.Header // replace the original headers of the same name, the others are added
+	RemoveHeaders []string
+	Body          *string
+
+	Timeout            time.Duration // DefaultReplayTimeout when zero, redirects included
+	FollowRedirects    bool          // at most maxReplayRedirects
+	InsecureSkipVerify bool          // TLS certificates aren't verified
+}
+
+// Replay sends a stored request again with the edits of opts and saves the exchange as a new request
+// of the same program, linked to the original and filed under the program's replay job. Requests that
+// fail to get a response are saved too, with status 0 and the error as comment. It returns the new id.
+func (s *RequestService) Replay(ctx context.Context, id int, opts *ReplayOptions) (int, error) {
+	original, err := first[models.MyRequest](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+	if original.ProgramId == nil {
+		return 0, utils.BadRequest("the request belongs to no program")
+	}
+	programId := *original.ProgramId
+
+	outgoing, sentHeaders, err := replayRequest(ctx, original, opts)
+	if err != nil {
+		return 0, err
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultReplayTimeout
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	outgoing = outgoing.WithContext(sendCtx)
+
+	request := &models.MyRequest{
+		URL:         outgoing.URL.String(),
+		Method:      outgoing.Method,
+		Domain:      outgoing.URL.Hostname(),
+		ReqBody:     opts.body(original),
+		ReqMimeType: outgoing.Header.Get("Content-Type"),
+		RequestTime: time.Now().Format(time.RFC3339),
+		Comment:     fmt.Sprintf("Replay of request %d", original.Id),
+		ProgramId:   &programId,
+		ReplayOfId:  &original.Id,
+	}
+	if _, err := endpointPath(request.URL); err != nil {
+		return 0, utils.BadRequest(fmt.Sprintf("invalid url '%s': %v", request.URL, err))
+	}
+
+	start := time.Now()
+	resp, err := replayClient(opts).Do(outgoing)
+	var resHeaders []models.Header
+	var resBody []byte
+	if err != nil {
+		request.LatencyMs = time.Since(start).Milliseconds()
+		request.Comment += fmt.Sprintf(", error: %v", err)
+	} else {
+		defer resp.Body.Close()
+		raw, err := io.ReadAll(io.LimitReader(resp.Body, proxy.DefaultMaxBodySize+1))
+		request.LatencyMs = time.Since(start).Milliseconds()
+		if err != nil {
+			request.Comment += fmt.Sprintf(", failed to read the response: %v", err)
+		}
+		if len(raw) > proxy.DefaultMaxBodySize {
+			raw = raw[:proxy.DefaultMaxBodySize]
+			request.Comment += ", body truncated"
+		}
+
+		resHeaders = proxyHeaders("", resp.Header)
+		request.HTTPVersion = resp.Proto
+		request.ResStatus = resp.StatusCode
+		request.ResHTTPVersion = resp.Proto
+		request.ResMimeType = resp.Header.Get("Content-Type")
+		request.RedirectURL = resp.Header.Get("Location")
+		if final := resp.Request.URL.String(); final != request.URL {
+			request.RedirectURL = final // where the redirects ended
+		}
+		if resp.ContentLength > 0 {
+			request.ResDeclaredSize = int(resp.ContentLength)
+		}
+		resBody, err = rawhttp.DecodeContent(raw, resHeaders)
+		if err != nil {
+			log.Printf("Replay of request %d: %v", original.Id, err)
+		}
+	}
+	request.RespSize = len(resBody)
+	request.SetResBody(resBody, rawhttp.IsBinary(resBody))
+
+	reqHeadersJSON, err := models.HeaderSlice(sentHeaders).ToJSON()
+	if err != nil {
+		return 0, err
+	}
+	resHeadersJSON, err := models.HeaderSlice(resHeaders).ToJSON()
+	if err != nil {
+		return 0, err
+	}
+	request.ReqHeaders = reqHeadersJSON
+	request.ResHeaders = resHeadersJSON
+
+	setRequestHashes(request, sentHeaders, resHeaders, resBody)
+
+	// the request was sent, saving it is not cut short by the caller going away
+	ctx = context.WithoutCancel(ctx)
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	job, err := programJob(ctx, tx, models.JobTypeReplay, programId)
+	if err != nil {
+		return 0, err
+	}
+	sequence, err := nextSequence(ctx, tx, job.Id)
+	if err != nil {
+		return 0, err
+	}
+	request.ImportJobId = job.Id
+	request.Sequence = sequence
+
+	endpoints, err := newEndpointResolver(ctx, tx, programId, "Auto-generated from replayed request")
+	if err != nil {
+		return 0, err
+	}
+	if err := endpoints.Assign(ctx, []*models.MyRequest{request}); err != nil {
+		return 0, err
+	}
+	if err := tx.Create(request).Error; err != nil {
+		return 0, fmt.Errorf("failed to create request: %v", err)
+	}
+	now := time.Now()
+	err = tx.Model(job).Updates(map[string]any{
+		"TotalItems":     gorm.Expr("total_items + 1"),
+		"ProcessedItems": gorm.Expr("processed_items + 1"),
+		"FinishedAt":     &now,
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return request.Id, tx.Commit().Error
+}
+
+func (opts *ReplayOptions) body(original *models.MyRequest) string {
+	if opts.Body != nil {
+		return *opts.Body
+	}
+	return original.ReqBody
+}
+
+// replayRequest builds the HTTP request sending original with the edits of opts. It also returns the
+// headers as they are sent, Host first, to be stored.
+func replayRequest(ctx context.Context, original *models.MyRequest, opts *ReplayOptions) (*http.Request, []models.Header, error) {
+	method := original.Method
+	if opts.Method != "" {
+		method = strings.ToUpper(opts.Method)
+	}
+	if len(method) > 10 {
+		return nil, nil, utils.BadRequest(fmt.Sprintf("invalid method '%s'", method))
+	}
+	rawURL := original.URL
+	if opts.URL != "" {
+		rawURL = opts.URL
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return nil, nil, utils.BadRequest(fmt.Sprintf("invalid url '%s', expected an absolute http or https URL", rawURL))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), strings.NewReader(opts.body(original)))
+	if err != nil {
+		return nil, nil, utils.BadRequest(fmt.Sprintf("invalid request: %v", err))
+	}
+
+	var headers []models.Header
+	if original.ReqHeaders != "" {
+		if headers, err = models.HeaderSliceFromJSON(original.ReqHeaders); err != nil {
+			return nil, nil, fmt.Errorf("invalid stored request headers: %v", err)
+		}
+	}
+	dropped := make(map[string]bool)
+	for _, name := range opts.RemoveHeaders {
+		dropped[strings.ToLower(name)] = true
+	}
+	for _, header := range opts.SetHeaders {
+		dropped[strings.ToLower(header.Name)] = true
+	}
+	var sent []models.Header
+	for _, header := range headers {
+		name := strings.ToLower(header.Name)
+		if !dropped[name] && !replaySkippedHeaders[name] && !strings.HasPrefix(name, ":") {
+			sent = append(sent, header)
+		}
+	}
+	for _, header := range opts.SetHeaders {
+		name := strings.ToLower(header.Name)
+		if name == "host" {
+			req.Host = header.Value
+		} else if !replaySkippedHeaders[name] && !strings.HasPrefix(name, ":") {
+			sent = append(sent, header)
+		}
+	}
+	for _, header := range sent {
+		req.Header.Add(header.Name, header.Value)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	return req, append([]models.Header{{Name: "Host", Value: host}}, sent...), nil
+}
+
+// replayClient sends replays without touching their encoding, following redirects only when asked
+func replayClient(opts *ReplayOptions) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableCompression = true // the Accept-Encoding of the request is kept and the body decoded when saved
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !opts.FollowRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= maxReplayRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxReplayRedirects)
+			}
+			return nil
+		},
+	}
+}
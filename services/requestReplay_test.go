@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+)
+
+func TestReplayRequestHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored []models.Header
+		opts   ReplayOptions
+		want   []models.Header // as stored, Host first
+	}{
+		{
+			name:   "original headers",
+			stored: []models.Header{{Name: "Accept", Value: "*/*"}, {Name: "Cookie", Value: "a=1"}, {Name: "Cookie", Value: "b=2"}},
+			want:   []models.Header{{Name: "Host", Value: "example.com"}, {Name: "Accept", Value: "*/*"}, {Name: "Cookie", Value: "a=1"}, {Name: "Cookie", Value: "b=2"}},
+		},
+		{
+			name: "hop-by-hop and computed headers",
+			stored: []models.Header{
+				{Name: "Connection", Value: "keep-alive"}, {Name: "Keep-Alive", Value: "timeout=5"},
+				{Name: "Proxy-Connection", Value: "keep-alive"}, {Name: "Transfer-Encoding", Value: "chunked"},
+				{Name: "Upgrade", Value: "h2c"}, {Name: "Content-Length", Value: "99"}, {Name: "Accept", Value: "*/*"},
+			},
+			want: []models.Header{{Name: "Host", Value: "example.com"}, {Name: "Accept", Value: "*/*"}},
+		},
+		{
+			name:   "pseudo-headers",
+			stored: []models.Header{{Name: ":authority", Value: "example.com"}, {Name: ":path", Value: "/a"}, {Name: "accept", Value: "*/*"}},
+			opts:   ReplayOptions{SetHeaders: []models.Header{{Name: ":method", Value: "PUT"}}},
+			want:   []models.Header{{Name: "Host", Value: "example.com"}, {Name: "accept", Value: "*/*"}},
+		},
+		{
+			name:   "stored Host",
+			stored: []models.Header{{Name: "Host", Value: "old.example.com"}, {Name: "Accept", Value: "*/*"}},
+			want:   []models.Header{{Name: "Host", Value: "example.com"}, {Name: "Accept", Value: "*/*"}},
+		},
+		{
+			name:   "Host override",
+			stored: []models.Header{{Name: "Host", Value: "old.example.com"}},
+			opts:   ReplayOptions{SetHeaders: []models.Header{{Name: "host", Value: "vhost.example.com"}}},
+			want:   []models.Header{{Name: "Host", Value: "vhost.example.com"}},
+		},
+		{
+			name:   "set replaces every header of the name",
+			stored: []models.Header{{Name: "Cookie", Value: "a=1"}, {Name: "Accept", Value: "*/*"}, {Name: "cookie", Value: "b=2"}},
+			opts:   ReplayOptions{SetHeaders: []models.Header{{Name: "COOKIE", Value: "c=3"}, {Name: "X-New", Value: "1"}}},
+			want:   []models.Header{{Name: "Host", Value: "example.com"}, {Name: "Accept", Value: "*/*"}, {Name: "COOKIE", Value: "c=3"}, {Name: "X-New", Value: "1"}},
+		},
+		{
+			name:   "remove",
+			stored: []models.Header{{Name: "Authorization", Value: "Bearer x"}, {Name: "Accept", Value: "*/*"}},
+			opts:   ReplayOptions{RemoveHeaders: []string{"authorization", "X-Missing"}},
+			want:   []models.Header{{Name: "Host", Value: "example.com"}, {Name: "Accept", Value: "*/*"}},
+		},
+		{
+			name:   "set wins over remove",
+			stored: []models.Header{{Name: "Authorization", Value: "Bearer x"}},
+			opts:   ReplayOptions{RemoveHeaders: []string{"Authorization"}, SetHeaders: []models.Header{{Name: "Authorization", Value: "Bearer y"}}},
+			want:   []models.Header{{Name: "Host", Value: "example.com"}, {Name: "Authorization", Value: "Bearer y"}},
+		},
+		{
+			name: "set hop-by-hop is ignored",
+			opts: ReplayOptions{SetHeaders: []models.Header{{Name: "Transfer-Encoding", Value: "chunked"}, {Name: "Content-Length", Value: "1"}}},
+			want: []models.Header{{Name: "Host", Value: "example.com"}},
+		},
+		{
+			name: "URL with a port",
+			opts: ReplayOptions{URL: "http://example.com:8080/b"},
+			want: []models.Header{{Name: "Host", Value: "example.com:8080"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := models.HeaderSlice(tt.stored).ToJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			original := &models.MyRequest{Method: "GET", URL: "https://example.com/a", ReqHeaders: stored}
+			req, sent, err := replayRequest(context.Background(), original, &tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(sent) != fmt.Sprint(tt.want) {
+				t.Errorf("got headers %v, want %v", sent, tt.want)
+			}
+			if req.Host != tt.want[0].Value {
+				t.Errorf("got Host %q, want %q", req.Host, tt.want[0].Value)
+			}
+			// what is stored is what is sent
+			for _, header := range sent[1:] {
+				if !containsValue(req.Header.Values(header.Name), header.Value) {
+					t.Errorf("%s: %s is not sent, got %v", header.Name, header.Value, req.Header)
+				}
+			}
+			if len(req.Header) > len(sent)-1 {
+				t.Errorf("got %d header names sent for %d stored headers: %v", len(req.Header), len(sent)-1, req.Header)
+			}
+		})
+	}
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReplayRequestInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ReplayOptions
+	}{
+		{name: "relative URL", opts: ReplayOptions{URL: "/a"}},
+		{name: "other scheme", opts: ReplayOptions{URL: "ftp://example.com/a"}},
+		{name: "no host", opts: ReplayOptions{URL: "https:///a"}},
+		{name: "long method", opts: ReplayOptions{Method: "PROPPATCHED"}},
+		{name: "invalid method", opts: ReplayOptions{Method: "GE T"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := &models.MyRequest{Method: "GET", URL: "https://example.com/a"}
+			if _, _, err := replayRequest(context.Background(), original, &tt.opts); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+// replayTarget stores a request of the test program to be replayed against url
+func replayTarget(t *testing.T, url string) (*RequestService, *models.MyRequest) {
+	t.Helper()
+	db, programId := newTestDB(t)
+	headers, _ := models.HeaderSlice{{Name: "Accept", Value: "*/*"}, {Name: "X-Removed", Value: "1"}}.ToJSON()
+	original := &models.MyRequest{ProgramId: &programId, Method: "GET", URL: url, Domain: "127.0.0.1", ReqHeaders: headers}
+	if err := db.Create(original).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &RequestService{DB: db}, original
+}
+
+func replayed(t *testing.T, service *RequestService, original *models.MyRequest, opts *ReplayOptions) *models.MyRequest {
+	t.Helper()
+	id, err := service.Replay(context.Background(), original.Id, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := first[models.MyRequest](service.DB, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ReplayOfId == nil || *req.ReplayOfId != original.Id || req.ImportJobId == 0 || req.EndpointId == 0 {
+		t.Errorf("got replay of %v in job %d with endpoint %d", req.ReplayOfId, req.ImportJobId, req.EndpointId)
+	}
+	return req
+}
+
+func TestReplay(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/slow":
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "%s %s accept=%s removed=%s set=%s", r.Method, r.URL.Path, r.Header.Get("Accept"), r.Header.Get("X-Removed"), r.Header.Get("X-Set"))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		opts         ReplayOptions
+		wantStatus   int
+		wantBody     string
+		wantRedirect string
+		wantComment  string
+		wantHits     int32
+	}{
+		{
+			name:       "edits",
+			path:       "/a",
+			opts:       ReplayOptions{Method: "post", SetHeaders: []models.Header{{Name: "X-Set", Value: "yes"}}, RemoveHeaders: []string{"x-removed"}},
+			wantStatus: http.StatusOK,
+			wantBody:   "POST /a accept=*/* removed= set=yes",
+			wantHits:   1,
+		},
+		{
+			name:         "redirects off",
+			path:         "/redirect",
+			wantStatus:   http.StatusFound,
+			wantRedirect: "/final",
+			wantHits:     1,
+		},
+		{
+			name:         "redirects on",
+			path:         "/redirect",
+			opts:         ReplayOptions{FollowRedirects: true},
+			wantStatus:   http.StatusOK,
+			wantBody:     "GET /final accept=*/* removed=1 set=",
+			wantRedirect: server.URL + "/final",
+			wantHits:     2,
+		},
+		{
+			name:        "too many redirects",
+			path:        "/loop",
+			opts:        ReplayOptions{FollowRedirects: true},
+			wantComment: fmt.Sprintf("stopped after %d redirects", maxReplayRedirects),
+			wantHits:    maxReplayRedirects,
+		},
+		{
+			name:        "timeout",
+			path:        "/slow",
+			opts:        ReplayOptions{Timeout: 50 * time.Millisecond},
+			wantComment: "context deadline exceeded",
+			wantHits:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			service, original := replayTarget(t, server.URL+tt.path)
+			req := replayed(t, service, original, &tt.opts)
+			if req.ResStatus != tt.wantStatus {
+				t.Errorf("got status %d, want %d", req.ResStatus, tt.wantStatus)
+			}
+			if body := string(req.ResBodyBytes()); body != tt.wantBody && tt.wantBody != "" {
+				t.Errorf("got body %q, want %q", body, tt.wantBody)
+			}
+			if req.RedirectURL != tt.wantRedirect {
+				t.Errorf("got redirect %q, want %q", req.RedirectURL, tt.wantRedirect)
+			}
+			wantComment := fmt.Sprintf("Replay of request %d", original.Id)
+			if tt.wantComment != "" {
+				if !strings.HasPrefix(req.Comment, wantComment+", error: ") || !strings.Contains(req.Comment, tt.wantComment) {
+					t.Errorf("got comment %q, want the error %q", req.Comment, tt.wantComment)
+				}
+			} else if req.Comment != wantComment {
+				t.Errorf("got comment %q, want %q", req.Comment, wantComment)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("the server got %d requests, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestReplayTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secure")
+	}))
+	defer server.Close()
+	service, original := replayTarget(t, server.URL+"/")
+
+	// the test server's certificate is signed by no trusted CA
+	req := replayed(t, service, original, &ReplayOptions{})
+	if req.ResStatus != 0 || !strings.Contains(req.Comment, "certificate") {
+		t.Errorf("got status %d and comment %q, want a certificate error", req.ResStatus, req.Comment)
+	}
+	req = replayed(t, service, original, &ReplayOptions{InsecureSkipVerify: true})
+	if req.ResStatus != http.StatusOK || string(req.ResBodyBytes()) != "secure" {
+		t.Errorf("got %d %q, want 200 secure", req.ResStatus, req.ResBodyBytes())
+	}
+}
+
+func TestReplayFailedSend(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	service, original := replayTarget(t, server.URL+"/gone")
+
+	req := replayed(t, service, original, &ReplayOptions{})
+	if req.ResStatus != 0 || req.RespSize != 0 {
+		t.Errorf("got status %d and size %d, want no response", req.ResStatus, req.RespSize)
+	}
+	if !strings.HasPrefix(req.Comment, fmt.Sprintf("Replay of request %d, error: ", original.Id)) || !strings.Contains(req.Comment, "connection refused") {
+		t.Errorf("got comment %q, want the connection error", req.Comment)
+	}
+	if req.Sequence != 1 || req.URL != original.URL {
+		t.Errorf("got sequence %d and URL %s", req.Sequence, req.URL)
+	}
+}
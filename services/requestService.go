@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 
+	"github.com/linn221/RequesterBackend/filterql"
 	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/search"
+	"github.com/linn221/RequesterBackend/utils"
 	"gorm.io/gorm"
 )
 
@@ -14,123 +16,109 @@ type RequestService struct {
 	DB *gorm.DB
 }
 
-// buildOrderClauses builds ORDER BY clauses from multiple ordering parameters
-func (s *RequestService) buildOrderClauses(orderBy1 string, asc1 bool, orderBy2 string, asc2 bool, orderBy3 string, asc3 bool, orderBy4 string, asc4 bool) string {
-	var clauses []string
-
-	// Helper function to map order_by parameter to database column
-	mapToColumn := func(orderBy string) string {
-		switch orderBy {
-		case "method":
-			return "method"
-		case "content_type":
-			// content_type is extracted from response headers, we'll need to handle this differently
-			// For now, skip ordering by content_type as it requires a more complex query
-			return ""
-		case "size":
-			return "resp_size"
-		case "latency":
-			return "latency_ms"
-		case "url":
-			return "url"
-		case "sequence_number":
-			return "sequence"
-		default:
-			// Invalid order_by parameter, skip ordering
-			return ""
-		}
-	}
+// requestSorts are the sort keys of request lists
+var requestSorts = Sorts{
+	"program_id":      "program_id",
+	"endpoint_id":     "endpoint_id",
+	"job_id":          "import_job_id",
+	"sequence_number": "sequence",
+	"url":             "url",
+	"method":          "method",
+	"domain":          "domain",
+	"status":          "res_status",
+	"content_type":    "res_content_type",
+	"size":            "resp_size",
+	"latency":         "latency_ms",
+	"ssl_time":        "timing_ssl",
+	"wait_time":       "timing_wait",
+	"resource_type":   "resource_type",
+	"scope":           "scope",
+	"created_at":      "created_at",
+}
 
-	// Helper function to build a single order clause
-	buildClause := func(orderBy string, asc bool) string {
-		column := mapToColumn(orderBy)
-		if column == "" {
-			return ""
-		}
-		direction := "ASC"
-		if !asc {
-			direction = "DESC"
-		}
-		return fmt.Sprintf("%s %s", column, direction)
+// List retrieves requests with filtering and full-text search, sorted by the page
+func (s *RequestService) List(ctx context.Context, q *RequestQuery, page *Page, fields Fields) ([]*models.MyRequest, error) {
+	query, err := s.filter(ctx, q)
+	if err != nil {
+		return nil, err
 	}
+	return findRequestList(query, page, fields)
+}
 
-	// Build clauses for each level (orderBy1 has highest priority)
-	if orderBy1 != "" {
-		if clause := buildClause(orderBy1, asc1); clause != "" {
-			clauses = append(clauses, clause)
-		}
+// filter builds the query on requests matching the filters and the search of q
+func (s *RequestService) filter(ctx context.Context, q *RequestQuery) (*gorm.DB, error) {
+	query := s.DB.WithContext(ctx).Model(&models.MyRequest{})
+	// Apply filters
+	if q.ProgramId != nil {
+		query = query.Where("program_id = ?", *q.ProgramId)
 	}
-	if orderBy2 != "" {
-		if clause := buildClause(orderBy2, asc2); clause != "" {
-			clauses = append(clauses, clause)
-		}
+	if q.EndpointId != nil {
+		query = query.Where("endpoint_id = ?", *q.EndpointId)
 	}
-	if orderBy3 != "" {
-		if clause := buildClause(orderBy3, asc3); clause != "" {
-			clauses = append(clauses, clause)
-		}
+	if q.JobId != nil {
+		query = query.Where("import_job_id = ?", *q.JobId)
 	}
-	if orderBy4 != "" {
-		if clause := buildClause(orderBy4, asc4); clause != "" {
-			clauses = append(clauses, clause)
-		}
+	if q.ReplayOfId != nil {
+		query = query.Where("replay_of_id = ?", *q.ReplayOfId)
 	}
 
-	// Join all clauses with commas
-	return strings.Join(clauses, ", ")
-}
-
-// List retrieves requests with filtering and search
-func (s *RequestService) List(ctx context.Context, programId, endpointId, jobId *int, rawSQL, domain, urlContains, urlMatch string, includeSubdomains bool, orderBy1 string, asc1 bool, orderBy2 string, asc2 bool, orderBy3 string, asc3 bool, orderBy4 string, asc4 bool) ([]*models.MyRequest, error) {
-	var requests []*models.MyRequest
-	query := s.DB.WithContext(ctx).Preload("Program").Preload("Endpoint").Preload("Notes").Preload("Attachments").Preload("Taggables.Tag")
-	// Apply filters
-	if programId != nil {
-		query = query.Where("program_id = ?", *programId)
-	}
-	if endpointId != nil {
-		query = query.Where("endpoint_id = ?", *endpointId)
-	}
-	if jobId != nil {
-		query = query.Where("import_job_id = ?", *jobId)
+	// Search in request body, response body, headers, and URL through the full-text index
+	if q.Search != "" {
+		var err error
+		if query, err = applySearch(query, q.Search); err != nil {
+			return nil, err
+		}
 	}
 
 	// Apply domain filter
-	if domain != "" {
-		if includeSubdomains {
+	if q.Domain != "" {
+		if q.IncludeSubdomains {
 			// Include subdomains: match domain or any subdomain
-			query = query.Where("domain = ? OR domain LIKE ?", domain, "%."+domain)
+			query = query.Where("domain = ? OR domain LIKE ?", q.Domain, "%."+q.Domain)
 		} else {
 			// Exact domain match only
-			query = query.Where("domain = ?", domain)
+			query = query.Where("domain = ?", q.Domain)
 		}
 	}
 
 	// Apply URL contains filter
-	if urlContains != "" {
-		query = query.Where("url LIKE ?", "%"+urlContains+"%")
+	if q.URLContains != "" {
+		query = query.Where("url LIKE ?", "%"+q.URLContains+"%")
 	}
 
 	// Apply URL match filter (exact match)
-	if urlMatch != "" {
-		query = query.Where("url = ?", urlMatch)
+	if q.URLMatch != "" {
+		query = query.Where("url = ?", q.URLMatch)
 	}
 
-	// Apply raw SQL filter if provided
-	if rawSQL != "" {
-		query = query.Where(rawSQL)
+	// Apply resource type filter (document, script, xhr, ...)
+	if q.ResourceType != "" {
+		query = query.Where("resource_type = ?", q.ResourceType)
 	}
 
-	// Apply multi-level ordering
-	orderClauses := s.buildOrderClauses(orderBy1, asc1, orderBy2, asc2, orderBy3, asc3, orderBy4, asc4)
-	if len(orderClauses) > 0 {
-		query = query.Order(orderClauses)
+	// Apply scope filter (in, out, unknown)
+	if q.Scope != "" {
+		query = query.Where("scope = ?", q.Scope)
 	}
 
-	if err := query.Find(&requests).Error; err != nil {
-		return nil, err
+	// Templates come from API docs, observed traffic is everything else
+	if q.IsTemplate != nil {
+		query = query.Where("is_template = ?", *q.IsTemplate)
 	}
-	return requests, nil
+
+	// Apply the filter query, like status:>=400 method:POST
+	if q.Filter != "" {
+		var err error
+		if query, err = applyFilter(query, q.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	// Apply raw SQL filter if provided, the handler only passes it when ALLOW_RAW_SQL is set
+	if q.RawSQL != "" {
+		query = query.Where(q.RawSQL)
+	}
+	return query, nil
 }
 
 // Get retrieves a request by Id
@@ -142,47 +130,98 @@ func (s *RequestService) Get(ctx context.Context, id int) (*models.MyRequest, er
 	return &request, nil
 }
 
-// SearchRequests searches for requests based on query string
-func (s *RequestService) SearchRequests(ctx context.Context, searchQuery, domain, urlContains, urlMatch string, includeSubdomains bool, orderBy1 string, asc1 bool, orderBy2 string, asc2 bool, orderBy3 string, asc3 bool, orderBy4 string, asc4 bool) ([]*models.MyRequest, error) {
-	var requests []*models.MyRequest
+// GetResponseBody retrieves a request with only the columns needed to serve its raw response body
+func (s *RequestService) GetResponseBody(ctx context.Context, id int) (*models.MyRequest, error) {
+	var request models.MyRequest
+	if err := s.DB.WithContext(ctx).Select("id", "res_headers", "res_body", "res_body_binary", "res_body_blob").First(&request, id).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
 
-	// Search in request body, response body, headers, and URL
-	query := s.DB.WithContext(ctx).Preload("Program").Preload("Endpoint").Preload("Notes").Preload("Attachments").Preload("Taggables.Tag")
-	searchPattern := "%" + searchQuery + "%"
-	query = query.Where("url LIKE ? OR req_body LIKE ? OR res_body LIKE ? OR req_headers LIKE ? OR res_headers LIKE ?",
-		searchPattern, searchPattern, searchPattern, searchPattern, searchPattern)
+// searchSnippets is how many fields of a search result are excerpted
+const searchSnippets = 3
 
-	// Apply domain filter
-	if domain != "" {
-		if includeSubdomains {
-			// Include subdomains: match domain or any subdomain
-			query = query.Where("domain = ? OR domain LIKE ?", domain, "%."+domain)
-		} else {
-			// Exact domain match only
-			query = query.Where("domain = ?", domain)
-		}
+// SearchResult is a request matching a full-text search and where it matched
+type SearchResult struct {
+	Request  *models.MyRequest
+	Snippets []search.Snippet
+}
+
+// Search runs a full-text search over the URL, headers and bodies of requests, sorted by the page.
+// Each result carries highlighted snippets of up to searchSnippets fields.
+func (s *RequestService) Search(ctx context.Context, q string, programId *int, page *Page) ([]*SearchResult, error) {
+	parsed, err := search.Parse(q)
+	if err != nil {
+		return nil, utils.BadRequest(fmt.Sprintf("invalid search: %v", err))
+	}
+	query, err := parsed.Apply(s.DB.WithContext(ctx).Model(&models.MyRequest{}))
+	if err != nil {
+		return nil, utils.BadRequest(fmt.Sprintf("invalid search: %v", err))
+	}
+	if programId != nil {
+		query = query.Where("program_id = ?", *programId)
+	}
+	if query, err = page.apply(query, requestSorts, ""); err != nil {
+		return nil, err
 	}
 
-	// Apply URL contains filter
-	if urlContains != "" {
-		query = query.Where("url LIKE ?", "%"+urlContains+"%")
+	var requests []*models.MyRequest
+	columns := []string{"id", "program_id", "endpoint_id", "method", "url", "domain", "res_status",
+		"req_headers", "req_body", "res_headers", "res_body"}
+	err = query.Select(append(columns, page.columns()...)).Find(&requests).Error
+	if err != nil {
+		return nil, err
 	}
 
-	// Apply URL match filter (exact match)
-	if urlMatch != "" {
-		query = query.Where("url = ?", urlMatch)
+	results := make([]*SearchResult, len(requests))
+	for i, request := range requests {
+		results[i] = &SearchResult{
+			Request: request,
+			Snippets: parsed.Snippets(map[string]string{
+				"url":         request.URL,
+				"req.headers": request.ReqHeaders,
+				"req.body":    request.ReqBody,
+				"res.headers": request.ResHeaders,
+				"res.body":    request.ResBody,
+			}, searchSnippets),
+		}
+	}
+	if len(requests) > 0 {
+		page.next(len(requests), requests[len(requests)-1])
 	}
+	return results, nil
+}
 
-	// Apply multi-level ordering
-	orderClauses := s.buildOrderClauses(orderBy1, asc1, orderBy2, asc2, orderBy3, asc3, orderBy4, asc4)
-	if len(orderClauses) > 0 {
-		query = query.Order(orderClauses)
+// findRequestList sorts and pages a filtered query on requests and loads what the wanted list fields need,
+// the text field needs everything
+func findRequestList(query *gorm.DB, page *Page, fields Fields) ([]*models.MyRequest, error) {
+	query, err := page.apply(query, requestSorts, "")
+	if err != nil {
+		return nil, err
+	}
+	if fields.Has("program_name", "text") {
+		query = query.Preload("Program")
+	}
+	if fields.Has("endpoint_name", "text") {
+		query = query.Preload("Endpoint")
+	}
+	if fields.Has("text") {
+		query = query.Preload("Notes").Preload("Attachments")
+	} else {
+		query = query.Omit("req_headers", "req_body", "res_headers", "res_body", "res_body_blob")
+	}
+	if fields.Has("tags") {
+		query = query.Preload("Taggables.Tag")
 	}
 
+	var requests []*models.MyRequest
 	if err := query.Find(&requests).Error; err != nil {
 		return nil, err
 	}
-
+	if len(requests) > 0 {
+		page.next(len(requests), requests[len(requests)-1])
+	}
 	return requests, nil
 }
 
@@ -223,3 +262,29 @@ func ParseResponseBody(bodyJSON string) (interface{}, error) {
 	}
 	return body, nil
 }
+
+// applyFilter adds the conditions of a filter query to a query on requests
+func applyFilter(query *gorm.DB, filter string) (*gorm.DB, error) {
+	parsed, err := filterql.Parse(filter)
+	if err != nil {
+		return nil, utils.BadRequest(fmt.Sprintf("invalid filter: %v", err))
+	}
+	query, err = parsed.Apply(query)
+	if err != nil {
+		return nil, utils.BadRequest(fmt.Sprintf("invalid filter: %v", err))
+	}
+	return query, nil
+}
+
+// applySearch restricts a query on requests to those matching a full-text search
+func applySearch(query *gorm.DB, q string) (*gorm.DB, error) {
+	parsed, err := search.Parse(q)
+	if err != nil {
+		return nil, utils.BadRequest(fmt.Sprintf("invalid search: %v", err))
+	}
+	query, err = parsed.Apply(query)
+	if err != nil {
+		return nil, utils.BadRequest(fmt.Sprintf("invalid search: %v", err))
+	}
+	return query, nil
+}
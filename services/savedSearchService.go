@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+type SavedSearchService struct {
+	DB       *gorm.DB
+	Requests *RequestService
+}
+
+// SavedSearchStats is what a saved search knows about its requests, collections only
+type SavedSearchStats struct {
+	Total    int64 // requests in the collection
+	NewCount int64 // requests added since the collection was last viewed
+}
+
+// savedSearchSorts are the sort keys of the saved search list
+var savedSearchSorts = Sorts{
+	"program_id": "program_id",
+	"name":       "name",
+	"pinned":     "pinned",
+	"shared":     "shared",
+	"collection": "collection",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// CollectionRefresh reports how a refresh changed a collection
+type CollectionRefresh struct {
+	Total   int
+	Added   int
+	Removed int
+}
+
+// savedSearchParams are the parameters of GET /requests a saved search can store, its filters and sort.
+// The program is a field of the search, raw SQL is never stored and pagination is chosen when the search is run.
+func savedSearchParams() map[string]bool {
+	params := map[string]bool{"sort": true}
+	for _, name := range RequestQueryParams {
+		if name != "program_id" && name != "raw_sql" {
+			params[name] = true
+		}
+	}
+	return params
+}
+
+// EncodeSavedSearchQuery checks the parameters of a saved search and encodes them as a query string
+func EncodeSavedSearchQuery(params map[string]string) (string, error) {
+	allowed := savedSearchParams()
+	values := url.Values{}
+	for name, value := range params {
+		if !allowed[name] {
+			names := make([]string, 0, len(allowed))
+			for name := range allowed {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", utils.BadRequest(fmt.Sprintf("invalid parameter '%s', expected %s", name, strings.Join(names, ", ")))
+		}
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	return values.Encode(), nil
+}
+
+// DecodeSavedSearchQuery returns the stored parameters of a saved search
+func DecodeSavedSearchQuery(query string) map[string]string {
+	values, _ := url.ParseQuery(query)
+	params := make(map[string]string, len(values))
+	for name := range values {
+		params[name] = values.Get(name)
+	}
+	return params
+}
+
+// Create validates and saves a search, returning its id
+func (s *SavedSearchService) Create(ctx context.Context, search *models.SavedSearch) (int, error) {
+	if err := s.validate(ctx, search); err != nil {
+		return 0, err
+	}
+	if err := s.DB.WithContext(ctx).Create(search).Error; err != nil {
+		return 0, err
+	}
+	return search.Id, nil
+}
+
+// validate checks the program and runs the stored query once without loading anything, so a bad
+// filter or search is reported when it is saved
+func (s *SavedSearchService) validate(ctx context.Context, search *models.SavedSearch) error {
+	if search.ProgramId != nil {
+		if _, err := first[models.Program](s.DB.WithContext(ctx), *search.ProgramId); err != nil {
+			return err
+		}
+	}
+	q, err := s.requestQuery(search, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Requests.filter(ctx, q); err != nil {
+		return err
+	}
+	if _, err := requestSorts.order(savedSort(search)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// savedSort returns the stored sort of a search, used when a run doesn't pick one
+func savedSort(search *models.SavedSearch) string {
+	values, _ := url.ParseQuery(search.Query)
+	return values.Get("sort")
+}
+
+// requestQuery parses the stored parameters of a search, run on programId when it is shared
+func (s *SavedSearchService) requestQuery(search *models.SavedSearch, programId *int) (*RequestQuery, error) {
+	values, err := url.ParseQuery(search.Query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored query: %v", err)
+	}
+	values.Del("program_id")
+	values.Del("raw_sql")
+	q, err := ParseRequestQuery(values)
+	if err != nil {
+		return nil, err
+	}
+
+	q.ProgramId = search.ProgramId
+	if programId != nil && (q.ProgramId == nil || *programId != *q.ProgramId) {
+		if !search.Shared && search.ProgramId != nil {
+			return nil, utils.BadRequest(fmt.Sprintf("the search belongs to program %d, share it to run it on others", *search.ProgramId))
+		}
+		q.ProgramId = programId
+	}
+	return q, nil
+}
+
+// Get retrieves a saved search by Id
+func (s *SavedSearchService) Get(ctx context.Context, id int) (*models.SavedSearch, error) {
+	return first[models.SavedSearch](s.DB.WithContext(ctx), id)
+}
+
+// List retrieves saved searches, by default pinned ones first then by name. With a program, the searches of
+// the program, those of every program and the shared ones are listed.
+func (s *SavedSearchService) List(ctx context.Context, programId *int, pinned *bool, page *Page) ([]*models.SavedSearch, error) {
+	query := s.DB.WithContext(ctx).Model(&models.SavedSearch{})
+	if programId != nil {
+		query = query.Where("program_id = ? OR program_id IS NULL OR shared = ?", *programId, true)
+	}
+	if pinned != nil {
+		query = query.Where("pinned = ?", *pinned)
+	}
+	query, err := page.apply(query, savedSearchSorts, "-pinned,name")
+	if err != nil {
+		return nil, err
+	}
+
+	var searches []*models.SavedSearch
+	if err := query.Find(&searches).Error; err != nil {
+		return nil, err
+	}
+	if len(searches) > 0 {
+		page.next(len(searches), searches[len(searches)-1])
+	}
+	return searches, nil
+}
+
+// Stats counts the requests of the collections among searches, as of their last refresh
+func (s *SavedSearchService) Stats(ctx context.Context, searches []*models.SavedSearch) (map[int]*SavedSearchStats, error) {
+	stats := make(map[int]*SavedSearchStats)
+	for _, search := range searches {
+		if !search.Collection {
+			continue
+		}
+		stat := &SavedSearchStats{}
+		items := s.DB.WithContext(ctx).Model(&models.CollectionItem{}).Where("saved_search_id = ?", search.Id)
+		if err := items.Session(&gorm.Session{}).Count(&stat.Total).Error; err != nil {
+			return nil, err
+		}
+		stat.NewCount = stat.Total
+		if search.LastViewedAt != nil {
+			if err := items.Where("added_at > ?", *search.LastViewedAt).Count(&stat.NewCount).Error; err != nil {
+				return nil, err
+			}
+		}
+		stats[search.Id] = stat
+	}
+	return stats, nil
+}
+
+// Update replaces the definition of a search. A collection whose query changed is emptied, it fills up
+// again on the next refresh.
+func (s *SavedSearchService) Update(ctx context.Context, id int, input *models.SavedSearch) (int, error) {
+	search, err := first[models.SavedSearch](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.validate(ctx, input); err != nil {
+		return 0, err
+	}
+	reset := !input.Collection || input.Query != search.Query || !sameProgram(input.ProgramId, search.ProgramId)
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	updates := map[string]any{
+		"ProgramId":   input.ProgramId,
+		"Name":        input.Name,
+		"Description": input.Description,
+		"Query":       input.Query,
+		"Pinned":      input.Pinned,
+		"Shared":      input.Shared,
+		"Collection":  input.Collection,
+	}
+	if reset {
+		updates["RefreshedAt"] = nil
+		if err := tx.Where("saved_search_id = ?", search.Id).Delete(&models.CollectionItem{}).Error; err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Model(search).Updates(updates).Error; err != nil {
+		return 0, err
+	}
+	return search.Id, tx.Commit().Error
+}
+
+func sameProgram(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Delete deletes a saved search and the items of its collection
+func (s *SavedSearchService) Delete(ctx context.Context, id int) (int, error) {
+	search, err := first[models.SavedSearch](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	if err := tx.Where("saved_search_id = ?", search.Id).Delete(&models.CollectionItem{}).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Delete(search).Error; err != nil {
+		return 0, err
+	}
+	return search.Id, tx.Commit().Error
+}
+
+// Run lists the requests a search matches now, on programId when the search is shared. The stored sort
+// applies unless the page has one.
+func (s *SavedSearchService) Run(ctx context.Context, id int, programId *int, page *Page, fields Fields) ([]*models.MyRequest, error) {
+	search, err := first[models.SavedSearch](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.requestQuery(search, programId)
+	if err != nil {
+		return nil, err
+	}
+	if page != nil && page.Sort == "" {
+		page.Sort = savedSort(search)
+	}
+	return s.Requests.List(ctx, q, page, fields)
+}
+
+// Refresh materializes which requests match a collection: new matches are added with the current time
+// and requests that stopped matching are removed
+func (s *SavedSearchService) Refresh(ctx context.Context, id int) (*CollectionRefresh, error) {
+	search, err := first[models.SavedSearch](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if !search.Collection {
+		return nil, utils.BadRequest("the saved search is not a collection")
+	}
+	q, err := s.requestQuery(search, nil)
+	if err != nil {
+		return nil, err
+	}
+	query, err := s.Requests.filter(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	var matching []int
+	if err := query.Pluck("id", &matching).Error; err != nil {
+		return nil, err
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	var existing []int
+	if err := tx.Model(&models.CollectionItem{}).Where("saved_search_id = ?", search.Id).Pluck("request_id", &existing).Error; err != nil {
+		return nil, err
+	}
+	current := make(map[int]bool, len(matching))
+	for _, requestId := range matching {
+		current[requestId] = true
+	}
+	kept := make(map[int]bool, len(existing))
+	var removed []int
+	for _, requestId := range existing {
+		if current[requestId] {
+			kept[requestId] = true
+		} else {
+			removed = append(removed, requestId)
+		}
+	}
+
+	now := time.Now()
+	var added []*models.CollectionItem
+	for _, requestId := range matching {
+		if !kept[requestId] {
+			added = append(added, &models.CollectionItem{SavedSearchId: search.Id, RequestId: requestId, AddedAt: now})
+		}
+	}
+	if len(added) > 0 {
+		if err := tx.CreateInBatches(added, importBatchSize).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, chunk := range chunkIds(removed) {
+		if err := tx.Where("saved_search_id = ? AND request_id IN ?", search.Id, chunk).Delete(&models.CollectionItem{}).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Model(search).Update("RefreshedAt", &now).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return &CollectionRefresh{Total: len(matching), Added: len(added), Removed: len(removed)}, nil
+}
+
+// ListCollection refreshes a collection and lists its requests, with newOnly only those added since it was
+// last viewed. They are sorted like Run. page.Total counts the listed requests, the stats count the whole collection.
+func (s *SavedSearchService) ListCollection(ctx context.Context, id int, newOnly bool, page *Page, fields Fields) ([]*models.MyRequest, *SavedSearchStats, error) {
+	if _, err := s.Refresh(ctx, id); err != nil {
+		return nil, nil, err
+	}
+	search, err := first[models.SavedSearch](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats, err := s.Stats(ctx, []*models.SavedSearch{search})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items := s.DB.Model(&models.CollectionItem{}).Select("request_id").Where("saved_search_id = ?", search.Id)
+	if newOnly && search.LastViewedAt != nil {
+		items = items.Where("added_at > ?", *search.LastViewedAt)
+	}
+	query := s.DB.WithContext(ctx).Model(&models.MyRequest{}).Where("id IN (?)", items)
+	if page != nil && page.Sort == "" {
+		page.Sort = savedSort(search)
+	}
+	requests, err := findRequestList(query, page, fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return requests, stats[search.Id], nil
+}
+
+// MarkViewed records that a collection was viewed, its current requests stop being new
+func (s *SavedSearchService) MarkViewed(ctx context.Context, id int) (int, error) {
+	search, err := first[models.SavedSearch](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+	if !search.Collection {
+		return 0, utils.BadRequest("the saved search is not a collection")
+	}
+	now := time.Now()
+	if err := s.DB.WithContext(ctx).Model(search).Update("LastViewedAt", &now).Error; err != nil {
+		return 0, err
+	}
+	return search.Id, nil
+}
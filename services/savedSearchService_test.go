@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+func newTestSavedSearchService(t *testing.T) (*SavedSearchService, int) {
+	t.Helper()
+	db, programId := newTestDB(t)
+	return &SavedSearchService{DB: db, Requests: &RequestService{DB: db}}, programId
+}
+
+// createTestRequest saves a GET request of the program to https://example.com followed by path
+func createTestRequest(t *testing.T, db *gorm.DB, programId int, path string) *models.MyRequest {
+	t.Helper()
+	endpoint := &models.Endpoint{ProgramId: programId, Domain: "example.com", Method: "GET", URI: path}
+	if err := db.Create(endpoint).Error; err != nil {
+		t.Fatal(err)
+	}
+	job := &models.ImportJob{ProgramId: &programId, JobType: models.JobTypeManual, Title: "manual", Status: models.JobStatusDone}
+	if err := db.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+	request := &models.MyRequest{ProgramId: &programId, ImportJobId: job.Id, EndpointId: endpoint.Id, Sequence: 1,
+		URL: "https://example.com" + path, Method: "GET", Domain: "example.com", ResStatus: 200}
+	if err := db.Create(request).Error; err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func createTestSearch(t *testing.T, service *SavedSearchService, search *models.SavedSearch) *models.SavedSearch {
+	t.Helper()
+	if _, err := service.Create(context.Background(), search); err != nil {
+		t.Fatal(err)
+	}
+	return search
+}
+
+func requestIds(requests []*models.MyRequest) []int {
+	ids := make([]int, len(requests))
+	for i, request := range requests {
+		ids[i] = request.Id
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func collectionItems(t *testing.T, db *gorm.DB, searchId int) []int {
+	t.Helper()
+	var ids []int
+	if err := db.Model(&models.CollectionItem{}).Where("saved_search_id = ?", searchId).Order("request_id ASC").Pluck("request_id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestSavedSearchRefresh(t *testing.T) {
+	service, programId := newTestSavedSearchService(t)
+	db, ctx := service.DB, context.Background()
+	admin1 := createTestRequest(t, db, programId, "/admin/1")
+	admin2 := createTestRequest(t, db, programId, "/admin/2")
+	createTestRequest(t, db, programId, "/public")
+	search := createTestSearch(t, service, &models.SavedSearch{ProgramId: &programId, Name: "admin", Query: "url_contains=admin", Collection: true})
+
+	refresh, err := service.Refresh(ctx, search.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *refresh != (CollectionRefresh{Total: 2, Added: 2}) {
+		t.Errorf("got first refresh %+v, want 2 added", *refresh)
+	}
+	if refresh, _ = service.Refresh(ctx, search.Id); *refresh != (CollectionRefresh{Total: 2}) {
+		t.Errorf("got refresh without changes %+v, want nothing added or removed", *refresh)
+	}
+
+	// one request stops matching and another one starts
+	if err := db.Model(admin1).Update("URL", "https://example.com/public/1").Error; err != nil {
+		t.Fatal(err)
+	}
+	admin3 := createTestRequest(t, db, programId, "/admin/3")
+	if refresh, _ = service.Refresh(ctx, search.Id); *refresh != (CollectionRefresh{Total: 2, Added: 1, Removed: 1}) {
+		t.Errorf("got refresh %+v, want 1 added and 1 removed", *refresh)
+	}
+	if got, want := collectionItems(t, db, search.Id), []int{admin2.Id, admin3.Id}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got collection items %v, want %v", got, want)
+	}
+	if stored, _ := service.Get(ctx, search.Id); stored.RefreshedAt == nil {
+		t.Error("the refresh time was not saved")
+	}
+
+	plain := createTestSearch(t, service, &models.SavedSearch{ProgramId: &programId, Name: "plain", Query: "url_contains=admin"})
+	if _, err := service.Refresh(ctx, plain.Id); !errors.Is(err, utils.ErrBadRequest) {
+		t.Errorf("got error %v refreshing a search that is no collection, want a bad request", err)
+	}
+}
+
+func TestSavedSearchCollectionNewOnly(t *testing.T) {
+	service, programId := newTestSavedSearchService(t)
+	db, ctx := service.DB, context.Background()
+	admin1 := createTestRequest(t, db, programId, "/admin/1")
+	admin2 := createTestRequest(t, db, programId, "/admin/2")
+	search := createTestSearch(t, service, &models.SavedSearch{ProgramId: &programId, Name: "admin", Query: "url_contains=admin", Collection: true})
+	plain := createTestSearch(t, service, &models.SavedSearch{ProgramId: &programId, Name: "plain", Query: "url_contains=admin"})
+
+	// every request is new before the collection is viewed
+	requests, stats, err := service.ListCollection(ctx, search.Id, true, &Page{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestIds(requests), []int{admin1.Id, admin2.Id}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got requests %v before the first view, want %v", got, want)
+	}
+	if *stats != (SavedSearchStats{Total: 2, NewCount: 2}) {
+		t.Errorf("got stats %+v, want 2 new of 2", *stats)
+	}
+
+	if _, err := service.MarkViewed(ctx, search.Id); err != nil {
+		t.Fatal(err)
+	}
+	admin3 := createTestRequest(t, db, programId, "/admin/3")
+
+	requests, stats, err = service.ListCollection(ctx, search.Id, true, &Page{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestIds(requests), []int{admin3.Id}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got new requests %v, want %v", got, want)
+	}
+	if *stats != (SavedSearchStats{Total: 3, NewCount: 1}) {
+		t.Errorf("got stats %+v, want 1 new of 3", *stats)
+	}
+	requests, _, err = service.ListCollection(ctx, search.Id, false, &Page{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestIds(requests), []int{admin1.Id, admin2.Id, admin3.Id}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got requests %v, want %v", got, want)
+	}
+
+	stored, _ := service.Get(ctx, search.Id)
+	all, err := service.Stats(ctx, []*models.SavedSearch{stored, plain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || *all[search.Id] != (SavedSearchStats{Total: 3, NewCount: 1}) {
+		t.Errorf("got stats %v, want those of the collection only", all)
+	}
+	if _, err := service.MarkViewed(ctx, plain.Id); !errors.Is(err, utils.ErrBadRequest) {
+		t.Errorf("got error %v marking a search that is no collection as viewed, want a bad request", err)
+	}
+}
+
+func TestSavedSearchUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		update    func(search *models.SavedSearch)
+		wantItems bool
+		wantErr   bool
+	}{
+		{name: "name", update: func(s *models.SavedSearch) { s.Name = "renamed"; s.Pinned = true }, wantItems: true},
+		{name: "query", update: func(s *models.SavedSearch) { s.Query = "url_contains=admin%2F1" }},
+		{name: "program", update: func(s *models.SavedSearch) { s.ProgramId = nil }},
+		{name: "no collection", update: func(s *models.SavedSearch) { s.Collection = false }},
+		{name: "invalid sort", update: func(s *models.SavedSearch) { s.Query = "sort=bogus" }, wantItems: true, wantErr: true},
+		{name: "invalid filter", update: func(s *models.SavedSearch) { s.Query = "filter=status:>>" }, wantItems: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, programId := newTestSavedSearchService(t)
+			db, ctx := service.DB, context.Background()
+			createTestRequest(t, db, programId, "/admin/1")
+			createTestRequest(t, db, programId, "/admin/2")
+			search := createTestSearch(t, service, &models.SavedSearch{ProgramId: &programId, Name: "admin", Query: "url_contains=admin", Collection: true})
+			if _, err := service.Refresh(ctx, search.Id); err != nil {
+				t.Fatal(err)
+			}
+
+			input := *search
+			tt.update(&input)
+			_, err := service.Update(ctx, search.Id, &input)
+			if tt.wantErr {
+				if !errors.Is(err, utils.ErrBadRequest) {
+					t.Errorf("got error %v, want a bad request", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := service.Get(ctx, search.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantErr && (stored.Name != input.Name || stored.Query != input.Query || stored.Pinned != input.Pinned ||
+				stored.Collection != input.Collection || !sameProgram(stored.ProgramId, input.ProgramId)) {
+				t.Errorf("got search %+v, want %+v", stored, input)
+			}
+			if tt.wantErr && stored.Query != search.Query {
+				t.Errorf("got query %q after a failed update, want %q", stored.Query, search.Query)
+			}
+			items := collectionItems(t, db, search.Id)
+			if (len(items) == 2) != tt.wantItems || (stored.RefreshedAt != nil) != tt.wantItems {
+				t.Errorf("got %d collection items refreshed at %v, want the items kept %v", len(items), stored.RefreshedAt, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestSavedSearchRunOnProgram(t *testing.T) {
+	service, programId := newTestSavedSearchService(t)
+	db, ctx := service.DB, context.Background()
+	other := &models.Program{Name: "other", Domains: "example.com"}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatal(err)
+	}
+	own := createTestRequest(t, db, programId, "/admin")
+	createTestRequest(t, db, programId, "/public")
+	others := createTestRequest(t, db, other.Id, "/admin")
+
+	shared := createTestSearch(t, service, &models.SavedSearch{ProgramId: &programId, Name: "shared", Query: "url_contains=admin", Shared: true})
+	private := createTestSearch(t, service, &models.SavedSearch{ProgramId: &programId, Name: "private", Query: "url_contains=admin"})
+	global := createTestSearch(t, service, &models.SavedSearch{Name: "global", Query: "url_contains=admin"})
+
+	tests := []struct {
+		name      string
+		search    *models.SavedSearch
+		programId *int
+		want      []int
+		wantErr   bool
+	}{
+		{name: "shared on its program", search: shared, want: []int{own.Id}},
+		{name: "shared on another program", search: shared, programId: &other.Id, want: []int{others.Id}},
+		{name: "private on its program", search: private, programId: &programId, want: []int{own.Id}},
+		{name: "private on another program", search: private, programId: &other.Id, wantErr: true},
+		{name: "every program", search: global, want: []int{own.Id, others.Id}},
+		{name: "every program on one", search: global, programId: &other.Id, want: []int{others.Id}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, err := service.Run(ctx, tt.search.Id, tt.programId, &Page{}, nil)
+			if tt.wantErr {
+				if !errors.Is(err, utils.ErrBadRequest) {
+					t.Errorf("got error %v, want a bad request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := requestIds(requests); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got requests %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// the other program lists the shared search and the one of every program, not the private one
+	searches, err := service.List(ctx, &other.Id, nil, &Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, search := range searches {
+		names = append(names, search.Name)
+	}
+	if want := []string{"global", "shared"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got searches %v listed on the other program, want %v", names, want)
+	}
+}
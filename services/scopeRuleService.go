@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/linn221/RequesterBackend/models"
+	"github.com/linn221/RequesterBackend/scope"
+	"github.com/linn221/RequesterBackend/utils"
+	"gorm.io/gorm"
+)
+
+type ScopeRuleService struct {
+	DB *gorm.DB
+}
+
+// ScopeCheckResult tells whether a URL is in the scope of a program and which rule decided it
+type ScopeCheckResult struct {
+	Status scope.Status
+	Rule   *models.ScopeRule // nil when no rule matched or the decision came from the program's domains
+	Domain string            // the program domain that put the URL in scope
+}
+
+func (s *ScopeRuleService) validate(db *gorm.DB, input *models.ScopeRule) error {
+	if input.Kind != models.ScopeRuleIn && input.Kind != models.ScopeRuleOut {
+		return utils.BadRequest(fmt.Sprintf("invalid kind '%s', expected in or out", input.Kind))
+	}
+	rule := scopeRule(input)
+	if err := rule.Compile(); err != nil {
+		return utils.BadRequest(err.Error())
+	}
+	input.Host, input.Scheme = rule.Host, rule.Scheme
+	if _, err := first[models.Program](db, input.ProgramId); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.BadRequest(fmt.Sprintf("program with ID %d not found", input.ProgramId))
+		}
+		return err
+	}
+	return nil
+}
+
+// Create creates a new scope rule and returns its Id, the scope of the program's requests and endpoints is updated
+func (s *ScopeRuleService) Create(ctx context.Context, rule *models.ScopeRule) (int, error) {
+	if err := s.validate(s.DB.WithContext(ctx), rule); err != nil {
+		return 0, err
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	if err := tx.Create(rule).Error; err != nil {
+		return 0, err
+	}
+	if err := recomputeScope(ctx, tx, rule.ProgramId); err != nil {
+		return 0, err
+	}
+	return rule.Id, tx.Commit().Error
+}
+
+// List retrieves scope rules, optionally only those of one program
+func (s *ScopeRuleService) List(ctx context.Context, programId *int) ([]*models.ScopeRule, error) {
+	var rules []*models.ScopeRule
+	query := s.DB.WithContext(ctx)
+	if programId != nil {
+		query = query.Where("program_id = ?", *programId)
+	}
+	if err := query.Order("program_id ASC, id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Delete deletes a scope rule by Id and returns the deleted Id, the scope of the program's requests and endpoints is updated
+func (s *ScopeRuleService) Delete(ctx context.Context, id int) (int, error) {
+	rule, err := first[models.ScopeRule](s.DB.WithContext(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	if err := tx.Delete(rule).Error; err != nil {
+		return 0, err
+	}
+	if err := recomputeScope(ctx, tx, rule.ProgramId); err != nil {
+		return 0, err
+	}
+	return rule.Id, tx.Commit().Error
+}
+
+// Check tests a URL against the scope of a program
+func (s *ScopeRuleService) Check(ctx context.Context, programId int, rawURL string) (*ScopeCheckResult, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, utils.BadRequest(fmt.Sprintf("invalid url '%s'", rawURL))
+	}
+	loaded, err := loadScope(ctx, s.DB, programId)
+	if err != nil {
+		return nil, err
+	}
+
+	status, matched := loaded.scope.Check(u)
+	result := &ScopeCheckResult{Status: status}
+	if matched != nil {
+		if rule, ok := loaded.rules[matched]; ok {
+			result.Rule = rule
+		} else {
+			result.Domain = matched.Host
+		}
+	}
+	return result, nil
+}
+
+// loadedScope is the compiled scope of a program, rules maps compiled rules back to the stored ones
+type loadedScope struct {
+	scope *scope.Scope
+	rules map[*scope.Rule]*models.ScopeRule
+}
+
+// loadScope builds the scope of a program from its scope rules and its domains, every domain counts as an in-scope host rule
+func loadScope(ctx context.Context, db *gorm.DB, programId int) (*loadedScope, error) {
+	program, err := first[models.Program](db.WithContext(ctx), programId)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*models.ScopeRule
+	if err := db.WithContext(ctx).Where("program_id = ?", programId).Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load scope rules: %v", err)
+	}
+	return newLoadedScope(program, rules), nil
+}
+
+// newLoadedScope compiles the scope of a program from its domains and its scope rules
+func newLoadedScope(program *models.Program, rules []*models.ScopeRule) *loadedScope {
+	loaded := &loadedScope{scope: &scope.Scope{}, rules: make(map[*scope.Rule]*models.ScopeRule, len(rules))}
+	for _, domain := range parseProgramDomains(program.Domains) {
+		rule := &scope.Rule{Host: domain}
+		if rule.Compile() == nil {
+			loaded.scope.In = append(loaded.scope.In, rule)
+		}
+	}
+	for _, stored := range rules {
+		rule := scopeRule(stored)
+		if err := rule.Compile(); err != nil {
+			continue // validated on create, only hand-edited rows can fail
+		}
+		loaded.rules[rule] = stored
+		if stored.Kind == models.ScopeRuleOut {
+			loaded.scope.Out = append(loaded.scope.Out, rule)
+		} else {
+			loaded.scope.In = append(loaded.scope.In, rule)
+		}
+	}
+	return loaded
+}
+
+func scopeRule(rule *models.ScopeRule) *scope.Rule {
+	return &scope.Rule{
+		Host:       rule.Host,
+		Scheme:     rule.Scheme,
+		Port:       rule.Port,
+		PathPrefix: rule.PathPrefix,
+	}
+}
+
+// recomputeScope sets the scope of every request and endpoint of a program again, after its rules or domains changed
+func recomputeScope(ctx context.Context, db *gorm.DB, programId int) error {
+	loaded, err := loadScope(ctx, db, programId)
+	if err != nil {
+		return err
+	}
+
+	var requests []*models.MyRequest
+	err = db.WithContext(ctx).
+		Select("id", "url", "scope").
+		Where("program_id = ?", programId).
+		FindInBatches(&requests, importBatchSize*10, func(batch *gorm.DB, _ int) error {
+			changed := make(map[scope.Status][]int)
+			for _, req := range requests {
+				if status := loaded.scope.CheckURL(req.URL); string(status) != req.Scope {
+					changed[status] = append(changed[status], req.Id)
+				}
+			}
+			return updateScope(ctx, db, &models.MyRequest{}, changed)
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update the scope of requests: %v", err)
+	}
+
+	var endpoints []*models.Endpoint
+	err = db.WithContext(ctx).
+		Select("id", "domain", "uri", "scope").
+		Where("program_id = ?", programId).
+		FindInBatches(&endpoints, importBatchSize*10, func(batch *gorm.DB, _ int) error {
+			changed := make(map[scope.Status][]int)
+			for _, endpoint := range endpoints {
+				if status := loaded.scope.CheckHostPath(endpoint.Domain, endpoint.URI); string(status) != endpoint.Scope {
+					changed[status] = append(changed[status], endpoint.Id)
+				}
+			}
+			return updateScope(ctx, db, &models.Endpoint{}, changed)
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update the scope of endpoints: %v", err)
+	}
+	return nil
+}
+
+func updateScope(ctx context.Context, db *gorm.DB, model any, changed map[scope.Status][]int) error {
+	for status, ids := range changed {
+		for _, chunk := range chunkIds(ids) {
+			if err := db.WithContext(ctx).Model(model).Where("id IN ?", chunk).UpdateColumn("scope", string(status)).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -12,6 +12,15 @@ type VulnService struct {
 	DB *gorm.DB
 }
 
+// vulnSorts are the sort keys of the vuln list
+var vulnSorts = Sorts{
+	"title":      "title",
+	"slug":       "slug",
+	"parent_id":  "parent_id",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
 // will return a copy of the service but DB is a new transaction, and a function to be used with defer for closing dependencies, a function for commiting the transaction
 // for this case, it is DB, but for other services, it could be a file or something, therefore,I want to use this function signature as universal for creating new instance service, always returning new service, clean up function and commit function to call when the service has finished successfully(serve different purpose and the last one may be optional sometimes)
 func (s *VulnService) NewInstance(ctx context.Context) (*VulnService, func(), func() error) {
@@ -78,24 +87,31 @@ func (s *VulnService) Get(ctx context.Context, id int) (*models.Vuln, error) {
 }
 
 // List retrieves all vulnerabilities with optional filtering
-func (s *VulnService) List(ctx context.Context, parentId *int) ([]*models.Vuln, error) {
-	var vulns []*models.Vuln
-	query := s.DB.WithContext(ctx).
-		Preload("Parent").
-		Preload("Children").
-		Preload("Attachments").
-		Preload("Images").
-		Preload("Notes").
-		Preload("Taggables.Tag")
-
+func (s *VulnService) List(ctx context.Context, parentId *int, page *Page, fields Fields) ([]*models.Vuln, error) {
+	query := s.DB.WithContext(ctx).Model(&models.Vuln{})
 	if parentId != nil {
 		query = query.Where("parent_id = ?", *parentId)
 	}
 
+	query, err := page.apply(query, vulnSorts, "")
+	if err != nil {
+		return nil, err
+	}
+	// the list only shows the parent's title and the tags
+	if fields.Has("parent_name") {
+		query = query.Preload("Parent")
+	}
+	if fields.Has("tags") {
+		query = query.Preload("Taggables.Tag")
+	}
+
+	var vulns []*models.Vuln
 	if err := query.Find(&vulns).Error; err != nil {
 		return nil, fmt.Errorf("failed to list vulnerabilities: %v", err)
 	}
-
+	if len(vulns) > 0 {
+		page.next(len(vulns), vulns[len(vulns)-1])
+	}
 	return vulns, nil
 }
 
@@ -0,0 +1,282 @@
+// Package zap reads the messages exported by OWASP ZAP. Three formats are supported: the text dump
+// written by "Export Messages to File", and the XML and JSON message lists of the ZAP API
+// (core/view/messages). ZAP's HAR export is plain HAR and is read with the har package.
+package zap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatXML  Format = "xml"
+	FormatJSON Format = "json"
+	FormatHAR  Format = "har"
+)
+
+// Message is a single request/response pair
+type Message struct {
+	Id        int
+	Request   []byte // raw request, head and body
+	Response  []byte // raw response, empty when ZAP has no response
+	RTT       int64  // round trip time in milliseconds
+	Note      string
+	Timestamp time.Time // zero when unknown
+}
+
+// DetectFormat guesses the export format from the start of a file
+func DetectFormat(r io.Reader) (Format, error) {
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return FormatText, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '<':
+			return FormatXML, nil
+		case '{':
+			// the first key tells HAR ({"log": ...}) and API messages ({"messages": ...}) apart
+			br.UnreadByte()
+			dec := json.NewDecoder(br)
+			if _, err := dec.Token(); err != nil {
+				return "", fmt.Errorf("invalid JSON export: %v", err)
+			}
+			token, err := dec.Token()
+			if err != nil {
+				return "", fmt.Errorf("invalid JSON export: %v", err)
+			}
+			switch token {
+			case "log":
+				return FormatHAR, nil
+			case "messages":
+				return FormatJSON, nil
+			}
+			return "", fmt.Errorf("unknown ZAP JSON export, expected \"log\" or \"messages\"")
+		default:
+			return FormatText, nil
+		}
+	}
+}
+
+// Reader reads messages one at a time, so memory use does not depend on the size of the export
+type Reader struct {
+	next func() (*Message, error)
+}
+
+func NewReader(r io.Reader, format Format) (*Reader, error) {
+	switch format {
+	case FormatText:
+		return &Reader{next: newTextReader(r)}, nil
+	case FormatXML:
+		return &Reader{next: newXMLReader(r)}, nil
+	case FormatJSON:
+		return &Reader{next: newJSONReader(r)}, nil
+	}
+	return nil, fmt.Errorf("unsupported ZAP export format '%s'", format)
+}
+
+// Next returns the next message, it returns io.EOF once all messages have been read
+func (r *Reader) Next() (*Message, error) {
+	return r.next()
+}
+
+// apiMessage is a message of the ZAP API, all values are strings in the JSON format
+type apiMessage struct {
+	Id             string `xml:"id" json:"id"`
+	RequestHeader  string `xml:"requestHeader" json:"requestHeader"`
+	RequestBody    string `xml:"requestBody" json:"requestBody"`
+	ResponseHeader string `xml:"responseHeader" json:"responseHeader"`
+	ResponseBody   string `xml:"responseBody" json:"responseBody"`
+	RTT            string `xml:"rtt" json:"rtt"`
+	Note           string `xml:"note" json:"note"`
+	Timestamp      string `xml:"timestamp" json:"timestamp"`
+}
+
+func (m *apiMessage) toMessage() *Message {
+	msg := &Message{
+		Request: joinMessage(m.RequestHeader, m.RequestBody),
+		Note:    m.Note,
+	}
+	if m.ResponseHeader != "" {
+		msg.Response = joinMessage(m.ResponseHeader, m.ResponseBody)
+	}
+	msg.Id, _ = strconv.Atoi(m.Id)
+	msg.RTT, _ = strconv.ParseInt(m.RTT, 10, 64)
+	if millis, err := strconv.ParseInt(m.Timestamp, 10, 64); err == nil && millis > 0 {
+		msg.Timestamp = time.UnixMilli(millis).UTC()
+	}
+	return msg
+}
+
+// joinMessage puts a header and body back together, ZAP headers normally end with the blank line
+func joinMessage(header, body string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n\n")) && !bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\n")) {
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString(body)
+	return buf.Bytes()
+}
+
+func newXMLReader(r io.Reader) func() (*Message, error) {
+	dec := xml.NewDecoder(r)
+	return func() (*Message, error) {
+		for {
+			token, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			start, ok := token.(xml.StartElement)
+			if !ok || start.Name.Local != "message" {
+				continue
+			}
+			var m apiMessage
+			if err := dec.DecodeElement(&m, &start); err != nil {
+				return nil, err
+			}
+			return m.toMessage(), nil
+		}
+	}
+}
+
+func newJSONReader(r io.Reader) func() (*Message, error) {
+	dec := json.NewDecoder(r)
+	started, done := false, false
+	return func() (*Message, error) {
+		if done {
+			return nil, io.EOF
+		}
+		if !started {
+			if err := seekMessages(dec); err != nil {
+				return nil, err
+			}
+			started = true
+		}
+		if !dec.More() {
+			done = true
+			return nil, io.EOF
+		}
+		var m apiMessage
+		if err := dec.Decode(&m); err != nil {
+			return nil, err
+		}
+		return m.toMessage(), nil
+	}
+}
+
+// seekMessages moves the decoder to the first element of the "messages" array
+func seekMessages(dec *json.Decoder) error {
+	if token, err := dec.Token(); err != nil {
+		return err
+	} else if token != json.Delim('{') {
+		return fmt.Errorf("invalid ZAP JSON export")
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if token == "messages" {
+			if token, err := dec.Token(); err != nil {
+				return err
+			} else if token != json.Delim('[') {
+				return fmt.Errorf("invalid ZAP JSON export: \"messages\" is not an array")
+			}
+			return nil
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("missing \"messages\" in ZAP JSON export")
+}
+
+// messageDelimiter starts every message of a text dump, followed by the history id
+var messageDelimiter = regexp.MustCompile(`^==== (\d+) ==========\r?\n?$`)
+
+// responseStart finds the status line that ends the request of a text dump message
+var responseStart = regexp.MustCompile(`(?m)^HTTP/\d(?:\.\d)? \d{3}`)
+
+func newTextReader(r io.Reader) func() (*Message, error) {
+	br := bufio.NewReader(r)
+	id := 0
+	started := false
+	return func() (*Message, error) {
+		var buf bytes.Buffer
+		for {
+			line, err := br.ReadBytes('\n')
+			if m := messageDelimiter.FindSubmatch(line); m != nil {
+				nextId, _ := strconv.Atoi(string(m[1]))
+				if started {
+					msg := splitTextMessage(id, buf.Bytes())
+					id = nextId
+					return msg, nil
+				}
+				started, id = true, nextId
+				continue
+			}
+			if started {
+				buf.Write(line)
+			}
+			if err == io.EOF {
+				if !started {
+					return nil, io.EOF
+				}
+				started = false
+				return splitTextMessage(id, buf.Bytes()), nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// splitTextMessage splits a text dump message at the response status line
+func splitTextMessage(id int, data []byte) *Message {
+	msg := &Message{Id: id}
+	headEnd, sepLen := bytes.Index(data, []byte("\n\n")), 2
+	if crlf := bytes.Index(data, []byte("\r\n\r\n")); crlf != -1 && (headEnd == -1 || crlf < headEnd) {
+		headEnd, sepLen = crlf, 4
+	}
+	if headEnd == -1 {
+		msg.Request = data
+		return msg
+	}
+	headEnd += sepLen
+
+	split := len(data)
+	if loc := responseStart.FindIndex(data[headEnd:]); loc != nil {
+		split = headEnd + loc[0]
+		msg.Response = trimLineBreak(data[split:])
+	}
+	msg.Request = append(data[:headEnd:headEnd], trimLineBreak(data[headEnd:split])...)
+	return msg
+}
+
+// trimLineBreak removes the line break ZAP writes after each body
+func trimLineBreak(data []byte) []byte {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	return bytes.TrimSuffix(data, []byte("\r"))
+}
@@ -0,0 +1,227 @@
+package zap
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// message is what a test expects of a read message
+type message struct {
+	id       int
+	request  string
+	response string
+}
+
+func readAll(t *testing.T, input string, format Format) ([]message, error) {
+	t.Helper()
+	r, err := NewReader(strings.NewReader(input), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []message
+	for {
+		msg, err := r.Next()
+		if err == io.EOF {
+			return messages, nil
+		}
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, message{id: msg.Id, request: string(msg.Request), response: string(msg.Response)})
+	}
+}
+
+const lfDump = "==== 1 ==========\n" +
+	"GET http://example.com/ HTTP/1.1\nHost: example.com\n\n" +
+	"HTTP/1.1 200 OK\nContent-Type: text/plain\n\nhello\n" +
+	"==== 7 ==========\n" +
+	"POST http://example.com/login HTTP/1.1\nHost: example.com\nContent-Length: 7\n\na=1&b=2\n" +
+	"HTTP/1.1 302 Found\nLocation: /\n\n\n"
+
+var lfMessages = []message{
+	{
+		id:       1,
+		request:  "GET http://example.com/ HTTP/1.1\nHost: example.com\n\n",
+		response: "HTTP/1.1 200 OK\nContent-Type: text/plain\n\nhello",
+	},
+	{
+		id:       7,
+		request:  "POST http://example.com/login HTTP/1.1\nHost: example.com\nContent-Length: 7\n\na=1&b=2",
+		response: "HTTP/1.1 302 Found\nLocation: /\n\n",
+	},
+}
+
+func TestTextReader(t *testing.T) {
+	crlf := strings.ReplaceAll(lfDump, "\n", "\r\n")
+	crlfMessages := make([]message, len(lfMessages))
+	for i, m := range lfMessages {
+		crlfMessages[i] = message{id: m.id, request: strings.ReplaceAll(m.request, "\n", "\r\n"), response: strings.ReplaceAll(m.response, "\n", "\r\n")}
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []message
+	}{
+		{name: "LF dump", input: lfDump, want: lfMessages},
+		{name: "CRLF dump", input: crlf, want: crlfMessages},
+		{
+			// ZAP writes CRLF messages between LF separator lines
+			name: "CRLF messages with LF separators",
+			input: "==== 3 ==========\n" +
+				"GET http://example.com/a HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+				"HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n\n",
+			want: []message{{
+				id:       3,
+				request:  "GET http://example.com/a HTTP/1.1\r\nHost: example.com\r\n\r\n",
+				response: "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n",
+			}},
+		},
+		{
+			name:  "no response",
+			input: "==== 4 ==========\nGET http://example.com/b HTTP/1.1\nHost: example.com\n\n",
+			want:  []message{{id: 4, request: "GET http://example.com/b HTTP/1.1\nHost: example.com\n\n"}},
+		},
+		{
+			name:  "text before the first message",
+			input: "exported by ZAP\n\n" + lfDump,
+			want:  lfMessages,
+		},
+		{
+			name:  "truncated in the request head",
+			input: lfDump + "==== 8 ==========\nGET http://example.com/c HTTP/1.1\nHost: exa",
+			want:  append(lfMessages[:len(lfMessages):len(lfMessages)], message{id: 8, request: "GET http://example.com/c HTTP/1.1\nHost: exa"}),
+		},
+		{
+			name:  "truncated in the response body",
+			input: "==== 9 ==========\nGET http://example.com/d HTTP/1.1\n\nHTTP/1.1 200 OK\nContent-Length: 10\n\nhel",
+			want: []message{{
+				id:       9,
+				request:  "GET http://example.com/d HTTP/1.1\n\n",
+				response: "HTTP/1.1 200 OK\nContent-Length: 10\n\nhel",
+			}},
+		},
+		{name: "empty", input: ""},
+		{name: "no messages", input: "nothing to see\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAll(t, tt.input, FormatText)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d messages, want %d: %q", len(got), len(tt.want), got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("message %d:\n got %q\nwant %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAPIReaders(t *testing.T) {
+	xmlExport := `<?xml version="1.0"?><messages>` +
+		`<message><id>5</id><requestHeader>GET http://example.com/ HTTP/1.1&#13;&#10;Host: example.com&#13;&#10;&#13;&#10;</requestHeader>` +
+		`<requestBody></requestBody><responseHeader>HTTP/1.1 200 OK&#13;&#10;</responseHeader><responseBody>ok</responseBody>` +
+		`<rtt>42</rtt><note>login</note><timestamp>1704067200000</timestamp></message>` +
+		`<message><id>6</id><requestHeader>GET http://example.com/x HTTP/1.1</requestHeader></message>` +
+		`</messages>`
+	jsonExport := `{"other": {"a": [1]}, "messages": [` +
+		`{"id": "5", "requestHeader": "GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\n\r\n", "requestBody": "", ` +
+		`"responseHeader": "HTTP/1.1 200 OK\r\n", "responseBody": "ok", "rtt": "42", "note": "login", "timestamp": "1704067200000"},` +
+		`{"id": "6", "requestHeader": "GET http://example.com/x HTTP/1.1"}]}`
+
+	want := []message{
+		{id: 5, request: "GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\n\r\n", response: "HTTP/1.1 200 OK\r\n\r\nok"},
+		{id: 6, request: "GET http://example.com/x HTTP/1.1\r\n\r\n"},
+	}
+	for _, tt := range []struct {
+		format Format
+		input  string
+	}{{FormatXML, xmlExport}, {FormatJSON, jsonExport}} {
+		t.Run(string(tt.format), func(t *testing.T) {
+			got, err := readAll(t, tt.input, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d messages, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("message %d:\n got %q\nwant %q", i, got[i], want[i])
+				}
+			}
+
+			r, _ := NewReader(strings.NewReader(tt.input), tt.format)
+			msg, err := r.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.RTT != 42 || msg.Note != "login" || !msg.Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("got rtt %d note %q timestamp %v", msg.RTT, msg.Note, msg.Timestamp)
+			}
+		})
+	}
+}
+
+func TestAPIReaderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+		want   string
+	}{
+		{"JSON without messages", FormatJSON, `{"other": 1}`, `missing "messages"`},
+		{"JSON messages not an array", FormatJSON, `{"messages": {}}`, `"messages" is not an array`},
+		{"JSON not an object", FormatJSON, `[]`, "invalid ZAP JSON export"},
+		{"truncated JSON", FormatJSON, `{"messages": [{"id": "1", "requestHea`, "unexpected EOF"},
+		{"truncated XML", FormatXML, `<messages><message><id>1</id><requestHeader>GET`, "unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readAll(t, tt.input, tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewReader(strings.NewReader(""), FormatHAR); err == nil {
+		t.Error("NewReader for HAR: got no error")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Format
+		wantErr bool
+	}{
+		{"==== 1 ==========\n", FormatText, false},
+		{"", FormatText, false},
+		{"\r\n  <?xml version=\"1.0\"?><messages/>", FormatXML, false},
+		{`{"log": {"entries": []}}`, FormatHAR, false},
+		{` {"messages": []}`, FormatJSON, false},
+		{`{"entries": []}`, "", true},
+		{`{"log"`, FormatHAR, false}, // only the first key is read, the HAR reader reports the truncation
+		{`{`, "", true},
+	}
+	for _, tt := range tests {
+		got, err := DetectFormat(strings.NewReader(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DetectFormat(%q): got error %v, want error %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DetectFormat(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}